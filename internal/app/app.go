@@ -2,7 +2,11 @@ package app
 
 import (
 	"context"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/hop-/gotchat/internal/core"
 	"github.com/hop-/gotchat/internal/ui"
@@ -13,21 +17,54 @@ type App struct {
 	eventManager core.EventDispatcher
 	services     core.ServiceDispatcher
 	ui           ui.UI
+
+	// Runs the blocking commands, nil runs them on the event loop
+	commands *commandPool
+	// Executes the commands through the middlewares, nil executes them directly
+	runner *commandRunner
+	// Time the application has to stop after quitting, DefaultShutdownTimeout if zero
+	shutdownTimeout time.Duration
 }
 
 func (a *App) Init() error {
 	return a.services.InitAll()
 }
 
-func (a *App) Run() {
+// listen registers the event loop, the events which don't fit its buffer are queued, not dropped,
+// if the dispatcher supports the backpressure policies
+func (a *App) listen(ctx context.Context) core.EventListener {
+	if subscriber, ok := a.eventManager.(core.EventSubscriber); ok {
+		return subscriber.SubscribeWith(ctx, core.ListenerOptions{
+			Name:   "app",
+			Policy: core.Unbounded,
+		})
+	}
+
+	return a.eventManager.Register(ctx)
+}
+
+// Run runs the application until it quits, it returns core.ErrShutdownTimeout
+// if the services didn't stop in time
+func (a *App) Run() error {
 	ctx, cancel := context.WithCancel(context.Background())
-	eventListner := a.eventManager.Register(ctx)
+	eventListner := a.listen(ctx)
+
+	// Signals quit the same way as the UI
+	stopSignals := a.handleSignals()
+	defer stopSignals()
 
+	// The services and the UI are waited for separately, so the one which doesn't stop is reported
 	wg := sync.WaitGroup{}
+	uiWg := sync.WaitGroup{}
+
+	// Blocking commands run in background so the loop keeps handling events
+	if a.commands != nil {
+		a.commands.start(ctx)
+	}
 
 	// Run all services and UI in separate goroutines
 	a.services.RunAll(ctx, &wg)
-	go a.ui.Run(ctx, &wg)
+	go a.ui.Run(ctx, &uiWg)
 
 	// Run the event loop
 	isRunning := true
@@ -41,7 +78,7 @@ func (a *App) Run() {
 
 		commands := a.mapEventToCommands(event)
 
-		a.executeCommands(commands, ctx)
+		a.executeCommands(event, commands, ctx)
 
 		switch event.(type) {
 		case core.QuitEvent:
@@ -49,14 +86,95 @@ func (a *App) Run() {
 		}
 	}
 
+	return a.shutdown(cancel, &wg, &uiWg)
+}
+
+// handleSignals emits QuitEvent on SIGINT and SIGTERM
+func (a *App) handleSignals() func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for sig := range signals {
+			log.Infof("Received %v, shutting down", sig)
+			a.eventManager.Emit(core.QuitEvent{})
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(signals)
+	}
+}
+
+// shutdown stops the application before the deadline: the submitted commands finish,
+// the services close in reverse dependency order and the goroutines are waited for
+func (a *App) shutdown(cancel context.CancelFunc, wg *sync.WaitGroup, uiWg *sync.WaitGroup) error {
+	timeout := a.shutdownTimeout
+	if timeout <= 0 {
+		timeout = core.DefaultShutdownTimeout
+	}
+	deadline, cancelDeadline := context.WithTimeout(context.Background(), timeout)
+	defer cancelDeadline()
+
+	// Let the submitted commands finish, e.g. the messages being sent
+	if a.commands != nil && !a.commands.drain(deadline) {
+		log.Warnf("Commands didn't finish in time, cancelling them")
+	}
+
 	//cancel all services and UI
 	cancel()
+	uiStopped := waitGroup(uiWg)
+	servicesStopped := waitGroup(wg)
 
 	// Close the application gracefully
-	a.close()
+	report := a.close(deadline)
 
-	// Wait for all goroutines to finish
-	wg.Wait()
+	// Wait for the goroutines of the UI and of the services which aren't reported yet
+	if !waitStopped(deadline, uiStopped) {
+		report.NotStopped = append(report.NotStopped, "UI")
+	}
+	if !waitStopped(deadline, servicesStopped) && len(report.NotStopped) == 0 {
+		report.NotStopped = append(report.NotStopped, "Services")
+	}
+
+	if err := report.Err(); err != nil {
+		log.Errorf("Shutdown didn't complete: %v", err)
+
+		return err
+	}
+
+	log.Infof("Application stopped")
+
+	return nil
+}
+
+// waitGroup returns a channel closed once the goroutines of the group are done
+func waitGroup(wg *sync.WaitGroup) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	return done
+}
+
+// waitStopped waits for the goroutines until the deadline, the stopped ones aren't reported
+// even if the deadline has passed meanwhile
+func waitStopped(deadline context.Context, stopped chan struct{}) bool {
+	select {
+	case <-stopped:
+		return true
+	default:
+	}
+
+	select {
+	case <-stopped:
+		return true
+	case <-deadline.Done():
+		return false
+	}
 }
 
 func (a *App) mapEventToCommands(event core.Event) []core.Command {
@@ -70,16 +188,23 @@ func (a *App) mapEventToCommands(event core.Event) []core.Command {
 	return commands
 }
 
-func (a *App) executeCommands(commands []core.Command, ctx context.Context) {
+// executeCommands runs the commands mapped from the event, failed ones emit CommandFailed
+func (a *App) executeCommands(origin core.Event, commands []core.Command, ctx context.Context) {
+	runner := a.runner
+	if runner == nil {
+		runner = newCommandRunner()
+	}
+
 	var events []core.Event
 	for _, cmd := range commands {
-		cmdEvents, err := cmd.Execute(ctx)
-		if err != nil {
-			log.Errorf("Failed to execute command: %v\n", err)
+		// Events of the blocking commands are emitted when they are done
+		if a.commands != nil && core.IsBlocking(cmd) {
+			a.commands.submit(ctx, origin, cmd)
 
 			continue
 		}
-		events = append(events, cmdEvents...)
+
+		events = append(events, runner.run(ctx, origin, cmd)...)
 	}
 
 	for _, e := range events {
@@ -87,16 +212,23 @@ func (a *App) executeCommands(commands []core.Command, ctx context.Context) {
 	}
 }
 
-func (a *App) close() {
-	errs := a.services.CloseAll()
-	if len(errs) > 0 {
-		for _, err := range errs {
-			log.Errorf("Failed to close service: %v\n", err)
-		}
+// close closes the services, the ones which support it before the deadline, and the UI
+func (a *App) close(deadline context.Context) *core.ShutdownReport {
+	var report *core.ShutdownReport
+	if graceful, ok := a.services.(core.GracefulDispatcher); ok {
+		report = graceful.Shutdown(deadline)
+	} else {
+		report = &core.ShutdownReport{Errors: a.services.CloseAll()}
+	}
+
+	for _, err := range report.Errors {
+		log.Errorf("Failed to close service: %v\n", err)
 	}
 
 	err := a.ui.Close()
 	if err != nil {
 		log.Errorf("Failed to close UI: %v\n", err)
 	}
+
+	return report
 }
@@ -2,7 +2,11 @@ package app
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/hop-/gotchat/internal/core"
 	"github.com/hop-/gotchat/internal/ui"
@@ -40,6 +44,28 @@ func TestApp_mapEventToCommands(t *testing.T) {
 	mockService.AssertCalled(t, "MapEventToCommands", mock.Anything)
 }
 
+func TestApp_listen(t *testing.T) {
+	em := core.NewEventManager(1)
+	app := &App{
+		eventManager: em,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := app.listen(ctx)
+
+	// The loop falls behind the events, none of them is dropped
+	for i := range 10 {
+		em.Emit(testEvent{i})
+	}
+	for i := range 10 {
+		event, err := listener.Next(ctx)
+		if err != nil || event != (testEvent{i}) {
+			t.Fatalf("Expected event %d, got %v (%v)", i, event, err)
+		}
+	}
+}
+
 func TestApp_executeCommands(t *testing.T) {
 	mockEventManager := core.NewMockEventDispatcher(t)
 	mockCommand := core.NewMockCommand(t)
@@ -50,7 +76,7 @@ func TestApp_executeCommands(t *testing.T) {
 		eventManager: mockEventManager,
 	}
 
-	app.executeCommands([]core.Command{mockCommand}, context.Background())
+	app.executeCommands(core.QuitEvent{}, []core.Command{mockCommand}, context.Background())
 
 	mockCommand.AssertCalled(t, "Execute", mock.Anything)
 }
@@ -67,8 +93,135 @@ func TestApp_close(t *testing.T) {
 		ui:       mockUI,
 	}
 
-	app.close()
+	app.close(context.Background())
 
 	mockServices.AssertCalled(t, "CloseAll")
 	mockUI.AssertCalled(t, "Close")
 }
+
+func TestApp_executeCommands_Failed(t *testing.T) {
+	mockEventManager := core.NewMockEventDispatcher(t)
+	mockCommand := core.NewMockCommand(t)
+
+	failure := errors.New("peer is not connected")
+	mockCommand.On("Execute", mock.Anything).Return(nil, failure)
+	mockEventManager.On("Emit", mock.MatchedBy(func(e core.Event) bool {
+		failed, ok := e.(core.CommandFailed)
+
+		return ok && failed.Event == (core.SendMessageEvent{PeerUserId: "bob"}) && errors.Is(failed.Err, failure)
+	})).Once()
+
+	app := &App{
+		eventManager: mockEventManager,
+	}
+
+	app.executeCommands(core.SendMessageEvent{PeerUserId: "bob"}, []core.Command{mockCommand}, context.Background())
+
+	mockEventManager.AssertExpectations(t)
+}
+
+func TestApp_shutdown(t *testing.T) {
+	mockServices := core.NewMockServiceDispatcher(t)
+	mockUI := ui.NewMockUI(t)
+	emitter := &captureEmitter{}
+
+	mockServices.On("CloseAll").Return([]error{})
+	mockUI.On("Close").Return(nil)
+
+	app := &App{
+		services: mockServices,
+		ui:       mockUI,
+		commands: newCommandPool(1, newCommandRunner(), emitter),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.commands.start(ctx)
+
+	// The submitted commands finish before the services are closed
+	app.commands.submit(ctx, nil, &testCommand{key: "peer", run: func() []core.Event {
+		time.Sleep(10 * time.Millisecond)
+
+		return []core.Event{testEvent{1}}
+	}})
+	app.commands.submit(ctx, nil, &testCommand{key: "peer", run: func() []core.Event {
+		return []core.Event{testEvent{2}}
+	}})
+
+	if err := app.shutdown(cancel, &sync.WaitGroup{}, &sync.WaitGroup{}); err != nil {
+		t.Fatalf("Expected a complete shutdown, got %v", err)
+	}
+
+	assert.Equal(t, []core.Event{testEvent{1}, testEvent{2}}, emitter.emitted())
+	mockServices.AssertCalled(t, "CloseAll")
+}
+
+func TestApp_shutdownTimeout(t *testing.T) {
+	mockServices := core.NewMockServiceDispatcher(t)
+	mockUI := ui.NewMockUI(t)
+
+	mockServices.On("CloseAll").Return([]error{})
+	mockUI.On("Close").Return(nil)
+
+	app := &App{
+		services:        mockServices,
+		ui:              mockUI,
+		shutdownTimeout: 20 * time.Millisecond,
+	}
+
+	// A goroutine of the UI which never finishes
+	uiWg := &sync.WaitGroup{}
+	uiWg.Add(1)
+
+	_, cancel := context.WithCancel(context.Background())
+	err := app.shutdown(cancel, &sync.WaitGroup{}, uiWg)
+	if !errors.Is(err, core.ErrShutdownTimeout) || !strings.Contains(err.Error(), "still running: UI") {
+		t.Errorf("Expected ErrShutdownTimeout for the UI, got %v", err)
+	}
+}
+
+// leakingService starts a goroutine which never finishes
+type leakingService struct{}
+
+func (s *leakingService) Init() error {
+	return nil
+}
+
+func (s *leakingService) Run(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+}
+
+func (s *leakingService) MapEventToCommands(event core.Event) []core.Command {
+	return nil
+}
+
+func (s *leakingService) Close() error {
+	return nil
+}
+
+func (s *leakingService) Name() string {
+	return "Leaking"
+}
+
+func TestApp_shutdownTimeout_Service(t *testing.T) {
+	services := core.NewContainer()
+	services.Register(&leakingService{})
+	mockUI := ui.NewMockUI(t)
+	mockUI.On("Close").Return(nil)
+
+	app := &App{
+		services:        services,
+		ui:              mockUI,
+		shutdownTimeout: 20 * time.Millisecond,
+	}
+
+	wg := &sync.WaitGroup{}
+	services.InitAll()
+	services.RunAll(context.Background(), wg)
+
+	// The service which doesn't stop is reported, not the UI
+	_, cancel := context.WithCancel(context.Background())
+	err := app.shutdown(cancel, wg, &sync.WaitGroup{})
+	if !errors.Is(err, core.ErrShutdownTimeout) || !strings.Contains(err.Error(), "still running: Leaking)") {
+		t.Errorf("Expected ErrShutdownTimeout for the service, got %v", err)
+	}
+}
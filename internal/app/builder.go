@@ -1,20 +1,32 @@
 package app
 
 import (
+	"time"
+
 	"github.com/hop-/gotchat/internal/core"
 	"github.com/hop-/gotchat/internal/ui"
 	"github.com/hop-/gotchat/pkg/log"
 )
 
 type Builder struct {
-	em       *core.EventManager
-	ui       ui.UI
-	services []core.Service
+	em              *core.EventManager
+	ui              ui.UI
+	services        []core.Service
+	commandWorkers  int
+	commandTimeout  time.Duration
+	retryPolicy     core.RetryPolicy
+	healthInterval  time.Duration
+	shutdownTimeout time.Duration
 }
 
 func NewBuilder() *Builder {
 	return &Builder{
-		services: make([]core.Service, 0),
+		services:        make([]core.Service, 0),
+		commandWorkers:  DefaultCommandWorkers,
+		commandTimeout:  DefaultCommandTimeout,
+		retryPolicy:     core.DefaultRetryPolicy,
+		healthInterval:  core.DefaultHealthCheckInterval,
+		shutdownTimeout: core.DefaultShutdownTimeout,
 	}
 }
 
@@ -36,23 +48,69 @@ func (b *Builder) WithService(s core.Service) *Builder {
 	return b
 }
 
+// WithCommandWorkers sets the number of workers running the blocking commands
+func (b *Builder) WithCommandWorkers(workers int) *Builder {
+	b.commandWorkers = workers
+
+	return b
+}
+
+// WithCommandTimeout sets the time a command may run, zero disables the timeout
+func (b *Builder) WithCommandTimeout(timeout time.Duration) *Builder {
+	b.commandTimeout = timeout
+
+	return b
+}
+
+// WithRetryPolicy sets how the commands failed with transient errors are retried
+func (b *Builder) WithRetryPolicy(policy core.RetryPolicy) *Builder {
+	b.retryPolicy = policy
+
+	return b
+}
+
+// WithHealthCheckInterval sets the time between the health checks of the services
+func (b *Builder) WithHealthCheckInterval(interval time.Duration) *Builder {
+	b.healthInterval = interval
+
+	return b
+}
+
+// WithShutdownTimeout sets the time the application has to stop after quitting
+func (b *Builder) WithShutdownTimeout(timeout time.Duration) *Builder {
+	b.shutdownTimeout = timeout
+
+	return b
+}
+
 func (b *Builder) GetEventManager() *core.EventManager {
 	return b.em
 }
 
 func (b *Builder) Build() *App {
-	container := core.NewContainer()
+	if b.em == nil || b.ui == nil {
+		log.Fatalf("EventManager and UI must be set")
+	}
+
+	// The supervisor emits the state changes of the services and restarts the failed ones
+	container := core.NewSupervisedContainer(b.em, b.healthInterval)
 	for _, s := range b.services {
 		container.Register(s)
 	}
 
-	if b.em == nil || b.ui == nil {
-		log.Fatalf("EventManager and UI must be set")
-	}
+	// Each attempt of a command has its own timeout
+	runner := newCommandRunner(
+		core.LogCommands(),
+		core.RetryCommands(b.retryPolicy),
+		core.TimeoutCommands(b.commandTimeout),
+	)
 
 	return &App{
 		b.em,
 		container,
 		b.ui,
+		newCommandPool(b.commandWorkers, runner, b.em),
+		runner,
+		b.shutdownTimeout,
 	}
 }
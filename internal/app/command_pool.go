@@ -0,0 +1,178 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/pkg/log"
+)
+
+const (
+	// Default number of workers running the blocking commands
+	DefaultCommandWorkers = 4
+	// Number of the submitted commands waiting for a worker per worker
+	commandQueuePerWorker = 64
+)
+
+var ErrCommandQueueFull = errors.New("too many commands are waiting to run")
+
+type commandJob struct {
+	cmd core.Command
+	key string
+	// Event the command was mapped from
+	origin core.Event
+}
+
+// commandPool runs the blocking commands on a bounded number of workers,
+// the commands with the same ordering key run one after another in the submission order
+type commandPool struct {
+	workers int
+	jobs    chan commandJob
+	wg      sync.WaitGroup
+
+	// Queued commands by ordering key, a key is present while one of its commands runs
+	mu     sync.Mutex
+	queues map[string][]commandJob
+
+	runner *commandRunner
+	// Emits the result events of the finished commands
+	emitter core.EventEmitter
+}
+
+func newCommandPool(workers int, runner *commandRunner, emitter core.EventEmitter) *commandPool {
+	if workers <= 0 {
+		workers = DefaultCommandWorkers
+	}
+
+	return &commandPool{
+		workers: workers,
+		jobs:    make(chan commandJob, workers*commandQueuePerWorker),
+		queues:  make(map[string][]commandJob),
+		runner:  runner,
+		emitter: emitter,
+	}
+}
+
+// start runs the workers until the jobs are closed
+func (p *commandPool) start(ctx context.Context) {
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.work(ctx)
+	}
+}
+
+// submit queues the command without waiting, the command fails with ErrCommandQueueFull
+// when the queue is full
+func (p *commandPool) submit(ctx context.Context, origin core.Event, cmd core.Command) {
+	if ctx.Err() != nil {
+		log.Warnf("Command %T is not started, the application is stopping", cmd)
+
+		return
+	}
+
+	job := commandJob{cmd, core.OrderingKeyOf(cmd), origin}
+
+	if job.key != "" {
+		p.mu.Lock()
+		if queue, busy := p.queues[job.key]; busy {
+			// The worker running the key picks it up
+			p.queues[job.key] = append(queue, job)
+			p.mu.Unlock()
+
+			return
+		}
+		p.queues[job.key] = nil
+		p.mu.Unlock()
+	}
+
+	select {
+	case p.jobs <- job:
+	default:
+		log.Warnf("Command %T is rejected, the command queue is full", cmd)
+		p.release(job.key)
+		p.emitter.Emit(core.CommandFailed{
+			Command: core.CommandName(cmd),
+			Event:   origin,
+			Err:     ErrCommandQueueFull,
+		})
+	}
+}
+
+func (p *commandPool) work(ctx context.Context) {
+	defer p.wg.Done()
+
+	for job := range p.jobs {
+		// The commands of the key run on this worker one after another
+		for ok := true; ok; job, ok = p.next(job.key) {
+			p.run(ctx, job)
+		}
+	}
+}
+
+// next returns the next queued command of the key or releases the key
+func (p *commandPool) next(key string) (commandJob, bool) {
+	if key == "" {
+		return commandJob{}, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	queue := p.queues[key]
+	if len(queue) == 0 {
+		delete(p.queues, key)
+
+		return commandJob{}, false
+	}
+	p.queues[key] = queue[1:]
+
+	return queue[0], true
+}
+
+func (p *commandPool) release(key string) {
+	if key == "" {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.queues, key)
+}
+
+func (p *commandPool) run(ctx context.Context, job commandJob) {
+	if ctx.Err() != nil {
+		log.Debugf("Command %T is skipped, the application is stopping", job.cmd)
+
+		return
+	}
+
+	for _, e := range p.runner.run(ctx, job.origin, job.cmd) {
+		p.emitter.Emit(e)
+	}
+}
+
+// drain waits until the submitted commands are done or the deadline passes,
+// the commands run as long as their context isn't cancelled
+func (p *commandPool) drain(deadline context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		p.stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-deadline.Done():
+		return false
+	}
+}
+
+// stop waits for the running commands, the queued ones are skipped once the context is done
+func (p *commandPool) stop() {
+	close(p.jobs)
+	p.wg.Wait()
+}
@@ -0,0 +1,211 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// testEvent is the result event of a test command
+type testEvent struct {
+	Value int
+}
+
+// testCommand is a blocking command running the function
+type testCommand struct {
+	key string
+	run func() []core.Event
+}
+
+func (c *testCommand) Execute(ctx context.Context) ([]core.Event, error) {
+	return c.run(), nil
+}
+
+func (c *testCommand) IsBlocking() bool {
+	return true
+}
+
+func (c *testCommand) OrderingKey() string {
+	return c.key
+}
+
+// captureEmitter collects the emitted events
+type captureEmitter struct {
+	mu     sync.Mutex
+	events []core.Event
+}
+
+func (e *captureEmitter) Emit(event core.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.events = append(e.events, event)
+}
+
+func (e *captureEmitter) emitted() []core.Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]core.Event(nil), e.events...)
+}
+
+func TestCommandPool_RunsInParallel(t *testing.T) {
+	emitter := &captureEmitter{}
+	pool := newCommandPool(2, newCommandRunner(), emitter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool.start(ctx)
+
+	// Both commands have to run at the same time to pass the barrier
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	for i := range 2 {
+		pool.submit(ctx, nil, &testCommand{run: func() []core.Event {
+			barrier.Done()
+			barrier.Wait()
+
+			return []core.Event{testEvent{i}}
+		}})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		pool.stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the commands to run in parallel")
+	}
+
+	assert.ElementsMatch(t, []core.Event{testEvent{0}, testEvent{1}}, emitter.emitted())
+}
+
+func TestCommandPool_KeepsOrder(t *testing.T) {
+	emitter := &captureEmitter{}
+	pool := newCommandPool(4, newCommandRunner(), emitter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool.start(ctx)
+
+	// The first command is slow, the later ones with the same key must wait for it
+	for i := range 10 {
+		pool.submit(ctx, nil, &testCommand{key: "peer", run: func() []core.Event {
+			if i == 0 {
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			return []core.Event{testEvent{i}}
+		}})
+	}
+	pool.stop()
+
+	events := emitter.emitted()
+	if len(events) != 10 {
+		t.Fatalf("Expected 10 events, got %d", len(events))
+	}
+	for i, e := range events {
+		if e != (testEvent{i}) {
+			t.Errorf("Expected event %d at position %d, got %v", i, i, e)
+		}
+	}
+}
+
+func TestCommandPool_SkipsAfterCancel(t *testing.T) {
+	emitter := &captureEmitter{}
+	pool := newCommandPool(1, newCommandRunner(), emitter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pool.start(ctx)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	pool.submit(ctx, nil, &testCommand{key: "peer", run: func() []core.Event {
+		close(started)
+		<-release
+
+		return []core.Event{testEvent{0}}
+	}})
+	<-started
+
+	pool.submit(ctx, nil, &testCommand{key: "peer", run: func() []core.Event {
+		return []core.Event{testEvent{1}}
+	}})
+
+	// The running command finishes, the queued one is skipped
+	cancel()
+	close(release)
+	pool.stop()
+
+	assert.Equal(t, []core.Event{testEvent{0}}, emitter.emitted())
+}
+
+func TestApp_executeCommands_Blocking(t *testing.T) {
+	emitter := &captureEmitter{}
+	mockEventManager := core.NewMockEventDispatcher(t)
+	mockCommand := core.NewMockCommand(t)
+
+	mockCommand.On("Execute", mock.Anything).Return([]core.Event{}, nil)
+
+	app := &App{
+		eventManager: mockEventManager,
+		commands:     newCommandPool(1, newCommandRunner(), emitter),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.commands.start(ctx)
+
+	// The blocking command doesn't hold the loop
+	release := make(chan struct{})
+	blocking := &testCommand{run: func() []core.Event {
+		<-release
+
+		return []core.Event{testEvent{1}}
+	}}
+	app.executeCommands(core.QuitEvent{}, []core.Command{blocking, mockCommand}, ctx)
+	mockCommand.AssertCalled(t, "Execute", mock.Anything)
+
+	close(release)
+	app.commands.stop()
+
+	assert.Equal(t, []core.Event{testEvent{1}}, emitter.emitted())
+}
+
+func TestCommandPool_RejectsWhenFull(t *testing.T) {
+	emitter := &captureEmitter{}
+	pool := newCommandPool(1, newCommandRunner(), emitter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Without the workers the queue fills up and the submission doesn't wait
+	for i := range commandQueuePerWorker + 1 {
+		pool.submit(ctx, nil, &testCommand{run: func() []core.Event {
+			return []core.Event{testEvent{i}}
+		}})
+	}
+
+	events := emitter.emitted()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 rejected command, got %v", events)
+	}
+	if failed, ok := events[0].(core.CommandFailed); !ok || failed.Err != ErrCommandQueueFull {
+		t.Errorf("Expected CommandFailed with ErrCommandQueueFull, got %v", events[0])
+	}
+
+	pool.start(ctx)
+	pool.stop()
+	if len(emitter.emitted()) != commandQueuePerWorker+1 {
+		t.Errorf("Expected the queued commands to run, got %d events", len(emitter.emitted()))
+	}
+}
@@ -0,0 +1,36 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+)
+
+// Default time a command may run before its context is cancelled
+const DefaultCommandTimeout = 30 * time.Second
+
+// commandRunner executes the commands through the middleware chain
+type commandRunner struct {
+	execute core.CommandExecutor
+}
+
+func newCommandRunner(middlewares ...core.CommandMiddleware) *commandRunner {
+	return &commandRunner{
+		core.ChainCommandMiddleware(core.ExecuteCommand, middlewares...),
+	}
+}
+
+// run returns the events of the command, or CommandFailed with the origin event if it fails
+func (r *commandRunner) run(ctx context.Context, origin core.Event, cmd core.Command) []core.Event {
+	events, err := r.execute(ctx, cmd)
+	if err != nil {
+		return []core.Event{core.CommandFailed{
+			Command: core.CommandName(cmd),
+			Event:   origin,
+			Err:     err,
+		}}
+	}
+
+	return events
+}
@@ -2,12 +2,19 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/hop-/gotchat/internal/app"
 	"github.com/hop-/gotchat/internal/config"
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/journal"
+	"github.com/hop-/gotchat/internal/plugin"
 	"github.com/hop-/gotchat/internal/services"
 	"github.com/hop-/gotchat/internal/storage"
+	"github.com/hop-/gotchat/internal/ui"
+	"github.com/hop-/gotchat/internal/ui/plain"
 	"github.com/hop-/gotchat/internal/ui/tui"
+	"github.com/hop-/gotchat/internal/ui/tui/components"
 	"github.com/hop-/gotchat/pkg/log"
 	"github.com/spf13/cobra"
 )
@@ -34,6 +41,24 @@ func init() {
 		config.GetDataStorageFilePath(),
 		"file to store chat data and configurations",
 	)
+	appCmd.Flags().StringVarP(
+		&generalRelayAddress,
+		"relay", "r",
+		config.GetRelayAddress(),
+		"relay address (host:port) used when peers can't be reached directly",
+	)
+	appCmd.Flags().BoolVar(
+		&generalJournal,
+		"journal",
+		config.GetJournalEnabled(),
+		"record the events in the journal, see the journal command",
+	)
+	appCmd.Flags().StringVar(
+		&generalUi,
+		"ui",
+		config.GetUi(),
+		"user interface, tui or plain for line by line input and output",
+	)
 }
 
 func executeApp() {
@@ -44,17 +69,85 @@ func executeApp() {
 		log.Fatalf("Failed to initialize application: %v", err)
 	}
 
-	application.Run()
+	// Services which didn't stop in time are left behind
+	if err := application.Run(); err != nil {
+		log.Fatalf("Failed to stop application: %v", err)
+	}
 }
 
 func buildApplication() *app.App {
+	builder, s := buildServices()
 
+	// Create the chosen UI and set it in the builder
+	builder.WithUI(newUi(s))
+
+	return builder.Build()
+}
+
+// newUi creates the UI chosen with --ui and adds the chat commands of the plugins to it
+func newUi(s appServices) ui.UI {
+	switch generalUi {
+	case "tui":
+		for name, command := range s.chatCommands {
+			if err := components.AddEventChatCommand(name, command); err != nil {
+				log.Warnf("Failed to add chat command of a plugin: %v", err)
+			}
+		}
+
+		return tui.New(
+			s.em,
+			s.userManager,
+			s.chatManager,
+			s.discoveryManager,
+		)
+	case "plain":
+		plainUi := plain.New(s.em, s.userManager, s.chatManager, os.Stdin, os.Stdout)
+		for name, command := range s.chatCommands {
+			if err := plainUi.AddChatCommand(name, command); err != nil {
+				log.Warnf("Failed to add chat command of a plugin: %v", err)
+			}
+		}
+
+		return plainUi
+	default:
+		log.Fatalf("Unknown user interface %s, use tui or plain", generalUi)
+
+		return nil
+	}
+}
+
+// appServices are the services the user interfaces are built on
+type appServices struct {
+	em               *core.EventManager
+	userManager      *services.UserManager
+	chatManager      *services.ChatManager
+	discoveryManager *services.DiscoveryManager
+	// Chat commands of the plugins
+	chatCommands map[string]plugin.ChatCommand
+}
+
+// buildServices creates the application builder with all services set in it
+func buildServices() (*app.Builder, appServices) {
 	// Create a new application builder
 	builder := app.NewBuilder().
-		WithEventDispatcher(100)
+		WithEventDispatcher(100).
+		WithCommandWorkers(config.GetCommandWorkers()).
+		WithCommandTimeout(config.GetCommandTimeout()).
+		WithHealthCheckInterval(config.GetHealthCheckInterval()).
+		WithShutdownTimeout(config.GetShutdownTimeout())
 	// Get the event manager from the builder
 	em := builder.GetEventManager()
 
+	// Create a new scheduler for the delayed and recurring events and set it in the builder
+	scheduler := core.NewScheduler(em, core.SystemClock)
+	builder.WithService(scheduler)
+
+	// Record the events in the journal if enabled and set it in the builder
+	if generalJournal {
+		recorder := journal.NewRecorder(em, config.GetJournalFilePath(), journal.DefaultMaxSize, journal.DefaultMaxFiles)
+		builder.WithService(recorder)
+	}
+
 	// Create a new storage and set it in the builder
 	storage := storage.NewStorage("file:" + generalDataStorageFile)
 	builder.WithService(storage)
@@ -76,27 +169,81 @@ func buildApplication() *app.App {
 	)
 	builder.WithService(chatManager)
 
+	// Create a new peer policy manager and set it in the builder
+	peerPolicyManager := services.NewPeerPolicyManager(
+		em,
+		storage.GetPeerPolicyRepository(),
+		storage.GetPeerRuleRepository(),
+	)
+	builder.WithService(peerPolicyManager)
+
+	// Create a new invite manager and set it in the builder
+	inviteManager := services.NewInviteManager(
+		em,
+		storage.GetInviteRepository(),
+		storage.GetIdentityKeyRepository(),
+	)
+	builder.WithService(inviteManager)
+
+	// Create a new device manager and set it in the builder
+	deviceManager := services.NewDeviceManager(
+		em,
+		storage.GetDeviceRepository(),
+		storage.GetDeviceLinkRepository(),
+		userManager,
+		inviteManager,
+		config.GetDeviceName(),
+	)
+	builder.WithService(deviceManager)
+
 	// Create a new server
 	portStr := fmt.Sprintf(":%d", generalServerPort)
 	server := services.NewServer(portStr)
 
+	// Create a new relay client if a relay is configured
+	var relay *services.Relay
+	if generalRelayAddress != "" {
+		relay = services.NewRelay(generalRelayAddress)
+	}
+
+	// Create the abuse protection for inbound connections
+	guard := newAbuseGuard(em)
+
 	// Create a new connection manager and set it in the builder
 	connectionManager := services.NewConnectionManager(
 		em,
 		server,
+		relay,
+		guard,
 		userManager,
 		connectionDetailsManager,
+		peerPolicyManager,
+		inviteManager,
+		deviceManager,
 	)
 
 	builder.WithService(connectionManager)
 
-	// Create a new UI and set it in the builder
-	ui := tui.New(
-		em,
-		userManager,
-		chatManager,
-	)
-	builder.WithUI(ui)
+	// Create a new discovery manager which announces the local server
+	discoveryManager := services.NewDiscoveryManager(em, config.GetDiscoveryGroup(), generalServerPort)
+	builder.WithService(discoveryManager)
 
-	return builder.Build()
+	// Load the plugins after the services they may depend on
+	chatCommands := loadPlugins(builder, em)
+
+	return builder, appServices{em, userManager, chatManager, discoveryManager, chatCommands}
+}
+
+// newAbuseGuard creates the abuse protection for inbound connections with the configured limits
+func newAbuseGuard(em core.EventEmitter) *services.AbuseGuard {
+	limits := services.DefaultAbuseLimits()
+	limits.MaxUnauthenticated = config.GetMaxUnauthenticatedConnections()
+	limits.HandshakeTimeout = config.GetHandshakeTimeout()
+	limits.AcceptRate = config.GetAcceptRate()
+	limits.MessageRate = config.GetMessageRate()
+	limits.MaxFrameSize = config.GetMaxFrameSize()
+	limits.MaxConcurrentRequests = config.GetMaxConcurrentRequests()
+	limits.BanDuration = config.GetBanDuration()
+
+	return services.NewAbuseGuard(em, limits)
 }
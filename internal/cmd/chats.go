@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hop-/gotchat/internal/config"
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/daemon"
+	"github.com/spf13/cobra"
+)
+
+var (
+	chatsUser string
+	chatsCmd  = &cobra.Command{
+		Use:   "chats",
+		Short: "Read the chats of a local user",
+		Long:  `Read the chats of a local user without the UI. The password of the user is taken from GOTCHAT_PASSWORD or asked for.`,
+	}
+	chatsListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the chats of the user",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			executeChatsList()
+		},
+	}
+	historyCmd = &cobra.Command{
+		Use:   "history <chat>",
+		Short: "Print the messages of a chat, given by its name or id",
+		Long:  `Print the messages of a chat of a local user, oldest first. The password of the user is taken from GOTCHAT_PASSWORD or asked for.`,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			executeHistory(args[0])
+		},
+	}
+)
+
+func init() {
+	// Flags for chats and history commands
+	for _, cmd := range []*cobra.Command{chatsCmd, historyCmd} {
+		cmd.PersistentFlags().StringVarP(
+			&generalDataStorageFile,
+			"storage", "s",
+			config.GetDataStorageFilePath(),
+			"file to store chat data and configurations",
+		)
+		cmd.PersistentFlags().StringVarP(
+			&chatsUser,
+			"user", "u",
+			"",
+			"name or id of the user, can be omitted if there is only one",
+		)
+	}
+	chatsListCmd.Flags().BoolVar(
+		&scriptJson,
+		"json",
+		false,
+		"print the chats as json",
+	)
+	historyCmd.Flags().BoolVar(
+		&scriptJson,
+		"json",
+		false,
+		"print the messages as json",
+	)
+
+	chatsCmd.AddCommand(chatsListCmd)
+}
+
+// userChats returns the chats of the authenticated user
+func (s *scriptServices) userChats(user *core.User) []daemon.ChatInfo {
+	chats, err := s.chatManager.GetChatsByUserId(user.Id)
+	if err != nil {
+		exitWith(exitFailure, "failed to get chats: %v", err)
+	}
+
+	infos := make([]daemon.ChatInfo, 0, len(chats))
+	for _, chat := range chats {
+		infos = append(infos, daemon.ChatInfo{Id: chat.Id, Name: chat.Name})
+	}
+
+	return infos
+}
+
+func executeChatsList() {
+	s := openScriptServices()
+	defer s.Close()
+
+	user := s.findUser(chatsUser)
+	s.authenticate(user, readPassword(fmt.Sprintf("Password of %s: ", user.Name)))
+
+	chats := s.userChats(user)
+
+	if scriptJson {
+		printJson(chats)
+
+		return
+	}
+
+	for _, chat := range chats {
+		fmt.Printf("%s  %s\n", chat.Id, chat.Name)
+	}
+}
+
+func executeHistory(nameOrId string) {
+	s := openScriptServices()
+	defer s.Close()
+
+	user := s.findUser(chatsUser)
+	s.authenticate(user, readPassword(fmt.Sprintf("Password of %s: ", user.Name)))
+
+	// Only the user's own chats are readable
+	var chat *daemon.ChatInfo
+	for _, c := range s.userChats(user) {
+		if c.Id == nameOrId {
+			chat = &c
+
+			break
+		}
+		if c.Name == nameOrId {
+			if chat != nil {
+				exitWith(exitUsage, "there are several chats named %s, use the id", nameOrId)
+			}
+			chat = &c
+		}
+	}
+	if chat == nil {
+		exitWith(exitNotFound, "chat %s not found", nameOrId)
+	}
+
+	messages, err := s.chatManager.GetChatMessagesByChatId(chat.Id)
+	if err != nil {
+		exitWith(exitFailure, "failed to get messages: %v", err)
+	}
+
+	infos := make([]daemon.MessageInfo, 0, len(messages))
+	for _, message := range messages {
+		infos = append(infos, daemon.MessageInfo{Member: message.Member, Text: message.Text, At: message.At})
+	}
+
+	if scriptJson {
+		printJson(infos)
+
+		return
+	}
+
+	for _, message := range infos {
+		fmt.Printf("[%s] %s: %s\n", message.At.Format(time.DateTime), message.Member, message.Text)
+	}
+}
@@ -3,9 +3,10 @@ package cmd
 import (
 	"github.com/hop-/gotchat/internal/app"
 	"github.com/hop-/gotchat/internal/config"
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/journal"
 	"github.com/hop-/gotchat/internal/services"
 	"github.com/hop-/gotchat/internal/storage"
-	"github.com/hop-/gotchat/internal/ui/tui"
 	"github.com/hop-/gotchat/pkg/log"
 	"github.com/spf13/cobra"
 )
@@ -30,6 +31,24 @@ func init() {
 		config.GetDataStorageFilePath(),
 		"file to store chat data and configurations",
 	)
+	clientCmd.Flags().StringVarP(
+		&generalRelayAddress,
+		"relay", "r",
+		config.GetRelayAddress(),
+		"relay address (host:port) used when peers can't be reached directly",
+	)
+	clientCmd.Flags().BoolVar(
+		&generalJournal,
+		"journal",
+		config.GetJournalEnabled(),
+		"record the events in the journal, see the journal command",
+	)
+	clientCmd.Flags().StringVar(
+		&generalUi,
+		"ui",
+		config.GetUi(),
+		"user interface, tui or plain for line by line input and output",
+	)
 }
 
 func executeClient() {
@@ -40,17 +59,34 @@ func executeClient() {
 		log.Fatalf("Failed to initialize application: %v", err)
 	}
 
-	application.Run()
+	// Services which didn't stop in time are left behind
+	if err := application.Run(); err != nil {
+		log.Fatalf("Failed to stop application: %v", err)
+	}
 }
 
 func buildApplicationWithoutServer() *app.App {
 
 	// Create a new application builder
 	builder := app.NewBuilder().
-		WithEventDispatcher(100)
+		WithEventDispatcher(100).
+		WithCommandWorkers(config.GetCommandWorkers()).
+		WithCommandTimeout(config.GetCommandTimeout()).
+		WithHealthCheckInterval(config.GetHealthCheckInterval()).
+		WithShutdownTimeout(config.GetShutdownTimeout())
 	// Get the event manager from the builder
 	em := builder.GetEventManager()
 
+	// Create a new scheduler for the delayed and recurring events and set it in the builder
+	scheduler := core.NewScheduler(em, core.SystemClock)
+	builder.WithService(scheduler)
+
+	// Record the events in the journal if enabled and set it in the builder
+	if generalJournal {
+		recorder := journal.NewRecorder(em, config.GetJournalFilePath(), journal.DefaultMaxSize, journal.DefaultMaxFiles)
+		builder.WithService(recorder)
+	}
+
 	// Create a new storage and set it in the builder
 	storage := storage.NewStorage("file:" + generalDataStorageFile)
 	builder.WithService(storage)
@@ -72,23 +108,66 @@ func buildApplicationWithoutServer() *app.App {
 	)
 	builder.WithService(chatManager)
 
+	// Create a new peer policy manager and set it in the builder
+	peerPolicyManager := services.NewPeerPolicyManager(
+		em,
+		storage.GetPeerPolicyRepository(),
+		storage.GetPeerRuleRepository(),
+	)
+	builder.WithService(peerPolicyManager)
+
+	// Create a new invite manager and set it in the builder
+	inviteManager := services.NewInviteManager(
+		em,
+		storage.GetInviteRepository(),
+		storage.GetIdentityKeyRepository(),
+	)
+	builder.WithService(inviteManager)
+
+	// Create a new device manager and set it in the builder
+	deviceManager := services.NewDeviceManager(
+		em,
+		storage.GetDeviceRepository(),
+		storage.GetDeviceLinkRepository(),
+		userManager,
+		inviteManager,
+		config.GetDeviceName(),
+	)
+	builder.WithService(deviceManager)
+
+	// Create a new relay client if a relay is configured,
+	// peers reach the client through the relay, so the inbound connections are protected
+	var relay *services.Relay
+	var guard *services.AbuseGuard
+	if generalRelayAddress != "" {
+		relay = services.NewRelay(generalRelayAddress)
+		guard = newAbuseGuard(em)
+	}
+
 	// Create a new connection manager and set it in the builder
 	connectionManager := services.NewConnectionManager(
 		em,
 		nil, // No server for client mode
+		relay,
+		guard, // Nothing to protect without a server or a relay
 		userManager,
 		connectionDetailsManager,
+		peerPolicyManager,
+		inviteManager,
+		deviceManager,
 	)
 
 	builder.WithService(connectionManager)
 
-	// Create a new UI and set it in the builder
-	ui := tui.New(
-		em,
-		userManager,
-		chatManager,
-	)
-	builder.WithUI(ui)
+	// Create a new discovery manager, nothing is announced without a server
+	discoveryManager := services.NewDiscoveryManager(em, config.GetDiscoveryGroup(), 0)
+	builder.WithService(discoveryManager)
+
+	// Load the plugins after the services they may depend on
+	chatCommands := loadPlugins(builder, em)
+
+	// Create the chosen UI and set it in the builder
+	builder.WithUI(newUi(appServices{em, userManager, chatManager, discoveryManager, chatCommands}))
 
 	return builder.Build()
 }
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"github.com/hop-/gotchat/internal/app"
+	"github.com/hop-/gotchat/internal/config"
+	"github.com/hop-/gotchat/internal/daemon"
+	"github.com/hop-/gotchat/internal/ui"
+	"github.com/hop-/gotchat/pkg/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	daemonSocket string
+	daemonCmd    = &cobra.Command{
+		Use:   "daemon",
+		Short: "Run the application in background without the UI",
+		Long:  `Run all services without the terminal UI. The users log in, chat and follow the events through the JSON-RPC control API on a Unix socket, which the other frontends and scripts attach to.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			executeDaemon()
+		},
+	}
+)
+
+func init() {
+	// Flags for daemon command
+	daemonCmd.Flags().IntVarP(
+		&generalServerPort,
+		"port", "p",
+		config.GetServerPort(),
+		"port on which connection listener will be started",
+	)
+	daemonCmd.Flags().StringVarP(
+		&generalDataStorageFile,
+		"storage", "s",
+		config.GetDataStorageFilePath(),
+		"file to store chat data and configurations",
+	)
+	daemonCmd.Flags().StringVarP(
+		&generalRelayAddress,
+		"relay", "r",
+		config.GetRelayAddress(),
+		"relay address (host:port) used when peers can't be reached directly",
+	)
+	daemonCmd.Flags().BoolVar(
+		&generalJournal,
+		"journal",
+		config.GetJournalEnabled(),
+		"record the events in the journal, see the journal command",
+	)
+	daemonCmd.Flags().StringVar(
+		&daemonSocket,
+		"socket",
+		config.GetControlSocketPath(),
+		"Unix socket of the control API",
+	)
+}
+
+func executeDaemon() {
+	application := buildDaemon()
+
+	err := application.Init()
+	if err != nil {
+		log.Fatalf("Failed to initialize daemon: %v", err)
+	}
+
+	// Services which didn't stop in time are left behind
+	if err := application.Run(); err != nil {
+		log.Fatalf("Failed to stop daemon: %v", err)
+	}
+}
+
+func buildDaemon() *app.App {
+	builder, s := buildServices()
+
+	// Create the control API and set it in the builder
+	server := daemon.NewServer(s.em, daemonSocket, s.userManager, s.chatManager)
+	builder.WithService(server)
+
+	// Nothing is shown, the daemon runs until it's signaled
+	builder.WithUI(ui.NewHeadless())
+
+	return builder.Build()
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hop-/gotchat/internal/config"
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/services"
+	"github.com/hop-/gotchat/internal/storage"
+	"github.com/hop-/gotchat/pkg/log"
+	"github.com/hop-/gotchat/pkg/qrcode"
+	"github.com/spf13/cobra"
+)
+
+var (
+	deviceUser     string
+	deviceAddress  string
+	deviceTtl      time.Duration
+	devicePassword string
+	deviceCmd      = &cobra.Command{
+		Use:   "device",
+		Short: "Link several devices to one user",
+		Long:  `Link a new device to an existing user. The device which has the user creates a link code while its app is running, the new device redeems it with "gotchat device link <code>" and receives the identity of the user.`,
+	}
+	deviceLinkCodeCmd = &cobra.Command{
+		Use:   "link-code",
+		Short: "Create a one-time code to link a new device",
+		Run: func(cmd *cobra.Command, args []string) {
+			executeDeviceLinkCode()
+		},
+	}
+	deviceLinkCmd = &cobra.Command{
+		Use:   "link <code>",
+		Short: "Link this device to the user of the code",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			executeDeviceLink(args[0])
+		},
+	}
+	deviceListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the devices of the user",
+		Run: func(cmd *cobra.Command, args []string) {
+			executeDeviceList()
+		},
+	}
+)
+
+func init() {
+	// Flags for device command
+	deviceCmd.PersistentFlags().StringVarP(
+		&generalDataStorageFile,
+		"storage", "s",
+		config.GetDataStorageFilePath(),
+		"file to store chat data and configurations",
+	)
+
+	// Flags for device link-code command
+	deviceLinkCodeCmd.Flags().StringVarP(
+		&deviceUser,
+		"user", "u",
+		"",
+		"name or id of the user, can be omitted if there is only one",
+	)
+	deviceLinkCodeCmd.Flags().StringVarP(
+		&deviceAddress,
+		"address", "a",
+		"",
+		"address (host:port) the new device connects to, defaults to the local address and the server port",
+	)
+	deviceLinkCodeCmd.Flags().DurationVar(
+		&deviceTtl,
+		"ttl",
+		config.GetInviteTtl(),
+		"time the code stays valid",
+	)
+	deviceLinkCodeCmd.Flags().IntVarP(
+		&generalServerPort,
+		"port", "p",
+		config.GetServerPort(),
+		"port on which the user's server listens",
+	)
+
+	// Flags for device link command
+	deviceLinkCmd.Flags().StringVar(
+		&devicePassword,
+		"password",
+		"",
+		"password of the user on this device, asked if omitted",
+	)
+
+	// Flags for device list command
+	deviceListCmd.Flags().StringVarP(
+		&deviceUser,
+		"user", "u",
+		"",
+		"name or id of the user, can be omitted if there is only one",
+	)
+
+	deviceCmd.AddCommand(deviceLinkCodeCmd)
+	deviceCmd.AddCommand(deviceLinkCmd)
+	deviceCmd.AddCommand(deviceListCmd)
+}
+
+// openDeviceManager opens the storage with the services needed to manage devices
+func openDeviceManager() (*storage.Storage, *services.UserManager, *services.DeviceManager) {
+	storage := storage.NewStorage("file:" + generalDataStorageFile)
+	if err := storage.Init(); err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+
+	em := core.NewEventManager(0)
+
+	userManager := services.NewUserManager(em, storage.GetUserRepository())
+	inviteManager := services.NewInviteManager(em, storage.GetInviteRepository(), storage.GetIdentityKeyRepository())
+	deviceManager := services.NewDeviceManager(
+		em,
+		storage.GetDeviceRepository(),
+		storage.GetDeviceLinkRepository(),
+		userManager,
+		inviteManager,
+		config.GetDeviceName(),
+	)
+
+	return storage, userManager, deviceManager
+}
+
+func executeDeviceLinkCode() {
+	storage, userManager, deviceManager := openDeviceManager()
+	defer storage.Close()
+
+	user, err := findInvitingUser(userManager, deviceUser)
+	if err != nil {
+		log.Fatalf("Failed to find the user: %v", err)
+	}
+
+	address := deviceAddress
+	if address == "" {
+		address = net.JoinHostPort(localHost(), fmt.Sprint(generalServerPort))
+	}
+
+	link, err := deviceManager.CreateLinkCode(user.UniqueId, address, deviceTtl)
+	if err != nil {
+		log.Fatalf("Failed to create link code: %v", err)
+	}
+
+	uri := link.DeviceLinkURI()
+
+	fmt.Printf("Link a new device to %s (%s)\n", user.Name, user.UniqueId)
+	fmt.Printf("Fingerprint: %s\n", link.Fingerprint)
+	fmt.Printf("Valid until: %s\n", link.ExpiresAt.Format(time.RFC1123))
+	fmt.Printf("Keep the app running on this device until the new one is linked\n\n")
+
+	if code, err := qrcode.Encode([]byte(uri)); err == nil {
+		fmt.Println(code.String())
+	} else {
+		log.Warnf("Failed to render QR code: %v", err)
+	}
+
+	fmt.Printf("gotchat device link '%s'\n", uri)
+}
+
+func executeDeviceLink(uri string) {
+	storage, _, deviceManager := openDeviceManager()
+	defer storage.Close()
+
+	password := devicePassword
+	if password == "" {
+		fmt.Print("Password for the user on this device: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			log.Fatalf("Failed to read password: %v", err)
+		}
+		password = strings.TrimSpace(line)
+	}
+
+	user, err := deviceManager.LinkDevice(uri, password)
+	if err != nil {
+		log.Fatalf("Failed to link device: %v", err)
+	}
+
+	fmt.Printf("This device is linked to %s (%s)\n", user.Name, user.UniqueId)
+}
+
+func executeDeviceList() {
+	storage, userManager, deviceManager := openDeviceManager()
+	defer storage.Close()
+
+	user, err := findInvitingUser(userManager, deviceUser)
+	if err != nil {
+		log.Fatalf("Failed to find the user: %v", err)
+	}
+
+	local, _, err := deviceManager.LocalDevice(user.UniqueId)
+	if err != nil {
+		log.Fatalf("Failed to get the local device: %v", err)
+	}
+
+	devices, err := deviceManager.Devices(user.UniqueId)
+	if err != nil {
+		log.Fatalf("Failed to get devices: %v", err)
+	}
+
+	fmt.Printf("Devices of %s (%s)\n", user.Name, user.UniqueId)
+	for _, device := range devices {
+		marker := " "
+		if device.UniqueId == local.UniqueId {
+			marker = "*"
+		}
+		fmt.Printf("%s %s  %s  added %s\n", marker, device.UniqueId, device.Name, device.CreatedAt.Format(time.RFC1123))
+	}
+}
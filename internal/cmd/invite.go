@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hop-/gotchat/internal/config"
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/services"
+	"github.com/hop-/gotchat/internal/storage"
+	"github.com/hop-/gotchat/pkg/log"
+	"github.com/hop-/gotchat/pkg/qrcode"
+	"github.com/spf13/cobra"
+)
+
+var (
+	inviteUser    string
+	inviteAddress string
+	inviteTtl     time.Duration
+	inviteCmd     = &cobra.Command{
+		Use:   "invite",
+		Short: "Create a one-time invite for the first contact",
+		Long:  `Create a short-lived invite as a gotchat:// link and a QR code. The peer joins with "/join <link>", the secret in the link protects the first handshake from a man in the middle.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			executeInvite()
+		},
+	}
+)
+
+func init() {
+	// Flags for invite command
+	inviteCmd.Flags().StringVarP(
+		&inviteUser,
+		"user", "u",
+		"",
+		"name or id of the inviting user, can be omitted if there is only one",
+	)
+	inviteCmd.Flags().StringVarP(
+		&inviteAddress,
+		"address", "a",
+		"",
+		"address (host:port) the peer connects to, defaults to the local address and the server port",
+	)
+	inviteCmd.Flags().DurationVar(
+		&inviteTtl,
+		"ttl",
+		config.GetInviteTtl(),
+		"time the invite stays valid",
+	)
+	inviteCmd.Flags().IntVarP(
+		&generalServerPort,
+		"port", "p",
+		config.GetServerPort(),
+		"port on which the inviting user's server listens",
+	)
+	inviteCmd.Flags().StringVarP(
+		&generalDataStorageFile,
+		"storage", "s",
+		config.GetDataStorageFilePath(),
+		"file to store chat data and configurations",
+	)
+}
+
+func executeInvite() {
+	storage := storage.NewStorage("file:" + generalDataStorageFile)
+	if err := storage.Init(); err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+	defer storage.Close()
+
+	em := core.NewEventManager(0)
+
+	userManager := services.NewUserManager(em, storage.GetUserRepository())
+	inviteManager := services.NewInviteManager(em, storage.GetInviteRepository(), storage.GetIdentityKeyRepository())
+
+	user, err := findInvitingUser(userManager, inviteUser)
+	if err != nil {
+		log.Fatalf("Failed to find the inviting user: %v", err)
+	}
+
+	address := inviteAddress
+	if address == "" {
+		address = net.JoinHostPort(localHost(), fmt.Sprint(generalServerPort))
+	}
+
+	invite, err := inviteManager.CreateInvite(user.UniqueId, address, inviteTtl)
+	if err != nil {
+		log.Fatalf("Failed to create invite: %v", err)
+	}
+
+	uri := invite.URI()
+
+	fmt.Printf("Invite from %s (%s)\n", user.Name, user.UniqueId)
+	fmt.Printf("Fingerprint: %s\n", invite.Fingerprint)
+	fmt.Printf("Valid until: %s\n\n", invite.ExpiresAt.Format(time.RFC1123))
+
+	if code, err := qrcode.Encode([]byte(uri)); err == nil {
+		fmt.Println(code.String())
+	} else {
+		log.Warnf("Failed to render QR code: %v", err)
+	}
+
+	fmt.Printf("/join %s\n", uri)
+}
+
+func findInvitingUser(userManager *services.UserManager, nameOrId string) (*core.User, error) {
+	users, err := userManager.GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	if nameOrId == "" {
+		if len(users) != 1 {
+			return nil, fmt.Errorf("there are %d users, pick one with --user", len(users))
+		}
+
+		return users[0], nil
+	}
+
+	for _, user := range users {
+		if user.UniqueId == nameOrId || user.Name == nameOrId {
+			return user, nil
+		}
+	}
+
+	return nil, fmt.Errorf("user %s not found", nameOrId)
+}
+
+// localHost returns the first non-loopback IPv4 address of the machine
+func localHost() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "localhost"
+	}
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			return ipNet.IP.String()
+		}
+	}
+
+	return "localhost"
+}
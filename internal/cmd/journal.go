@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hop-/gotchat/internal/config"
+	"github.com/hop-/gotchat/internal/journal"
+	"github.com/hop-/gotchat/pkg/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	journalFile     string
+	journalTypes    []string
+	journalSince    time.Duration
+	journalContains string
+	journalLast     int
+	journalJson     bool
+	journalCmd      = &cobra.Command{
+		Use:   "journal",
+		Short: "Print the recorded events",
+		Long:  `Print the events recorded in the journal, oldest first. The app records them when it runs with --journal or GOTCHAT_JOURNAL=true, the secrets are redacted.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			executeJournal()
+		},
+	}
+)
+
+func init() {
+	// Flags for journal command
+	journalCmd.Flags().StringVarP(
+		&journalFile,
+		"file", "f",
+		config.GetJournalFilePath(),
+		"journal file, the rotated files next to it are read too",
+	)
+	journalCmd.Flags().StringSliceVarP(
+		&journalTypes,
+		"type", "t",
+		nil,
+		"event types to print, matched as parts of the type, e.g. PeerLeft or services.",
+	)
+	journalCmd.Flags().DurationVar(
+		&journalSince,
+		"since",
+		0,
+		"only the events of the last duration, e.g. 24h",
+	)
+	journalCmd.Flags().StringVarP(
+		&journalContains,
+		"contains", "c",
+		"",
+		"only the events whose payload contains the text",
+	)
+	journalCmd.Flags().IntVarP(
+		&journalLast,
+		"last", "n",
+		0,
+		"only the last events",
+	)
+	journalCmd.Flags().BoolVar(
+		&journalJson,
+		"json",
+		false,
+		"print the entries as json lines",
+	)
+}
+
+func executeJournal() {
+	filter := journal.Filter{
+		Types:    journalTypes,
+		Contains: journalContains,
+		Last:     journalLast,
+	}
+	if journalSince > 0 {
+		filter.Since = time.Now().Add(-journalSince)
+	}
+
+	entries, err := journal.Read(journalFile, filter)
+	if err != nil {
+		log.Fatalf("Failed to read journal: %v", err)
+	}
+
+	for _, entry := range entries {
+		if journalJson {
+			line, err := json.Marshal(entry)
+			if err != nil {
+				log.Fatalf("Failed to encode journal entry: %v", err)
+			}
+			fmt.Println(string(line))
+
+			continue
+		}
+
+		fmt.Println(entry)
+	}
+}
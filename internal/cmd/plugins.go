@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/hop-/gotchat/internal/app"
+	"github.com/hop-/gotchat/internal/config"
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/plugin"
+	"github.com/hop-/gotchat/pkg/log"
+)
+
+// loadPlugins loads the plugins registered at build time and the enabled executables of the plugins
+// directory, it sets their services in the builder and returns their chat commands for the UI
+func loadPlugins(builder *app.Builder, em core.EventBus) map[string]plugin.ChatCommand {
+	plugins := plugin.Registered()
+	for _, path := range plugin.FindExecutables(config.GetPluginsDir(), config.GetEnabledPlugins()) {
+		plugins = append(plugins, plugin.NewExternal(path))
+	}
+
+	// A plugin which fails to load doesn't stop the application
+	manager := plugin.NewManager(em)
+	for _, p := range plugins {
+		if err := manager.Load(p); err != nil {
+			log.Errorf("Failed to load plugin %s: %v", p.Name(), err)
+		}
+	}
+
+	for _, s := range manager.Services() {
+		builder.WithService(s)
+	}
+
+	return manager.ChatCommands()
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hop-/gotchat/internal/config"
+	"github.com/hop-/gotchat/pkg/log"
+	"github.com/hop-/gotchat/pkg/network"
+	"github.com/spf13/cobra"
+)
+
+var (
+	relayPort          int
+	relayAcceptTimeout time.Duration
+	relayCmd           = &cobra.Command{
+		Use:   "relay",
+		Short: "Run a relay server",
+		Long:  `Run a lightweight relay which pipes encrypted frames between peers that can't reach each other directly (e.g. behind NAT).`,
+		Run: func(cmd *cobra.Command, args []string) {
+			executeRelay()
+		},
+	}
+)
+
+func init() {
+	// Flags for relay command
+	relayCmd.Flags().IntVarP(
+		&relayPort,
+		"port", "p",
+		config.GetRelayPort(),
+		"port on which relay will be started",
+	)
+	relayCmd.Flags().DurationVar(
+		&relayAcceptTimeout,
+		"accept-timeout",
+		30*time.Second,
+		"time to wait for a registered peer to accept a relayed connection",
+	)
+}
+
+func executeRelay() {
+	address := fmt.Sprintf(":%d", relayPort)
+
+	log.Infof("Starting relay on %s", address)
+	listener, err := network.NewTcpTransport().Listen(address)
+	if err != nil {
+		log.Fatalf("Failed to start relay: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	relay := network.NewRelay(listener, relayAcceptTimeout)
+	err = relay.Serve(ctx)
+	if err != nil {
+		log.Errorf("Relay stopped with error: %v", err)
+	}
+
+	log.Infof("Relay stopped")
+}
@@ -34,14 +34,42 @@ func init() {
 		config.GetDataStorageFilePath(),
 		"file to store chat data and configurations",
 	)
+	rootCmd.Flags().StringVarP(
+		&generalRelayAddress,
+		"relay", "r",
+		config.GetRelayAddress(),
+		"relay address (host:port) used when peers can't be reached directly",
+	)
+	rootCmd.Flags().BoolVar(
+		&generalJournal,
+		"journal",
+		config.GetJournalEnabled(),
+		"record the events in the journal, see the journal command",
+	)
+	rootCmd.Flags().StringVar(
+		&generalUi,
+		"ui",
+		config.GetUi(),
+		"user interface, tui or plain for line by line input and output",
+	)
 
 	// Add subcommands
 	rootCmd.AddCommand(appCmd)
 	rootCmd.AddCommand(clientCmd)
+	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(relayCmd)
+	rootCmd.AddCommand(inviteCmd)
+	rootCmd.AddCommand(deviceCmd)
+	rootCmd.AddCommand(journalCmd)
+	rootCmd.AddCommand(usersCmd)
+	rootCmd.AddCommand(chatsCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(sendCmd)
 	rootCmd.AddCommand(versionCmd)
 }
 
-func Execute() {
+// Execute runs the command and returns the exit code of the process
+func Execute() (code int) {
 	log.Configure().
 		InMemory().
 		StdOut().
@@ -49,12 +77,27 @@ func Execute() {
 		Init()
 	defer log.Close()
 
+	defer func() {
+		if r := recover(); r != nil {
+			exit, ok := r.(scriptExit)
+			if !ok {
+				panic(r)
+			}
+			code = int(exit)
+		}
+	}()
+
 	err := createRootDirIfNotExists()
 	if err != nil {
 		log.Fatalf("Failed to create root directory: %v", err)
 	}
-	cobra.CheckErr(rootCmd.Execute())
 
+	// Only invalid arguments and flags fail here, cobra has printed the error
+	if err := rootCmd.Execute(); err != nil {
+		return exitUsage
+	}
+
+	return 0
 }
 
 func createRootDirIfNotExists() error {
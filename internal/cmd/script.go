@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/hop-/gotchat/internal/config"
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/daemon"
+	"github.com/hop-/gotchat/internal/services"
+	"github.com/hop-/gotchat/internal/storage"
+)
+
+// Exit codes of the scripting commands
+const (
+	// Unexpected failures, e.g. of the storage
+	exitFailure = iota + 1
+	// Invalid arguments or input
+	exitUsage
+	// The user, chat or peer doesn't exist
+	exitNotFound
+	// Wrong password
+	exitDenied
+	// The daemon isn't running or the message couldn't be delivered
+	exitUnavailable
+)
+
+var scriptJson bool
+
+// scriptServices are the services the scripting commands use without running the app
+type scriptServices struct {
+	storage     *storage.Storage
+	userManager *services.UserManager
+	chatManager *services.ChatManager
+}
+
+// openScriptServices opens the configured storage with the user and chat managers
+func openScriptServices() *scriptServices {
+	storage := storage.NewStorage("file:" + generalDataStorageFile)
+	if err := storage.Init(); err != nil {
+		exitWith(exitFailure, "failed to open storage: %v", err)
+	}
+
+	// Nobody listens to the events of a single command
+	em := core.NewEventManager(0)
+
+	userManager := services.NewUserManager(em, storage.GetUserRepository())
+	chatManager := services.NewChatManager(
+		userManager,
+		storage.GetChannelRepository(),
+		storage.GetAttendanceRepository(),
+		storage.GetMessageRepository(),
+	)
+
+	return &scriptServices{storage, userManager, chatManager}
+}
+
+func (s *scriptServices) Close() {
+	s.storage.Close()
+}
+
+// findUser finds the user by name or id, the only user if it's omitted
+func (s *scriptServices) findUser(nameOrId string) *core.User {
+	users, err := s.userManager.GetAllUsers()
+	if errors.Is(err, services.ErrNotFound) {
+		exitWith(exitNotFound, "there are no users")
+	}
+	if err != nil {
+		exitWith(exitFailure, "failed to get users: %v", err)
+	}
+
+	if nameOrId == "" {
+		if len(users) != 1 {
+			exitWith(exitUsage, "there are %d users, pick one with --user", len(users))
+		}
+
+		return users[0]
+	}
+
+	var found *core.User
+	for _, user := range users {
+		if user.UniqueId == nameOrId {
+			return user
+		}
+		if user.Name == nameOrId {
+			if found != nil {
+				exitWith(exitUsage, "there are several users named %s, use the id", nameOrId)
+			}
+			found = user
+		}
+	}
+	if found == nil {
+		exitWith(exitNotFound, "user %s not found", nameOrId)
+	}
+
+	return found
+}
+
+// authenticate exits unless the password is the user's one
+func (s *scriptServices) authenticate(user *core.User, password string) {
+	if !core.CheckPasswordHash(password, user.Password) {
+		exitWith(exitDenied, "invalid password for %s", user.Name)
+	}
+}
+
+// readPassword returns the password from GOTCHAT_PASSWORD or asks for it,
+// without echo when the input is a terminal
+func readPassword(prompt string) string {
+	if password := config.GetPassword(); password != "" {
+		return password
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+
+	var password string
+	if term.IsTerminal(os.Stdin.Fd()) {
+		line, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			exitWith(exitFailure, "failed to read password: %v", err)
+		}
+		password = string(line)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			exitWith(exitUsage, "no password, set GOTCHAT_PASSWORD or type it")
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	if password == "" {
+		exitWith(exitUsage, "the password is empty")
+	}
+
+	return password
+}
+
+// printJson prints the value as indented json
+func printJson(v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		exitWith(exitFailure, "failed to encode output: %v", err)
+	}
+	fmt.Println(string(data))
+}
+
+// exitCodeOf returns the exit code of the error of a service or the control API
+func exitCodeOf(err error) int {
+	var rpcErr *daemon.Error
+
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, services.ErrorInvalidCredentials):
+		return exitDenied
+	case errors.Is(err, services.ErrorInvalidInput):
+		return exitUsage
+	case errors.As(err, &rpcErr) && rpcErr.Code == daemon.CodeInvalidParams:
+		return exitUsage
+	case errors.As(err, &rpcErr) && rpcErr.Code == daemon.CodeFailed:
+		return exitUnavailable
+	default:
+		return exitFailure
+	}
+}
+
+// scriptExit is the exit code a scripting command unwinds to Execute with
+type scriptExit int
+
+// exitWith prints the error and unwinds to Execute with the code,
+// the deferred cleanups of the command run on the way
+func exitWith(code int, format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	panic(scriptExit(code))
+}
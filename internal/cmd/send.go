@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hop-/gotchat/internal/config"
+	"github.com/hop-/gotchat/internal/daemon"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sendTo      string
+	sendMessage string
+	sendFrom    string
+	sendSocket  string
+	sendCmd     = &cobra.Command{
+		Use:   "send",
+		Short: "Send a message through the running daemon",
+		Long:  `Send a message to a peer through the daemon started with "gotchat daemon", which holds the connections. The sender is logged in to the daemon if it isn't yet, its password is taken from GOTCHAT_PASSWORD or asked for. The command returns once the message is sent or has failed.`,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			executeSend()
+		},
+	}
+)
+
+func init() {
+	// Flags for send command
+	sendCmd.Flags().StringVar(
+		&sendTo,
+		"to",
+		"",
+		"unique id of the peer user",
+	)
+	sendCmd.Flags().StringVarP(
+		&sendMessage,
+		"message", "m",
+		"",
+		"text of the message",
+	)
+	sendCmd.Flags().StringVarP(
+		&sendFrom,
+		"user", "u",
+		"",
+		"name or id of the sending user, can be omitted if there is only one",
+	)
+	sendCmd.Flags().StringVar(
+		&sendSocket,
+		"socket",
+		config.GetControlSocketPath(),
+		"Unix socket of the daemon's control API",
+	)
+	sendCmd.Flags().BoolVar(
+		&scriptJson,
+		"json",
+		false,
+		"print the result as json",
+	)
+	sendCmd.MarkFlagRequired("to")
+	sendCmd.MarkFlagRequired("message")
+}
+
+func executeSend() {
+	if strings.TrimSpace(sendMessage) == "" {
+		exitWith(exitUsage, "the message is empty")
+	}
+
+	client, err := daemon.Dial(sendSocket)
+	if err != nil {
+		exitWith(exitUnavailable, "the daemon isn't running, start it with \"gotchat daemon\": %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	user := findDaemonUser(ctx, client, sendFrom)
+	if !user.LoggedIn {
+		password := readPassword(fmt.Sprintf("Password of %s: ", user.Name))
+		err := client.Call(ctx, daemon.MethodLogin, daemon.LoginParams{User: user.Id, Password: password}, nil)
+		var rpcErr *daemon.Error
+		if errors.As(err, &rpcErr) && rpcErr.Code == daemon.CodeFailed {
+			exitWith(exitDenied, "failed to log in: %v", err)
+		}
+		if err != nil {
+			exitWith(exitFailure, "failed to log in: %v", err)
+		}
+	}
+
+	var result daemon.SendResult
+	params := daemon.SendParams{To: sendTo, Text: sendMessage, From: user.Id}
+	if err := client.Call(ctx, daemon.MethodSend, params, &result); err != nil {
+		exitWith(exitCodeOf(err), "%v", err)
+	}
+
+	if scriptJson {
+		printJson(result)
+
+		return
+	}
+
+	fmt.Printf("Sent %s to %d device(s) of %s\n", result.MessageId, result.Delivered, sendTo)
+	if len(result.Undelivered) > 0 {
+		fmt.Printf("Not connected: %s\n", strings.Join(result.Undelivered, ", "))
+	}
+}
+
+// findDaemonUser finds the user of the daemon by name or id, the only user if it's omitted
+func findDaemonUser(ctx context.Context, client *daemon.Client, nameOrId string) daemon.UserInfo {
+	var users []daemon.UserInfo
+	if err := client.Call(ctx, daemon.MethodUsers, nil, &users); err != nil {
+		exitWith(exitFailure, "failed to get users: %v", err)
+	}
+
+	if nameOrId == "" {
+		if len(users) != 1 {
+			exitWith(exitUsage, "there are %d users, pick one with --user", len(users))
+		}
+
+		return users[0]
+	}
+
+	var found []daemon.UserInfo
+	for _, user := range users {
+		if user.Id == nameOrId {
+			return user
+		}
+		if user.Name == nameOrId {
+			found = append(found, user)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		exitWith(exitNotFound, "user %s not found", nameOrId)
+	case 1:
+		return found[0]
+	}
+	exitWith(exitUsage, "there are several users named %s, use the id", nameOrId)
+
+	return daemon.UserInfo{}
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hop-/gotchat/internal/config"
+	"github.com/hop-/gotchat/internal/services"
+	"github.com/spf13/cobra"
+)
+
+var (
+	usersCmd = &cobra.Command{
+		Use:   "users",
+		Short: "Manage the local users",
+		Long:  `Manage the local users without the UI. The passwords are taken from GOTCHAT_PASSWORD or asked for.`,
+	}
+	usersListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the local users",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			executeUsersList()
+		},
+	}
+	usersCreateCmd = &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a local user",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			executeUsersCreate(args[0])
+		},
+	}
+	usersDeleteCmd = &cobra.Command{
+		Use:   "delete <name or id>",
+		Short: "Delete a local user, its password is required",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			executeUsersDelete(args[0])
+		},
+	}
+)
+
+// userOutput is a user printed by the scripting commands
+type userOutput struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	LastLogin time.Time `json:"lastLogin"`
+}
+
+func init() {
+	// Flags for users command
+	usersCmd.PersistentFlags().StringVarP(
+		&generalDataStorageFile,
+		"storage", "s",
+		config.GetDataStorageFilePath(),
+		"file to store chat data and configurations",
+	)
+
+	// Flags for users list and create commands
+	usersListCmd.Flags().BoolVar(
+		&scriptJson,
+		"json",
+		false,
+		"print the users as json",
+	)
+	usersCreateCmd.Flags().BoolVar(
+		&scriptJson,
+		"json",
+		false,
+		"print the created user as json",
+	)
+
+	usersCmd.AddCommand(usersListCmd)
+	usersCmd.AddCommand(usersCreateCmd)
+	usersCmd.AddCommand(usersDeleteCmd)
+}
+
+func executeUsersList() {
+	s := openScriptServices()
+	defer s.Close()
+
+	users, err := s.userManager.GetAllUsers()
+	if err != nil && !errors.Is(err, services.ErrNotFound) {
+		exitWith(exitFailure, "failed to get users: %v", err)
+	}
+
+	outputs := make([]userOutput, 0, len(users))
+	for _, user := range users {
+		outputs = append(outputs, userOutput{user.UniqueId, user.Name, user.LastLogin})
+	}
+
+	if scriptJson {
+		printJson(outputs)
+
+		return
+	}
+
+	for _, user := range outputs {
+		fmt.Printf("%s  %s  last login %s\n", user.Id, user.Name, user.LastLogin.Format(time.RFC1123))
+	}
+}
+
+func executeUsersCreate(name string) {
+	s := openScriptServices()
+	defer s.Close()
+
+	password := readPassword(fmt.Sprintf("Password for %s: ", name))
+
+	user, err := s.userManager.CreateUser(name, password)
+	if err != nil {
+		exitWith(exitCodeOf(err), "failed to create user: %v", err)
+	}
+
+	if scriptJson {
+		printJson(userOutput{user.UniqueId, user.Name, user.LastLogin})
+
+		return
+	}
+
+	fmt.Printf("Created %s (%s)\n", user.Name, user.UniqueId)
+}
+
+func executeUsersDelete(nameOrId string) {
+	s := openScriptServices()
+	defer s.Close()
+
+	user := s.findUser(nameOrId)
+	password := readPassword(fmt.Sprintf("Password of %s: ", user.Name))
+
+	if err := s.userManager.DeleteUser(user, password); err != nil {
+		exitWith(exitCodeOf(err), "failed to delete user: %v", err)
+	}
+
+	fmt.Printf("Deleted %s (%s)\n", user.Name, user.UniqueId)
+}
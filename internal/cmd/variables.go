@@ -3,4 +3,7 @@ package cmd
 var (
 	generalServerPort      int
 	generalDataStorageFile string
+	generalRelayAddress    string
+	generalJournal         bool
+	generalUi              string
 )
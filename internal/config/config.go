@@ -4,6 +4,8 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"strings"
+	"time"
 )
 
 var (
@@ -62,3 +64,285 @@ func GetServerPort() int {
 
 	return port
 }
+
+func GetRelayAddress() string {
+	if relayAddress, ok := os.LookupEnv("GOTCHAT_RELAY_ADDRESS"); ok {
+		return relayAddress
+	}
+
+	return "" // no relay by default
+}
+
+func GetRelayPort() int {
+	port := 7666 // default relay port
+
+	if portStr, ok := os.LookupEnv("GOTCHAT_RELAY_PORT"); ok {
+		var err error
+		if port, err = strconv.Atoi(portStr); err != nil {
+			port = 7666 // default relay port
+		}
+	}
+
+	return port
+}
+
+func GetDiscoveryGroup() string {
+	if group, ok := os.LookupEnv("GOTCHAT_DISCOVERY_GROUP"); ok {
+		return group
+	}
+
+	return "239.255.76.65:7667" // default multicast group
+}
+
+func GetMaxUnauthenticatedConnections() int {
+	maxConnections := 32 // default limit
+
+	if maxStr, ok := os.LookupEnv("GOTCHAT_MAX_UNAUTHENTICATED_CONNECTIONS"); ok {
+		var err error
+		if maxConnections, err = strconv.Atoi(maxStr); err != nil {
+			maxConnections = 32 // default limit
+		}
+	}
+
+	return maxConnections
+}
+
+func GetHandshakeTimeout() time.Duration {
+	timeout := 10 * time.Second // default timeout
+
+	if timeoutStr, ok := os.LookupEnv("GOTCHAT_HANDSHAKE_TIMEOUT"); ok {
+		var err error
+		if timeout, err = time.ParseDuration(timeoutStr); err != nil {
+			timeout = 10 * time.Second // default timeout
+		}
+	}
+
+	return timeout
+}
+
+// GetAcceptRate returns the allowed inbound connections per second from a single host
+func GetAcceptRate() float64 {
+	rate := 1.0 // default rate
+
+	if rateStr, ok := os.LookupEnv("GOTCHAT_ACCEPT_RATE"); ok {
+		var err error
+		if rate, err = strconv.ParseFloat(rateStr, 64); err != nil {
+			rate = 1.0 // default rate
+		}
+	}
+
+	return rate
+}
+
+// GetMessageRate returns the allowed messages per second from a single peer
+func GetMessageRate() float64 {
+	rate := 20.0 // default rate
+
+	if rateStr, ok := os.LookupEnv("GOTCHAT_MESSAGE_RATE"); ok {
+		var err error
+		if rate, err = strconv.ParseFloat(rateStr, 64); err != nil {
+			rate = 20.0 // default rate
+		}
+	}
+
+	return rate
+}
+
+// GetMaxFrameSize returns the maximum size in bytes of a frame read from a peer
+func GetMaxFrameSize() uint64 {
+	var size uint64 = 1 << 20 // default size
+
+	if sizeStr, ok := os.LookupEnv("GOTCHAT_MAX_FRAME_SIZE"); ok {
+		var err error
+		if size, err = strconv.ParseUint(sizeStr, 10, 64); err != nil || size == 0 {
+			size = 1 << 20 // default size
+		}
+	}
+
+	return size
+}
+
+// GetMaxConcurrentRequests returns the maximum requests of a peer served at once
+func GetMaxConcurrentRequests() int {
+	limit := 16 // default limit
+
+	if limitStr, ok := os.LookupEnv("GOTCHAT_MAX_CONCURRENT_REQUESTS"); ok {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit <= 0 {
+			limit = 16 // default limit
+		}
+	}
+
+	return limit
+}
+
+func GetBanDuration() time.Duration {
+	duration := 10 * time.Minute // default duration
+
+	if durationStr, ok := os.LookupEnv("GOTCHAT_BAN_DURATION"); ok {
+		var err error
+		if duration, err = time.ParseDuration(durationStr); err != nil {
+			duration = 10 * time.Minute // default duration
+		}
+	}
+
+	return duration
+}
+
+// GetInviteTtl returns how long an invite stays valid
+func GetInviteTtl() time.Duration {
+	ttl := 15 * time.Minute // default ttl
+
+	if ttlStr, ok := os.LookupEnv("GOTCHAT_INVITE_TTL"); ok {
+		var err error
+		if ttl, err = time.ParseDuration(ttlStr); err != nil || ttl <= 0 {
+			ttl = 15 * time.Minute // default ttl
+		}
+	}
+
+	return ttl
+}
+
+// GetDeviceName returns the name this device is shown with to the user's other devices and peers
+func GetDeviceName() string {
+	if name, ok := os.LookupEnv("GOTCHAT_DEVICE_NAME"); ok && name != "" {
+		return name
+	}
+
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
+	}
+
+	return "device" // default name
+}
+
+// GetCommandWorkers returns the number of workers running the blocking commands
+func GetCommandWorkers() int {
+	workers := 4 // default workers
+
+	if workersStr, ok := os.LookupEnv("GOTCHAT_COMMAND_WORKERS"); ok {
+		var err error
+		if workers, err = strconv.Atoi(workersStr); err != nil || workers <= 0 {
+			workers = 4 // default workers
+		}
+	}
+
+	return workers
+}
+
+// GetCommandTimeout returns how long a command may run, zero disables the timeout
+func GetCommandTimeout() time.Duration {
+	timeout := 30 * time.Second // default timeout
+
+	if timeoutStr, ok := os.LookupEnv("GOTCHAT_COMMAND_TIMEOUT"); ok {
+		var err error
+		if timeout, err = time.ParseDuration(timeoutStr); err != nil || timeout < 0 {
+			timeout = 30 * time.Second // default timeout
+		}
+	}
+
+	return timeout
+}
+
+// GetHealthCheckInterval returns the time between the health checks of the services
+func GetHealthCheckInterval() time.Duration {
+	interval := 5 * time.Second // default interval
+
+	if intervalStr, ok := os.LookupEnv("GOTCHAT_HEALTH_CHECK_INTERVAL"); ok {
+		var err error
+		if interval, err = time.ParseDuration(intervalStr); err != nil || interval <= 0 {
+			interval = 5 * time.Second // default interval
+		}
+	}
+
+	return interval
+}
+
+// GetShutdownTimeout returns the time the application has to stop after quitting
+func GetShutdownTimeout() time.Duration {
+	timeout := 10 * time.Second // default timeout
+
+	if timeoutStr, ok := os.LookupEnv("GOTCHAT_SHUTDOWN_TIMEOUT"); ok {
+		var err error
+		if timeout, err = time.ParseDuration(timeoutStr); err != nil || timeout <= 0 {
+			timeout = 10 * time.Second // default timeout
+		}
+	}
+
+	return timeout
+}
+
+// GetJournalEnabled returns whether the events are recorded in the journal
+func GetJournalEnabled() bool {
+	enabled := false // disabled by default
+
+	if enabledStr, ok := os.LookupEnv("GOTCHAT_JOURNAL"); ok {
+		var err error
+		if enabled, err = strconv.ParseBool(enabledStr); err != nil {
+			enabled = false // disabled by default
+		}
+	}
+
+	return enabled
+}
+
+// GetJournalFilePath returns the file the events are recorded in, the rotated files are next to it
+func GetJournalFilePath() string {
+	var journalFileName string
+	var ok bool
+
+	if journalFileName, ok = os.LookupEnv("GOTCHAT_JOURNAL_FILE_NAME"); !ok {
+		journalFileName = "journal.jsonl"
+	}
+
+	return path.Join(GetRootDir(), journalFileName)
+}
+
+// GetPluginsDir returns the directory whose executables are loaded as plugins
+func GetPluginsDir() string {
+	if pluginsDir, ok := os.LookupEnv("GOTCHAT_PLUGINS_DIR"); ok {
+		return pluginsDir
+	}
+
+	return path.Join(GetRootDir(), "plugins")
+}
+
+// GetEnabledPlugins returns the names of the executables of the plugins directory which are started,
+// given as a comma separated list
+func GetEnabledPlugins() []string {
+	var names []string // none by default
+
+	for _, name := range strings.Split(os.Getenv("GOTCHAT_PLUGINS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// GetControlSocketPath returns the Unix socket of the daemon's control API
+func GetControlSocketPath() string {
+	var socketFileName string
+	var ok bool
+
+	if socketFileName, ok = os.LookupEnv("GOTCHAT_CONTROL_SOCKET_NAME"); !ok {
+		socketFileName = "gotchat.sock"
+	}
+
+	return path.Join(GetRootDir(), socketFileName)
+}
+
+// GetPassword returns the password of the user for the scripting commands, empty to prompt for it
+func GetPassword() string {
+	return os.Getenv("GOTCHAT_PASSWORD") // default none
+}
+
+// GetUi returns the user interface of the app, "tui" or "plain"
+func GetUi() string {
+	if ui, ok := os.LookupEnv("GOTCHAT_UI"); ok && ui != "" {
+		return ui
+	}
+
+	return "tui" // default ui
+}
@@ -3,7 +3,9 @@ package config
 import (
 	"os"
 	"path"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestGetBaseDir(t *testing.T) {
@@ -85,3 +87,395 @@ func TestGetServerPort(t *testing.T) {
 		t.Errorf("GetServerPort() = %v, want %v", got, 7665)
 	}
 }
+
+func TestGetRelayAddress(t *testing.T) {
+	originalEnv, hadEnv := os.LookupEnv("GOTCHAT_RELAY_ADDRESS")
+	defer func() {
+		if hadEnv {
+			os.Setenv("GOTCHAT_RELAY_ADDRESS", originalEnv)
+		} else {
+			os.Unsetenv("GOTCHAT_RELAY_ADDRESS")
+		}
+	}()
+
+	// Test with environment variable set
+	os.Setenv("GOTCHAT_RELAY_ADDRESS", "relay.example.com:7666")
+	if got := GetRelayAddress(); got != "relay.example.com:7666" {
+		t.Errorf("GetRelayAddress() = %v, want %v", got, "relay.example.com:7666")
+	}
+
+	// Test without environment variable
+	os.Unsetenv("GOTCHAT_RELAY_ADDRESS")
+	if got := GetRelayAddress(); got != "" {
+		t.Errorf("GetRelayAddress() = %v, want empty string", got)
+	}
+}
+
+func TestGetRelayPort(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_RELAY_PORT")
+	defer os.Setenv("GOTCHAT_RELAY_PORT", originalEnv)
+
+	// Test with environment variable set to a valid port
+	os.Setenv("GOTCHAT_RELAY_PORT", "9090")
+	if got := GetRelayPort(); got != 9090 {
+		t.Errorf("GetRelayPort() = %v, want %v", got, 9090)
+	}
+
+	// Test with environment variable set to an invalid port
+	os.Setenv("GOTCHAT_RELAY_PORT", "invalid")
+	if got := GetRelayPort(); got != 7666 {
+		t.Errorf("GetRelayPort() = %v, want %v", got, 7666)
+	}
+
+	// Test without environment variable
+	os.Unsetenv("GOTCHAT_RELAY_PORT")
+	if got := GetRelayPort(); got != 7666 {
+		t.Errorf("GetRelayPort() = %v, want %v", got, 7666)
+	}
+}
+
+func TestGetDiscoveryGroup(t *testing.T) {
+	originalEnv, hadEnv := os.LookupEnv("GOTCHAT_DISCOVERY_GROUP")
+	defer func() {
+		if hadEnv {
+			os.Setenv("GOTCHAT_DISCOVERY_GROUP", originalEnv)
+		} else {
+			os.Unsetenv("GOTCHAT_DISCOVERY_GROUP")
+		}
+	}()
+
+	// Test with environment variable set
+	os.Setenv("GOTCHAT_DISCOVERY_GROUP", "239.0.0.1:9999")
+	if got := GetDiscoveryGroup(); got != "239.0.0.1:9999" {
+		t.Errorf("GetDiscoveryGroup() = %v, want %v", got, "239.0.0.1:9999")
+	}
+
+	// Test without environment variable
+	os.Unsetenv("GOTCHAT_DISCOVERY_GROUP")
+	if got := GetDiscoveryGroup(); got != "239.255.76.65:7667" {
+		t.Errorf("GetDiscoveryGroup() = %v, want %v", got, "239.255.76.65:7667")
+	}
+}
+
+func TestGetMaxUnauthenticatedConnections(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_MAX_UNAUTHENTICATED_CONNECTIONS")
+	defer os.Setenv("GOTCHAT_MAX_UNAUTHENTICATED_CONNECTIONS", originalEnv)
+
+	// Test with environment variable set to a valid number
+	os.Setenv("GOTCHAT_MAX_UNAUTHENTICATED_CONNECTIONS", "5")
+	if got := GetMaxUnauthenticatedConnections(); got != 5 {
+		t.Errorf("GetMaxUnauthenticatedConnections() = %v, want %v", got, 5)
+	}
+
+	// Test with environment variable set to an invalid number
+	os.Setenv("GOTCHAT_MAX_UNAUTHENTICATED_CONNECTIONS", "invalid")
+	if got := GetMaxUnauthenticatedConnections(); got != 32 {
+		t.Errorf("GetMaxUnauthenticatedConnections() = %v, want %v", got, 32)
+	}
+}
+
+func TestGetHandshakeTimeout(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_HANDSHAKE_TIMEOUT")
+	defer os.Setenv("GOTCHAT_HANDSHAKE_TIMEOUT", originalEnv)
+
+	// Test with environment variable set to a valid duration
+	os.Setenv("GOTCHAT_HANDSHAKE_TIMEOUT", "3s")
+	if got := GetHandshakeTimeout(); got != 3*time.Second {
+		t.Errorf("GetHandshakeTimeout() = %v, want %v", got, 3*time.Second)
+	}
+
+	// Test with environment variable set to an invalid duration
+	os.Setenv("GOTCHAT_HANDSHAKE_TIMEOUT", "invalid")
+	if got := GetHandshakeTimeout(); got != 10*time.Second {
+		t.Errorf("GetHandshakeTimeout() = %v, want %v", got, 10*time.Second)
+	}
+}
+
+func TestGetMessageRate(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_MESSAGE_RATE")
+	defer os.Setenv("GOTCHAT_MESSAGE_RATE", originalEnv)
+
+	// Test with environment variable set to a valid rate
+	os.Setenv("GOTCHAT_MESSAGE_RATE", "2.5")
+	if got := GetMessageRate(); got != 2.5 {
+		t.Errorf("GetMessageRate() = %v, want %v", got, 2.5)
+	}
+
+	// Test with environment variable set to an invalid rate
+	os.Setenv("GOTCHAT_MESSAGE_RATE", "invalid")
+	if got := GetMessageRate(); got != 20 {
+		t.Errorf("GetMessageRate() = %v, want %v", got, 20)
+	}
+}
+
+func TestGetMaxFrameSize(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_MAX_FRAME_SIZE")
+	defer os.Setenv("GOTCHAT_MAX_FRAME_SIZE", originalEnv)
+
+	// Test with environment variable set to a valid size
+	os.Setenv("GOTCHAT_MAX_FRAME_SIZE", "4096")
+	if got := GetMaxFrameSize(); got != 4096 {
+		t.Errorf("GetMaxFrameSize() = %v, want %v", got, 4096)
+	}
+
+	// Test with environment variable set to an invalid size
+	os.Setenv("GOTCHAT_MAX_FRAME_SIZE", "invalid")
+	if got := GetMaxFrameSize(); got != 1<<20 {
+		t.Errorf("GetMaxFrameSize() = %v, want %v", got, 1<<20)
+	}
+}
+
+func TestGetMaxConcurrentRequests(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_MAX_CONCURRENT_REQUESTS")
+	defer os.Setenv("GOTCHAT_MAX_CONCURRENT_REQUESTS", originalEnv)
+
+	// Test with environment variable set to a valid limit
+	os.Setenv("GOTCHAT_MAX_CONCURRENT_REQUESTS", "4")
+	if got := GetMaxConcurrentRequests(); got != 4 {
+		t.Errorf("GetMaxConcurrentRequests() = %v, want %v", got, 4)
+	}
+
+	// Test with environment variable set to an invalid limit
+	os.Setenv("GOTCHAT_MAX_CONCURRENT_REQUESTS", "invalid")
+	if got := GetMaxConcurrentRequests(); got != 16 {
+		t.Errorf("GetMaxConcurrentRequests() = %v, want %v", got, 16)
+	}
+}
+
+func TestGetInviteTtl(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_INVITE_TTL")
+	defer os.Setenv("GOTCHAT_INVITE_TTL", originalEnv)
+
+	// Test with environment variable set to a valid duration
+	os.Setenv("GOTCHAT_INVITE_TTL", "1h")
+	if got := GetInviteTtl(); got != time.Hour {
+		t.Errorf("GetInviteTtl() = %v, want %v", got, time.Hour)
+	}
+
+	// Test with environment variable set to a negative duration
+	os.Setenv("GOTCHAT_INVITE_TTL", "-1m")
+	if got := GetInviteTtl(); got != 15*time.Minute {
+		t.Errorf("GetInviteTtl() = %v, want %v", got, 15*time.Minute)
+	}
+}
+
+func TestGetDeviceName(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_DEVICE_NAME")
+	defer os.Setenv("GOTCHAT_DEVICE_NAME", originalEnv)
+
+	// Test with environment variable set
+	os.Setenv("GOTCHAT_DEVICE_NAME", "laptop")
+	if got := GetDeviceName(); got != "laptop" {
+		t.Errorf("GetDeviceName() = %v, want %v", got, "laptop")
+	}
+
+	// Test with environment variable set to an empty name
+	os.Setenv("GOTCHAT_DEVICE_NAME", "")
+	if got := GetDeviceName(); got == "" {
+		t.Error("GetDeviceName() returned an empty name")
+	}
+}
+
+func TestGetCommandWorkers(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_COMMAND_WORKERS")
+	defer os.Setenv("GOTCHAT_COMMAND_WORKERS", originalEnv)
+
+	// Test with environment variable set
+	os.Setenv("GOTCHAT_COMMAND_WORKERS", "8")
+	if got := GetCommandWorkers(); got != 8 {
+		t.Errorf("GetCommandWorkers() = %v, want %v", got, 8)
+	}
+
+	// Test with environment variable set to an invalid value
+	os.Setenv("GOTCHAT_COMMAND_WORKERS", "many")
+	if got := GetCommandWorkers(); got != 4 {
+		t.Errorf("GetCommandWorkers() = %v, want %v", got, 4)
+	}
+
+	// Test with environment variable set to zero
+	os.Setenv("GOTCHAT_COMMAND_WORKERS", "0")
+	if got := GetCommandWorkers(); got != 4 {
+		t.Errorf("GetCommandWorkers() = %v, want %v", got, 4)
+	}
+}
+
+func TestGetCommandTimeout(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_COMMAND_TIMEOUT")
+	defer os.Setenv("GOTCHAT_COMMAND_TIMEOUT", originalEnv)
+
+	// Test with environment variable set
+	os.Setenv("GOTCHAT_COMMAND_TIMEOUT", "5s")
+	if got := GetCommandTimeout(); got != 5*time.Second {
+		t.Errorf("GetCommandTimeout() = %v, want %v", got, 5*time.Second)
+	}
+
+	// Test with environment variable set to zero
+	os.Setenv("GOTCHAT_COMMAND_TIMEOUT", "0")
+	if got := GetCommandTimeout(); got != 0 {
+		t.Errorf("GetCommandTimeout() = %v, want %v", got, 0)
+	}
+
+	// Test with environment variable set to an invalid value
+	os.Setenv("GOTCHAT_COMMAND_TIMEOUT", "later")
+	if got := GetCommandTimeout(); got != 30*time.Second {
+		t.Errorf("GetCommandTimeout() = %v, want %v", got, 30*time.Second)
+	}
+}
+
+func TestGetHealthCheckInterval(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_HEALTH_CHECK_INTERVAL")
+	defer os.Setenv("GOTCHAT_HEALTH_CHECK_INTERVAL", originalEnv)
+
+	// Test with environment variable set
+	os.Setenv("GOTCHAT_HEALTH_CHECK_INTERVAL", "1m")
+	if got := GetHealthCheckInterval(); got != time.Minute {
+		t.Errorf("GetHealthCheckInterval() = %v, want %v", got, time.Minute)
+	}
+
+	// Test with environment variable set to zero
+	os.Setenv("GOTCHAT_HEALTH_CHECK_INTERVAL", "0s")
+	if got := GetHealthCheckInterval(); got != 5*time.Second {
+		t.Errorf("GetHealthCheckInterval() = %v, want %v", got, 5*time.Second)
+	}
+}
+
+func TestGetShutdownTimeout(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_SHUTDOWN_TIMEOUT")
+	defer os.Setenv("GOTCHAT_SHUTDOWN_TIMEOUT", originalEnv)
+
+	// Test with environment variable set
+	os.Setenv("GOTCHAT_SHUTDOWN_TIMEOUT", "3s")
+	if got := GetShutdownTimeout(); got != 3*time.Second {
+		t.Errorf("GetShutdownTimeout() = %v, want %v", got, 3*time.Second)
+	}
+
+	// Test with environment variable set to an invalid value
+	os.Setenv("GOTCHAT_SHUTDOWN_TIMEOUT", "soon")
+	if got := GetShutdownTimeout(); got != 10*time.Second {
+		t.Errorf("GetShutdownTimeout() = %v, want %v", got, 10*time.Second)
+	}
+}
+
+func TestGetJournalEnabled(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_JOURNAL")
+	defer os.Setenv("GOTCHAT_JOURNAL", originalEnv)
+
+	// Test with environment variable set
+	os.Setenv("GOTCHAT_JOURNAL", "true")
+	if got := GetJournalEnabled(); !got {
+		t.Errorf("GetJournalEnabled() = %v, want %v", got, true)
+	}
+
+	// Test with environment variable set to an invalid value
+	os.Setenv("GOTCHAT_JOURNAL", "sometimes")
+	if got := GetJournalEnabled(); got {
+		t.Errorf("GetJournalEnabled() = %v, want %v", got, false)
+	}
+}
+
+func TestGetJournalFilePath(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_JOURNAL_FILE_NAME")
+	defer os.Setenv("GOTCHAT_JOURNAL_FILE_NAME", originalEnv)
+
+	// Test with environment variable set
+	os.Setenv("GOTCHAT_JOURNAL_FILE_NAME", "events.jsonl")
+	expected := path.Join(GetRootDir(), "events.jsonl")
+	if got := GetJournalFilePath(); got != expected {
+		t.Errorf("GetJournalFilePath() = %v, want %v", got, expected)
+	}
+
+	// Test without environment variable
+	os.Unsetenv("GOTCHAT_JOURNAL_FILE_NAME")
+	expected = path.Join(GetRootDir(), "journal.jsonl")
+	if got := GetJournalFilePath(); got != expected {
+		t.Errorf("GetJournalFilePath() = %v, want %v", got, expected)
+	}
+}
+
+func TestGetPluginsDir(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_PLUGINS_DIR")
+	defer os.Setenv("GOTCHAT_PLUGINS_DIR", originalEnv)
+
+	// Test with environment variable set
+	os.Setenv("GOTCHAT_PLUGINS_DIR", "/opt/gotchat/plugins")
+	if got := GetPluginsDir(); got != "/opt/gotchat/plugins" {
+		t.Errorf("GetPluginsDir() = %v, want %v", got, "/opt/gotchat/plugins")
+	}
+
+	// Test without environment variable
+	os.Unsetenv("GOTCHAT_PLUGINS_DIR")
+	expected := path.Join(GetRootDir(), "plugins")
+	if got := GetPluginsDir(); got != expected {
+		t.Errorf("GetPluginsDir() = %v, want %v", got, expected)
+	}
+}
+
+func TestGetEnabledPlugins(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_PLUGINS")
+	defer os.Setenv("GOTCHAT_PLUGINS", originalEnv)
+
+	// Test with environment variable set
+	os.Setenv("GOTCHAT_PLUGINS", "weather, ,echo")
+	if got := GetEnabledPlugins(); !reflect.DeepEqual(got, []string{"weather", "echo"}) {
+		t.Errorf("GetEnabledPlugins() = %v, want %v", got, []string{"weather", "echo"})
+	}
+
+	// Test without environment variable
+	os.Unsetenv("GOTCHAT_PLUGINS")
+	if got := GetEnabledPlugins(); got != nil {
+		t.Errorf("GetEnabledPlugins() = %v, want none", got)
+	}
+}
+
+func TestGetControlSocketPath(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_CONTROL_SOCKET_NAME")
+	defer os.Setenv("GOTCHAT_CONTROL_SOCKET_NAME", originalEnv)
+
+	// Test with environment variable set
+	os.Setenv("GOTCHAT_CONTROL_SOCKET_NAME", "control.sock")
+	expected := path.Join(GetRootDir(), "control.sock")
+	if got := GetControlSocketPath(); got != expected {
+		t.Errorf("GetControlSocketPath() = %v, want %v", got, expected)
+	}
+
+	// Test without environment variable
+	os.Unsetenv("GOTCHAT_CONTROL_SOCKET_NAME")
+	expected = path.Join(GetRootDir(), "gotchat.sock")
+	if got := GetControlSocketPath(); got != expected {
+		t.Errorf("GetControlSocketPath() = %v, want %v", got, expected)
+	}
+}
+
+func TestGetPassword(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_PASSWORD")
+	defer os.Setenv("GOTCHAT_PASSWORD", originalEnv)
+
+	// Test with environment variable set
+	os.Setenv("GOTCHAT_PASSWORD", "secret")
+	if got := GetPassword(); got != "secret" {
+		t.Errorf("GetPassword() = %v, want %v", got, "secret")
+	}
+
+	// Test without environment variable
+	os.Unsetenv("GOTCHAT_PASSWORD")
+	if got := GetPassword(); got != "" {
+		t.Errorf("GetPassword() = %v, want empty", got)
+	}
+}
+
+func TestGetUi(t *testing.T) {
+	originalEnv := os.Getenv("GOTCHAT_UI")
+	defer os.Setenv("GOTCHAT_UI", originalEnv)
+
+	// Test with environment variable set
+	os.Setenv("GOTCHAT_UI", "plain")
+	if got := GetUi(); got != "plain" {
+		t.Errorf("GetUi() = %v, want %v", got, "plain")
+	}
+
+	// Test without environment variable
+	os.Unsetenv("GOTCHAT_UI")
+	if got := GetUi(); got != "tui" {
+		t.Errorf("GetUi() = %v, want %v", got, "tui")
+	}
+}
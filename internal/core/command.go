@@ -7,3 +7,32 @@ import (
 type Command interface {
 	Execute(ctx context.Context) ([]Event, error)
 }
+
+// BlockingCommand is a command which may take long, e.g. waits for the network,
+// blocking commands run on the worker pool instead of the event loop
+type BlockingCommand interface {
+	Command
+	IsBlocking() bool
+}
+
+// OrderedCommand is a blocking command which runs after the earlier commands with the same ordering key
+type OrderedCommand interface {
+	BlockingCommand
+	OrderingKey() string
+}
+
+// IsBlocking reports whether the command has to run off the event loop
+func IsBlocking(cmd Command) bool {
+	blocking, ok := cmd.(BlockingCommand)
+
+	return ok && blocking.IsBlocking()
+}
+
+// OrderingKeyOf returns the ordering key of the command, empty if it can run in any order
+func OrderingKeyOf(cmd Command) string {
+	if ordered, ok := cmd.(OrderedCommand); ok {
+		return ordered.OrderingKey()
+	}
+
+	return ""
+}
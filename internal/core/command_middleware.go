@@ -0,0 +1,178 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hop-/gotchat/pkg/log"
+)
+
+// CommandExecutor executes a command
+type CommandExecutor func(ctx context.Context, cmd Command) ([]Event, error)
+
+// CommandMiddleware wraps the execution of the commands
+type CommandMiddleware func(next CommandExecutor) CommandExecutor
+
+// ExecuteCommand is the executor at the end of the middleware chain
+func ExecuteCommand(ctx context.Context, cmd Command) ([]Event, error) {
+	return cmd.Execute(ctx)
+}
+
+// ChainCommandMiddleware wraps the executor with the middlewares, the first one is the outermost
+func ChainCommandMiddleware(executor CommandExecutor, middlewares ...CommandMiddleware) CommandExecutor {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		executor = middlewares[i](executor)
+	}
+
+	return executor
+}
+
+// TimedCommand is a command with its own timeout instead of the default one
+type TimedCommand interface {
+	Command
+	Timeout() time.Duration
+}
+
+// CommandName names the command in logs and events
+func CommandName(cmd Command) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", cmd), "*")
+}
+
+// transientError marks an error which may go away when the command is retried
+type transientError struct {
+	err error
+}
+
+func (e transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e transientError) Unwrap() error {
+	return e.err
+}
+
+// Transient marks the error as worth retrying
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return transientError{err}
+}
+
+// IsTransient reports whether the command failed with an error worth retrying,
+// the errors marked with Transient and the network timeouts are
+func IsTransient(err error) bool {
+	var transient transientError
+	if errors.As(err, &transient) {
+		return true
+	}
+
+	var timeout interface{ Timeout() bool }
+
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
+
+// TimeoutCommands cancels the command after the timeout, a TimedCommand sets its own
+func TimeoutCommands(timeout time.Duration) CommandMiddleware {
+	return func(next CommandExecutor) CommandExecutor {
+		return func(ctx context.Context, cmd Command) ([]Event, error) {
+			d := timeout
+			if timed, ok := cmd.(TimedCommand); ok {
+				d = timed.Timeout()
+			}
+			if d <= 0 {
+				return next(ctx, cmd)
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			events, err := next(ctx, cmd)
+			if err == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				// The command didn't notice the deadline, its result is late but still valid
+				log.Warnf("command=%s timeout=%s status=late", CommandName(cmd), d)
+			}
+
+			return events, err
+		}
+	}
+}
+
+// RetryPolicy decides how the commands failed with transient errors are retried
+type RetryPolicy struct {
+	// Number of attempts including the first one
+	MaxAttempts int
+	// Wait before the first retry, doubled after each one
+	Backoff time.Duration
+	// Upper bound of the wait
+	MaxBackoff time.Duration
+}
+
+// Default retry policy of the application commands
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     200 * time.Millisecond,
+	MaxBackoff:  2 * time.Second,
+}
+
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.Backoff << retry
+	if d <= 0 || (p.MaxBackoff > 0 && d > p.MaxBackoff) {
+		d = p.MaxBackoff
+	}
+
+	return d
+}
+
+// RetryCommands retries the commands failed with transient errors,
+// an attempt which timed out is retried while the parent context is alive
+func RetryCommands(policy RetryPolicy) CommandMiddleware {
+	return func(next CommandExecutor) CommandExecutor {
+		return func(ctx context.Context, cmd Command) ([]Event, error) {
+			for attempt := 1; ; attempt++ {
+				events, err := next(ctx, cmd)
+				if err == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil {
+					return events, err
+				}
+				if !IsTransient(err) && !errors.Is(err, context.DeadlineExceeded) {
+					return events, err
+				}
+
+				wait := policy.backoff(attempt - 1)
+				log.Debugf("command=%s attempt=%d retry_in=%s error=%q", CommandName(cmd), attempt, wait, err)
+
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+
+					return events, err
+				}
+			}
+		}
+	}
+}
+
+// LogCommands logs the commands with their duration and result
+func LogCommands() CommandMiddleware {
+	return func(next CommandExecutor) CommandExecutor {
+		return func(ctx context.Context, cmd Command) ([]Event, error) {
+			start := time.Now()
+			events, err := next(ctx, cmd)
+			duration := time.Since(start)
+
+			if err != nil {
+				log.Errorf("command=%s duration=%s status=failed error=%q", CommandName(cmd), duration, err)
+			} else {
+				log.Debugf("command=%s duration=%s status=ok events=%d", CommandName(cmd), duration, len(events))
+			}
+
+			return events, err
+		}
+	}
+}
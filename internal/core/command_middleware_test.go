@@ -0,0 +1,158 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// funcCommand is a command running the function
+type funcCommand struct {
+	run     func(ctx context.Context) ([]Event, error)
+	timeout time.Duration
+}
+
+func (c *funcCommand) Execute(ctx context.Context) ([]Event, error) {
+	return c.run(ctx)
+}
+
+// timedCommand is a command with its own timeout
+type timedCommand struct {
+	funcCommand
+}
+
+func (c *timedCommand) Timeout() time.Duration {
+	return c.timeout
+}
+
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+func TestChainCommandMiddleware_Order(t *testing.T) {
+	var calls []string
+	trace := func(name string) CommandMiddleware {
+		return func(next CommandExecutor) CommandExecutor {
+			return func(ctx context.Context, cmd Command) ([]Event, error) {
+				calls = append(calls, name)
+
+				return next(ctx, cmd)
+			}
+		}
+	}
+
+	execute := ChainCommandMiddleware(ExecuteCommand, trace("outer"), trace("inner"))
+	events, err := execute(context.Background(), &funcCommand{run: func(ctx context.Context) ([]Event, error) {
+		calls = append(calls, "command")
+
+		return []Event{otherEvent{1}}, nil
+	}})
+
+	if err != nil || len(events) != 1 {
+		t.Fatalf("Expected one event, got %v: %v", events, err)
+	}
+	if len(calls) != 3 || calls[0] != "outer" || calls[1] != "inner" || calls[2] != "command" {
+		t.Errorf("Expected outer, inner, command, got %v", calls)
+	}
+}
+
+func TestRetryCommands(t *testing.T) {
+	execute := ChainCommandMiddleware(ExecuteCommand, RetryCommands(testRetryPolicy))
+
+	// Transient errors are retried until the command succeeds
+	attempts := 0
+	_, err := execute(context.Background(), &funcCommand{run: func(ctx context.Context) ([]Event, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, Transient(errors.New("database is locked"))
+		}
+
+		return nil, nil
+	}})
+	if err != nil || attempts != 3 {
+		t.Errorf("Expected success after 3 attempts, got %d: %v", attempts, err)
+	}
+
+	// Permanent errors aren't retried
+	attempts = 0
+	permanent := errors.New("unknown peer")
+	_, err = execute(context.Background(), &funcCommand{run: func(ctx context.Context) ([]Event, error) {
+		attempts++
+
+		return nil, permanent
+	}})
+	if !errors.Is(err, permanent) || attempts != 1 {
+		t.Errorf("Expected one attempt with the permanent error, got %d: %v", attempts, err)
+	}
+
+	// The attempts are limited
+	attempts = 0
+	_, err = execute(context.Background(), &funcCommand{run: func(ctx context.Context) ([]Event, error) {
+		attempts++
+
+		return nil, Transient(permanent)
+	}})
+	if !errors.Is(err, permanent) || attempts != 3 {
+		t.Errorf("Expected 3 attempts with the last error, got %d: %v", attempts, err)
+	}
+}
+
+func TestTimeoutCommands(t *testing.T) {
+	execute := ChainCommandMiddleware(ExecuteCommand, RetryCommands(testRetryPolicy), TimeoutCommands(time.Hour))
+
+	// Each attempt has its own deadline, the timed out ones are retried
+	attempts := 0
+	_, err := execute(context.Background(), &timedCommand{funcCommand{
+		timeout: 5 * time.Millisecond,
+		run: func(ctx context.Context) ([]Event, error) {
+			attempts++
+			if attempts == 1 {
+				<-ctx.Done()
+
+				return nil, ctx.Err()
+			}
+
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("Expected the attempt to have a deadline")
+			}
+
+			return nil, nil
+		},
+	}})
+	if err != nil || attempts != 2 {
+		t.Errorf("Expected success after a timed out attempt, got %d: %v", attempts, err)
+	}
+
+	// Nothing is retried once the parent context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts = 0
+	_, err = execute(ctx, &funcCommand{run: func(ctx context.Context) ([]Event, error) {
+		attempts++
+
+		return nil, ctx.Err()
+	}})
+	if !errors.Is(err, context.Canceled) || attempts != 1 {
+		t.Errorf("Expected one cancelled attempt, got %d: %v", attempts, err)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	if IsTransient(errors.New("failed")) {
+		t.Error("Expected a plain error not to be transient")
+	}
+	if !IsTransient(Transient(errors.New("failed"))) {
+		t.Error("Expected a marked error to be transient")
+	}
+	if !IsTransient(errors.Join(errors.New("dial"), timeoutError{})) {
+		t.Error("Expected a network timeout to be transient")
+	}
+	if Transient(nil) != nil {
+		t.Error("Expected no error to stay nil")
+	}
+}
+
+// timeoutError is a network timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "i/o timeout" }
+func (timeoutError) Timeout() bool { return true }
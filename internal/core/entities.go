@@ -76,15 +76,20 @@ func NewConnectionDetails(hostUniqueId string, clientUniqueId string, encryption
 // Message entity
 type Message struct {
 	BaseEntity
-	UserId    int       `name:"user_id"`
+	UniqueId string `name:"unique_id"`
+	// Local user who sent the message, zero if a peer sent it
+	UserId int `name:"user_id"`
+	// Unique id of the user who sent the message
+	SenderId  string    `name:"sender_id"`
 	ChannelId int       `name:"channel_id"`
-	Text      string    `name:"text"`
-	CreatedAt time.Time `name:"created_at"`
+	Text      string    `name:"content"`
+	CreatedAt time.Time `name:"timestamp"`
 }
 
 func NewMessage(userId int, channelId int, text string) *Message {
 	return &Message{
 		BaseEntity: BaseEntity{},
+		UniqueId:   generateUuid(),
 		UserId:     userId,
 		ChannelId:  channelId,
 		Text:       text,
@@ -123,3 +128,156 @@ func NewAttendance(userId int, channelId int) *Attendance {
 		JoinedAt:   time.Now(),
 	}
 }
+
+// Peer policies decide which unknown peers can connect
+const (
+	PeerPolicyAnyone    = "anyone"
+	PeerPolicyAskMe     = "ask"
+	PeerPolicyKnownOnly = "known"
+)
+
+// IsValidPeerPolicy reports whether the policy is one of the known ones
+func IsValidPeerPolicy(policy string) bool {
+	switch policy {
+	case PeerPolicyAnyone, PeerPolicyAskMe, PeerPolicyKnownOnly:
+		return true
+	default:
+		return false
+	}
+}
+
+// PeerPolicy entity
+type PeerPolicy struct {
+	BaseEntity
+	OwnerUniqueId string    `name:"owner_unique_id"`
+	Policy        string    `name:"policy"`
+	UpdatedAt     time.Time `name:"updated_at"`
+}
+
+func NewPeerPolicy(ownerUniqueId string, policy string) *PeerPolicy {
+	return &PeerPolicy{
+		BaseEntity:    BaseEntity{},
+		OwnerUniqueId: ownerUniqueId,
+		Policy:        policy,
+		UpdatedAt:     time.Now(),
+	}
+}
+
+// Peer rule kinds
+const (
+	PeerRuleAllowUser    = "allow_user"
+	PeerRuleBlockUser    = "block_user"
+	PeerRuleBlockAddress = "block_address"
+)
+
+// PeerRule entity
+type PeerRule struct {
+	BaseEntity
+	OwnerUniqueId string    `name:"owner_unique_id"`
+	Kind          string    `name:"kind"`
+	Value         string    `name:"value"`
+	CreatedAt     time.Time `name:"created_at"`
+}
+
+func NewPeerRule(ownerUniqueId string, kind string, value string) *PeerRule {
+	return &PeerRule{
+		BaseEntity:    BaseEntity{},
+		OwnerUniqueId: ownerUniqueId,
+		Kind:          kind,
+		Value:         value,
+		CreatedAt:     time.Now(),
+	}
+}
+
+// Invite entity
+type Invite struct {
+	BaseEntity
+	UniqueId      string `name:"unique_id"`
+	OwnerUniqueId string `name:"owner_unique_id"`
+	// Wrapped one-time secret
+	Secret    string    `name:"secret"`
+	ExpiresAt time.Time `name:"expires_at"`
+	CreatedAt time.Time `name:"created_at"`
+}
+
+func NewInvite(uniqueId string, ownerUniqueId string, secret string, expiresAt time.Time) *Invite {
+	return &Invite{
+		BaseEntity:    BaseEntity{},
+		UniqueId:      uniqueId,
+		OwnerUniqueId: ownerUniqueId,
+		Secret:        secret,
+		ExpiresAt:     expiresAt,
+		CreatedAt:     time.Now(),
+	}
+}
+
+// IdentityKey entity
+type IdentityKey struct {
+	BaseEntity
+	OwnerUniqueId string `name:"owner_unique_id"`
+	PublicKey     string `name:"public_key"`
+	// Wrapped private key
+	PrivateKey string    `name:"private_key"`
+	CreatedAt  time.Time `name:"created_at"`
+}
+
+func NewIdentityKey(ownerUniqueId string, publicKey string, privateKey string) *IdentityKey {
+	return &IdentityKey{
+		BaseEntity:    BaseEntity{},
+		OwnerUniqueId: ownerUniqueId,
+		PublicKey:     publicKey,
+		PrivateKey:    privateKey,
+		CreatedAt:     time.Now(),
+	}
+}
+
+// Device entity
+type Device struct {
+	BaseEntity
+	UniqueId      string `name:"unique_id"`
+	OwnerUniqueId string `name:"owner_unique_id"`
+	Name          string `name:"name"`
+	PublicKey     string `name:"public_key"`
+	// Wrapped private key, only set for the local device
+	PrivateKey string `name:"private_key"`
+	// Identity key of the owner which signed the device key
+	IdentityKey string    `name:"identity_key"`
+	Signature   string    `name:"signature"`
+	CreatedAt   time.Time `name:"created_at"`
+}
+
+func NewDevice(uniqueId string, ownerUniqueId string, name string, publicKey string, privateKey string, identityKey string, signature string) *Device {
+	return &Device{
+		BaseEntity:    BaseEntity{},
+		UniqueId:      uniqueId,
+		OwnerUniqueId: ownerUniqueId,
+		Name:          name,
+		PublicKey:     publicKey,
+		PrivateKey:    privateKey,
+		IdentityKey:   identityKey,
+		Signature:     signature,
+		CreatedAt:     time.Now(),
+	}
+}
+
+// DeviceLink entity
+type DeviceLink struct {
+	BaseEntity
+	UniqueId      string `name:"unique_id"`
+	OwnerUniqueId string `name:"owner_unique_id"`
+	// Wrapped one-time secret
+	Secret    string    `name:"secret"`
+	ExpiresAt time.Time `name:"expires_at"`
+	CreatedAt time.Time `name:"created_at"`
+}
+
+func NewDeviceLink(uniqueId string, ownerUniqueId string, secret string, expiresAt time.Time) *DeviceLink {
+	return &DeviceLink{
+		BaseEntity:    BaseEntity{},
+		UniqueId:      uniqueId,
+		OwnerUniqueId: ownerUniqueId,
+		Secret:        secret,
+		ExpiresAt:     expiresAt,
+		CreatedAt:     time.Now(),
+	}
+}
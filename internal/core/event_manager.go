@@ -2,6 +2,8 @@ package core
 
 import (
 	"context"
+	"fmt"
+	"slices"
 	"sync"
 )
 
@@ -17,6 +19,83 @@ type EventEmitter interface {
 	Emit(Event)
 }
 
+// EventSubscriber registers listeners which only receive the events they are interested in
+type EventSubscriber interface {
+	Subscribe(ctx context.Context, filter EventFilter) EventListener
+	SubscribeWith(ctx context.Context, options ListenerOptions) EventListener
+}
+
+// EventBus dispatches events to all listeners and to the filtered ones
+type EventBus interface {
+	EventDispatcher
+	EventSubscriber
+}
+
+// EventFilter reports whether the listener is interested in the event,
+// it's called on the emitting goroutine so it must be fast and must not emit
+type EventFilter func(Event) bool
+
+// OfType matches the events of type T
+func OfType[T Event]() EventFilter {
+	return func(e Event) bool {
+		_, ok := e.(T)
+
+		return ok
+	}
+}
+
+// Where matches the events of type T which satisfy all predicates
+func Where[T Event](predicates ...func(T) bool) EventFilter {
+	return func(e Event) bool {
+		typed, ok := e.(T)
+		if !ok {
+			return false
+		}
+
+		for _, predicate := range predicates {
+			if !predicate(typed) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// AnyOf matches the events matched by at least one of the filters
+func AnyOf(filters ...EventFilter) EventFilter {
+	return func(e Event) bool {
+		for _, filter := range filters {
+			if filter(e) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// SubscribeTo delivers the events of type T which satisfy all predicates,
+// the channel is closed when the context is done
+func SubscribeTo[T Event](ctx context.Context, s EventSubscriber, predicates ...func(T) bool) <-chan T {
+	listener := s.Subscribe(ctx, Where(predicates...))
+	typed := make(chan T)
+
+	go func() {
+		defer close(typed)
+
+		for e := range listener {
+			select {
+			case typed <- e.(T):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return typed
+}
+
 // Event Listener is a channel that receives events
 type EventListener chan Event
 
@@ -33,22 +112,47 @@ func (l EventListener) Next(ctx context.Context) (Event, error) {
 type EventManager struct {
 	bufferSize  int
 	listenersMu sync.RWMutex
-	listeners   []EventListener
+	listeners   []*subscription
+
+	// Number of the listeners registered so far, names the unnamed ones
+	registered int
+
+	emittedMu sync.Mutex
+	emitted   map[string]uint64
 }
 
 func NewEventManager(bufferSize int) *EventManager {
 	return &EventManager{
 		bufferSize,
 		sync.RWMutex{},
-		make([]EventListener, 0),
-		//make(chan Event, bufferSize),
+		make([]*subscription, 0),
+		0,
+		sync.Mutex{},
+		make(map[string]uint64),
 	}
 }
 
+// Register registers a listener which receives all events
 func (m *EventManager) Register(ctx context.Context) EventListener {
+	return m.SubscribeWith(ctx, ListenerOptions{})
+}
+
+// Subscribe registers a listener which only receives the events matching the filter,
+// the others don't take the room in its buffer
+func (m *EventManager) Subscribe(ctx context.Context, filter EventFilter) EventListener {
+	return m.SubscribeWith(ctx, ListenerOptions{Filter: filter})
+}
+
+// SubscribeWith registers a listener with the filter and the policy applied when it falls behind
+func (m *EventManager) SubscribeWith(ctx context.Context, options ListenerOptions) EventListener {
 	ch := make(EventListener, m.bufferSize)
+
 	m.listenersMu.Lock()
-	m.listeners = append(m.listeners, ch)
+	m.registered++
+	if options.Name == "" {
+		options.Name = fmt.Sprintf("listener-%d", m.registered)
+	}
+	m.listeners = append(m.listeners, newSubscription(ch, options))
 	m.listenersMu.Unlock()
 
 	// Unregister as soon as the context is done
@@ -62,29 +166,64 @@ func (m *EventManager) Register(ctx context.Context) EventListener {
 }
 
 func (m *EventManager) Unregister(ch EventListener) {
-	m.listenersMu.Lock()
-	defer m.listenersMu.Unlock()
+	var removed *subscription
 
-	for i, listener := range m.listeners {
-		if listener == ch {
+	m.listenersMu.Lock()
+	for i, s := range m.listeners {
+		if s.listener == ch {
 			m.listeners = append(m.listeners[:i], m.listeners[i+1:]...)
-			close(listener) // Close the channel to signal that it's no longer in use
+			removed = s
 
-			return
+			break
 		}
 	}
+	m.listenersMu.Unlock()
+
+	if removed == nil {
+		return
+	}
+
+	// The emitters still delivering to the listener give up before it's closed
+	removed.close()
+	close(removed.listener) // Close the channel to signal that it's no longer in use
 }
 
 func (m *EventManager) Emit(e Event) {
+	m.emittedMu.Lock()
+	m.emitted[eventType(e)]++
+	m.emittedMu.Unlock()
+
+	// A slow listener must not hold the others nor the registration
 	m.listenersMu.RLock()
-	defer m.listenersMu.RUnlock()
+	listeners := slices.Clone(m.listeners)
+	m.listenersMu.RUnlock()
 
-	for _, listener := range m.listeners {
-		select {
-		case listener <- e:
-		default:
-			// TODO: handle the case where the channel is full
-			// Optional: log dropped events or block
+	for _, s := range listeners {
+		// Listeners which aren't interested are skipped
+		if !s.accepts(e) {
+			continue
 		}
+
+		s.deliver(e)
+	}
+}
+
+// Metrics returns a snapshot of the emitted, delivered and dropped events by type
+func (m *EventManager) Metrics() EventMetrics {
+	m.emittedMu.Lock()
+	emitted := make(map[string]uint64, len(m.emitted))
+	for t, count := range m.emitted {
+		emitted[t] = count
 	}
+	m.emittedMu.Unlock()
+
+	m.listenersMu.RLock()
+	defer m.listenersMu.RUnlock()
+
+	listeners := make([]ListenerMetrics, 0, len(m.listeners))
+	for _, s := range m.listeners {
+		listeners = append(listeners, s.metrics())
+	}
+
+	return EventMetrics{emitted, listeners}
 }
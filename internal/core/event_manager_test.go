@@ -77,3 +77,83 @@ func TestEventListener_Next_ContextCancelled(t *testing.T) {
 		t.Fatal("Expected error due to cancelled context, got nil")
 	}
 }
+
+type otherEvent struct {
+	Value int
+}
+
+func TestEventManager_Subscribe(t *testing.T) {
+	em := NewEventManager(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener := em.Subscribe(ctx, OfType[otherEvent]())
+
+	// Uninterested listeners are skipped, so their buffer stays free
+	em.Emit(mockEvent{})
+	em.Emit(otherEvent{1})
+
+	select {
+	case e := <-listener:
+		if e != (otherEvent{1}) {
+			t.Fatalf("Expected otherEvent, got %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected event to be received, but timed out")
+	}
+
+	select {
+	case e := <-listener:
+		t.Fatalf("Expected no more events, got %v", e)
+	default:
+	}
+}
+
+func TestEventManager_SubscribeAnyOf(t *testing.T) {
+	em := NewEventManager(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener := em.Subscribe(ctx, AnyOf(OfType[mockEvent](), Where(func(e otherEvent) bool { return e.Value > 1 })))
+
+	em.Emit(otherEvent{1})
+	em.Emit(mockEvent{})
+	em.Emit(otherEvent{2})
+
+	for _, expected := range []Event{mockEvent{}, otherEvent{2}} {
+		if e := <-listener; e != expected {
+			t.Errorf("Expected %v, got %v", expected, e)
+		}
+	}
+}
+
+func TestSubscribeTo(t *testing.T) {
+	em := NewEventManager(10)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events := SubscribeTo(ctx, em, func(e otherEvent) bool { return e.Value%2 == 0 })
+
+	em.Emit(mockEvent{})
+	em.Emit(otherEvent{1})
+	em.Emit(otherEvent{2})
+
+	select {
+	case e := <-events:
+		if e.Value != 2 {
+			t.Errorf("Expected the even event, got %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected event to be received, but timed out")
+	}
+
+	// The channel is closed with the context
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("Expected the channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the channel to be closed, but timed out")
+	}
+}
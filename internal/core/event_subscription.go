@@ -0,0 +1,316 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hop-/gotchat/pkg/log"
+)
+
+// BackpressurePolicy decides what happens to an event when the listener's buffer is full
+type BackpressurePolicy int
+
+const (
+	// DropNewest discards the event which doesn't fit
+	DropNewest BackpressurePolicy = iota
+	// DropOldest discards the oldest buffered event to make room for the new one
+	DropOldest
+	// Block waits up to the block timeout for room and drops the event after it
+	Block
+	// Unbounded queues the events which don't fit, nothing is dropped
+	Unbounded
+)
+
+// Default time the emitter waits for a listener with the Block policy
+const DefaultBlockTimeout = time.Second
+
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	case Block:
+		return "block"
+	case Unbounded:
+		return "unbounded"
+	default:
+		return fmt.Sprintf("policy(%d)", int(p))
+	}
+}
+
+// ListenerOptions configure a listener of the event manager
+type ListenerOptions struct {
+	// Name shown in logs and metrics, generated if empty
+	Name string
+	// Filter of the events the listener receives, nil receives all
+	Filter EventFilter
+	// Policy applied when the buffer is full
+	Policy BackpressurePolicy
+	// Time to wait with the Block policy, DefaultBlockTimeout if zero
+	BlockTimeout time.Duration
+}
+
+// ListenerMetrics are the counters of a listener by event type
+type ListenerMetrics struct {
+	Name      string
+	Policy    BackpressurePolicy
+	Delivered map[string]uint64
+	Dropped   map[string]uint64
+	// Events waiting to be read
+	Pending int
+}
+
+// EventMetrics are the counters of the event manager by event type
+type EventMetrics struct {
+	Emitted   map[string]uint64
+	Listeners []ListenerMetrics
+}
+
+// eventType names the type of the event in metrics
+func eventType(e Event) string {
+	return fmt.Sprintf("%T", e)
+}
+
+// subscription is a listener with its options and counters
+type subscription struct {
+	listener EventListener
+	options  ListenerOptions
+
+	mu        sync.Mutex
+	delivered map[string]uint64
+	dropped   map[string]uint64
+	// The listener is behind until it reads most of its buffer
+	behind bool
+
+	// Overflow of the Unbounded policy moved to the listener in background
+	pending []Event
+	notify  chan struct{}
+	done    chan struct{}
+	pumpWg  sync.WaitGroup
+
+	// Deliveries hold the read lock, so the listener isn't closed under them
+	sendMu sync.RWMutex
+	closed bool
+}
+
+func newSubscription(listener EventListener, options ListenerOptions) *subscription {
+	if options.Policy == Block && options.BlockTimeout <= 0 {
+		options.BlockTimeout = DefaultBlockTimeout
+	}
+
+	s := &subscription{
+		listener:  listener,
+		options:   options,
+		delivered: make(map[string]uint64),
+		dropped:   make(map[string]uint64),
+		notify:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+
+	if options.Policy == Unbounded {
+		s.pumpWg.Add(1)
+		go s.pump()
+	}
+
+	return s
+}
+
+func (s *subscription) accepts(e Event) bool {
+	return s.options.Filter == nil || s.options.Filter(e)
+}
+
+// deliver passes the event to the listener according to its policy
+func (s *subscription) deliver(e Event) {
+	s.sendMu.RLock()
+	defer s.sendMu.RUnlock()
+
+	if s.closed {
+		return
+	}
+
+	// Events queued by the Unbounded policy are counted once the pump delivers them
+	delivered, queued := false, false
+
+	switch s.options.Policy {
+	case DropOldest:
+		delivered = s.deliverDroppingOldest(e)
+	case Block:
+		delivered = s.deliverBlocking(e)
+	case Unbounded:
+		delivered = s.deliverUnbounded(e)
+		queued = !delivered
+	default:
+		select {
+		case s.listener <- e:
+			delivered = true
+		default:
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := eventType(e)
+	dropped := !delivered && !queued
+	if delivered {
+		s.delivered[t]++
+	} else if dropped {
+		s.dropped[t]++
+	}
+
+	s.checkBackpressure(t, dropped)
+}
+
+func (s *subscription) deliverDroppingOldest(e Event) bool {
+	for {
+		select {
+		case s.listener <- e:
+			return true
+		default:
+		}
+
+		// Make room by dropping the oldest event, the listener may have read it meanwhile
+		select {
+		case old := <-s.listener:
+			s.mu.Lock()
+			s.dropped[eventType(old)]++
+			s.mu.Unlock()
+		default:
+			// Unbuffered listener which isn't reading
+			if cap(s.listener) == 0 {
+				return false
+			}
+		}
+	}
+}
+
+func (s *subscription) deliverBlocking(e Event) bool {
+	select {
+	case s.listener <- e:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(s.options.BlockTimeout)
+	defer timer.Stop()
+
+	select {
+	case s.listener <- e:
+		return true
+	case <-timer.C:
+		return false
+	case <-s.done:
+		return false
+	}
+}
+
+// deliverUnbounded passes the event to the listener or queues it for the pump,
+// it reports whether the event was delivered right away
+func (s *subscription) deliverUnbounded(e Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Queued events go first to keep the order
+	if len(s.pending) == 0 {
+		select {
+		case s.listener <- e:
+			return true
+		default:
+		}
+	}
+
+	s.pending = append(s.pending, e)
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+
+	return false
+}
+
+// pump moves the queued events to the listener
+func (s *subscription) pump() {
+	defer s.pumpWg.Done()
+
+	for {
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.mu.Unlock()
+
+			select {
+			case <-s.notify:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		e := s.pending[0]
+		s.mu.Unlock()
+
+		select {
+		case s.listener <- e:
+			s.mu.Lock()
+			s.pending[0] = nil
+			s.pending = s.pending[1:]
+			s.delivered[eventType(e)]++
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// checkBackpressure warns once when the listener falls behind
+// Note: s.mu must be held by the caller
+func (s *subscription) checkBackpressure(t string, dropped bool) {
+	size := cap(s.listener)
+	waiting := len(s.listener) + len(s.pending)
+
+	switch {
+	case !s.behind && (dropped || len(s.pending) > 0 || (size > 0 && waiting >= size*3/4)):
+		s.behind = true
+		if dropped {
+			log.Warnf("Event listener %s (%s) is behind, dropped %s", s.options.Name, s.options.Policy, t)
+		} else {
+			log.Warnf("Event listener %s (%s) is behind, %d events are waiting", s.options.Name, s.options.Policy, waiting)
+		}
+	case s.behind && !dropped && len(s.pending) == 0 && waiting <= size/4:
+		s.behind = false
+		log.Infof("Event listener %s caught up", s.options.Name)
+	}
+}
+
+func (s *subscription) metrics() ListenerMetrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metrics := ListenerMetrics{
+		Name:      s.options.Name,
+		Policy:    s.options.Policy,
+		Delivered: make(map[string]uint64, len(s.delivered)),
+		Dropped:   make(map[string]uint64, len(s.dropped)),
+		Pending:   len(s.listener) + len(s.pending),
+	}
+	for t, count := range s.delivered {
+		metrics.Delivered[t] = count
+	}
+	for t, count := range s.dropped {
+		metrics.Dropped[t] = count
+	}
+
+	return metrics
+}
+
+// close stops the delivery, the listener can be closed after it
+func (s *subscription) close() {
+	// The blocked deliveries give up, then the ones in flight are waited for
+	close(s.done)
+
+	s.sendMu.Lock()
+	s.closed = true
+	s.sendMu.Unlock()
+
+	s.pumpWg.Wait()
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEventManager_DropNewest(t *testing.T) {
+	em := NewEventManager(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener := em.SubscribeWith(ctx, ListenerOptions{Name: "slow"})
+
+	em.Emit(otherEvent{1})
+	em.Emit(otherEvent{2})
+
+	if e := <-listener; e != (otherEvent{1}) {
+		t.Errorf("Expected the first event to be kept, got %v", e)
+	}
+
+	metrics := em.Metrics()
+	if metrics.Emitted["core.otherEvent"] != 2 {
+		t.Errorf("Expected 2 emitted events, got %v", metrics.Emitted)
+	}
+	if len(metrics.Listeners) != 1 || metrics.Listeners[0].Name != "slow" {
+		t.Fatalf("Expected the slow listener metrics, got %+v", metrics.Listeners)
+	}
+	if l := metrics.Listeners[0]; l.Delivered["core.otherEvent"] != 1 || l.Dropped["core.otherEvent"] != 1 {
+		t.Errorf("Expected 1 delivered and 1 dropped event, got %+v", l)
+	}
+}
+
+func TestEventManager_DropOldest(t *testing.T) {
+	em := NewEventManager(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener := em.SubscribeWith(ctx, ListenerOptions{Policy: DropOldest})
+
+	for i := 1; i <= 3; i++ {
+		em.Emit(otherEvent{i})
+	}
+
+	for _, expected := range []int{2, 3} {
+		if e := <-listener; e != (otherEvent{expected}) {
+			t.Errorf("Expected event %d, got %v", expected, e)
+		}
+	}
+
+	if l := em.Metrics().Listeners[0]; l.Delivered["core.otherEvent"] != 3 || l.Dropped["core.otherEvent"] != 1 {
+		t.Errorf("Expected 3 delivered and the oldest dropped, got %+v", l)
+	}
+}
+
+func TestEventManager_Block(t *testing.T) {
+	em := NewEventManager(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener := em.SubscribeWith(ctx, ListenerOptions{Policy: Block, BlockTimeout: 50 * time.Millisecond})
+
+	em.Emit(otherEvent{1})
+
+	// The emitter waits for the listener to make room
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-listener
+	}()
+	em.Emit(otherEvent{2})
+
+	if e := <-listener; e != (otherEvent{2}) {
+		t.Errorf("Expected the blocked event to be delivered, got %v", e)
+	}
+
+	// The event is dropped after the timeout
+	em.Emit(otherEvent{3})
+	start := time.Now()
+	em.Emit(otherEvent{4})
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("Expected the emitter to wait for the timeout")
+	}
+
+	if l := em.Metrics().Listeners[0]; l.Dropped["core.otherEvent"] != 1 || l.Pending != 1 {
+		t.Errorf("Expected 1 dropped and 1 pending event, got %+v", l)
+	}
+}
+
+func TestEventManager_Unbounded(t *testing.T) {
+	em := NewEventManager(1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	listener := em.SubscribeWith(ctx, ListenerOptions{Policy: Unbounded})
+
+	for i := 1; i <= 10; i++ {
+		em.Emit(otherEvent{i})
+	}
+
+	// Only the event which fit the buffer is delivered, the queued ones are counted once they are
+	if l := em.Metrics().Listeners[0]; l.Pending != 10 || len(l.Dropped) != 0 || l.Delivered["core.otherEvent"] != 1 {
+		t.Errorf("Expected all events to be pending and 1 delivered, got %+v", l)
+	}
+
+	// Nothing is lost and the order is kept
+	for i := 1; i <= 10; i++ {
+		select {
+		case e := <-listener:
+			if e != (otherEvent{i}) {
+				t.Fatalf("Expected event %d, got %v", i, e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected event %d, but timed out", i)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for em.Metrics().Listeners[0].Delivered["core.otherEvent"] != 10 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 10 delivered events, got %+v", em.Metrics().Listeners[0])
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Unregistering stops the queue
+	em.Emit(otherEvent{11})
+	em.Emit(otherEvent{12})
+	cancel()
+	for range listener {
+	}
+}
+
+func TestEventManager_BlockedListener(t *testing.T) {
+	em := NewEventManager(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Nobody reads from the slow listener
+	slowCtx, unregisterSlow := context.WithCancel(ctx)
+	em.SubscribeWith(slowCtx, ListenerOptions{Name: "slow", Policy: Block, BlockTimeout: time.Minute})
+
+	emitted := make(chan struct{})
+	go func() {
+		defer close(emitted)
+
+		em.Emit(otherEvent{1})
+	}()
+
+	// The listeners are registered and unregistered while the emitter is blocked
+	registered := make(chan struct{})
+	go func() {
+		defer close(registered)
+
+		otherCtx, unregisterOther := context.WithCancel(ctx)
+		listener := em.Register(otherCtx)
+		unregisterOther()
+		for range listener {
+		}
+	}()
+
+	select {
+	case <-registered:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the registration not to wait for the blocked emitter")
+	}
+
+	// Unregistering the slow listener releases the emitter
+	unregisterSlow()
+	select {
+	case <-emitted:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the emitter to give up once the listener is unregistered")
+	}
+}
@@ -1,5 +1,7 @@
 package core
 
+import "net/url"
+
 type Event any
 
 type QuitEvent struct{}
@@ -12,6 +14,8 @@ type NewMessageEvent struct {
 type ConnectEvent struct {
 	Host string
 	Port string
+	// Optional peer user id, used to connect through the relay when direct dialing fails
+	PeerUserId string
 }
 
 type UserCreatedEvent struct {
@@ -26,6 +30,77 @@ type UserLoggedOutEvent struct {
 	User *User
 }
 
+// SwitchUserEvent makes one of the logged in users the active one
+type SwitchUserEvent struct {
+	User *User
+}
+
 type UserUpdatedEvent struct {
 	User *User
 }
+
+type UserDeletedEvent struct {
+	User *User
+}
+
+type JoinEvent struct {
+	URI string
+}
+
+// Redact returns the event without the secret of the invite
+func (e JoinEvent) Redact() Event {
+	u, err := url.Parse(e.URI)
+	if err != nil {
+		return JoinEvent{"[redacted]"}
+	}
+
+	query := u.Query()
+	if query.Has("secret") {
+		query.Set("secret", "[redacted]")
+		u.RawQuery = query.Encode()
+	}
+
+	return JoinEvent{u.String()}
+}
+
+type SetPeerPolicyEvent struct {
+	Policy string
+}
+
+type PeerRuleEvent struct {
+	Kind  string
+	Value string
+	// Remove the rule instead of adding it
+	Remove bool
+	// Unique id of the user the rule belongs to, the active user if empty
+	Owner string
+}
+
+type ConnectionRequestDecisionEvent struct {
+	RequestId string
+	Accept    bool
+}
+
+// SendMessageEvent sends the text to the peer from the active user
+type SendMessageEvent struct {
+	PeerUserId string
+	Text       string
+	// Id of the message, the sender can find its MessageSent by it, generated if empty
+	MessageId string
+}
+
+// CommandFailed is emitted when a command fails after its retries,
+// Event is the one the command was mapped from
+type CommandFailed struct {
+	Command string
+	Event   Event
+	Err     error
+}
+
+// ServiceStateChanged is emitted when a service of the container changes its state,
+// Err is the cause of the degraded and stopped states
+type ServiceStateChanged struct {
+	Service string
+	State   ServiceState
+	Err     error
+}
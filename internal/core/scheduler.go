@@ -0,0 +1,266 @@
+package core
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hop-/gotchat/pkg/log"
+)
+
+// ScheduleHandle identifies a scheduled event to cancel it
+type ScheduleHandle uint64
+
+// scheduledEvent is an event waiting for its time
+type scheduledEvent struct {
+	handle ScheduleHandle
+	event  Event
+	due    time.Time
+	// Schedule of the recurring events, nil for the one-shot ones
+	schedule Schedule
+	// Position in the queue
+	index int
+}
+
+// scheduleQueue orders the events by their due time
+type scheduleQueue []*scheduledEvent
+
+func (q scheduleQueue) Len() int {
+	return len(q)
+}
+
+func (q scheduleQueue) Less(i, j int) bool {
+	return q[i].due.Before(q[j].due)
+}
+
+func (q scheduleQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *scheduleQueue) Push(x any) {
+	e := x.(*scheduledEvent)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *scheduleQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+
+	return e
+}
+
+// Scheduler emits events at a later time, once or recurring,
+// so the services don't need their own timer goroutines
+type Scheduler struct {
+	eventEmitter EventEmitter
+	clock        Clock
+
+	mu         sync.Mutex
+	queue      scheduleQueue
+	handles    map[ScheduleHandle]*scheduledEvent
+	lastHandle ScheduleHandle
+
+	// Wakes the loop when the earliest event changes
+	wake chan struct{}
+}
+
+func NewScheduler(eventEmitter EventEmitter, clock Clock) *Scheduler {
+	return &Scheduler{
+		eventEmitter,
+		clock,
+		sync.Mutex{},
+		nil,
+		make(map[ScheduleHandle]*scheduledEvent),
+		0,
+		make(chan struct{}, 1),
+	}
+}
+
+// Init implements Service.
+func (s *Scheduler) Init() error {
+	return nil
+}
+
+// Run implements Service.
+func (s *Scheduler) Run(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	for {
+		var timer Timer
+		var fire <-chan time.Time
+
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			timer = s.clock.NewTimer(s.queue[0].due.Sub(s.clock.Now()))
+			fire = timer.C()
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+
+			return
+		case <-s.wake:
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-fire:
+			s.emitDue()
+		}
+	}
+}
+
+// MapEventToCommands implements Service.
+func (s *Scheduler) MapEventToCommands(event Event) []Command {
+	return nil
+}
+
+// Close implements Service.
+func (s *Scheduler) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queue = nil
+	s.handles = make(map[ScheduleHandle]*scheduledEvent)
+
+	return nil
+}
+
+// Name implements Service.
+func (s *Scheduler) Name() string {
+	return "Scheduler"
+}
+
+// After emits the event once the duration has passed
+func (s *Scheduler) After(d time.Duration, event Event) ScheduleHandle {
+	return s.add(s.clock.Now().Add(d), event, nil)
+}
+
+// At emits the event at the time
+func (s *Scheduler) At(t time.Time, event Event) ScheduleHandle {
+	return s.add(t, event, nil)
+}
+
+// Every emits the event every interval, the first time after one interval
+func (s *Scheduler) Every(interval time.Duration, event Event) ScheduleHandle {
+	return s.Repeat(Every(interval), event)
+}
+
+// Cron emits the event at the times of the cron spec, see ParseCron
+func (s *Scheduler) Cron(spec string, event Event) (ScheduleHandle, error) {
+	schedule, err := ParseCron(spec)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.Repeat(schedule, event), nil
+}
+
+// Repeat emits the event at the times of the schedule, missed times are skipped
+func (s *Scheduler) Repeat(schedule Schedule, event Event) ScheduleHandle {
+	return s.add(schedule.Next(s.clock.Now()), event, schedule)
+}
+
+// Cancel stops the scheduled event, it reports whether the event was still scheduled
+func (s *Scheduler) Cancel(handle ScheduleHandle) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.handles[handle]
+	if !ok {
+		return false
+	}
+
+	delete(s.handles, handle)
+	heap.Remove(&s.queue, e.index)
+	s.notify()
+
+	return true
+}
+
+// Pending returns the number of the scheduled events
+func (s *Scheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.queue)
+}
+
+func (s *Scheduler) add(due time.Time, event Event, schedule Schedule) ScheduleHandle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastHandle++
+	handle := s.lastHandle
+
+	// A schedule without any next time never fires
+	if due.IsZero() {
+		log.Warnf("Event %T is never emitted by its schedule", event)
+
+		return handle
+	}
+
+	e := &scheduledEvent{handle, event, due, schedule, 0}
+	s.handles[handle] = e
+	heap.Push(&s.queue, e)
+	s.notify()
+
+	return handle
+}
+
+// notify wakes the loop to wait for the new earliest event
+// Note: s.mu must be held by the caller
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// emitDue emits the events which are due and schedules the next times of the recurring ones
+func (s *Scheduler) emitDue() {
+	now := s.clock.Now()
+
+	var events []Event
+
+	s.mu.Lock()
+	for len(s.queue) > 0 && !s.queue[0].due.After(now) {
+		e := s.queue[0]
+		events = append(events, e.event)
+
+		if e.schedule == nil {
+			heap.Pop(&s.queue)
+			delete(s.handles, e.handle)
+
+			continue
+		}
+
+		next := e.schedule.Next(e.due)
+		if !next.After(now) {
+			next = e.schedule.Next(now)
+		}
+		if next.IsZero() {
+			heap.Pop(&s.queue)
+			delete(s.handles, e.handle)
+
+			continue
+		}
+		e.due = next
+		heap.Fix(&s.queue, e.index)
+	}
+	s.mu.Unlock()
+
+	for _, e := range events {
+		s.eventEmitter.Emit(e)
+	}
+}
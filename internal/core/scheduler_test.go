@@ -0,0 +1,173 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventRecorder passes the emitted events to a channel
+type eventRecorder struct {
+	events chan Event
+}
+
+func (r *eventRecorder) Emit(e Event) {
+	r.events <- e
+}
+
+func (r *eventRecorder) next(t *testing.T) Event {
+	t.Helper()
+
+	select {
+	case e := <-r.events:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("expected an event to be emitted")
+
+		return nil
+	}
+}
+
+func startTestScheduler(t *testing.T, now time.Time) (*Scheduler, *FakeClock, *eventRecorder) {
+	clock := NewFakeClock(now)
+	recorder := &eventRecorder{make(chan Event, 10)}
+	scheduler := NewScheduler(recorder, clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	go scheduler.Run(ctx, wg)
+
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	return scheduler, clock, recorder
+}
+
+// marker is emitted right away, the events emitted before it were due before it
+type marker struct{}
+
+func TestScheduler_After(t *testing.T) {
+	scheduler, clock, recorder := startTestScheduler(t, time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC))
+
+	scheduler.After(time.Minute, otherEvent{1})
+	scheduler.After(2*time.Minute, otherEvent{2})
+
+	// Nothing is due yet
+	clock.Advance(30 * time.Second)
+	scheduler.After(0, marker{})
+	if e := recorder.next(t); e != (marker{}) {
+		t.Fatalf("expected nothing before the marker, got %v", e)
+	}
+
+	clock.Advance(30 * time.Second)
+	if e := recorder.next(t); e != (otherEvent{1}) {
+		t.Errorf("expected the first event, got %v", e)
+	}
+
+	clock.Advance(time.Minute)
+	if e := recorder.next(t); e != (otherEvent{2}) {
+		t.Errorf("expected the second event, got %v", e)
+	}
+
+	if scheduler.Pending() != 0 {
+		t.Errorf("expected no pending events, got %d", scheduler.Pending())
+	}
+}
+
+func TestScheduler_EveryAndCancel(t *testing.T) {
+	scheduler, clock, recorder := startTestScheduler(t, time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC))
+
+	handle := scheduler.Every(time.Minute, otherEvent{1})
+
+	for range 3 {
+		clock.Advance(time.Minute)
+		if e := recorder.next(t); e != (otherEvent{1}) {
+			t.Fatalf("expected the recurring event, got %v", e)
+		}
+	}
+
+	// Missed times are skipped
+	clock.Advance(5 * time.Minute)
+	recorder.next(t)
+	scheduler.After(0, marker{})
+	if e := recorder.next(t); e != (marker{}) {
+		t.Fatalf("expected the missed times to be skipped, got %v", e)
+	}
+
+	if !scheduler.Cancel(handle) {
+		t.Error("expected the event to be cancelled")
+	}
+	if scheduler.Cancel(handle) {
+		t.Error("expected the event to be cancelled only once")
+	}
+
+	clock.Advance(time.Minute)
+	scheduler.After(0, marker{})
+	if e := recorder.next(t); e != (marker{}) {
+		t.Errorf("expected the cancelled event not to be emitted, got %v", e)
+	}
+}
+
+func TestScheduler_Cron(t *testing.T) {
+	scheduler, clock, recorder := startTestScheduler(t, time.Date(2025, 1, 1, 10, 5, 0, 0, time.UTC))
+
+	if _, err := scheduler.Cron("every minute", otherEvent{0}); !errors.Is(err, ErrInvalidCronSpec) {
+		t.Errorf("expected ErrInvalidCronSpec, got %v", err)
+	}
+
+	if _, err := scheduler.Cron("*/15 * * * *", otherEvent{1}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	clock.Advance(10 * time.Minute)
+	if e := recorder.next(t); e != (otherEvent{1}) || !clock.Now().Equal(time.Date(2025, 1, 1, 10, 15, 0, 0, time.UTC)) {
+		t.Errorf("expected the event at 10:15, got %v at %v", e, clock.Now())
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	from := time.Date(2025, 1, 1, 10, 5, 0, 0, time.UTC) // Wednesday
+
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2025, 1, 1, 10, 6, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 9-17 * * *", time.Date(2025, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2025, 1, 2, 2, 30, 0, 0, time.UTC)},
+		{"0 0 * * 1,5", time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 1", time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", from.Add(90 * time.Second)},
+	}
+
+	for _, tt := range tests {
+		schedule, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Errorf("ParseCron(%q) failed: %v", tt.spec, err)
+
+			continue
+		}
+		if next := schedule.Next(from); !next.Equal(tt.next) {
+			t.Errorf("ParseCron(%q).Next() = %v, want %v", tt.spec, next, tt.next)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "@every soon"} {
+		if _, err := ParseCron(spec); !errors.Is(err, ErrInvalidCronSpec) {
+			t.Errorf("ParseCron(%q) = %v, want ErrInvalidCronSpec", spec, err)
+		}
+	}
+
+	// A date which doesn't exist never comes
+	schedule, _ := ParseCron("0 0 30 2 *")
+	if next := schedule.Next(from); !next.IsZero() {
+		t.Errorf("expected no next time for February 30, got %v", next)
+	}
+}
@@ -2,8 +2,17 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
+)
+
+var (
+	ErrServiceCycle             = errors.New("services depend on each other")
+	ErrUnknownServiceDependency = errors.New("dependency is not registered")
+	ErrServiceDependencyFailed  = errors.New("dependency failed to init")
 )
 
 type ServiceDispatcher interface {
@@ -14,12 +23,57 @@ type ServiceDispatcher interface {
 	CloseAll() []error
 }
 
+// DependentService is a service which needs other services, by name, to be initialized before it
+type DependentService interface {
+	Service
+	Dependencies() []string
+}
+
 type ServiceContainer struct {
 	services []Service
+
+	// Services which failed to init or whose dependencies did, they don't run
+	failed map[Service]bool
+
+	// Emits the state changes, nil disables the supervisor
+	emitter EventEmitter
+	// Time between the health checks
+	interval time.Duration
+
+	mu       sync.Mutex
+	statuses map[Service]*serviceStatus
+	// Closed when Run of the service returns
+	runs map[Service]chan struct{}
+	// Goroutines of the services, Run and Restart of a service get its own group
+	groups map[Service]*sync.WaitGroup
+	// Services with the RestartAlways policy whose Run returned
+	exited chan Service
+	closed bool
 }
 
 func NewContainer() *ServiceContainer {
-	return &ServiceContainer{}
+	return NewSupervisedContainer(nil, 0)
+}
+
+// NewSupervisedContainer creates a container which emits the state changes of the services,
+// checks their health every interval and restarts them according to their policies
+func NewSupervisedContainer(emitter EventEmitter, interval time.Duration) *ServiceContainer {
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+
+	return &ServiceContainer{
+		nil,
+		make(map[Service]bool),
+		emitter,
+		interval,
+		sync.Mutex{},
+		make(map[Service]*serviceStatus),
+		make(map[Service]chan struct{}),
+		make(map[Service]*sync.WaitGroup),
+		make(chan Service),
+		false,
+	}
 }
 
 func (c *ServiceContainer) GetAll() []Service {
@@ -30,35 +84,195 @@ func (c *ServiceContainer) Register(s Service) {
 	c.services = append(c.services, s)
 }
 
-func (c *ServiceContainer) InitAll() error {
+// dependenciesOf returns the declared dependencies of the service
+func dependenciesOf(s Service) []string {
+	if dependent, ok := s.(DependentService); ok {
+		return dependent.Dependencies()
+	}
+
+	return nil
+}
+
+// ordered returns the services with each one after its dependencies,
+// the services without dependencies between them keep the registration order
+func (c *ServiceContainer) ordered() ([]Service, error) {
+	hasDependencies := false
 	for _, s := range c.services {
+		if len(dependenciesOf(s)) > 0 {
+			hasDependencies = true
+
+			break
+		}
+	}
+	if !hasDependencies {
+		return c.services, nil
+	}
+
+	byName := make(map[string]Service, len(c.services))
+	for _, s := range c.services {
+		byName[s.Name()] = s
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[Service]int, len(c.services))
+	order := make([]Service, 0, len(c.services))
+	var path []string
+
+	var visit func(s Service) error
+	visit = func(s Service) error {
+		switch state[s] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("%w: %s -> %s", ErrServiceCycle, strings.Join(path, " -> "), s.Name())
+		}
+
+		state[s] = visiting
+		path = append(path, s.Name())
+		for _, name := range dependenciesOf(s) {
+			dependency, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("service %s: %w: %s", s.Name(), ErrUnknownServiceDependency, name)
+			}
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[s] = visited
+		order = append(order, s)
+
+		return nil
+	}
+
+	for _, s := range c.services {
+		if err := visit(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// InitAll initializes the services in dependency order,
+// a service isn't initialized if one of its dependencies failed
+func (c *ServiceContainer) InitAll() error {
+	services, err := c.ordered()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for _, s := range services {
+		if dependency := c.failedDependency(s); dependency != "" {
+			err := fmt.Errorf("%w: %s", ErrServiceDependencyFailed, dependency)
+			c.failed[s] = true
+			c.setState(s, ServiceStopped, err)
+			errs = append(errs, fmt.Errorf("service %s is not started: %w", s.Name(), err))
+
+			continue
+		}
+
 		if err := s.Init(); err != nil {
-			return fmt.Errorf("service %s failed to init: %w", s.Name(), err)
+			c.failed[s] = true
+			c.setState(s, ServiceStopped, err)
+			errs = append(errs, fmt.Errorf("service %s failed to init: %w", s.Name(), err))
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
+}
+
+// failedDependency returns the name of a dependency which isn't initialized, empty if none
+func (c *ServiceContainer) failedDependency(s Service) string {
+	if len(c.failed) == 0 {
+		return ""
+	}
+
+	for _, name := range dependenciesOf(s) {
+		for _, dependency := range c.services {
+			if c.failed[dependency] && dependency.Name() == name {
+				return name
+			}
+		}
+	}
+
+	return ""
 }
 
+// RunAll runs the initialized services and their supervisor, the group tracks the supervisor,
+// each service runs with a group of its own so the ones which don't stop can be told apart
 func (c *ServiceContainer) RunAll(ctx context.Context, wg *sync.WaitGroup) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	for _, s := range c.services {
-		go s.Run(ctx, wg)
+		if c.failed[s] {
+			continue
+		}
+
+		c.setState(s, ServiceStarting, nil)
+		c.start(ctx, s)
+		c.setState(s, ServiceRunning, nil)
+	}
+
+	if c.emitter != nil {
+		wg.Add(1)
+		go c.supervise(ctx, wg)
 	}
 
 	return nil
 }
 
+// closeOrder returns the initialized services in reverse dependency order
+func (c *ServiceContainer) closeOrder() []Service {
+	services, err := c.ordered()
+	if err != nil {
+		// Services can't be sorted, close them in reverse registration order
+		services = c.services
+	}
+
+	order := make([]Service, 0, len(services))
+	for i := len(services) - 1; i >= 0; i-- {
+		if !c.failed[services[i]] {
+			order = append(order, services[i])
+		}
+	}
+
+	return order
+}
+
+// CloseAll closes the initialized services in reverse dependency order
 func (c *ServiceContainer) CloseAll() []error {
-	errs := make([]error, 0, len(c.services))
-	for _, s := range c.services {
-		if err := s.Close(); err != nil {
-			errs = append(errs, fmt.Errorf("service %s failed to close: %w", s.Name(), err))
+	// Services aren't restarted from now on
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+
+	var errs []error
+	for _, s := range c.closeOrder() {
+		if err := c.closeService(s); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	if len(errs) != 0 {
-		return errs
+	return errs
+}
+
+// closeService closes the service and records it as stopped
+// Note: c.mu must be held by the caller
+func (c *ServiceContainer) closeService(s Service) error {
+	err := s.Close()
+	if err != nil {
+		err = fmt.Errorf("service %s failed to close: %w", s.Name(), err)
 	}
+	c.setState(s, ServiceStopped, err)
 
-	return nil
+	return err
 }
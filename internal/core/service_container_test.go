@@ -2,6 +2,8 @@ package core
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -85,7 +87,8 @@ func TestServiceContainer_RunAll(t *testing.T) {
 	}
 
 	time.Sleep(100 * time.Millisecond) // Allow goroutines to start
-	mockService.AssertCalled(t, "Run", ctx, wg)
+	// The service runs with a group of its own
+	mockService.AssertCalled(t, "Run", ctx, mock.Anything)
 	wg.Wait()
 }
 
@@ -110,3 +113,106 @@ func TestServiceContainer_CloseAll(t *testing.T) {
 	mockService1.AssertCalled(t, "Close")
 	mockService2.AssertCalled(t, "Close")
 }
+
+// testService records its lifecycle calls in the shared log
+type testService struct {
+	name    string
+	deps    []string
+	initErr error
+	calls   *[]string
+}
+
+func (s *testService) Init() error {
+	*s.calls = append(*s.calls, "init "+s.name)
+
+	return s.initErr
+}
+
+func (s *testService) Run(ctx context.Context, wg *sync.WaitGroup) {}
+
+func (s *testService) MapEventToCommands(event Event) []Command {
+	return nil
+}
+
+func (s *testService) Close() error {
+	*s.calls = append(*s.calls, "close "+s.name)
+
+	return nil
+}
+
+func (s *testService) Name() string {
+	return s.name
+}
+
+func (s *testService) Dependencies() []string {
+	return s.deps
+}
+
+func TestServiceContainer_DependencyOrder(t *testing.T) {
+	var calls []string
+	container := NewContainer()
+
+	// Registered before their dependencies
+	container.Register(&testService{name: "Connections", deps: []string{"Users", "Storage"}, calls: &calls})
+	container.Register(&testService{name: "Users", deps: []string{"Storage"}, calls: &calls})
+	container.Register(&testService{name: "Discovery", calls: &calls})
+	container.Register(&testService{name: "Storage", calls: &calls})
+
+	if err := container.InitAll(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	container.CloseAll()
+
+	expected := []string{
+		"init Storage", "init Users", "init Connections", "init Discovery",
+		"close Discovery", "close Connections", "close Users", "close Storage",
+	}
+	if strings.Join(calls, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+}
+
+func TestServiceContainer_DependencyErrors(t *testing.T) {
+	var calls []string
+
+	cyclic := NewContainer()
+	cyclic.Register(&testService{name: "A", deps: []string{"B"}, calls: &calls})
+	cyclic.Register(&testService{name: "B", deps: []string{"C"}, calls: &calls})
+	cyclic.Register(&testService{name: "C", deps: []string{"A"}, calls: &calls})
+	if err := cyclic.InitAll(); !errors.Is(err, ErrServiceCycle) {
+		t.Errorf("expected ErrServiceCycle, got %v", err)
+	}
+
+	unknown := NewContainer()
+	unknown.Register(&testService{name: "A", deps: []string{"Storage"}, calls: &calls})
+	if err := unknown.InitAll(); !errors.Is(err, ErrUnknownServiceDependency) {
+		t.Errorf("expected ErrUnknownServiceDependency, got %v", err)
+	}
+
+	if len(calls) != 0 {
+		t.Errorf("expected no service to be initialized, got %v", calls)
+	}
+}
+
+func TestServiceContainer_FailedDependency(t *testing.T) {
+	var calls []string
+	container := NewContainer()
+
+	failure := errors.New("database is locked")
+	container.Register(&testService{name: "Storage", initErr: failure, calls: &calls})
+	container.Register(&testService{name: "Users", deps: []string{"Storage"}, calls: &calls})
+	container.Register(&testService{name: "Connections", deps: []string{"Users"}, calls: &calls})
+	container.Register(&testService{name: "Discovery", calls: &calls})
+
+	err := container.InitAll()
+	if !errors.Is(err, failure) || !errors.Is(err, ErrServiceDependencyFailed) {
+		t.Errorf("expected the init and dependency errors, got %v", err)
+	}
+
+	// Only the independent service is initialized and closed
+	container.CloseAll()
+	expected := []string{"init Storage", "init Discovery", "close Discovery"}
+	if strings.Join(calls, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+}
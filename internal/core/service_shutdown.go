@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default time the services have to stop
+const DefaultShutdownTimeout = 10 * time.Second
+
+var ErrShutdownTimeout = errors.New("services didn't stop in time")
+
+// GracefulDispatcher is a service dispatcher which stops the services before a deadline
+type GracefulDispatcher interface {
+	Shutdown(ctx context.Context) *ShutdownReport
+}
+
+// ShutdownReport is the result of the shutdown of the services
+type ShutdownReport struct {
+	// Services whose Close didn't return before the deadline, they and the rest aren't closed
+	NotClosed []string
+	// Services whose Run or goroutines didn't return before the deadline
+	NotStopped []string
+	// Close errors of the services
+	Errors []error
+}
+
+// Complete reports whether all services stopped in time
+func (r *ShutdownReport) Complete() bool {
+	return len(r.NotClosed) == 0 && len(r.NotStopped) == 0
+}
+
+// Err returns ErrShutdownTimeout with the services which didn't stop, nil if all did
+func (r *ShutdownReport) Err() error {
+	if r.Complete() {
+		return nil
+	}
+
+	var parts []string
+	if len(r.NotClosed) > 0 {
+		parts = append(parts, "not closed: "+strings.Join(r.NotClosed, ", "))
+	}
+	if len(r.NotStopped) > 0 {
+		parts = append(parts, "still running: "+strings.Join(r.NotStopped, ", "))
+	}
+
+	return fmt.Errorf("%w (%s)", ErrShutdownTimeout, strings.Join(parts, "; "))
+}
+
+// Shutdown closes the services in reverse dependency order, so the ones everything depends on
+// close last, then waits for their Run and their goroutines to return. It gives up at the deadline
+// of the context and reports the services which didn't stop.
+func (c *ServiceContainer) Shutdown(ctx context.Context) *ShutdownReport {
+	report := &ShutdownReport{}
+
+	c.mu.Lock()
+	c.closed = true
+	services := c.closeOrder()
+	runs := make(map[Service]chan struct{}, len(c.runs))
+	for s, done := range c.runs {
+		runs[s] = c.stopped(done, c.groups[s])
+	}
+	c.mu.Unlock()
+
+	for i, s := range services {
+		closed := make(chan error, 1)
+		go func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			closed <- c.closeService(s)
+		}()
+
+		select {
+		case err := <-closed:
+			if err != nil {
+				report.Errors = append(report.Errors, err)
+			}
+		case <-ctx.Done():
+			// The hanging Close keeps the lock, the rest can't be closed safely
+			for _, rest := range services[i:] {
+				report.NotClosed = append(report.NotClosed, rest.Name())
+			}
+
+			return report
+		}
+	}
+
+	for _, s := range services {
+		done, ok := runs[s]
+		if !ok {
+			continue
+		}
+
+		// Stopped services aren't reported even if the deadline has passed meanwhile
+		select {
+		case <-done:
+			continue
+		default:
+		}
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			report.NotStopped = append(report.NotStopped, s.Name())
+		}
+	}
+
+	return report
+}
+
+// stopped returns a channel closed once Run has returned and the goroutines of the service are done
+func (c *ServiceContainer) stopped(done chan struct{}, group *sync.WaitGroup) chan struct{} {
+	stopped := make(chan struct{})
+	go func() {
+		<-done
+		group.Wait()
+		close(stopped)
+	}()
+
+	return stopped
+}
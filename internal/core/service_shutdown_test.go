@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hangingService doesn't return from Close or Run until released
+type hangingService struct {
+	testService
+	hangClose bool
+	release   chan struct{}
+}
+
+func (s *hangingService) Run(ctx context.Context, wg *sync.WaitGroup) {
+	if !s.hangClose {
+		<-s.release
+	}
+}
+
+func (s *hangingService) Close() error {
+	if s.hangClose {
+		<-s.release
+	}
+
+	return s.testService.Close()
+}
+
+func TestServiceContainer_Shutdown(t *testing.T) {
+	var calls []string
+	container := NewContainer()
+
+	container.Register(&testService{name: "Connections", deps: []string{"Storage"}, calls: &calls})
+	container.Register(&testService{name: "Storage", calls: &calls})
+
+	container.InitAll()
+	container.RunAll(context.Background(), &sync.WaitGroup{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	report := container.Shutdown(ctx)
+	if !report.Complete() || report.Err() != nil {
+		t.Errorf("expected a complete shutdown, got %+v", report)
+	}
+
+	// Storage closes last
+	expected := []string{"init Storage", "init Connections", "close Connections", "close Storage"}
+	if strings.Join(calls, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+}
+
+func TestServiceContainer_ShutdownDeadline(t *testing.T) {
+	var calls []string
+	release := make(chan struct{})
+	defer close(release)
+
+	// The connections don't stop running, the discovery hangs in Close
+	container := NewContainer()
+	container.Register(&testService{name: "Storage", calls: &calls})
+	container.Register(&hangingService{testService{name: "Connections", deps: []string{"Storage"}, calls: &calls}, false, release})
+	container.Register(&hangingService{testService{name: "Discovery", deps: []string{"Storage"}, calls: &calls}, true, release})
+
+	container.InitAll()
+	container.RunAll(context.Background(), &sync.WaitGroup{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	report := container.Shutdown(ctx)
+	if !errors.Is(report.Err(), ErrShutdownTimeout) {
+		t.Fatalf("expected ErrShutdownTimeout, got %v", report.Err())
+	}
+
+	// Nothing after the hanging service is closed
+	if strings.Join(report.NotClosed, ", ") != "Discovery, Connections, Storage" {
+		t.Errorf("expected Discovery and the services closed after it not to be closed, got %v", report.NotClosed)
+	}
+	if len(report.NotStopped) != 0 {
+		t.Errorf("expected no services waited for after the hanging Close, got %v", report.NotStopped)
+	}
+	if !strings.Contains(report.Err().Error(), "not closed: Discovery, Connections, Storage") {
+		t.Errorf("expected the report in the error, got %v", report.Err())
+	}
+}
+
+func TestServiceContainer_ShutdownStillRunning(t *testing.T) {
+	var calls []string
+	release := make(chan struct{})
+	defer close(release)
+
+	container := NewContainer()
+	container.Register(&hangingService{testService{name: "Connections", calls: &calls}, false, release})
+
+	container.InitAll()
+	container.RunAll(context.Background(), &sync.WaitGroup{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	report := container.Shutdown(ctx)
+	if len(report.NotClosed) != 0 || strings.Join(report.NotStopped, ", ") != "Connections" {
+		t.Errorf("expected Connections to be reported as running, got %+v", report)
+	}
+}
@@ -0,0 +1,281 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hop-/gotchat/pkg/log"
+)
+
+// ServiceState is the lifecycle state of a service reported by the container
+type ServiceState string
+
+const (
+	ServiceStarting ServiceState = "starting"
+	ServiceRunning  ServiceState = "running"
+	// The health check fails, the service may be restarted
+	ServiceDegraded ServiceState = "degraded"
+	ServiceStopped  ServiceState = "stopped"
+)
+
+// Default time between the health checks of the services
+const DefaultHealthCheckInterval = 5 * time.Second
+
+var ErrServiceExited = errors.New("service stopped running")
+
+// HealthChecker is a service which reports whether it works, nil when healthy
+type HealthChecker interface {
+	Health() error
+}
+
+// RestartMode decides when the supervisor restarts a service
+type RestartMode int
+
+const (
+	// RestartNever only reports the service as degraded
+	RestartNever RestartMode = iota
+	// RestartOnFailure restarts the service when its health check fails
+	RestartOnFailure
+	// RestartAlways also restarts the service when its Run returns
+	RestartAlways
+)
+
+func (m RestartMode) String() string {
+	switch m {
+	case RestartNever:
+		return "never"
+	case RestartOnFailure:
+		return "on-failure"
+	case RestartAlways:
+		return "always"
+	default:
+		return fmt.Sprintf("restart(%d)", int(m))
+	}
+}
+
+// RestartPolicy is the restart mode with the wait between the consecutive restarts
+type RestartPolicy struct {
+	Mode RestartMode
+	// Wait before the first restart, doubled after each failed one
+	Backoff time.Duration
+	// Upper bound of the wait
+	MaxBackoff time.Duration
+}
+
+func (p RestartPolicy) backoff(restarts int) time.Duration {
+	d := p.Backoff << restarts
+	if d <= 0 || (p.MaxBackoff > 0 && d > p.MaxBackoff) {
+		d = p.MaxBackoff
+	}
+
+	return d
+}
+
+// SupervisedService is a service with its own restart policy, the others are never restarted
+type SupervisedService interface {
+	RestartPolicy() RestartPolicy
+}
+
+// Restarter is a service which restarts without losing its state,
+// the others are closed, initialized and run again
+type Restarter interface {
+	Restart(ctx context.Context, wg *sync.WaitGroup) error
+}
+
+// serviceStatus is what the supervisor knows about a service
+type serviceStatus struct {
+	state ServiceState
+	// Restarts since the service was last healthy
+	restarts    int
+	nextRestart time.Time
+	// Run returned and the service isn't restarted yet
+	exited bool
+}
+
+func restartPolicyOf(s Service) RestartPolicy {
+	if supervised, ok := s.(SupervisedService); ok {
+		return supervised.RestartPolicy()
+	}
+
+	return RestartPolicy{}
+}
+
+// setState records the state and emits it when it changes
+// Note: c.mu must be held by the caller
+func (c *ServiceContainer) setState(s Service, state ServiceState, err error) {
+	status, ok := c.statuses[s]
+	if !ok {
+		status = &serviceStatus{}
+		c.statuses[s] = status
+	}
+	if status.state == state {
+		return
+	}
+	status.state = state
+
+	if c.emitter != nil {
+		c.emitter.Emit(ServiceStateChanged{s.Name(), state, err})
+	}
+}
+
+// start runs the service in background
+// Note: c.mu must be held by the caller
+func (c *ServiceContainer) start(ctx context.Context, s Service) {
+	done := make(chan struct{})
+	c.runs[s] = done
+
+	go c.run(ctx, c.groupOf(s), s, done)
+}
+
+// groupOf returns the group of the goroutines of the service
+// Note: c.mu must be held by the caller
+func (c *ServiceContainer) groupOf(s Service) *sync.WaitGroup {
+	group, ok := c.groups[s]
+	if !ok {
+		group = &sync.WaitGroup{}
+		c.groups[s] = group
+	}
+
+	return group
+}
+
+// run runs the service and reports when it returns
+func (c *ServiceContainer) run(ctx context.Context, wg *sync.WaitGroup, s Service, done chan struct{}) {
+	s.Run(ctx, wg)
+	close(done)
+
+	if restartPolicyOf(s).Mode != RestartAlways || c.emitter == nil {
+		return
+	}
+
+	select {
+	case c.exited <- s:
+	case <-ctx.Done():
+	}
+}
+
+// supervise checks the health of the services until the context is done
+func (c *ServiceContainer) supervise(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	// Listeners registered after the start learn the states on the first tick
+	announced := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-c.exited:
+			c.mu.Lock()
+			if ctx.Err() == nil && !c.closed {
+				c.statuses[s].exited = true
+				c.setState(s, ServiceDegraded, ErrServiceExited)
+				c.restart(ctx, s, ErrServiceExited)
+			}
+			c.mu.Unlock()
+		case <-ticker.C:
+			if !announced {
+				c.announce()
+				announced = true
+			}
+			c.checkAll(ctx)
+		}
+	}
+}
+
+// announce emits the current states of all services
+func (c *ServiceContainer) announce() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range c.services {
+		if status, ok := c.statuses[s]; ok {
+			c.emitter.Emit(ServiceStateChanged{s.Name(), status.state, nil})
+		}
+	}
+}
+
+func (c *ServiceContainer) checkAll(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range c.services {
+		if ctx.Err() != nil || c.closed {
+			return
+		}
+		if c.failed[s] {
+			continue
+		}
+
+		// Retried after the backoff until it runs again
+		if c.statuses[s].exited {
+			c.restart(ctx, s, ErrServiceExited)
+
+			continue
+		}
+
+		checker, ok := s.(HealthChecker)
+		if !ok {
+			continue
+		}
+
+		if err := checker.Health(); err != nil {
+			c.setState(s, ServiceDegraded, err)
+			c.restart(ctx, s, err)
+
+			continue
+		}
+
+		// Healthy again, the next failure restarts without waiting
+		c.statuses[s].restarts = 0
+		c.setState(s, ServiceRunning, nil)
+	}
+}
+
+// restart restarts the degraded service according to its policy
+// Note: c.mu must be held by the caller
+func (c *ServiceContainer) restart(ctx context.Context, s Service, cause error) {
+	policy := restartPolicyOf(s)
+	status := c.statuses[s]
+	if policy.Mode == RestartNever || time.Now().Before(status.nextRestart) {
+		return
+	}
+
+	status.nextRestart = time.Now().Add(policy.backoff(status.restarts))
+	status.restarts++
+
+	log.Warnf("Restarting service %s (%s), attempt %d: %v", s.Name(), policy.Mode, status.restarts, cause)
+	c.setState(s, ServiceStarting, cause)
+
+	if err := c.restartService(ctx, s); err != nil {
+		log.Errorf("Failed to restart service %s: %v", s.Name(), err)
+		c.setState(s, ServiceDegraded, err)
+
+		return
+	}
+
+	status.exited = false
+	c.setState(s, ServiceRunning, nil)
+}
+
+func (c *ServiceContainer) restartService(ctx context.Context, s Service) error {
+	if restarter, ok := s.(Restarter); ok {
+		return restarter.Restart(ctx, c.groupOf(s))
+	}
+
+	if err := s.Close(); err != nil {
+		log.Warnf("Failed to close service %s before restart: %v", s.Name(), err)
+	}
+	if err := s.Init(); err != nil {
+		return err
+	}
+	c.start(ctx, s)
+
+	return nil
+}
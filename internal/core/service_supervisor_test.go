@@ -0,0 +1,238 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stateRecorder collects the state changes emitted by the container
+type stateRecorder struct {
+	events chan ServiceStateChanged
+}
+
+func newStateRecorder() *stateRecorder {
+	return &stateRecorder{make(chan ServiceStateChanged, 100)}
+}
+
+func (r *stateRecorder) Emit(e Event) {
+	if changed, ok := e.(ServiceStateChanged); ok {
+		r.events <- changed
+	}
+}
+
+// waitFor waits for the state of the service, the other changes are skipped
+func (r *stateRecorder) waitFor(t *testing.T, service string, state ServiceState) ServiceStateChanged {
+	t.Helper()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case e := <-r.events:
+			if e.Service == service && e.State == state {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("expected %s to be %s", service, state)
+
+			return ServiceStateChanged{}
+		}
+	}
+}
+
+// supervisedService is a service with a switchable health
+type supervisedService struct {
+	name    string
+	policy  RestartPolicy
+	restart bool
+	// Run returns immediately instead of waiting for the context
+	exits bool
+
+	mu       sync.Mutex
+	health   error
+	inits    int
+	restarts int
+}
+
+func (s *supervisedService) Init() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inits++
+
+	return nil
+}
+
+func (s *supervisedService) Run(ctx context.Context, wg *sync.WaitGroup) {
+	if !s.exits {
+		<-ctx.Done()
+	}
+}
+
+func (s *supervisedService) MapEventToCommands(event Event) []Command {
+	return nil
+}
+
+func (s *supervisedService) Close() error {
+	return nil
+}
+
+func (s *supervisedService) Name() string {
+	return s.name
+}
+
+func (s *supervisedService) RestartPolicy() RestartPolicy {
+	return s.policy
+}
+
+func (s *supervisedService) Health() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.health
+}
+
+func (s *supervisedService) setHealth(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.health = err
+}
+
+func (s *supervisedService) count() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.inits, s.restarts
+}
+
+// restartingService restarts itself without being closed
+type restartingService struct {
+	*supervisedService
+}
+
+func (s restartingService) Restart(ctx context.Context, wg *sync.WaitGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.restarts++
+	s.health = nil
+
+	return nil
+}
+
+func startSupervisedContainer(t *testing.T, services ...Service) (*ServiceContainer, *stateRecorder) {
+	recorder := newStateRecorder()
+	container := NewSupervisedContainer(recorder, 5*time.Millisecond)
+	for _, s := range services {
+		container.Register(s)
+	}
+
+	if err := container.InitAll(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	container.RunAll(ctx, wg)
+
+	t.Cleanup(func() {
+		cancel()
+		container.CloseAll()
+		wg.Wait()
+	})
+
+	return container, recorder
+}
+
+func TestServiceContainer_RestartOnFailure(t *testing.T) {
+	s := &supervisedService{name: "Connections", policy: RestartPolicy{Mode: RestartOnFailure, Backoff: time.Hour}}
+	_, recorder := startSupervisedContainer(t, s)
+
+	recorder.waitFor(t, "Connections", ServiceRunning)
+
+	failure := errors.New("listener closed")
+	s.setHealth(failure)
+
+	degraded := recorder.waitFor(t, "Connections", ServiceDegraded)
+	if !errors.Is(degraded.Err, failure) {
+		t.Errorf("expected the health error, got %v", degraded.Err)
+	}
+	recorder.waitFor(t, "Connections", ServiceStarting)
+	recorder.waitFor(t, "Connections", ServiceRunning)
+
+	// Closed, initialized and run again
+	if inits, _ := s.count(); inits != 2 {
+		t.Errorf("expected the service to be initialized again, got %d inits", inits)
+	}
+
+	// The next restart waits for the backoff
+	time.Sleep(50 * time.Millisecond)
+	if inits, _ := s.count(); inits != 2 {
+		t.Errorf("expected no restart before the backoff, got %d inits", inits)
+	}
+
+	s.setHealth(nil)
+	recorder.waitFor(t, "Connections", ServiceRunning)
+}
+
+func TestServiceContainer_RestartNever(t *testing.T) {
+	s := &supervisedService{name: "Discovery"}
+	_, recorder := startSupervisedContainer(t, s)
+
+	s.setHealth(errors.New("multicast is unavailable"))
+	recorder.waitFor(t, "Discovery", ServiceDegraded)
+
+	s.setHealth(nil)
+	recorder.waitFor(t, "Discovery", ServiceRunning)
+
+	if inits, _ := s.count(); inits != 1 {
+		t.Errorf("expected no restart, got %d inits", inits)
+	}
+}
+
+func TestServiceContainer_RestartAlways(t *testing.T) {
+	s := &supervisedService{name: "Relay", exits: true, policy: RestartPolicy{Mode: RestartAlways, Backoff: time.Hour}}
+	_, recorder := startSupervisedContainer(t, s)
+
+	degraded := recorder.waitFor(t, "Relay", ServiceDegraded)
+	if !errors.Is(degraded.Err, ErrServiceExited) {
+		t.Errorf("expected ErrServiceExited, got %v", degraded.Err)
+	}
+	recorder.waitFor(t, "Relay", ServiceRunning)
+
+	if inits, _ := s.count(); inits != 2 {
+		t.Errorf("expected the service to be restarted once, got %d inits", inits)
+	}
+}
+
+func TestServiceContainer_Restarter(t *testing.T) {
+	s := restartingService{&supervisedService{name: "Connections", policy: RestartPolicy{Mode: RestartOnFailure}}}
+	_, recorder := startSupervisedContainer(t, s)
+
+	s.setHealth(errors.New("listener closed"))
+	recorder.waitFor(t, "Connections", ServiceDegraded)
+	recorder.waitFor(t, "Connections", ServiceRunning)
+
+	if inits, restarts := s.count(); inits != 1 || restarts != 1 {
+		t.Errorf("expected the service to restart itself, got %d inits and %d restarts", inits, restarts)
+	}
+}
+
+func TestServiceContainer_StoppedStates(t *testing.T) {
+	var calls []string
+	recorder := newStateRecorder()
+	container := NewSupervisedContainer(recorder, time.Hour)
+
+	container.Register(&testService{name: "Storage", initErr: errors.New("disk is full"), calls: &calls})
+	container.Register(&testService{name: "Users", deps: []string{"Storage"}, calls: &calls})
+
+	container.InitAll()
+
+	recorder.waitFor(t, "Storage", ServiceStopped)
+	if e := recorder.waitFor(t, "Users", ServiceStopped); !errors.Is(e.Err, ErrServiceDependencyFailed) {
+		t.Errorf("expected ErrServiceDependencyFailed, got %v", e.Err)
+	}
+}
@@ -0,0 +1,177 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/hop-/gotchat/internal/journal"
+	"github.com/hop-/gotchat/pkg/log"
+)
+
+// Events kept for the client until it reads them, the newer ones are dropped
+const clientEventsBuffer = 100
+
+var ErrClientClosed = errors.New("control API connection is closed")
+
+// Client calls the control API of a running daemon, the errors of the calls are *Error
+type Client struct {
+	conn net.Conn
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[uint64]chan Response
+	lastId  uint64
+
+	events chan journal.Entry
+	done   chan struct{}
+}
+
+// Dial connects to the daemon listening on the socket
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		conn,
+		sync.Mutex{},
+		sync.Mutex{},
+		make(map[uint64]chan Response),
+		0,
+		make(chan journal.Entry, clientEventsBuffer),
+		make(chan struct{}),
+	}
+	go c.read()
+
+	return c, nil
+}
+
+// Call calls the method and decodes its result into result, which may be nil
+func (c *Client) Call(ctx context.Context, method string, params any, result any) error {
+	request := Request{JsonRpc: jsonRpcVersion, Method: method}
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		request.Params = encoded
+	}
+
+	reply := make(chan Response, 1)
+
+	c.mu.Lock()
+	c.lastId++
+	id := c.lastId
+	c.pending[id] = reply
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	request.Id = json.RawMessage(strconv.FormatUint(id, 10))
+	if err := c.write(request); err != nil {
+		return err
+	}
+
+	select {
+	case response := <-reply:
+		if response.Error != nil {
+			return response.Error
+		}
+		if result == nil || len(response.Result) == 0 {
+			return nil
+		}
+
+		return json.Unmarshal(response.Result, result)
+	case <-c.done:
+		return ErrClientClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Events returns the subscribed events, the channel is closed with the connection
+func (c *Client) Events() <-chan journal.Entry {
+	return c.events
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) write(v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_, err = c.conn.Write(append(line, '\n'))
+
+	return err
+}
+
+// read dispatches the responses and the notifications until the connection is closed
+func (c *Client) read() {
+	defer close(c.events)
+	defer close(c.done)
+
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
+	for scanner.Scan() {
+		// Responses have an id, notifications have a method
+		var message struct {
+			Response
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			log.Warnf("Invalid message from the control API: %v", err)
+
+			continue
+		}
+
+		if message.Method == NotificationEvent {
+			var entry journal.Entry
+			if err := json.Unmarshal(message.Params, &entry); err != nil {
+				log.Warnf("Invalid event from the control API: %v", err)
+
+				continue
+			}
+
+			select {
+			case c.events <- entry:
+			default:
+				log.Warnf("Dropped event %s from the control API, the events aren't read", entry.Type)
+			}
+
+			continue
+		}
+
+		id, err := strconv.ParseUint(string(message.Id), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		reply, ok := c.pending[id]
+		c.mu.Unlock()
+
+		if ok {
+			reply <- message.Response
+		}
+	}
+}
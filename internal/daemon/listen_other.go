@@ -0,0 +1,10 @@
+//go:build !unix
+
+package daemon
+
+import "net"
+
+// listen creates the socket, its access is limited by the directory it's created in
+func listen(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
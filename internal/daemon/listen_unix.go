@@ -0,0 +1,42 @@
+//go:build unix
+
+package daemon
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// listen creates the socket in a private directory and moves it in place once only the owner can access it,
+// a chmod after the bind in place would leave a window for other users to connect
+func listen(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".listen-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	private := filepath.Join(dir, filepath.Base(path))
+	listener, err := net.Listen("unix", private)
+	if err != nil {
+		return nil, err
+	}
+
+	// The socket is moved, the server removes it on close
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if err := os.Chmod(private, 0600); err != nil {
+		listener.Close()
+
+		return nil, err
+	}
+
+	if err := os.Rename(private, path); err != nil {
+		listener.Close()
+
+		return nil, err
+	}
+
+	return listener, nil
+}
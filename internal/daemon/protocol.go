@@ -0,0 +1,174 @@
+// Package daemon exposes a running application to other frontends and scripts through
+// a JSON-RPC 2.0 API on a Unix socket, one JSON object per line in both directions.
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Methods of the control API
+const (
+	// LoginParams -> UserInfo, the user becomes the active one
+	MethodLogin = "login"
+	// UserParams -> nil
+	MethodLogout = "logout"
+	// nil -> []UserInfo
+	MethodUsers = "users"
+	// UserParams -> []ChatInfo, the chats of the user, the active one if omitted
+	MethodChats = "chats"
+	// HistoryParams -> []MessageInfo
+	MethodHistory = "history"
+	// SendParams -> SendResult, it returns once the message is sent or has failed
+	MethodSend = "send"
+	// ConnectParams -> ConnectResult, it returns once the handshake is done or has failed
+	MethodConnect = "connect"
+	// JoinParams -> ConnectResult, it returns once the handshake is done or has failed
+	MethodJoin = "join"
+	// ResolveParams -> nil, it answers a services.ConnectionRequested event
+	MethodResolve = "resolve"
+	// PolicyParams -> nil
+	MethodPolicy = "policy"
+	// SubscribeParams -> nil, the events come as "event" notifications with journal entries
+	MethodSubscribe = "subscribe"
+	// nil -> nil
+	MethodUnsubscribe = "unsubscribe"
+
+	// Notification of a subscribed event
+	NotificationEvent = "event"
+)
+
+// Error codes of JSON-RPC 2.0 and of the control API
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// The request is valid but it failed, e.g. invalid credentials
+	CodeFailed = -32000
+)
+
+const jsonRpcVersion = "2.0"
+
+type LoginParams struct {
+	// Name or unique id of the user
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+type UserParams struct {
+	// Name or unique id of a logged in user
+	User string `json:"user,omitempty"`
+}
+
+type HistoryParams struct {
+	Chat string `json:"chat"`
+}
+
+type SendParams struct {
+	// Unique id of the peer
+	To   string `json:"to"`
+	Text string `json:"text"`
+	// Name or unique id of the logged in user who sends, the active one if omitted
+	From string `json:"from,omitempty"`
+}
+
+type ConnectParams struct {
+	Host string `json:"host"`
+	Port string `json:"port"`
+	// Unique id of the peer, it lets the connection go through the relay
+	Peer string `json:"peer,omitempty"`
+	// Name or unique id of the logged in user who connects, the active one if omitted
+	From string `json:"from,omitempty"`
+}
+
+type JoinParams struct {
+	// Invite link, gotchat://join?...
+	Uri string `json:"uri"`
+	// Name or unique id of the logged in user who joins, the active one if omitted
+	From string `json:"from,omitempty"`
+}
+
+type ResolveParams struct {
+	RequestId string `json:"requestId"`
+	Accept    bool   `json:"accept"`
+}
+
+type PolicyParams struct {
+	// One of the peer policies, e.g. "ask"
+	Policy string `json:"policy"`
+	// Name or unique id of the logged in user, the active one if omitted
+	User string `json:"user,omitempty"`
+}
+
+type SubscribeParams struct {
+	// Event types as package.Name, e.g. services.MessageReceived, all if empty
+	Types []string `json:"types,omitempty"`
+}
+
+type UserInfo struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	LoggedIn bool   `json:"loggedIn"`
+}
+
+type ChatInfo struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type MessageInfo struct {
+	Member string    `json:"member"`
+	Text   string    `json:"text"`
+	At     time.Time `json:"at"`
+}
+
+type ConnectResult struct {
+	ConnId     string `json:"connId"`
+	PeerUserId string `json:"peerUserId"`
+}
+
+type SendResult struct {
+	MessageId string `json:"messageId"`
+	// Number of the peer's devices the message was sent to
+	Delivered int `json:"delivered"`
+	// Known devices of the peer which are not connected
+	Undelivered []string `json:"undelivered,omitempty"`
+}
+
+// Request is a call, or a notification if it has no id
+type Request struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type Response struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Notification is sent by the server without a request, Method is NotificationEvent
+type Notification struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+func newError(code int, format string, args ...any) *Error {
+	return &Error{code, fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,815 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/journal"
+	"github.com/hop-/gotchat/internal/services"
+	"github.com/hop-/gotchat/pkg/log"
+)
+
+const (
+	// Time a send waits for the message to be sent
+	sendTimeout = time.Minute
+	// Time a connect waits for the handshake, the peer's user may be asked to accept
+	connectTimeout = 3 * time.Minute
+	// Time the commands of the other methods have to finish
+	commandTimeout = 10 * time.Second
+)
+
+var ErrDaemonRunning = errors.New("daemon is already running")
+
+// Server serves the control API on a Unix socket, only the owner of the socket may connect
+type Server struct {
+	bus         core.EventBus
+	path        string
+	userManager *services.UserManager
+	chatManager *services.ChatManager
+
+	listener net.Listener
+
+	mu       sync.Mutex
+	sessions map[*session]struct{}
+	// Users logged in through the API by unique id
+	users map[string]*core.User
+	// Unique id of the user the messages are sent from
+	activeUserId string
+	// Number of the sessions so far, names their listeners
+	connected int
+}
+
+func NewServer(
+	bus core.EventBus,
+	path string,
+	userManager *services.UserManager,
+	chatManager *services.ChatManager,
+) *Server {
+	return &Server{
+		bus,
+		path,
+		userManager,
+		chatManager,
+		nil,
+		sync.Mutex{},
+		make(map[*session]struct{}),
+		make(map[string]*core.User),
+		"",
+		0,
+	}
+}
+
+// Init implements core.Service.
+func (s *Server) Init() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+
+	// The socket of a running daemon answers, the one left by a crashed daemon is replaced
+	if conn, err := net.Dial("unix", s.path); err == nil {
+		conn.Close()
+
+		return fmt.Errorf("%w: %s", ErrDaemonRunning, s.path)
+	}
+	os.Remove(s.path)
+
+	listener, err := listen(s.path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(s.path, 0600); err != nil {
+		listener.Close()
+
+		return err
+	}
+	s.listener = listener
+
+	log.Infof("Control API listening on %s", s.path)
+
+	return nil
+}
+
+// Run implements core.Service.
+func (s *Server) Run(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	go func() {
+		<-ctx.Done()
+		s.listener.Close()
+	}()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Errorf("Control API stopped accepting: %v", err)
+			}
+
+			return
+		}
+
+		s.mu.Lock()
+		s.connected++
+		sess := newSession(s, conn, fmt.Sprintf("control-%d", s.connected))
+		s.sessions[sess] = struct{}{}
+		s.mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sess.serve(ctx)
+
+			s.mu.Lock()
+			delete(s.sessions, sess)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// MapEventToCommands implements core.Service.
+func (s *Server) MapEventToCommands(event core.Event) []core.Command {
+	return nil
+}
+
+// Close implements core.Service.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sess := range s.sessions {
+		sess.close()
+	}
+
+	if s.listener == nil {
+		return nil
+	}
+
+	err := s.listener.Close()
+	os.Remove(s.path)
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// Name implements core.Service.
+func (s *Server) Name() string {
+	return "ControlServer"
+}
+
+// Dependencies implements core.DependentService.
+func (s *Server) Dependencies() []string {
+	return []string{"UserManager", "ChatManager"}
+}
+
+// call runs the method of the request for the session
+func (s *Server) call(ctx context.Context, sess *session, method string, params json.RawMessage) (any, *Error) {
+	switch method {
+	case MethodLogin:
+		var p LoginParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return s.login(p)
+	case MethodLogout:
+		var p UserParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return nil, s.logout(p)
+	case MethodUsers:
+		return s.listUsers()
+	case MethodChats:
+		var p UserParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return s.listChats(p)
+	case MethodHistory:
+		var p HistoryParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return s.history(p)
+	case MethodSend:
+		var p SendParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return s.send(ctx, p)
+	case MethodConnect:
+		var p ConnectParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return s.connect(ctx, p)
+	case MethodJoin:
+		var p JoinParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return s.join(ctx, p)
+	case MethodResolve:
+		var p ResolveParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return nil, s.resolve(ctx, p)
+	case MethodPolicy:
+		var p PolicyParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return nil, s.policy(ctx, p)
+	case MethodSubscribe:
+		var p SubscribeParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		sess.subscribe(ctx, p.Types)
+
+		return nil, nil
+	case MethodUnsubscribe:
+		sess.unsubscribe()
+
+		return nil, nil
+	default:
+		return nil, newError(CodeMethodNotFound, "method %q not found", method)
+	}
+}
+
+func decodeParams(params json.RawMessage, v any) *Error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return newError(CodeInvalidParams, "invalid params: %v", err)
+	}
+
+	return nil
+}
+
+// allUsers returns the users, none is not an error
+func (s *Server) allUsers() ([]*core.User, error) {
+	users, err := s.userManager.GetAllUsers()
+	if errors.Is(err, services.ErrNotFound) {
+		return nil, nil
+	}
+
+	return users, err
+}
+
+// findUser finds the user by unique id or by name, the name must be unambiguous
+func (s *Server) findUser(nameOrId string) (*core.User, *Error) {
+	users, err := s.allUsers()
+	if err != nil {
+		return nil, newError(CodeInternalError, "failed to get users: %v", err)
+	}
+
+	var found []*core.User
+	for _, user := range users {
+		if user.UniqueId == nameOrId {
+			return user, nil
+		}
+		if user.Name == nameOrId {
+			found = append(found, user)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, newError(CodeFailed, "user %q not found", nameOrId)
+	case 1:
+		return found[0], nil
+	default:
+		return nil, newError(CodeFailed, "several users are named %q, use the id", nameOrId)
+	}
+}
+
+// loggedInUser returns the logged in user by name or unique id, the active one if empty
+// Note: s.mu must be held by the caller
+func (s *Server) loggedInUser(nameOrId string) (*core.User, *Error) {
+	if nameOrId == "" {
+		if user, ok := s.users[s.activeUserId]; ok {
+			return user, nil
+		}
+
+		return nil, newError(CodeFailed, "no user is logged in")
+	}
+
+	for _, user := range s.users {
+		if user.UniqueId == nameOrId || user.Name == nameOrId {
+			return user, nil
+		}
+	}
+
+	return nil, newError(CodeFailed, "user %q is not logged in", nameOrId)
+}
+
+func (s *Server) login(p LoginParams) (*UserInfo, *Error) {
+	user, rpcErr := s.findUser(p.User)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	// The services log the user in and make it the active one
+	user, err := s.userManager.LoginUser(user, p.Password)
+	if errors.Is(err, services.ErrorInvalidCredentials) {
+		return nil, newError(CodeFailed, "invalid credentials")
+	}
+	if err != nil {
+		return nil, newError(CodeInternalError, "failed to log in: %v", err)
+	}
+
+	s.mu.Lock()
+	s.users[user.UniqueId] = user
+	s.activeUserId = user.UniqueId
+	s.mu.Unlock()
+
+	log.Infof("User %s logged in through the control API", user.Name)
+
+	return &UserInfo{user.UniqueId, user.Name, true}, nil
+}
+
+func (s *Server) logout(p UserParams) *Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, err := s.loggedInUser(p.User)
+	if err != nil {
+		return err
+	}
+
+	delete(s.users, user.UniqueId)
+	s.bus.Emit(core.UserLoggedOutEvent{User: user})
+
+	// Another logged in user becomes the active one
+	if s.activeUserId == user.UniqueId {
+		s.activeUserId = ""
+		for id, next := range s.users {
+			s.activeUserId = id
+			s.bus.Emit(core.SwitchUserEvent{User: next})
+
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) listUsers() ([]UserInfo, *Error) {
+	users, err := s.allUsers()
+	if err != nil {
+		return nil, newError(CodeInternalError, "failed to get users: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	infos := make([]UserInfo, 0, len(users))
+	for _, user := range users {
+		_, loggedIn := s.users[user.UniqueId]
+		infos = append(infos, UserInfo{user.UniqueId, user.Name, loggedIn})
+	}
+
+	return infos, nil
+}
+
+func (s *Server) listChats(p UserParams) ([]ChatInfo, *Error) {
+	s.mu.Lock()
+	user, rpcErr := s.loggedInUser(p.User)
+	s.mu.Unlock()
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	chats, err := s.chatManager.GetChatsByUserId(user.Id)
+	if err != nil {
+		return nil, newError(CodeInternalError, "failed to get chats: %v", err)
+	}
+
+	infos := make([]ChatInfo, 0, len(chats))
+	for _, chat := range chats {
+		infos = append(infos, ChatInfo{chat.Id, chat.Name})
+	}
+
+	return infos, nil
+}
+
+func (s *Server) history(p HistoryParams) ([]MessageInfo, *Error) {
+	// Only the chats of the logged in users are readable
+	s.mu.Lock()
+	users := make([]*core.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	s.mu.Unlock()
+
+	member := false
+	for _, user := range users {
+		chats, err := s.chatManager.GetChatsByUserId(user.Id)
+		if err != nil {
+			return nil, newError(CodeInternalError, "failed to get chats: %v", err)
+		}
+		for _, chat := range chats {
+			member = member || chat.Id == p.Chat
+		}
+	}
+	if !member {
+		return nil, newError(CodeFailed, "chat %q not found", p.Chat)
+	}
+
+	messages, err := s.chatManager.GetChatMessagesByChatId(p.Chat)
+	if err != nil {
+		return nil, newError(CodeInternalError, "failed to get messages: %v", err)
+	}
+
+	infos := make([]MessageInfo, 0, len(messages))
+	for _, message := range messages {
+		infos = append(infos, MessageInfo{message.Member, message.Text, message.At})
+	}
+
+	return infos, nil
+}
+
+// send emits the message from the user and waits until it's sent or has failed
+func (s *Server) send(ctx context.Context, p SendParams) (*SendResult, *Error) {
+	if p.To == "" || p.Text == "" {
+		return nil, newError(CodeInvalidParams, "to and text are required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	// The id tells the outcome of this send from the concurrent ones to the same peer
+	request := core.SendMessageEvent{PeerUserId: p.To, Text: p.Text, MessageId: uuid.NewString()}
+	outcome := s.bus.Subscribe(ctx, core.AnyOf(
+		core.Where(func(e services.MessageSent) bool {
+			return e.MessageId == request.MessageId
+		}),
+		core.Where(func(e core.CommandFailed) bool {
+			return e.Event == request
+		}),
+	))
+
+	// The messages are sent from the active user
+	if rpcErr := s.emitAs(p.From, request); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	e, err := outcome.Next(ctx)
+	if err != nil {
+		return nil, newError(CodeFailed, "message wasn't sent in time")
+	}
+
+	switch e := e.(type) {
+	case services.MessageSent:
+		return &SendResult{e.MessageId, e.Delivered, e.Undelivered}, nil
+	case core.CommandFailed:
+		return nil, newError(CodeFailed, "failed to send message: %v", e.Err)
+	default:
+		return nil, newError(CodeInternalError, "unexpected event %T", e)
+	}
+}
+
+// emitAs makes the logged in user the active one and emits the event for it
+func (s *Server) emitAs(nameOrId string, e core.Event) *Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, rpcErr := s.loggedInUser(nameOrId)
+	if rpcErr != nil {
+		return rpcErr
+	}
+
+	if user.UniqueId != s.activeUserId {
+		s.activeUserId = user.UniqueId
+		s.bus.Emit(core.SwitchUserEvent{User: user})
+	}
+	s.bus.Emit(e)
+
+	return nil
+}
+
+func (s *Server) connect(ctx context.Context, p ConnectParams) (*ConnectResult, *Error) {
+	if p.Host == "" || p.Port == "" {
+		return nil, newError(CodeInvalidParams, "host and port are required")
+	}
+
+	request := core.ConnectEvent{Host: p.Host, Port: p.Port, PeerUserId: p.Peer}
+
+	return s.awaitConnection(ctx, p.From, request, net.JoinHostPort(p.Host, p.Port))
+}
+
+func (s *Server) join(ctx context.Context, p JoinParams) (*ConnectResult, *Error) {
+	invite, err := services.ParseInviteLink(p.Uri)
+	if err != nil {
+		return nil, newError(CodeInvalidParams, "invalid invite: %v", err)
+	}
+
+	return s.awaitConnection(ctx, p.From, core.JoinEvent{URI: p.Uri}, invite.Address)
+}
+
+// awaitConnection emits the request for the user and waits until the handshake
+// of the connection to the address is done or has failed
+func (s *Server) awaitConnection(ctx context.Context, from string, request core.Event, address string) (*ConnectResult, *Error) {
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	outcome := s.bus.Subscribe(ctx, core.AnyOf(
+		core.Where(func(e services.ConnectionStarted) bool {
+			return e.Address == address
+		}),
+		core.OfType[services.ConnectionEstablished](),
+		core.OfType[services.ConnectionClosed](),
+		core.Where(func(e core.CommandFailed) bool {
+			return e.Event == request
+		}),
+	))
+
+	if rpcErr := s.emitAs(from, request); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	// The handshake may finish before the start of the connection is reported
+	connId := ""
+	finished := make(map[string]core.Event)
+	for {
+		e, err := outcome.Next(ctx)
+		if err != nil {
+			return nil, newError(CodeFailed, "connection wasn't established in time")
+		}
+
+		switch e := e.(type) {
+		case services.ConnectionStarted:
+			if connId == "" {
+				connId = e.Id
+			}
+		case services.ConnectionEstablished:
+			finished[e.Id] = e
+		case services.ConnectionClosed:
+			if _, ok := finished[e.Id]; !ok {
+				finished[e.Id] = e
+			}
+		case core.CommandFailed:
+			return nil, newError(CodeFailed, "failed to connect: %v", e.Err)
+		}
+
+		if connId == "" {
+			continue
+		}
+		switch e := finished[connId].(type) {
+		case services.ConnectionEstablished:
+			return &ConnectResult{e.Id, e.PeerUserId}, nil
+		case services.ConnectionClosed:
+			return nil, newError(CodeFailed, "connection %s failed during the handshake", connId)
+		}
+	}
+}
+
+func (s *Server) resolve(ctx context.Context, p ResolveParams) *Error {
+	if p.RequestId == "" {
+		return newError(CodeInvalidParams, "requestId is required")
+	}
+
+	request := core.ConnectionRequestDecisionEvent{RequestId: p.RequestId, Accept: p.Accept}
+
+	return s.awaitCommand(ctx, request, core.Where(func(e services.ConnectionRequestResolved) bool {
+		return e.RequestId == p.RequestId
+	}), func() *Error {
+		s.bus.Emit(request)
+
+		return nil
+	})
+}
+
+func (s *Server) policy(ctx context.Context, p PolicyParams) *Error {
+	if !core.IsValidPeerPolicy(p.Policy) {
+		return newError(CodeInvalidParams, "unknown peer policy %q", p.Policy)
+	}
+
+	request := core.SetPeerPolicyEvent{Policy: p.Policy}
+
+	return s.awaitCommand(ctx, request, core.Where(func(e services.PeerPolicyChanged) bool {
+		return e.Policy == p.Policy
+	}), func() *Error {
+		// The policy of the active user is changed
+		return s.emitAs(p.User, request)
+	})
+}
+
+// awaitCommand emits the request and waits for the event of its success or for its failure
+func (s *Server) awaitCommand(ctx context.Context, request core.Event, succeeded core.EventFilter, emit func() *Error) *Error {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	outcome := s.bus.Subscribe(ctx, core.AnyOf(
+		succeeded,
+		core.Where(func(e core.CommandFailed) bool {
+			return e.Event == request
+		}),
+	))
+
+	if rpcErr := emit(); rpcErr != nil {
+		return rpcErr
+	}
+
+	e, err := outcome.Next(ctx)
+	if err != nil {
+		return newError(CodeFailed, "request wasn't done in time")
+	}
+	if failed, ok := e.(core.CommandFailed); ok {
+		return newError(CodeFailed, "%v", failed.Err)
+	}
+
+	return nil
+}
+
+// session is a connection to the control API
+type session struct {
+	server *Server
+	conn   net.Conn
+	name   string
+
+	writeMu sync.Mutex
+
+	mu sync.Mutex
+	// Stops the event notifications
+	stopEvents context.CancelFunc
+}
+
+func newSession(server *Server, conn net.Conn, name string) *session {
+	return &session{
+		server,
+		conn,
+		name,
+		sync.Mutex{},
+		sync.Mutex{},
+		nil,
+	}
+}
+
+// serve handles the requests until the connection is closed, each request on its own
+// goroutine so a send waiting for the network doesn't hold the others
+func (sess *session) serve(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer sess.close()
+
+	calls := sync.WaitGroup{}
+	defer calls.Wait()
+
+	scanner := bufio.NewScanner(sess.conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
+	for scanner.Scan() {
+		var request Request
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			sess.respond(nil, nil, newError(CodeParseError, "parse error: %v", err))
+
+			continue
+		}
+		if request.JsonRpc != jsonRpcVersion || request.Method == "" {
+			sess.respond(request.Id, nil, newError(CodeInvalidRequest, "invalid request"))
+
+			continue
+		}
+
+		calls.Add(1)
+		go func() {
+			defer calls.Done()
+
+			result, err := sess.server.call(ctx, sess, request.Method, request.Params)
+			// Notifications aren't answered
+			if request.Id != nil {
+				sess.respond(request.Id, result, err)
+			}
+		}()
+	}
+}
+
+func (sess *session) respond(id json.RawMessage, result any, rpcErr *Error) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+
+	response := Response{JsonRpc: jsonRpcVersion, Id: id}
+	if rpcErr != nil {
+		response.Error = rpcErr
+	} else {
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			response.Error = newError(CodeInternalError, "failed to encode result: %v", err)
+		} else {
+			response.Result = encoded
+		}
+	}
+
+	sess.write(response)
+}
+
+func (sess *session) notify(method string, params any) {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		log.Warnf("Failed to encode %s notification: %v", method, err)
+
+		return
+	}
+
+	sess.write(Notification{jsonRpcVersion, method, encoded})
+}
+
+func (sess *session) write(v any) {
+	line, err := json.Marshal(v)
+	if err != nil {
+		log.Warnf("Failed to encode control API message: %v", err)
+
+		return
+	}
+
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+
+	// A client which has gone away is noticed by the reader
+	sess.conn.Write(append(line, '\n'))
+}
+
+// subscribe sends the events of the types to the client, replacing the previous subscription
+func (sess *session) subscribe(ctx context.Context, types []string) {
+	sess.unsubscribe()
+
+	ctx, cancel := context.WithCancel(ctx)
+	sess.mu.Lock()
+	sess.stopEvents = cancel
+	sess.mu.Unlock()
+
+	var filter core.EventFilter
+	if len(types) > 0 {
+		filter = func(e core.Event) bool {
+			eventType := journal.EventType(e)
+			for _, t := range types {
+				if t == eventType {
+					return true
+				}
+			}
+
+			return false
+		}
+	}
+
+	// A slow client loses its oldest events rather than holding the application
+	listener := sess.server.bus.SubscribeWith(ctx, core.ListenerOptions{
+		Name:   sess.name,
+		Filter: filter,
+		Policy: core.DropOldest,
+	})
+
+	go func() {
+		for e := range listener {
+			entry, err := journal.NewEntry(time.Now(), e)
+			if err != nil {
+				log.Warnf("Failed to serialize event %T for the control API: %v", e, err)
+
+				continue
+			}
+			sess.notify(NotificationEvent, entry)
+		}
+	}()
+}
+
+func (sess *session) unsubscribe() {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.stopEvents != nil {
+		sess.stopEvents()
+		sess.stopEvents = nil
+	}
+}
+
+func (sess *session) close() {
+	sess.unsubscribe()
+	sess.conn.Close()
+}
@@ -0,0 +1,310 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/services"
+	"github.com/stretchr/testify/mock"
+)
+
+// startTestServer runs the control API of a user "alice" with the password "secret" and one chat
+func startTestServer(t *testing.T) (*Server, *core.EventManager, string) {
+	hash, err := core.HashPassword("secret")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	alice := &core.User{BaseEntity: core.BaseEntity{Id: 1}, UniqueId: "alice-id", Name: "alice", Password: hash}
+
+	em := core.NewEventManager(10)
+
+	userRepo := core.NewMockRepository[core.User](t)
+	userRepo.On("GetAll").Return([]*core.User{alice}, nil).Maybe()
+	userRepo.On("Update", mock.Anything).Return(nil).Maybe()
+	userRepo.On("GetOne", 1).Return(alice, nil).Maybe()
+
+	general := &core.Channel{BaseEntity: core.BaseEntity{Id: 10}, UniqueId: "general-id", Name: "general"}
+	channelRepo := core.NewMockRepository[core.Channel](t)
+	channelRepo.On("GetOne", 10).Return(general, nil).Maybe()
+	channelRepo.On("GetOneBy", "unique_id", mock.Anything).Return(general, nil).Maybe()
+
+	attendanceRepo := core.NewMockRepository[core.Attendance](t)
+	attendanceRepo.On("GetAllBy", "user_id", 1).
+		Return([]*core.Attendance{{UserId: 1, ChannelId: 10}}, nil).Maybe()
+
+	messageRepo := core.NewMockRepository[core.Message](t)
+	messageRepo.On("GetAllBy", "channel_id", 10).
+		Return([]*core.Message{{UserId: 1, ChannelId: 10, Text: "hello", CreatedAt: time.Now()}}, nil).Maybe()
+
+	userManager := services.NewUserManager(em, userRepo)
+	chatManager := services.NewChatManager(userManager, channelRepo, attendanceRepo, messageRepo)
+
+	path := filepath.Join(t.TempDir(), "gotchat.sock")
+	server := NewServer(em, path, userManager, chatManager)
+	if err := server.Init(); err != nil {
+		t.Fatalf("failed to init the server: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	go server.Run(ctx, wg)
+
+	t.Cleanup(func() {
+		cancel()
+		server.Close()
+		wg.Wait()
+	})
+
+	return server, em, path
+}
+
+func dialTestServer(t *testing.T, path string) *Client {
+	client, err := Dial(path)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+	})
+
+	return client
+}
+
+func expectCode(t *testing.T, err error, code int) {
+	t.Helper()
+
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != code {
+		t.Errorf("expected error code %d, got %v", code, err)
+	}
+}
+
+func TestServer_Login(t *testing.T) {
+	_, _, path := startTestServer(t)
+	client := dialTestServer(t, path)
+	ctx := context.Background()
+
+	// Nothing is readable before logging in
+	expectCode(t, client.Call(ctx, MethodChats, nil, nil), CodeFailed)
+	expectCode(t, client.Call(ctx, MethodLogin, LoginParams{"alice", "wrong"}, nil), CodeFailed)
+	expectCode(t, client.Call(ctx, MethodLogin, LoginParams{"bob", "secret"}, nil), CodeFailed)
+
+	var user UserInfo
+	if err := client.Call(ctx, MethodLogin, LoginParams{"alice", "secret"}, &user); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if user != (UserInfo{"alice-id", "alice", true}) {
+		t.Errorf("expected alice to be logged in, got %v", user)
+	}
+
+	var users []UserInfo
+	if err := client.Call(ctx, MethodUsers, nil, &users); err != nil || len(users) != 1 || !users[0].LoggedIn {
+		t.Errorf("expected alice logged in, got %v (%v)", users, err)
+	}
+
+	var chats []ChatInfo
+	if err := client.Call(ctx, MethodChats, nil, &chats); err != nil || len(chats) != 1 || chats[0].Name != "general" {
+		t.Errorf("expected the general chat, got %v (%v)", chats, err)
+	}
+
+	var history []MessageInfo
+	if err := client.Call(ctx, MethodHistory, HistoryParams{"general-id"}, &history); err != nil || len(history) != 1 || history[0].Text != "hello" {
+		t.Errorf("expected the history of the chat, got %v (%v)", history, err)
+	}
+	expectCode(t, client.Call(ctx, MethodHistory, HistoryParams{"other-id"}, nil), CodeFailed)
+
+	if err := client.Call(ctx, MethodLogout, UserParams{"alice"}, nil); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	expectCode(t, client.Call(ctx, MethodChats, nil, nil), CodeFailed)
+}
+
+func TestServer_Send(t *testing.T) {
+	_, em, path := startTestServer(t)
+	client := dialTestServer(t, path)
+	ctx := context.Background()
+
+	expectCode(t, client.Call(ctx, MethodSend, SendParams{To: "bob-id", Text: "hi"}, nil), CodeFailed)
+	if err := client.Call(ctx, MethodLogin, LoginParams{"alice-id", "secret"}, nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// The services send to bob after another send to bob, and fail to send to carol
+	sendCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	requests := core.SubscribeTo[core.SendMessageEvent](sendCtx, em)
+	sent := make(chan string, 1)
+	go func() {
+		for request := range requests {
+			if request.PeerUserId == "bob-id" {
+				sent <- request.MessageId
+				em.Emit(services.MessageSent{MessageId: "other-message", PeerUserId: "bob-id", Delivered: 1})
+				em.Emit(services.MessageSent{MessageId: request.MessageId, PeerUserId: "bob-id", Delivered: 2})
+
+				continue
+			}
+			em.Emit(core.CommandFailed{Command: "SendMessage", Event: request, Err: services.ErrPeerNotConnected})
+		}
+	}()
+
+	var result SendResult
+	if err := client.Call(ctx, MethodSend, SendParams{To: "bob-id", Text: "hi"}, &result); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	messageId := <-sent
+	if messageId == "" || result.MessageId != messageId || result.Delivered != 2 {
+		t.Errorf("expected the message %q to be delivered, got %v", messageId, result)
+	}
+
+	expectCode(t, client.Call(ctx, MethodSend, SendParams{To: "carol-id", Text: "hi"}, nil), CodeFailed)
+	expectCode(t, client.Call(ctx, MethodSend, SendParams{To: "bob-id", Text: "hi", From: "carol"}, nil), CodeFailed)
+	expectCode(t, client.Call(ctx, MethodSend, SendParams{To: "bob-id"}, nil), CodeInvalidParams)
+}
+
+func TestServer_Connect(t *testing.T) {
+	_, em, path := startTestServer(t)
+	client := dialTestServer(t, path)
+	ctx := context.Background()
+
+	if err := client.Call(ctx, MethodLogin, LoginParams{"alice", "secret"}, nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// The services finish the handshake with bob before reporting the start, and fail to dial carol
+	servicesCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	connects := core.SubscribeTo[core.ConnectEvent](servicesCtx, em)
+	go func() {
+		for request := range connects {
+			if request.Host == "10.0.0.2" {
+				em.Emit(services.ConnectionEstablished{Id: "conn-1", PeerUserId: "bob-id"})
+				em.Emit(services.ConnectionStarted{Id: "conn-1", Address: "10.0.0.2:7665", PeerUserId: request.PeerUserId})
+
+				continue
+			}
+			em.Emit(core.CommandFailed{Command: "services.Connect", Event: request, Err: errors.New("connection refused")})
+		}
+	}()
+
+	var result ConnectResult
+	if err := client.Call(ctx, MethodConnect, ConnectParams{Host: "10.0.0.2", Port: "7665"}, &result); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result != (ConnectResult{"conn-1", "bob-id"}) {
+		t.Errorf("expected the connection to bob, got %v", result)
+	}
+
+	expectCode(t, client.Call(ctx, MethodConnect, ConnectParams{Host: "10.0.0.3", Port: "7665"}, nil), CodeFailed)
+	expectCode(t, client.Call(ctx, MethodConnect, ConnectParams{Host: "10.0.0.3"}, nil), CodeInvalidParams)
+	expectCode(t, client.Call(ctx, MethodJoin, JoinParams{Uri: "https://example.com"}, nil), CodeInvalidParams)
+}
+
+func TestServer_ResolveAndPolicy(t *testing.T) {
+	_, em, path := startTestServer(t)
+	client := dialTestServer(t, path)
+	ctx := context.Background()
+
+	servicesCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	decisions := core.SubscribeTo[core.ConnectionRequestDecisionEvent](servicesCtx, em)
+	policies := core.SubscribeTo[core.SetPeerPolicyEvent](servicesCtx, em)
+	go func() {
+		for {
+			select {
+			case request := <-decisions:
+				if request.RequestId == "r1" {
+					em.Emit(services.ConnectionRequestResolved{RequestId: "r1", Accept: request.Accept})
+
+					continue
+				}
+				em.Emit(core.CommandFailed{Command: "services.ResolveConnectionRequest", Event: request, Err: errors.New("not found")})
+			case request := <-policies:
+				em.Emit(services.PeerPolicyChanged{OwnerUniqueId: "alice-id", Policy: request.Policy})
+			case <-servicesCtx.Done():
+				return
+			}
+		}
+	}()
+
+	if err := client.Call(ctx, MethodResolve, ResolveParams{"r1", true}, nil); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	expectCode(t, client.Call(ctx, MethodResolve, ResolveParams{"r2", true}, nil), CodeFailed)
+
+	// The policy belongs to a logged in user
+	expectCode(t, client.Call(ctx, MethodPolicy, PolicyParams{Policy: core.PeerPolicyAnyone}, nil), CodeFailed)
+	if err := client.Call(ctx, MethodLogin, LoginParams{"alice", "secret"}, nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.Call(ctx, MethodPolicy, PolicyParams{Policy: core.PeerPolicyAnyone}, nil); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	expectCode(t, client.Call(ctx, MethodPolicy, PolicyParams{Policy: "everyone"}, nil), CodeInvalidParams)
+}
+
+func TestServer_SocketPermissions(t *testing.T) {
+	_, _, path := startTestServer(t)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("expected the socket, got %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		t.Errorf("expected the socket to be accessible to the owner only, got %v", info.Mode().Perm())
+	}
+
+	// The private directory the socket was created in is gone
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("failed to read the socket directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the socket next to it, got %d entries", len(entries))
+	}
+}
+
+func TestServer_Subscribe(t *testing.T) {
+	_, em, path := startTestServer(t)
+	client := dialTestServer(t, path)
+	ctx := context.Background()
+
+	listeners := len(em.Metrics().Listeners)
+	if err := client.Call(ctx, MethodSubscribe, SubscribeParams{[]string{"services.PeerLeft"}}, nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for len(em.Metrics().Listeners) == listeners {
+		time.Sleep(time.Millisecond)
+	}
+
+	em.Emit(services.ConnectionClosed{Id: "1"})
+	em.Emit(services.PeerLeft{ConnId: "1", PeerUserId: "bob-id", Reason: "closed"})
+
+	select {
+	case entry := <-client.Events():
+		if entry.Type != "services.PeerLeft" {
+			t.Errorf("expected only the subscribed events, got %s", entry.Type)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the event notification")
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	server, em, path := startTestServer(t)
+	client := dialTestServer(t, path)
+
+	expectCode(t, client.Call(context.Background(), "reboot", nil, nil), CodeMethodNotFound)
+
+	// Only one daemon listens on the socket
+	other := NewServer(em, path, server.userManager, server.chatManager)
+	if err := other.Init(); !errors.Is(err, ErrDaemonRunning) {
+		t.Errorf("expected ErrDaemonRunning, got %v", err)
+	}
+}
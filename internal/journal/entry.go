@@ -0,0 +1,148 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+)
+
+// Placeholder of the redacted values
+const redacted = "[redacted]"
+
+// Values nested deeper are cut, the events may reference connections with cycles
+const maxDepth = 6
+
+// Parts of the field names whose values are never recorded
+var secretFields = []string{"password", "secret", "token", "key", "salt", "signature"}
+
+// Redactor is implemented by the events keeping secrets in values that the field names don't reveal
+type Redactor interface {
+	Redact() core.Event
+}
+
+// Entry is an event recorded in the journal
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Type of the event as package.Name, e.g. services.PeerLeft
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// NewEntry serializes the event with its secrets redacted
+func NewEntry(at time.Time, e core.Event) (Entry, error) {
+	eventType := EventType(e)
+	if r, ok := e.(Redactor); ok {
+		e = r.Redact()
+	}
+
+	payload, err := json.Marshal(encodeValue(reflect.ValueOf(e), 0))
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return Entry{at, eventType, payload}, nil
+}
+
+func (e Entry) String() string {
+	return fmt.Sprintf("%s %s %s", e.Time.Format("2006-01-02 15:04:05.000"), e.Type, e.Payload)
+}
+
+// EventType names the type of the event as package.Name, e.g. services.PeerLeft
+func EventType(e core.Event) string {
+	return fmt.Sprintf("%T", e)
+}
+
+func isSecretField(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range secretFields {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encodeValue converts the value to what json encodes without failing:
+// errors become their messages, channels and functions are left out
+func encodeValue(v reflect.Value, depth int) any {
+	if !v.IsValid() {
+		return nil
+	}
+	if depth > maxDepth {
+		return "..."
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return nil
+	}
+
+	if v.CanInterface() {
+		switch value := v.Interface().(type) {
+		case time.Time:
+			return value.Format(time.RFC3339Nano)
+		case error:
+			return value.Error()
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return encodeValue(v.Elem(), depth+1)
+	case reflect.Struct:
+		fields := make(map[string]any, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if isSecretField(field.Name) {
+				fields[field.Name] = redacted
+
+				continue
+			}
+
+			kind := field.Type.Kind()
+			if kind == reflect.Chan || kind == reflect.Func || kind == reflect.UnsafePointer {
+				continue
+			}
+			fields[field.Name] = encodeValue(v.Field(i), depth+1)
+		}
+
+		return fields
+	case reflect.Slice, reflect.Array:
+		// Raw bytes are keys and ciphertexts more often than not
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("<%d bytes>", v.Len())
+		}
+
+		items := make([]any, v.Len())
+		for i := range items {
+			items[i] = encodeValue(v.Index(i), depth+1)
+		}
+
+		return items
+	case reflect.Map:
+		items := make(map[string]any, v.Len())
+		for it := v.MapRange(); it.Next(); {
+			items[fmt.Sprint(it.Key())] = encodeValue(it.Value(), depth+1)
+		}
+
+		return items
+	default:
+		if !v.CanInterface() {
+			return nil
+		}
+
+		return v.Interface()
+	}
+}
@@ -0,0 +1,184 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// Default size after which the journal file is rotated
+	DefaultMaxSize = 10 << 20
+	// Default number of the rotated files kept next to the journal file
+	DefaultMaxFiles = 5
+)
+
+var ErrJournalClosed = errors.New("journal is closed")
+
+// File is a journal file of one entry per line, rotated when it grows over the size limit.
+// The rotated files are kept as path.1 (the newest) to path.N, the older ones are removed.
+type File struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenFile opens the journal file for appending, it creates the file and its directory
+func OpenFile(path string, maxSize int64, maxFiles int) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	f := &File{
+		path,
+		maxSize,
+		maxFiles,
+		sync.Mutex{},
+		nil,
+		0,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Append writes the entry, it rotates the file first if the entry doesn't fit
+func (f *File) Append(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return ErrJournalClosed
+	}
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(line)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return fmt.Errorf("failed to rotate journal: %w", err)
+		}
+	}
+
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+
+	return err
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+
+	return nil
+}
+
+// rotate shifts the rotated files by one and starts a new journal file
+// Note: f.mu must be held by the caller
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	if f.maxFiles > 0 {
+		os.Remove(rotatedPath(f.path, f.maxFiles))
+		for i := f.maxFiles - 1; i > 0; i-- {
+			os.Rename(rotatedPath(f.path, i), rotatedPath(f.path, i+1))
+		}
+		if err := os.Rename(f.path, rotatedPath(f.path, 1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return err
+	}
+
+	return f.open()
+}
+
+func rotatedPath(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// files returns the existing journal files from the oldest to the newest
+func files(path string) []string {
+	var rotated []string
+	for i := 1; ; i++ {
+		if _, err := os.Stat(rotatedPath(path, i)); err != nil {
+			break
+		}
+		rotated = append(rotated, rotatedPath(path, i))
+	}
+
+	paths := make([]string, 0, len(rotated)+1)
+	for i := len(rotated) - 1; i >= 0; i-- {
+		paths = append(paths, rotated[i])
+	}
+	if _, err := os.Stat(path); err == nil {
+		paths = append(paths, path)
+	}
+
+	return paths
+}
+
+// readFile decodes the entries of the file, the lines which can't be decoded are skipped
+func readFile(path string, visit func(Entry)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// Entries with a large payload don't fit the default buffer
+	scanner.Buffer(make([]byte, 0, 64*1024), DefaultMaxSize)
+
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		visit(e)
+	}
+
+	return scanner.Err()
+}
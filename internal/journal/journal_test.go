@@ -0,0 +1,322 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hop-/gotchat/internal/app"
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/services"
+	"github.com/hop-/gotchat/internal/ui"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNewEntry_Redacted(t *testing.T) {
+	user := &core.User{UniqueId: "alice-id", Name: "alice", Password: "hunter2"}
+
+	entry, err := NewEntry(time.Now(), core.UserCreatedEvent{User: user})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if entry.Type != "core.UserCreatedEvent" {
+		t.Errorf("expected type core.UserCreatedEvent, got %s", entry.Type)
+	}
+	if strings.Contains(string(entry.Payload), "hunter2") {
+		t.Errorf("expected the password to be redacted, got %s", entry.Payload)
+	}
+	if !strings.Contains(string(entry.Payload), `"alice-id"`) {
+		t.Errorf("expected the user id to be recorded, got %s", entry.Payload)
+	}
+}
+
+func TestNewEntry_RedactedInvite(t *testing.T) {
+	link := &services.InviteLink{Address: "10.0.0.1:7665", UserId: "alice-id", InviteId: "invite-id", Secret: []byte("invite-secret"), ExpiresAt: time.Now()}
+	uri := link.URI()
+
+	entry, err := NewEntry(time.Now(), core.JoinEvent{URI: uri})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	u, _ := url.Parse(uri)
+	secret := u.Query().Get("secret")
+	if strings.Contains(string(entry.Payload), secret) {
+		t.Errorf("expected the invite secret to be redacted, got %s", entry.Payload)
+	}
+	if entry.Type != "core.JoinEvent" || !strings.Contains(string(entry.Payload), "invite-id") {
+		t.Errorf("expected the rest of the invite to be recorded, got %s %s", entry.Type, entry.Payload)
+	}
+}
+
+func TestNewEntry_Unserializable(t *testing.T) {
+	// A value with channels and functions is recorded without them
+	type withChannel struct {
+		Name   string
+		Events chan core.Event
+		OnDone func()
+	}
+
+	entry, err := NewEntry(time.Now(), services.ConnectionFailed{Err: errors.New("refused")})
+	if err != nil || string(entry.Payload) != `{"Err":"refused"}` {
+		t.Errorf("expected the error message, got %s (%v)", entry.Payload, err)
+	}
+
+	entry, err = NewEntry(time.Now(), withChannel{"test", make(chan core.Event), func() {}})
+	if err != nil || string(entry.Payload) != `{"Name":"test"}` {
+		t.Errorf("expected the channel and the function to be left out, got %s (%v)", entry.Payload, err)
+	}
+}
+
+func TestFile_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	file, err := OpenFile(path, 200, 2)
+	if err != nil {
+		t.Fatalf("failed to open the journal: %v", err)
+	}
+
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i := range 20 {
+		entry, _ := NewEntry(start.Add(time.Duration(i)*time.Second), services.ConnectionClosed{Id: "conn"})
+		if err := file.Append(entry); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	file.Close()
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 rotated files to be kept")
+	}
+
+	entries, err := Read(path, Filter{})
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if len(entries) == 0 || len(entries) >= 20 {
+		t.Fatalf("expected the oldest entries to be rotated out, got %d", len(entries))
+	}
+	for i := 1; i < len(entries); i++ {
+		if !entries[i].Time.After(entries[i-1].Time) {
+			t.Errorf("expected the entries from the oldest to the newest, got %v after %v", entries[i].Time, entries[i-1].Time)
+		}
+	}
+	if last := entries[len(entries)-1].Time; !last.Equal(start.Add(19 * time.Second)) {
+		t.Errorf("expected the newest entry last, got %v", last)
+	}
+}
+
+func TestRead_Filter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	file, err := OpenFile(path, DefaultMaxSize, DefaultMaxFiles)
+	if err != nil {
+		t.Fatalf("failed to open the journal: %v", err)
+	}
+
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	events := []core.Event{
+		services.PeerLeft{ConnId: "1", PeerUserId: "bob"},
+		services.ConnectionClosed{Id: "1"},
+		services.PeerLeft{ConnId: "2", PeerUserId: "carol"},
+		core.QuitEvent{},
+	}
+	for i, e := range events {
+		entry, _ := NewEntry(start.Add(time.Duration(i)*time.Minute), e)
+		file.Append(entry)
+	}
+	file.Close()
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{"all", Filter{}, 4},
+		{"type", Filter{Types: []string{"peerleft"}}, 2},
+		{"types", Filter{Types: []string{"services.PeerLeft", "core.QuitEvent"}}, 3},
+		{"since", Filter{Since: start.Add(time.Minute)}, 3},
+		{"until", Filter{Until: start.Add(time.Minute)}, 1},
+		{"contains", Filter{Contains: "carol"}, 1},
+		{"last", Filter{Types: []string{"PeerLeft"}, Last: 1}, 1},
+	}
+
+	for _, tt := range tests {
+		entries, err := Read(path, tt.filter)
+		if err != nil {
+			t.Fatalf("%s: failed to read: %v", tt.name, err)
+		}
+		if len(entries) != tt.want {
+			t.Errorf("%s: expected %d entries, got %d", tt.name, tt.want, len(entries))
+		}
+	}
+
+	entries, _ := Read(path, Filter{Types: []string{"PeerLeft"}, Last: 1})
+	if len(entries) == 1 && !strings.Contains(string(entries[0].Payload), "carol") {
+		t.Errorf("expected the last entry, got %s", entries[0].Payload)
+	}
+
+	if _, err := Read(filepath.Join(t.TempDir(), "missing.jsonl"), Filter{}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestRegistry_Decode(t *testing.T) {
+	registry := DefaultRegistry()
+
+	original := services.AbuseViolation{Host: "10.0.0.2", Err: errors.New("too many connections")}
+	entry, _ := NewEntry(time.Now(), original)
+
+	e, err := registry.Decode(entry)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	decoded, ok := e.(services.AbuseViolation)
+	if !ok || decoded.Host != original.Host || decoded.Err == nil || decoded.Err.Error() != original.Err.Error() {
+		t.Errorf("expected %v, got %v", original, e)
+	}
+
+	// The connection can't be restored, the rest of the event is
+	entry, _ = NewEntry(time.Now(), services.ConnectionEstablished{Id: "1", PeerUserId: "bob"})
+	if e, err := registry.Decode(entry); err != nil || e.(services.ConnectionEstablished).PeerUserId != "bob" {
+		t.Errorf("expected the event without the connection, got %v (%v)", e, err)
+	}
+
+	entry.Type = "plugins.Unknown"
+	if _, err := registry.Decode(entry); !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("expected ErrUnknownEvent, got %v", err)
+	}
+}
+
+// eventService collects the events the app maps to the services
+type eventService struct {
+	running chan struct{}
+	events  chan core.Event
+}
+
+func (s *eventService) Init() error {
+	return nil
+}
+
+func (s *eventService) Run(ctx context.Context, wg *sync.WaitGroup) {
+	close(s.running)
+}
+
+func (s *eventService) MapEventToCommands(event core.Event) []core.Command {
+	s.events <- event
+
+	return nil
+}
+
+func (s *eventService) Close() error {
+	return nil
+}
+
+func (s *eventService) Name() string {
+	return "Events"
+}
+
+func TestRecorderAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	// Record the events of one event manager
+	em := core.NewEventManager(10)
+	recorder := NewRecorder(em, path, DefaultMaxSize, DefaultMaxFiles)
+	if err := recorder.Init(); err != nil {
+		t.Fatalf("failed to init the recorder: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	go recorder.Run(ctx, wg)
+
+	recorded := []core.Event{
+		core.ConnectEvent{Host: "10.0.0.2", Port: "7665"},
+		services.PeerLeft{ConnId: "1", PeerUserId: "bob", Reason: "closed"},
+		core.QuitEvent{},
+	}
+
+	// Wait for the recorder to subscribe
+	for len(em.Metrics().Listeners) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for _, e := range recorded {
+		em.Emit(e)
+	}
+
+	for {
+		entries, _ := Read(path, Filter{})
+		if len(entries) == len(recorded) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+	recorder.Close()
+
+	// Replay them into a test app
+	service := &eventService{make(chan struct{}), make(chan core.Event, 100)}
+	mockUI := ui.NewMockUI(t)
+	mockUI.On("Run", mock.Anything, mock.Anything).Return(nil)
+	mockUI.On("Close").Return(nil)
+
+	builder := app.NewBuilder().WithEventDispatcher(10).WithUI(mockUI).WithService(service)
+	application := builder.Build()
+	if err := application.Init(); err != nil {
+		t.Fatalf("failed to init the app: %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- application.Run()
+	}()
+	<-service.running
+
+	entries, err := Read(path, Filter{})
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if n, err := Replay(context.Background(), builder.GetEventManager(), DefaultRegistry(), entries); err != nil || n != len(recorded) {
+		t.Fatalf("expected %d events to be replayed, got %d (%v)", len(recorded), n, err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected the app to stop, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the replayed QuitEvent to stop the app")
+	}
+
+	// The app emits the states of the services meanwhile
+	var replayed []core.Event
+	for len(service.events) > 0 {
+		if e := <-service.events; !isServiceState(e) {
+			replayed = append(replayed, e)
+		}
+	}
+	if len(replayed) != len(recorded) {
+		t.Fatalf("expected %d events, got %v", len(recorded), replayed)
+	}
+	for i, want := range recorded {
+		if replayed[i] != want {
+			t.Errorf("expected %v, got %v", want, replayed[i])
+		}
+	}
+}
+
+func isServiceState(e core.Event) bool {
+	_, ok := e.(core.ServiceStateChanged)
+
+	return ok
+}
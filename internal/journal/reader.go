@@ -0,0 +1,75 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Filter selects the entries read from the journal, the zero filter selects all
+type Filter struct {
+	// Types matched case-insensitively as parts of the event type, e.g. "peer" or "services.PeerLeft"
+	Types []string
+	// Entries recorded at or after the time
+	Since time.Time
+	// Entries recorded before the time
+	Until time.Time
+	// Text the payload contains
+	Contains string
+	// Only the last entries, zero returns all
+	Last int
+}
+
+func (f Filter) matches(e Entry) bool {
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	if f.Contains != "" && !strings.Contains(string(e.Payload), f.Contains) {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+
+	eventType := strings.ToLower(e.Type)
+	for _, t := range f.Types {
+		if strings.Contains(eventType, strings.ToLower(t)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Read returns the entries of the journal file and of its rotated files which match the filter,
+// from the oldest to the newest
+func Read(path string, filter Filter) ([]Entry, error) {
+	paths := files(path)
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no journal at %s: %w", path, os.ErrNotExist)
+	}
+
+	var entries []Entry
+	for _, p := range paths {
+		err := readFile(p, func(e Entry) {
+			if !filter.matches(e) {
+				return
+			}
+
+			entries = append(entries, e)
+			// The older ones are dropped as the newer ones come
+			if filter.Last > 0 && len(entries) > filter.Last {
+				entries = entries[1:]
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,99 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/pkg/log"
+)
+
+// Recorder records every event of the event manager in the journal file
+type Recorder struct {
+	subscriber core.EventSubscriber
+	path       string
+	maxSize    int64
+	maxFiles   int
+
+	file *File
+}
+
+func NewRecorder(subscriber core.EventSubscriber, path string, maxSize int64, maxFiles int) *Recorder {
+	return &Recorder{
+		subscriber,
+		path,
+		maxSize,
+		maxFiles,
+		nil,
+	}
+}
+
+// Init implements core.Service.
+func (r *Recorder) Init() error {
+	file, err := OpenFile(r.path, r.maxSize, r.maxFiles)
+	if err != nil {
+		return err
+	}
+	r.file = file
+
+	return nil
+}
+
+// Run implements core.Service.
+func (r *Recorder) Run(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	// Nothing is dropped, a slow disk only delays the records
+	listener := r.subscriber.SubscribeWith(ctx, core.ListenerOptions{
+		Name:   "journal",
+		Policy: core.Unbounded,
+	})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-listener:
+			if !ok {
+				return
+			}
+			r.record(e)
+		}
+	}
+}
+
+// MapEventToCommands implements core.Service.
+func (r *Recorder) MapEventToCommands(event core.Event) []core.Command {
+	return nil
+}
+
+// Close implements core.Service.
+func (r *Recorder) Close() error {
+	if r.file == nil {
+		return nil
+	}
+
+	return r.file.Close()
+}
+
+// Name implements core.Service.
+func (r *Recorder) Name() string {
+	return "Journal"
+}
+
+func (r *Recorder) record(e core.Event) {
+	entry, err := NewEntry(time.Now(), e)
+	if err != nil {
+		log.Warnf("Failed to serialize event %T for the journal: %v", e, err)
+
+		return
+	}
+
+	// The events emitted while shutting down may come after Close
+	if err := r.file.Append(entry); err != nil && !errors.Is(err, ErrJournalClosed) {
+		log.Warnf("Failed to record event %T in the journal: %v", e, err)
+	}
+}
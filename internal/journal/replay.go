@@ -0,0 +1,156 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/services"
+	"github.com/hop-/gotchat/pkg/log"
+)
+
+var ErrUnknownEvent = errors.New("unknown event type")
+
+// Registry knows the event types the entries are decoded to
+type Registry struct {
+	types map[string]reflect.Type
+}
+
+func NewRegistry(events ...core.Event) *Registry {
+	r := &Registry{make(map[string]reflect.Type)}
+	r.Register(events...)
+
+	return r
+}
+
+// DefaultRegistry knows the events of the core and of the services
+func DefaultRegistry() *Registry {
+	return NewRegistry(
+		core.QuitEvent{},
+		core.NewMessageEvent{},
+		core.ConnectEvent{},
+		core.UserCreatedEvent{},
+		core.UserLoggedInEvent{},
+		core.UserLoggedOutEvent{},
+		core.SwitchUserEvent{},
+		core.UserUpdatedEvent{},
+		core.UserDeletedEvent{},
+		core.JoinEvent{},
+		core.SetPeerPolicyEvent{},
+		core.PeerRuleEvent{},
+		core.ConnectionRequestDecisionEvent{},
+		core.SendMessageEvent{},
+		core.CommandFailed{},
+		core.ServiceStateChanged{},
+		services.NewUnauthenticatedConnection{},
+		services.ConnectionStarted{},
+		services.ConnectionEstablished{},
+		services.ConnectionClosed{},
+		services.PeerLeft{},
+		services.ConnectionAcceptError{},
+		services.ConnectionFailed{},
+		services.AbuseViolation{},
+		services.HostBanned{},
+		services.ConnectionRequested{},
+		services.ConnectionRequestExpired{},
+		services.ConnectionRequestResolved{},
+		services.InviteRedeemed{},
+		services.PeerPolicyChanged{},
+		services.PeerRuleChanged{},
+		services.RelayRegistered{},
+		services.RelayRegistrationFailed{},
+		services.NewMessage{},
+		services.MessageReadError{},
+		services.PeerDiscovered{},
+		services.PeerLost{},
+		services.DeviceLinked{},
+		services.DevicesUpdated{},
+		services.MessageSent{},
+		services.MessageReceived{},
+	)
+}
+
+// Register adds the types of the events
+func (r *Registry) Register(events ...core.Event) {
+	for _, e := range events {
+		r.types[EventType(e)] = reflect.TypeOf(e)
+	}
+}
+
+// Decode restores the event of the entry. Errors come back with their messages only,
+// the redacted secrets and the values which can't be serialized, like connections, stay empty.
+func (r *Registry) Decode(entry Entry) (core.Event, error) {
+	t, ok := r.types[entry.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEvent, entry.Type)
+	}
+
+	pointer := t.Kind() == reflect.Pointer
+	if pointer {
+		t = t.Elem()
+	}
+
+	v := reflect.New(t)
+	var typeErr *json.UnmarshalTypeError
+	if err := json.Unmarshal(entry.Payload, v.Interface()); err != nil && !errors.As(err, &typeErr) {
+		return nil, err
+	}
+	restoreErrors(v.Elem(), entry.Payload)
+
+	if pointer {
+		return v.Interface(), nil
+	}
+
+	return v.Elem().Interface(), nil
+}
+
+// restoreErrors sets the error fields of the struct from the recorded messages
+func restoreErrors(v reflect.Value, payload json.RawMessage) {
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return
+	}
+
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Type != errorType {
+			continue
+		}
+
+		var message string
+		if err := json.Unmarshal(fields[field.Name], &message); err == nil {
+			v.Field(i).Set(reflect.ValueOf(errors.New(message)))
+		}
+	}
+}
+
+// Replay emits the events of the entries in order, the entries of unknown types are skipped.
+// It returns the number of the emitted events.
+func Replay(ctx context.Context, emitter core.EventEmitter, registry *Registry, entries []Entry) (int, error) {
+	emitted := 0
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return emitted, err
+		}
+
+		e, err := registry.Decode(entry)
+		if err != nil {
+			log.Warnf("Skipping journal entry %s: %v", entry.Type, err)
+
+			continue
+		}
+
+		emitter.Emit(e)
+		emitted++
+	}
+
+	return emitted, nil
+}
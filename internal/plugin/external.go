@@ -0,0 +1,464 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/journal"
+	"github.com/hop-/gotchat/pkg/log"
+)
+
+// Version of the protocol spoken with the external plugins
+const ProtocolVersion = 1
+
+const (
+	// Time an external plugin has to register after it's started
+	registerTimeout = 5 * time.Second
+	// Time an external plugin has to reply to a chat command
+	commandTimeout = 10 * time.Second
+	// Time an external plugin has to exit after its stdin is closed
+	exitTimeout = 2 * time.Second
+)
+
+var ErrPluginExited = errors.New("plugin exited")
+
+// Messages of the protocol, one JSON object per line. The events are journal entries,
+// {"type":"services.PeerLeft","payload":{"ConnId":"..."}}, with the secrets redacted.
+const (
+	// Host: {"type":"hello","version":1}
+	messageHello = "hello"
+	// Plugin: {"type":"register","commands":["weather"],"subscribe":["services.MessageReceived"]},
+	// "*" subscribes to all events
+	messageRegister = "register"
+	// Host: {"type":"event","event":{...}}
+	messageEvent = "event"
+	// Host: {"type":"command","id":1,"name":"weather","args":["berlin"]}
+	messageCommand = "command"
+	// Plugin: {"type":"reply","id":1,"events":[{...}]} or {"type":"reply","id":1,"error":"..."}
+	messageReply = "reply"
+	// Plugin: {"type":"emit","event":{...}}
+	messageEmit = "emit"
+	// Plugin: {"type":"log","level":"info","message":"..."}
+	messageLog = "log"
+)
+
+type message struct {
+	Type      string          `json:"type"`
+	Version   int             `json:"version,omitempty"`
+	Commands  []string        `json:"commands,omitempty"`
+	Subscribe []string        `json:"subscribe,omitempty"`
+	Id        uint64          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Args      []string        `json:"args,omitempty"`
+	Event     *journal.Entry  `json:"event,omitempty"`
+	Events    []journal.Entry `json:"events,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Level     string          `json:"level,omitempty"`
+	Message   string          `json:"message,omitempty"`
+}
+
+// External is a plugin running as an executable. It's started when it's loaded, it registers
+// its chat commands and the event types it subscribes to, then it receives the events and
+// the chat commands on its stdin and replies, emits events and logs on its stdout.
+type External struct {
+	name     string
+	path     string
+	args     []string
+	registry *journal.Registry
+	emit     func(core.Event)
+
+	cmd     *exec.Cmd
+	writeMu sync.Mutex
+	stdin   io.WriteCloser
+
+	mu      sync.Mutex
+	pending map[uint64]chan message
+	lastId  uint64
+	// Why the plugin exited, set before done is closed
+	exitErr error
+
+	registered chan message
+	done       chan struct{}
+}
+
+// NewExternal creates the plugin of the executable, it's named after the file
+func NewExternal(path string, args ...string) *External {
+	return &External{
+		strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		path,
+		args,
+		journal.DefaultRegistry(),
+		nil,
+		nil,
+		sync.Mutex{},
+		nil,
+		sync.Mutex{},
+		make(map[uint64]chan message),
+		0,
+		nil,
+		make(chan message, 1),
+		make(chan struct{}),
+	}
+}
+
+// FindExecutables returns the executable files of the directory with the enabled names sorted by name,
+// none if the directory doesn't exist or other users can write to it
+func FindExecutables(dir string, enabled []string) []string {
+	if len(enabled) == 0 {
+		return nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil
+	}
+	if err := checkPermissions(info); err != nil {
+		log.Warnf("Plugins of %s are not loaded: %v", dir, err)
+
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if !slices.Contains(enabled, strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if err := checkPermissions(info); err != nil {
+			log.Warnf("Plugin %s is not loaded: %v", entry.Name(), err)
+
+			continue
+		}
+
+		if runtime.GOOS == "windows" {
+			if !strings.EqualFold(filepath.Ext(entry.Name()), ".exe") {
+				continue
+			}
+		} else if info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+
+		paths = append(paths, filepath.Join(dir, entry.Name()))
+	}
+
+	return paths
+}
+
+// Name implements Plugin.
+func (e *External) Name() string {
+	return e.name
+}
+
+// Setup implements Plugin.
+func (e *External) Setup(host Host) error {
+	e.emit = host.Emit
+
+	if err := e.start(); err != nil {
+		return err
+	}
+
+	var register message
+	select {
+	case register = <-e.registered:
+	case <-e.done:
+		return fmt.Errorf("%w before registering: %v", ErrPluginExited, e.exitErr)
+	case <-time.After(registerTimeout):
+		e.stop()
+
+		return fmt.Errorf("plugin didn't register in %v", registerTimeout)
+	}
+
+	for _, name := range register.Commands {
+		if err := host.AddChatCommand(name, e.chatCommand(name)); err != nil {
+			e.stop()
+
+			return err
+		}
+	}
+	if len(register.Subscribe) > 0 {
+		host.Subscribe(eventTypes(register.Subscribe), e.forward)
+	}
+	host.AddService(&externalService{e})
+
+	return nil
+}
+
+// externalService runs the plugin with the services, it's named apart from the plugin
+type externalService struct {
+	*External
+}
+
+// Name implements core.Service.
+func (s *externalService) Name() string {
+	return "Plugin " + s.name
+}
+
+// Init implements core.Service.
+func (e *External) Init() error {
+	return nil
+}
+
+// Run implements core.Service.
+func (e *External) Run(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	select {
+	case <-ctx.Done():
+	case <-e.done:
+		log.Warnf("Plugin %s exited: %v", e.name, e.exitErr)
+	}
+}
+
+// MapEventToCommands implements core.Service.
+func (e *External) MapEventToCommands(event core.Event) []core.Command {
+	return nil
+}
+
+// Close implements core.Service.
+func (e *External) Close() error {
+	e.stop()
+
+	return nil
+}
+
+// Health reports the plugin as degraded once its process has exited
+func (e *External) Health() error {
+	select {
+	case <-e.done:
+		return e.exitErr
+	default:
+		return nil
+	}
+}
+
+func (e *External) start() error {
+	cmd := exec.Command(e.path, e.args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	e.cmd = cmd
+	e.stdin = stdin
+
+	go e.read(stdout)
+
+	return e.send(message{Type: messageHello, Version: ProtocolVersion})
+}
+
+// stop closes the stdin of the plugin and kills it if it doesn't exit in time
+func (e *External) stop() {
+	if e.cmd == nil {
+		return
+	}
+
+	e.stdin.Close()
+
+	select {
+	case <-e.done:
+	case <-time.After(exitTimeout):
+		e.cmd.Process.Kill()
+		<-e.done
+	}
+}
+
+// read handles the messages of the plugin until it exits
+func (e *External) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Warnf("Plugin %s sent an invalid message: %v", e.name, err)
+
+			continue
+		}
+
+		e.handle(msg)
+	}
+
+	err := e.cmd.Wait()
+	if err == nil {
+		err = ErrPluginExited
+	}
+	e.exitErr = err
+	close(e.done)
+}
+
+func (e *External) handle(msg message) {
+	switch msg.Type {
+	case messageRegister:
+		select {
+		case e.registered <- msg:
+		default:
+			log.Warnf("Plugin %s registered again, ignored", e.name)
+		}
+	case messageReply:
+		e.mu.Lock()
+		reply, ok := e.pending[msg.Id]
+		delete(e.pending, msg.Id)
+		e.mu.Unlock()
+
+		if ok {
+			reply <- msg
+		}
+	case messageEmit:
+		if msg.Event == nil {
+			return
+		}
+
+		event, err := e.registry.Decode(*msg.Event)
+		if err != nil {
+			log.Warnf("Plugin %s emitted an invalid event: %v", e.name, err)
+
+			return
+		}
+		e.emit(event)
+	case messageLog:
+		switch msg.Level {
+		case "error":
+			log.Errorf("Plugin %s: %s", e.name, msg.Message)
+		case "warn":
+			log.Warnf("Plugin %s: %s", e.name, msg.Message)
+		case "debug":
+			log.Debugf("Plugin %s: %s", e.name, msg.Message)
+		default:
+			log.Infof("Plugin %s: %s", e.name, msg.Message)
+		}
+	default:
+		log.Warnf("Plugin %s sent an unknown message %q", e.name, msg.Type)
+	}
+}
+
+func (e *External) send(msg message) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+
+	_, err = e.stdin.Write(append(line, '\n'))
+
+	return err
+}
+
+// call sends the message and waits for the reply
+func (e *External) call(msg message) (message, error) {
+	reply := make(chan message, 1)
+
+	e.mu.Lock()
+	e.lastId++
+	msg.Id = e.lastId
+	e.pending[msg.Id] = reply
+	e.mu.Unlock()
+
+	forget := func() {
+		e.mu.Lock()
+		delete(e.pending, msg.Id)
+		e.mu.Unlock()
+	}
+
+	if err := e.send(msg); err != nil {
+		forget()
+
+		return message{}, err
+	}
+
+	select {
+	case r := <-reply:
+		return r, nil
+	case <-e.done:
+		forget()
+
+		return message{}, ErrPluginExited
+	case <-time.After(commandTimeout):
+		forget()
+
+		return message{}, fmt.Errorf("plugin didn't reply in %v", commandTimeout)
+	}
+}
+
+func (e *External) chatCommand(name string) ChatCommand {
+	return func(args ...string) ([]core.Event, error) {
+		reply, err := e.call(message{Type: messageCommand, Name: name, Args: args})
+		if err != nil {
+			return nil, err
+		}
+		if reply.Error != "" {
+			return nil, errors.New(reply.Error)
+		}
+
+		events := make([]core.Event, 0, len(reply.Events))
+		for _, entry := range reply.Events {
+			event, err := e.registry.Decode(entry)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, event)
+		}
+
+		return events, nil
+	}
+}
+
+// forward sends the event to the plugin
+func (e *External) forward(event core.Event) {
+	entry, err := journal.NewEntry(time.Now(), event)
+	if err != nil {
+		log.Warnf("Failed to serialize event %T for plugin %s: %v", event, e.name, err)
+
+		return
+	}
+
+	if err := e.send(message{Type: messageEvent, Event: &entry}); err != nil {
+		log.Debugf("Failed to send event %T to plugin %s: %v", event, e.name, err)
+	}
+}
+
+// eventTypes matches the events by their journal types, "*" matches all
+func eventTypes(types []string) core.EventFilter {
+	return func(event core.Event) bool {
+		eventType := journal.EventType(event)
+		for _, t := range types {
+			if t == "*" || t == eventType {
+				return true
+			}
+		}
+
+		return false
+	}
+}
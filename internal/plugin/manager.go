@@ -0,0 +1,172 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/pkg/log"
+)
+
+// Manager loads the plugins and collects their extensions
+type Manager struct {
+	bus core.EventBus
+
+	loaded   map[string]bool
+	services []core.Service
+	commands map[string]ChatCommand
+}
+
+func NewManager(bus core.EventBus) *Manager {
+	return &Manager{
+		bus,
+		make(map[string]bool),
+		make([]core.Service, 0),
+		make(map[string]ChatCommand),
+	}
+}
+
+// Load sets up the plugin, its extensions are kept only if the setup succeeds
+func (m *Manager) Load(p Plugin) error {
+	if m.loaded[p.Name()] {
+		return fmt.Errorf("plugin %s is already loaded", p.Name())
+	}
+
+	host := &pluginHost{m, newSubscriptions(p.Name(), m.bus), nil, make(map[string]ChatCommand)}
+	if err := p.Setup(host); err != nil {
+		return fmt.Errorf("failed to set up plugin %s: %w", p.Name(), err)
+	}
+
+	m.loaded[p.Name()] = true
+	m.services = append(m.services, host.services...)
+	if len(host.subscriptions.handlers) > 0 {
+		m.services = append(m.services, host.subscriptions)
+	}
+	for name, command := range host.commands {
+		m.commands[name] = command
+	}
+
+	log.Infof("Loaded plugin %s", p.Name())
+
+	return nil
+}
+
+// Services returns the services added by the plugins with the ones running their event handlers
+func (m *Manager) Services() []core.Service {
+	return m.services
+}
+
+// ChatCommands returns the chat commands added by the plugins by name
+func (m *Manager) ChatCommands() map[string]ChatCommand {
+	return m.commands
+}
+
+// pluginHost collects the extensions of one plugin
+type pluginHost struct {
+	manager       *Manager
+	subscriptions *subscriptions
+	services      []core.Service
+	commands      map[string]ChatCommand
+}
+
+// AddService implements Host.
+func (h *pluginHost) AddService(s core.Service) {
+	h.services = append(h.services, s)
+}
+
+// Subscribe implements Host.
+func (h *pluginHost) Subscribe(filter core.EventFilter, handler core.HandlerFunc) {
+	h.subscriptions.handlers = append(h.subscriptions.handlers, subscriptionHandler{filter, handler})
+}
+
+// AddChatCommand implements Host.
+func (h *pluginHost) AddChatCommand(name string, command ChatCommand) error {
+	if _, exists := h.manager.commands[name]; exists {
+		return fmt.Errorf("chat command '%s' already exists", name)
+	}
+	if _, exists := h.commands[name]; exists {
+		return fmt.Errorf("chat command '%s' already exists", name)
+	}
+
+	h.commands[name] = command
+
+	return nil
+}
+
+// Emit implements Host.
+func (h *pluginHost) Emit(e core.Event) {
+	h.manager.bus.Emit(e)
+}
+
+type subscriptionHandler struct {
+	filter  core.EventFilter
+	handler core.HandlerFunc
+}
+
+// subscriptions runs the event handlers of a plugin
+type subscriptions struct {
+	plugin   string
+	bus      core.EventSubscriber
+	handlers []subscriptionHandler
+}
+
+func newSubscriptions(plugin string, bus core.EventSubscriber) *subscriptions {
+	return &subscriptions{
+		plugin,
+		bus,
+		nil,
+	}
+}
+
+// Init implements core.Service.
+func (s *subscriptions) Init() error {
+	return nil
+}
+
+// Run implements core.Service.
+func (s *subscriptions) Run(ctx context.Context, wg *sync.WaitGroup) {
+	for i, h := range s.handlers {
+		// Nothing is dropped, a slow handler only delays its own events
+		listener := s.bus.SubscribeWith(ctx, core.ListenerOptions{
+			Name:   fmt.Sprintf("plugin-%s-%d", s.plugin, i+1),
+			Filter: h.filter,
+			Policy: core.Unbounded,
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for e := range listener {
+				s.handle(h.handler, e)
+			}
+		}()
+	}
+}
+
+// MapEventToCommands implements core.Service.
+func (s *subscriptions) MapEventToCommands(event core.Event) []core.Command {
+	return nil
+}
+
+// Close implements core.Service.
+func (s *subscriptions) Close() error {
+	return nil
+}
+
+// Name implements core.Service.
+func (s *subscriptions) Name() string {
+	return "Plugin " + s.plugin + " handlers"
+}
+
+// handle calls the handler, a panicking plugin doesn't take the application down
+func (s *subscriptions) handle(handler core.HandlerFunc, e core.Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Plugin %s panicked handling %T: %v", s.plugin, e, r)
+		}
+	}()
+
+	handler(e)
+}
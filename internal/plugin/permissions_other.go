@@ -0,0 +1,10 @@
+//go:build !unix
+
+package plugin
+
+import "os"
+
+// checkPermissions relies on the access control of the user's home directory
+func checkPermissions(info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkPermissions refuses the files and directories other users could replace
+func checkPermissions(info os.FileInfo) error {
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%s is writable by the group or others", info.Name())
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is not owned by the user", info.Name())
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+// Package plugin extends the application with team-specific services, event handlers and chat
+// commands without changing it. Plugins are compiled in and registered from their init with
+// Register, or run as external executables speaking JSON lines over stdin and stdout, see External.
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hop-/gotchat/internal/core"
+)
+
+// Plugin adds its extensions to the application through the host
+type Plugin interface {
+	// Name identifies the plugin, it must be unique
+	Name() string
+	// Setup adds the extensions of the plugin, it's called once before the application starts
+	Setup(host Host) error
+}
+
+// ChatCommand handles the "/name args..." chat command off the UI loop,
+// it returns the events to emit or the error shown to the user
+type ChatCommand func(args ...string) ([]core.Event, error)
+
+// Host is what a plugin extends the application through
+type Host interface {
+	// AddService runs the service with the services of the application
+	AddService(s core.Service)
+	// Subscribe calls the handler with the events matching the filter, nil matches all,
+	// the handlers of a plugin run on its own goroutines
+	Subscribe(filter core.EventFilter, handler core.HandlerFunc)
+	// AddChatCommand adds the chat command, it fails if another plugin has added it
+	AddChatCommand(name string, command ChatCommand) error
+	// Emit emits the event to the application
+	Emit(e core.Event)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]Plugin)
+)
+
+// Register makes the plugin loaded when the application starts, it's meant
+// to be called from the init of the plugin's package. It panics if the name is taken.
+func Register(p Plugin) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if p == nil {
+		panic("plugin: Register plugin is nil")
+	}
+	if _, exists := registry[p.Name()]; exists {
+		panic(fmt.Sprintf("plugin: Register called twice for plugin %s", p.Name()))
+	}
+
+	registry[p.Name()] = p
+}
+
+// Registered returns the plugins registered at build time sorted by name
+func Registered() []Plugin {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	plugins := make([]Plugin, 0, len(registry))
+	for _, p := range registry {
+		plugins = append(plugins, p)
+	}
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].Name() < plugins[j].Name()
+	})
+
+	return plugins
+}
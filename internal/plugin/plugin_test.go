@@ -0,0 +1,302 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/journal"
+)
+
+// echoPlugin is a build time plugin with a chat command and an event handler
+type echoPlugin struct {
+	name  string
+	setup error
+}
+
+func (p *echoPlugin) Name() string {
+	return p.name
+}
+
+func (p *echoPlugin) Setup(host Host) error {
+	if err := host.AddChatCommand("echo", func(args ...string) ([]core.Event, error) {
+		if len(args) < 2 {
+			return nil, errors.New("echo requires a user id and a text")
+		}
+
+		return []core.Event{core.SendMessageEvent{PeerUserId: args[0], Text: strings.Join(args[1:], " ")}}, nil
+	}); err != nil {
+		return err
+	}
+
+	host.Subscribe(core.OfType[core.ConnectEvent](), func(e core.Event) {
+		host.Emit(core.JoinEvent{URI: "gotchat://" + e.(core.ConnectEvent).Host})
+	})
+
+	return p.setup
+}
+
+// runServices runs the services of the plugins until the test ends
+func runServices(t *testing.T, em *core.EventManager, services []core.Service) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+
+	listeners := len(em.Metrics().Listeners)
+	for _, s := range services {
+		if err := s.Init(); err != nil {
+			t.Fatalf("failed to init %s: %v", s.Name(), err)
+		}
+		go s.Run(ctx, wg)
+	}
+
+	t.Cleanup(func() {
+		cancel()
+		for _, s := range services {
+			s.Close()
+		}
+		wg.Wait()
+	})
+
+	// Wait for the handlers to subscribe
+	for len(em.Metrics().Listeners) == listeners {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// expectJoin checks that connecting is answered with joining
+func expectJoin(t *testing.T, em *core.EventManager) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	joined := core.SubscribeTo[core.JoinEvent](ctx, em)
+	em.Emit(core.ConnectEvent{Host: "10.0.0.2", Port: "7665"})
+
+	select {
+	case e := <-joined:
+		if e.URI != "gotchat://10.0.0.2" {
+			t.Errorf("expected to join gotchat://10.0.0.2, got %s", e.URI)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the plugin to emit JoinEvent")
+	}
+}
+
+func expectEcho(t *testing.T, commands map[string]ChatCommand) {
+	t.Helper()
+
+	echo, ok := commands["echo"]
+	if !ok {
+		t.Fatal("expected the echo chat command")
+	}
+
+	events, err := echo("bob", "hello", "there")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(events) != 1 || events[0] != (core.SendMessageEvent{PeerUserId: "bob", Text: "hello there"}) {
+		t.Errorf("expected the message to bob, got %v", events)
+	}
+
+	if _, err := echo("bob"); err == nil || !strings.Contains(err.Error(), "requires") {
+		t.Errorf("expected the error of the plugin, got %v", err)
+	}
+}
+
+func TestManager_Load(t *testing.T) {
+	em := core.NewEventManager(10)
+	manager := NewManager(em)
+
+	if err := manager.Load(&echoPlugin{name: "echo"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Nothing of a failed plugin is kept
+	if err := manager.Load(&echoPlugin{name: "broken", setup: errors.New("no token")}); err == nil {
+		t.Error("expected the setup error")
+	}
+	// The chat command is taken
+	if err := manager.Load(&echoPlugin{name: "other"}); err == nil {
+		t.Error("expected the chat command to be taken")
+	}
+	if err := manager.Load(&echoPlugin{name: "echo"}); err == nil {
+		t.Error("expected the plugin to be loaded only once")
+	}
+
+	if len(manager.Services()) != 1 {
+		t.Fatalf("expected the service running the handlers, got %d services", len(manager.Services()))
+	}
+
+	expectEcho(t, manager.ChatCommands())
+
+	runServices(t, em, manager.Services())
+	expectJoin(t, em)
+}
+
+func TestManager_HandlerPanics(t *testing.T) {
+	em := core.NewEventManager(10)
+	manager := NewManager(em)
+
+	manager.Load(&panicPlugin{})
+	runServices(t, em, manager.Services())
+
+	// The handler keeps handling after a panic
+	em.Emit(core.QuitEvent{})
+	expectJoin(t, em)
+}
+
+type panicPlugin struct{}
+
+func (p *panicPlugin) Name() string {
+	return "panic"
+}
+
+func (p *panicPlugin) Setup(host Host) error {
+	host.Subscribe(nil, func(e core.Event) {
+		switch e := e.(type) {
+		case core.QuitEvent:
+			panic("unexpected quit")
+		case core.ConnectEvent:
+			host.Emit(core.JoinEvent{URI: "gotchat://" + e.Host})
+		}
+	})
+
+	return nil
+}
+
+func TestRegister(t *testing.T) {
+	Register(&echoPlugin{name: "registered"})
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, "registered")
+		registryMu.Unlock()
+	})
+
+	found := false
+	for _, p := range Registered() {
+		found = found || p.Name() == "registered"
+	}
+	if !found {
+		t.Error("expected the plugin to be registered")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering the name twice to panic")
+		}
+	}()
+	Register(&echoPlugin{name: "registered"})
+}
+
+func TestFindExecutables(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "weather"), []byte("#!/bin/sh\n"), 0755)
+	os.WriteFile(filepath.Join(dir, "README"), []byte("plugins\n"), 0644)
+	os.Mkdir(filepath.Join(dir, "data"), 0755)
+
+	os.WriteFile(filepath.Join(dir, "news"), []byte("#!/bin/sh\n"), 0755)
+	os.WriteFile(filepath.Join(dir, "shared"), []byte("#!/bin/sh\n"), 0755)
+	os.Chmod(filepath.Join(dir, "shared"), 0777)
+	enabled := []string{"weather", "README", "data", "shared"}
+
+	found := FindExecutables(dir, enabled)
+	if len(found) != 1 || filepath.Base(found[0]) != "weather" {
+		t.Errorf("expected only the enabled executable, got %v", found)
+	}
+
+	if found := FindExecutables(dir, nil); found != nil {
+		t.Errorf("expected no plugins without enabling them, got %v", found)
+	}
+
+	if found := FindExecutables(filepath.Join(dir, "missing"), enabled); found != nil {
+		t.Errorf("expected no plugins, got %v", found)
+	}
+
+	// Others could replace the plugins of the directory
+	os.Chmod(dir, 0777)
+	if found := FindExecutables(dir, enabled); runtime.GOOS != "windows" && found != nil {
+		t.Errorf("expected no plugins of a world-writable directory, got %v", found)
+	}
+}
+
+func TestExternal(t *testing.T) {
+	t.Setenv("GOTCHAT_TEST_PLUGIN", "1")
+
+	em := core.NewEventManager(10)
+	manager := NewManager(em)
+
+	external := NewExternal(os.Args[0], "-test.run=^TestExternalPluginProcess$")
+	if err := manager.Load(external); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// The handlers and the process
+	if len(manager.Services()) != 2 {
+		t.Fatalf("expected 2 services, got %d", len(manager.Services()))
+	}
+
+	expectEcho(t, manager.ChatCommands())
+
+	runServices(t, em, manager.Services())
+	expectJoin(t, em)
+
+	if err := external.Health(); err != nil {
+		t.Errorf("expected the plugin to be healthy, got %v", err)
+	}
+	external.Close()
+	if err := external.Health(); err == nil {
+		t.Error("expected the plugin to be reported once it has exited")
+	}
+}
+
+// TestExternalPluginProcess is the external plugin run by TestExternal
+func TestExternalPluginProcess(t *testing.T) {
+	if os.Getenv("GOTCHAT_TEST_PLUGIN") != "1" {
+		t.Skip("run by TestExternal")
+	}
+
+	out := json.NewEncoder(os.Stdout)
+	entry := func(e core.Event) *journal.Entry {
+		entry, _ := journal.NewEntry(time.Now(), e)
+
+		return &entry
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var msg message
+		json.Unmarshal(scanner.Bytes(), &msg)
+
+		switch msg.Type {
+		case messageHello:
+			out.Encode(message{Type: messageRegister, Commands: []string{"echo"}, Subscribe: []string{"core.ConnectEvent"}})
+		case messageCommand:
+			if len(msg.Args) < 2 {
+				out.Encode(message{Type: messageReply, Id: msg.Id, Error: "echo requires a user id and a text"})
+
+				continue
+			}
+
+			e := core.SendMessageEvent{PeerUserId: msg.Args[0], Text: strings.Join(msg.Args[1:], " ")}
+			out.Encode(message{Type: messageReply, Id: msg.Id, Events: []journal.Entry{*entry(e)}})
+		case messageEvent:
+			var connect core.ConnectEvent
+			json.Unmarshal(msg.Event.Payload, &connect)
+			out.Encode(message{Type: messageEmit, Event: entry(core.JoinEvent{URI: "gotchat://" + connect.Host})})
+			out.Encode(message{Type: messageLog, Level: "info", Message: fmt.Sprintf("joining %s", connect.Host)})
+		}
+	}
+
+	os.Exit(0)
+}
@@ -0,0 +1,422 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/pkg/log"
+	"github.com/hop-/gotchat/pkg/network"
+)
+
+var (
+	ErrHostBanned               = errors.New("host is banned")
+	ErrAcceptRateExceeded       = errors.New("too many connections from host")
+	ErrTooManyUnauthenticated   = errors.New("too many unauthenticated connections")
+	ErrMessageRateExceeded      = errors.New("too many messages from peer")
+	ErrHandshakeDeadlineReached = errors.New("handshake deadline reached")
+	ErrTooManyPendingRequests   = errors.New("too many pending connection requests")
+)
+
+// AbuseLimits configures the protection of the server against misbehaving hosts
+type AbuseLimits struct {
+	// Maximum concurrent connections which didn't finish the handshake
+	MaxUnauthenticated int
+	// Time given to a peer to finish the handshake
+	HandshakeTimeout time.Duration
+
+	// Maximum connection requests waiting for the user's decision in total and from a single host
+	MaxPendingRequests        int
+	MaxPendingRequestsPerHost int
+
+	// Inbound connections per second and burst from a single host
+	AcceptRate  float64
+	AcceptBurst int
+
+	// Messages per second and burst from a single host, or from a single peer if the host is unknown
+	MessageRate  float64
+	MessageBurst int
+
+	// Maximum size of a frame read from a peer, zero keeps the default of the network package
+	MaxFrameSize uint64
+	// Maximum requests of a peer served at once, zero keeps the default of the network package
+	MaxConcurrentRequests int
+
+	// Violations within the window which get a host banned
+	MaxViolations   int
+	ViolationWindow time.Duration
+	BanDuration     time.Duration
+
+	// Time before the same violation of a host is reported again, zero reports all of them
+	ReportInterval time.Duration
+}
+
+func DefaultAbuseLimits() AbuseLimits {
+	return AbuseLimits{
+		MaxUnauthenticated: 32,
+		HandshakeTimeout:   10 * time.Second,
+
+		MaxPendingRequests:        16,
+		MaxPendingRequestsPerHost: 2,
+
+		AcceptRate:   1,
+		AcceptBurst:  5,
+		MessageRate:  20,
+		MessageBurst: 40,
+		MaxFrameSize: 1 << 20, // 1 MiB
+
+		MaxConcurrentRequests: 16,
+
+		MaxViolations:   5,
+		ViolationWindow: time.Minute,
+		BanDuration:     10 * time.Minute,
+		ReportInterval:  10 * time.Second,
+	}
+}
+
+type violationRecord struct {
+	count int
+	since time.Time
+}
+
+// AbuseGuard applies AbuseLimits and bans repeat offenders.
+// A nil guard allows everything.
+type AbuseGuard struct {
+	eventEmitter core.EventEmitter
+	limits       AbuseLimits
+	now          func() time.Time
+
+	mu             sync.Mutex
+	acceptBuckets  map[string]*network.TokenBucket
+	messageBuckets map[string]*network.TokenBucket
+	violations     map[string]*violationRecord
+	bans           map[string]time.Time
+	// Last reports of the violations by host and reason
+	reports     map[string]time.Time
+	lastCleanup time.Time
+
+	// Connection requests waiting for the user's decision by host
+	pendingRequests      map[string]int
+	totalPendingRequests int
+
+	// Events emitted once g.mu is released, so a slow listener doesn't stall the connections
+	events []core.Event
+}
+
+func NewAbuseGuard(eventEmitter core.EventEmitter, limits AbuseLimits) *AbuseGuard {
+	return &AbuseGuard{
+		eventEmitter,
+		limits,
+		time.Now,
+		sync.Mutex{},
+		make(map[string]*network.TokenBucket),
+		make(map[string]*network.TokenBucket),
+		make(map[string]*violationRecord),
+		make(map[string]time.Time),
+		make(map[string]time.Time),
+		time.Time{},
+		make(map[string]int),
+		0,
+		nil,
+	}
+}
+
+// HandshakeTimeout returns the handshake deadline, zero means no deadline
+func (g *AbuseGuard) HandshakeTimeout() time.Duration {
+	if g == nil {
+		return 0
+	}
+
+	return g.limits.HandshakeTimeout
+}
+
+// LimitFrames applies the maximum frame size to the connection
+func (g *AbuseGuard) LimitFrames(conn *network.Conn) {
+	if g == nil || g.limits.MaxFrameSize == 0 {
+		return
+	}
+
+	conn.SetMaxFrameSize(g.limits.MaxFrameSize)
+}
+
+// LimitRequests applies the maximum of the concurrent requests to the connection
+func (g *AbuseGuard) LimitRequests(rpc *network.RpcConn) {
+	if g == nil || g.limits.MaxConcurrentRequests <= 0 {
+		return
+	}
+
+	rpc.SetMaxConcurrentRequests(g.limits.MaxConcurrentRequests)
+}
+
+// CheckReadError counts an oversized frame from the host as a violation,
+// other read errors are returned as they are
+func (g *AbuseGuard) CheckReadError(host string, err error) error {
+	if !errors.Is(err, network.ErrFrameTooLarge) {
+		return err
+	}
+
+	if violationErr := g.ReportViolation(host, network.ErrFrameTooLarge); errors.Is(violationErr, ErrHostBanned) {
+		return fmt.Errorf("%w: %w", ErrHostBanned, err)
+	}
+
+	return err
+}
+
+// AllowAccept checks whether a new inbound connection from the host can be handled
+func (g *AbuseGuard) AllowAccept(host string, unauthenticated int) error {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.unlock()
+
+	now := g.now()
+	g.cleanup(now)
+
+	if g.isBanned(host, now) {
+		return ErrHostBanned
+	}
+
+	if g.limits.MaxUnauthenticated > 0 && unauthenticated >= g.limits.MaxUnauthenticated {
+		// Not necessarily the fault of this particular host, so it's not counted
+		g.report(host, ErrTooManyUnauthenticated, now)
+
+		return ErrTooManyUnauthenticated
+	}
+
+	if g.limits.AcceptRate <= 0 {
+		return nil
+	}
+
+	bucket, ok := g.acceptBuckets[host]
+	if !ok {
+		bucket = network.NewTokenBucket(g.limits.AcceptRate, max(g.limits.AcceptBurst, 1), now)
+		g.acceptBuckets[host] = bucket
+	}
+
+	if !bucket.Allow(now) {
+		return g.violation(host, ErrAcceptRateExceeded, now)
+	}
+
+	return nil
+}
+
+// AllowMessage checks whether a message received from the peer can be handled,
+// all connections from the host share the budget so reconnecting doesn't renew it
+func (g *AbuseGuard) AllowMessage(peerUserId string, host string) error {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.unlock()
+
+	now := g.now()
+	g.cleanup(now)
+
+	if g.isBanned(host, now) {
+		return ErrHostBanned
+	}
+
+	if g.limits.MessageRate <= 0 {
+		return nil
+	}
+
+	// The host of the relayed connections is unknown, the peer is limited instead
+	key := host
+	if key == "" {
+		key = "peer:" + peerUserId
+	}
+
+	bucket, ok := g.messageBuckets[key]
+	if !ok {
+		bucket = network.NewTokenBucket(g.limits.MessageRate, max(g.limits.MessageBurst, 1), now)
+		g.messageBuckets[key] = bucket
+	}
+
+	if !bucket.Allow(now) {
+		return g.violation(host, ErrMessageRateExceeded, now)
+	}
+
+	return nil
+}
+
+// AcquirePendingRequest counts a connection request of the host waiting for the user's decision,
+// ReleasePendingRequest must be called once the request is resolved
+func (g *AbuseGuard) AcquirePendingRequest(host string) error {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.unlock()
+
+	now := g.now()
+	if g.limits.MaxPendingRequests > 0 && g.totalPendingRequests >= g.limits.MaxPendingRequests {
+		// Not necessarily the fault of this particular host, so it's not counted
+		g.report(host, ErrTooManyPendingRequests, now)
+
+		return ErrTooManyPendingRequests
+	}
+
+	if g.limits.MaxPendingRequestsPerHost > 0 && g.pendingRequests[host] >= g.limits.MaxPendingRequestsPerHost {
+		return g.violation(host, ErrTooManyPendingRequests, now)
+	}
+
+	g.pendingRequests[host]++
+	g.totalPendingRequests++
+
+	return nil
+}
+
+// ReleasePendingRequest forgets a resolved connection request of the host
+func (g *AbuseGuard) ReleasePendingRequest(host string) {
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.pendingRequests[host] <= 1 {
+		delete(g.pendingRequests, host)
+	} else {
+		g.pendingRequests[host]--
+	}
+	g.totalPendingRequests--
+}
+
+// ReportViolation records misbehavior of the host detected elsewhere
+func (g *AbuseGuard) ReportViolation(host string, reason error) error {
+	if g == nil {
+		return reason
+	}
+
+	g.mu.Lock()
+	defer g.unlock()
+
+	return g.violation(host, reason, g.now())
+}
+
+// IsBanned reports whether the host is currently banned
+func (g *AbuseGuard) IsBanned(host string) bool {
+	if g == nil {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.isBanned(host, g.now())
+}
+
+// unlock releases g.mu and emits the events of the violations recorded meanwhile
+func (g *AbuseGuard) unlock() {
+	events := g.events
+	g.events = nil
+	g.mu.Unlock()
+
+	for _, event := range events {
+		g.eventEmitter.Emit(event)
+	}
+}
+
+// violation records the violation and bans the host when it's a repeat offender
+// Note: g.mu must be held by the caller
+func (g *AbuseGuard) violation(host string, reason error, now time.Time) error {
+	g.report(host, reason, now)
+
+	// Connections with unknown origin can't be banned
+	if host == "" || g.limits.MaxViolations <= 0 {
+		return reason
+	}
+
+	record, ok := g.violations[host]
+	if !ok || now.Sub(record.since) > g.limits.ViolationWindow {
+		record = &violationRecord{0, now}
+		g.violations[host] = record
+	}
+	record.count++
+
+	if record.count < g.limits.MaxViolations {
+		return reason
+	}
+
+	until := now.Add(g.limits.BanDuration)
+	g.bans[host] = until
+	delete(g.violations, host)
+
+	log.Warnf("Abuse protection: host %s is banned until %s", host, until.Format(time.RFC3339))
+	g.events = append(g.events, HostBanned{host, until})
+
+	return fmt.Errorf("%w: %w", ErrHostBanned, reason)
+}
+
+// report logs and emits the violation, the same violation of the host is reported once per interval
+// Note: g.mu must be held by the caller
+func (g *AbuseGuard) report(host string, reason error, now time.Time) {
+	key := host + "|" + reason.Error()
+	if last, ok := g.reports[key]; ok && now.Sub(last) < g.limits.ReportInterval {
+		return
+	}
+	g.reports[key] = now
+
+	log.Warnf("Abuse protection: %v (host %s)", reason, host)
+	g.events = append(g.events, AbuseViolation{host, reason})
+}
+
+// Note: g.mu must be held by the caller
+func (g *AbuseGuard) isBanned(host string, now time.Time) bool {
+	until, ok := g.bans[host]
+	if !ok {
+		return false
+	}
+
+	if now.After(until) {
+		delete(g.bans, host)
+
+		return false
+	}
+
+	return true
+}
+
+// cleanup forgets idle hosts once in a while to keep the maps small
+// Note: g.mu must be held by the caller
+func (g *AbuseGuard) cleanup(now time.Time) {
+	if now.Sub(g.lastCleanup) < time.Minute {
+		return
+	}
+	g.lastCleanup = now
+
+	for host, bucket := range g.acceptBuckets {
+		if bucket.Full(now) {
+			delete(g.acceptBuckets, host)
+		}
+	}
+
+	for key, bucket := range g.messageBuckets {
+		if bucket.Full(now) {
+			delete(g.messageBuckets, key)
+		}
+	}
+
+	for key, last := range g.reports {
+		if now.Sub(last) >= g.limits.ReportInterval {
+			delete(g.reports, key)
+		}
+	}
+
+	for host, record := range g.violations {
+		if now.Sub(record.since) > g.limits.ViolationWindow {
+			delete(g.violations, host)
+		}
+	}
+
+	for host := range g.bans {
+		g.isBanned(host, now)
+	}
+}
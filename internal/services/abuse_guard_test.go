@@ -0,0 +1,220 @@
+package services
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/pkg/network"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestAbuseGuard(t *testing.T, limits AbuseLimits, now *time.Time) (*AbuseGuard, *core.MockEventEmitter) {
+	eventEmitter := core.NewMockEventEmitter(t)
+
+	guard := NewAbuseGuard(eventEmitter, limits)
+	guard.now = func() time.Time { return *now }
+
+	return guard, eventEmitter
+}
+
+func TestAbuseGuard_Nil(t *testing.T) {
+	var guard *AbuseGuard
+
+	if err := guard.AllowAccept("10.0.0.1", 1000); err != nil {
+		t.Errorf("Expected nil guard to allow connections, got %v", err)
+	}
+	if err := guard.AllowMessage("bob-id", "10.0.0.1"); err != nil {
+		t.Errorf("Expected nil guard to allow messages, got %v", err)
+	}
+	if guard.HandshakeTimeout() != 0 {
+		t.Errorf("Expected no handshake timeout, got %v", guard.HandshakeTimeout())
+	}
+	if guard.IsBanned("10.0.0.1") {
+		t.Error("Expected nil guard not to ban")
+	}
+}
+
+func TestAbuseGuard_AcceptRateAndBan(t *testing.T) {
+	now := time.Now()
+	limits := DefaultAbuseLimits()
+	limits.AcceptRate = 1
+	limits.AcceptBurst = 2
+	limits.MaxViolations = 2
+	guard, eventEmitter := newTestAbuseGuard(t, limits, &now)
+
+	// The repeated violation is counted but not reported again
+	eventEmitter.On("Emit", mock.AnythingOfType("services.AbuseViolation")).Once()
+	eventEmitter.On("Emit", mock.AnythingOfType("services.HostBanned")).Once()
+
+	for i := 0; i < 2; i++ {
+		if err := guard.AllowAccept("10.0.0.1", 0); err != nil {
+			t.Fatalf("Expected connection %d to be allowed, got %v", i, err)
+		}
+	}
+
+	if err := guard.AllowAccept("10.0.0.1", 0); !errors.Is(err, ErrAcceptRateExceeded) {
+		t.Errorf("Expected ErrAcceptRateExceeded, got %v", err)
+	}
+
+	// Other hosts are not affected
+	if err := guard.AllowAccept("10.0.0.2", 0); err != nil {
+		t.Errorf("Expected other host to be allowed, got %v", err)
+	}
+
+	// The second violation bans the host
+	if err := guard.AllowAccept("10.0.0.1", 0); !errors.Is(err, ErrHostBanned) {
+		t.Errorf("Expected ErrHostBanned, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := guard.AllowAccept("10.0.0.1", 0); !errors.Is(err, ErrHostBanned) {
+		t.Errorf("Expected host to stay banned, got %v", err)
+	}
+
+	// The ban expires
+	now = now.Add(limits.BanDuration)
+	if guard.IsBanned("10.0.0.1") {
+		t.Error("Expected ban to expire")
+	}
+}
+
+func TestAbuseGuard_MaxUnauthenticated(t *testing.T) {
+	now := time.Now()
+	limits := DefaultAbuseLimits()
+	limits.MaxUnauthenticated = 3
+	guard, eventEmitter := newTestAbuseGuard(t, limits, &now)
+
+	eventEmitter.On("Emit", mock.AnythingOfType("services.AbuseViolation")).Once()
+
+	if err := guard.AllowAccept("10.0.0.1", 2); err != nil {
+		t.Errorf("Expected connection to be allowed, got %v", err)
+	}
+	if err := guard.AllowAccept("10.0.0.1", 3); !errors.Is(err, ErrTooManyUnauthenticated) {
+		t.Errorf("Expected ErrTooManyUnauthenticated, got %v", err)
+	}
+}
+
+func TestAbuseGuard_PendingRequests(t *testing.T) {
+	now := time.Now()
+	limits := DefaultAbuseLimits()
+	limits.MaxPendingRequests = 3
+	limits.MaxPendingRequestsPerHost = 2
+	guard, eventEmitter := newTestAbuseGuard(t, limits, &now)
+
+	eventEmitter.On("Emit", mock.AnythingOfType("services.AbuseViolation")).Twice()
+
+	for i := 0; i < 2; i++ {
+		if err := guard.AcquirePendingRequest("10.0.0.1"); err != nil {
+			t.Fatalf("Expected request %d to be allowed, got %v", i, err)
+		}
+	}
+	if err := guard.AcquirePendingRequest("10.0.0.1"); !errors.Is(err, ErrTooManyPendingRequests) {
+		t.Errorf("Expected the host limit to be reached, got %v", err)
+	}
+
+	if err := guard.AcquirePendingRequest("10.0.0.2"); err != nil {
+		t.Errorf("Expected other host to be allowed, got %v", err)
+	}
+	if err := guard.AcquirePendingRequest("10.0.0.3"); !errors.Is(err, ErrTooManyPendingRequests) {
+		t.Errorf("Expected the total limit to be reached, got %v", err)
+	}
+
+	// Resolved requests make room for new ones
+	guard.ReleasePendingRequest("10.0.0.1")
+	if err := guard.AcquirePendingRequest("10.0.0.3"); err != nil {
+		t.Errorf("Expected the request to be allowed once another is resolved, got %v", err)
+	}
+}
+
+func TestAbuseGuard_MessageRate(t *testing.T) {
+	now := time.Now()
+	limits := DefaultAbuseLimits()
+	limits.MessageRate = 10
+	limits.MessageBurst = 10
+	limits.MaxViolations = 0
+	guard, eventEmitter := newTestAbuseGuard(t, limits, &now)
+
+	eventEmitter.On("Emit", mock.AnythingOfType("services.AbuseViolation")).Twice()
+
+	for i := 0; i < 10; i++ {
+		if err := guard.AllowMessage("bob-id", "10.0.0.1"); err != nil {
+			t.Fatalf("Expected message %d to be allowed, got %v", i, err)
+		}
+	}
+	if err := guard.AllowMessage("bob-id", "10.0.0.1"); !errors.Is(err, ErrMessageRateExceeded) {
+		t.Errorf("Expected ErrMessageRateExceeded, got %v", err)
+	}
+
+	// The peers of the same host share the budget, the violations are reported once per interval
+	if err := guard.AllowMessage("carol-id", "10.0.0.1"); !errors.Is(err, ErrMessageRateExceeded) {
+		t.Errorf("Expected the other peer of the host to be limited, got %v", err)
+	}
+
+	// Each host has its own budget, relayed peers without a host have one each
+	if err := guard.AllowMessage("bob-id", "10.0.0.2"); err != nil {
+		t.Errorf("Expected message from another host to be allowed, got %v", err)
+	}
+	if err := guard.AllowMessage("bob-id", ""); err != nil {
+		t.Errorf("Expected message from a relayed peer to be allowed, got %v", err)
+	}
+
+	// The bucket refills over time
+	now = now.Add(100 * time.Millisecond)
+	if err := guard.AllowMessage("bob-id", "10.0.0.1"); err != nil {
+		t.Errorf("Expected message after refill to be allowed, got %v", err)
+	}
+
+	// The violation is reported again after the interval
+	for range 10 {
+		guard.AllowMessage("bob-id", "10.0.0.1")
+	}
+	now = now.Add(limits.ReportInterval)
+	for range 20 {
+		guard.AllowMessage("bob-id", "10.0.0.1")
+	}
+}
+
+func TestAbuseGuard_FrameTooLarge(t *testing.T) {
+	now := time.Now()
+	limits := DefaultAbuseLimits()
+	limits.MaxFrameSize = 1024
+	limits.MaxViolations = 2
+	guard, eventEmitter := newTestAbuseGuard(t, limits, &now)
+
+	eventEmitter.On("Emit", mock.AnythingOfType("services.AbuseViolation")).Once()
+	eventEmitter.On("Emit", mock.AnythingOfType("services.HostBanned")).Once()
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	conn := network.NewConn(c2)
+	guard.LimitFrames(conn)
+
+	go func() {
+		var header [8]byte
+		binary.LittleEndian.PutUint64(header[:], 2048)
+		c1.Write(header[:])
+	}()
+
+	_, err := conn.Read()
+	if !errors.Is(err, network.ErrFrameTooLarge) {
+		t.Fatalf("Expected ErrFrameTooLarge, got %v", err)
+	}
+
+	// An oversized frame is a violation, other read errors aren't
+	if err := guard.CheckReadError("10.0.0.1", err); errors.Is(err, ErrHostBanned) {
+		t.Errorf("Expected the host not to be banned yet, got %v", err)
+	}
+	if err := guard.CheckReadError("10.0.0.1", io.EOF); err != io.EOF {
+		t.Errorf("Expected the read error to be returned as is, got %v", err)
+	}
+	if err := guard.CheckReadError("10.0.0.1", err); !errors.Is(err, ErrHostBanned) || !errors.Is(err, network.ErrFrameTooLarge) {
+		t.Errorf("Expected the repeat offender to be banned, got %v", err)
+	}
+}
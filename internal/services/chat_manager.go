@@ -54,6 +54,11 @@ func (cm *ChatManager) Name() string {
 	return "ChatManager"
 }
 
+// Dependencies implements core.DependentService.
+func (cm *ChatManager) Dependencies() []string {
+	return []string{"Storage", "UserManager"}
+}
+
 // Run implements core.Service.
 func (cm *ChatManager) Run(ctx context.Context, wg *sync.WaitGroup) {
 }
@@ -64,8 +69,19 @@ func (cm *ChatManager) Close() error {
 }
 
 func (cm *ChatManager) MapEventToCommands(event core.Event) []core.Command {
-	// TODO
-	return nil
+	switch e := event.(type) {
+	case MessageSent:
+		return []core.Command{&SaveMessage{cm, e.From, e.PeerUserId, "", e.MessageId, e.From, e.Text, e.At}}
+	case MessageReceived:
+		// The mirrored messages were sent by the user to the peer from another device
+		if e.Mirrored {
+			return []core.Command{&SaveMessage{cm, e.From, e.To, "", e.MessageId, e.From, e.Text, e.At}}
+		}
+
+		return []core.Command{&SaveMessage{cm, e.To, e.From, e.FromName, e.MessageId, e.From, e.Text, e.At}}
+	default:
+		return nil
+	}
 }
 
 func (cm *ChatManager) GetChatsByUserId(userId int) ([]Chat, error) {
@@ -76,7 +92,7 @@ func (cm *ChatManager) GetChatsByUserId(userId int) ([]Chat, error) {
 
 	chats := make([]Chat, 0, len(attendatnces))
 	for _, attendance := range attendatnces {
-		channel, err := cm.channelRepo.GetOneBy("unique_id", attendance.ChannelId)
+		channel, err := cm.channelRepo.GetOne(attendance.ChannelId)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get channel: %s", err.Error())
 		}
@@ -101,13 +117,18 @@ func (cm *ChatManager) GetChatMessagesByChatId(chatId string) ([]ChatMessage, er
 	chatMessages := make([]ChatMessage, 0, len(messages))
 
 	for _, message := range messages {
-		user, err := cm.userManager.GetUserById(message.UserId)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get user: %s", err.Error())
+		// Messages of the peer have no local user, the chat is named after the peer
+		member := chat.Name
+		if message.UserId != 0 {
+			user, err := cm.userManager.GetUserById(message.UserId)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get user: %s", err.Error())
+			}
+			member = user.Name
 		}
 
 		chatMessages = append(chatMessages, ChatMessage{
-			Member: user.Name,
+			Member: member,
 			Text:   message.Text,
 			At:     message.CreatedAt,
 		})
@@ -115,3 +136,90 @@ func (cm *ChatManager) GetChatMessagesByChatId(chatId string) ([]ChatMessage, er
 
 	return chatMessages, nil
 }
+
+// SaveMessage stores the message in the chat of the user with the peer,
+// it reports false if the message with the same id is already stored there
+func (cm *ChatManager) SaveMessage(ownerId string, peerUserId string, peerName string, message *core.Message) (bool, error) {
+	owner, err := cm.userManager.GetUserByUniqueId(ownerId)
+	if err != nil {
+		return false, fmt.Errorf("failed to get user: %s", err.Error())
+	}
+
+	channel, err := cm.getOrCreateDirectChannel(owner, peerUserId, peerName)
+	if err != nil {
+		return false, err
+	}
+
+	stored, err := cm.messageRepo.GetAllBy("unique_id", message.UniqueId)
+	if err != nil {
+		return false, fmt.Errorf("failed to get messages: %s", err.Error())
+	}
+	for _, m := range stored {
+		if m.ChannelId == channel.Id {
+			return false, nil
+		}
+	}
+
+	message.ChannelId = channel.Id
+	if message.SenderId == owner.UniqueId {
+		message.UserId = owner.Id
+	}
+
+	if err := cm.messageRepo.Create(message); err != nil {
+		return false, fmt.Errorf("failed to create message: %s", err.Error())
+	}
+
+	return true, nil
+}
+
+// getOrCreateDirectChannel returns the chat of the user with the peer,
+// the chat is created and attended by the user on the first message
+func (cm *ChatManager) getOrCreateDirectChannel(owner *core.User, peerUserId string, peerName string) (*core.Channel, error) {
+	channelId := directChannelId(owner.UniqueId, peerUserId)
+
+	channels, err := cm.channelRepo.GetAllBy("unique_id", channelId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel: %s", err.Error())
+	}
+
+	if len(channels) > 0 {
+		channel := channels[0]
+		// The chat is named after the peer once the name is known
+		if peerName != "" && channel.Name != peerName {
+			channel.Name = peerName
+			if err := cm.channelRepo.Update(channel); err != nil {
+				return nil, fmt.Errorf("failed to update channel: %s", err.Error())
+			}
+		}
+
+		return channel, nil
+	}
+
+	name := peerName
+	if name == "" {
+		name = peerUserId
+	}
+
+	if err := cm.channelRepo.Create(&core.Channel{UniqueId: channelId, Name: name}); err != nil {
+		return nil, fmt.Errorf("failed to create channel: %s", err.Error())
+	}
+
+	// The id of the new channel is known only once it's read back
+	channels, err = cm.channelRepo.GetAllBy("unique_id", channelId)
+	if err != nil || len(channels) == 0 {
+		return nil, fmt.Errorf("failed to get channel: %v", err)
+	}
+	channel := channels[0]
+
+	if err := cm.attendanceRepo.Create(core.NewAttendance(owner.Id, channel.Id)); err != nil {
+		return nil, fmt.Errorf("failed to create attendance: %s", err.Error())
+	}
+
+	return channel, nil
+}
+
+// directChannelId is the unique id of the chat of the user with the peer,
+// each logged in user has its own chat with the peer
+func directChannelId(ownerId string, peerUserId string) string {
+	return ownerId + ":" + peerUserId
+}
@@ -3,11 +3,13 @@ package services
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/storage"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -116,8 +118,8 @@ func TestChatManager_GetChatsByUserId_Success(t *testing.T) {
 
 	// Setup mock expectations
 	attendanceRepo.On("GetAllBy", "user_id", userId).Return(attendances, nil)
-	channelRepo.On("GetOneBy", "unique_id", mock.Anything).Return(channels[0], nil).Once()
-	channelRepo.On("GetOneBy", "unique_id", mock.Anything).Return(channels[1], nil).Once()
+	channelRepo.On("GetOne", 10).Return(channels[0], nil).Once()
+	channelRepo.On("GetOne", 20).Return(channels[1], nil).Once()
 
 	chats, err := cm.GetChatsByUserId(userId)
 
@@ -189,7 +191,7 @@ func TestChatManager_GetChatsByUserId_ChannelError(t *testing.T) {
 
 	// Setup mock expectations
 	attendanceRepo.On("GetAllBy", "user_id", userId).Return(attendances, nil)
-	channelRepo.On("GetOneBy", "unique_id", mock.Anything).Return(nil, expectedError)
+	channelRepo.On("GetOne", 10).Return(nil, expectedError)
 
 	chats, err := cm.GetChatsByUserId(userId)
 
@@ -383,3 +385,59 @@ func TestChatManager_GetChatMessagesByChatId_UserError(t *testing.T) {
 		t.Errorf("Expected specific error message, got %s", err.Error())
 	}
 }
+
+func TestChatManager_SaveMessage_Storage(t *testing.T) {
+	s := storage.NewStorage(filepath.Join(t.TempDir(), "gotchat.db"))
+	if err := s.Init(); err != nil {
+		t.Fatalf("Failed to init storage: %v", err)
+	}
+	defer s.Close()
+
+	eventEmitter := core.NewMockEventEmitter(t)
+	eventEmitter.On("Emit", mock.Anything).Return()
+
+	um := NewUserManager(eventEmitter, s.GetUserRepository())
+	created, err := um.CreateUser("alice", "secret")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	alice, _ := um.GetUserByUniqueId(created.UniqueId)
+
+	cm := NewChatManager(um, s.GetChannelRepository(), s.GetAttendanceRepository(), s.GetMessageRepository())
+
+	at := time.Now()
+	events := []core.Event{
+		MessageReceived{MessageId: "message-1", From: "bob-id", FromName: "bob", To: alice.UniqueId, Text: "hi alice", At: at},
+		// The same message received again is stored once
+		MessageReceived{MessageId: "message-1", From: "bob-id", FromName: "bob", To: alice.UniqueId, Text: "hi alice", At: at},
+		MessageSent{MessageId: "message-2", From: alice.UniqueId, PeerUserId: "bob-id", Text: "hi bob", At: at.Add(time.Second)},
+		MessageReceived{MessageId: "message-3", From: alice.UniqueId, To: "bob-id", Text: "from the laptop", At: at.Add(2 * time.Second), Mirrored: true},
+	}
+	for _, e := range events {
+		for _, cmd := range cm.MapEventToCommands(e) {
+			if _, err := cmd.Execute(context.Background()); err != nil {
+				t.Fatalf("Failed to save the message of %T: %v", e, err)
+			}
+		}
+	}
+
+	chats, err := cm.GetChatsByUserId(alice.Id)
+	if err != nil || len(chats) != 1 || chats[0].Name != "bob" {
+		t.Fatalf("Expected the chat with bob, got %v (%v)", chats, err)
+	}
+
+	messages, err := cm.GetChatMessagesByChatId(chats[0].Id)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := []struct{ Member, Text string }{{"bob", "hi alice"}, {"alice", "hi bob"}, {"alice", "from the laptop"}}
+	if len(messages) != len(want) {
+		t.Fatalf("Expected %d messages, got %v", len(want), messages)
+	}
+	for i, message := range messages {
+		if message.Member != want[i].Member || message.Text != want[i].Text {
+			t.Errorf("Expected %s: %s, got %s: %s", want[i].Member, want[i].Text, message.Member, message.Text)
+		}
+	}
+}
@@ -2,38 +2,231 @@ package services
 
 import (
 	"context"
+	"time"
 
 	"github.com/hop-/gotchat/internal/core"
 )
 
 type Connect struct {
-	cm      *ConnectionManager
-	address string
+	cm         *ConnectionManager
+	address    string
+	peerUserId string
 }
 
 func (c *Connect) Execute(ctx context.Context) ([]core.Event, error) {
-	c.cm.Connect(c.address)
+	connId, err := c.cm.Connect(ctx, c.address, c.peerUserId)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil, nil
+	return []core.Event{ConnectionStarted{connId, c.address, c.peerUserId}}, nil
+}
+
+// Connecting waits for the handshake with the peer
+func (c *Connect) IsBlocking() bool {
+	return true
+}
+
+type Join struct {
+	cm  *ConnectionManager
+	uri string
 }
 
-type ChangeUserController struct {
+func (j *Join) Execute(ctx context.Context) ([]core.Event, error) {
+	connId, err := j.cm.Join(ctx, j.uri)
+	if err != nil {
+		return nil, err
+	}
+
+	// The invite was parsed by the join
+	invite, _ := ParseInviteLink(j.uri)
+
+	return []core.Event{ConnectionStarted{connId, invite.Address, invite.UserId}}, nil
+}
+
+// Joining waits for the handshake with the inviter
+func (j *Join) IsBlocking() bool {
+	return true
+}
+
+type AddUserController struct {
 	cm   *ConnectionManager
 	User *core.User
 }
 
-func (c *ChangeUserController) Execute(ctx context.Context) ([]core.Event, error) {
-	c.cm.changeUserController(c.User)
+func (a *AddUserController) Execute(ctx context.Context) ([]core.Event, error) {
+	a.cm.addUserController(a.User)
 
 	return nil, nil
 }
 
+type SwitchUserController struct {
+	cm     *ConnectionManager
+	userId string
+}
+
+func (s *SwitchUserController) Execute(ctx context.Context) ([]core.Event, error) {
+	return nil, s.cm.switchUserController(s.userId)
+}
+
 type RemoveUserController struct {
-	cm *ConnectionManager
+	cm     *ConnectionManager
+	userId string
 }
 
 func (r *RemoveUserController) Execute(ctx context.Context) ([]core.Event, error) {
-	r.cm.removeUserController()
+	r.cm.removeUserController(r.userId)
+
+	return nil, nil
+}
+
+type StartAnnouncing struct {
+	dm   *DiscoveryManager
+	User *core.User
+}
+
+func (s *StartAnnouncing) Execute(ctx context.Context) ([]core.Event, error) {
+	s.dm.startAnnouncing(s.User)
+
+	return nil, nil
+}
+
+type StopAnnouncing struct {
+	dm     *DiscoveryManager
+	userId string
+}
+
+func (s *StopAnnouncing) Execute(ctx context.Context) ([]core.Event, error) {
+	s.dm.stopAnnouncing(s.userId)
 
 	return nil, nil
 }
+
+type ResolveConnectionRequest struct {
+	cm        *ConnectionManager
+	requestId string
+	accept    bool
+}
+
+func (r *ResolveConnectionRequest) Execute(ctx context.Context) ([]core.Event, error) {
+	if err := r.cm.ResolveConnectionRequest(r.requestId, r.accept); err != nil {
+		return nil, err
+	}
+
+	return []core.Event{ConnectionRequestResolved{r.requestId, r.accept}}, nil
+}
+
+type ChangePeerPolicyOwner struct {
+	pm    *PeerPolicyManager
+	owner string
+}
+
+func (c *ChangePeerPolicyOwner) Execute(ctx context.Context) ([]core.Event, error) {
+	c.pm.setOwner(c.owner)
+
+	return nil, nil
+}
+
+type ReleasePeerPolicyOwner struct {
+	pm    *PeerPolicyManager
+	owner string
+}
+
+func (r *ReleasePeerPolicyOwner) Execute(ctx context.Context) ([]core.Event, error) {
+	r.pm.releaseOwner(r.owner)
+
+	return nil, nil
+}
+
+type SetPeerPolicy struct {
+	pm     *PeerPolicyManager
+	policy string
+}
+
+func (s *SetPeerPolicy) Execute(ctx context.Context) ([]core.Event, error) {
+	owner, err := s.pm.currentOwner()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, s.pm.SetPolicy(owner, s.policy)
+}
+
+type UpdatePeerRule struct {
+	pm     *PeerPolicyManager
+	kind   string
+	value  string
+	remove bool
+	// The current owner if empty
+	owner string
+}
+
+func (u *UpdatePeerRule) Execute(ctx context.Context) ([]core.Event, error) {
+	owner := u.owner
+	if owner == "" {
+		var err error
+		owner, err = u.pm.currentOwner()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if u.remove {
+		return nil, u.pm.RemoveRule(owner, u.kind, u.value)
+	}
+
+	return nil, u.pm.AddRule(owner, u.kind, u.value)
+}
+
+type SendMessage struct {
+	cm         *ConnectionManager
+	peerUserId string
+	text       string
+	messageId  string
+}
+
+func (s *SendMessage) Execute(ctx context.Context) ([]core.Event, error) {
+	_, err := s.cm.SendMessage(s.peerUserId, s.text, s.messageId)
+
+	return nil, err
+}
+
+// Sending waits for the peer's connections
+func (s *SendMessage) IsBlocking() bool {
+	return true
+}
+
+// Messages to the same peer are sent in order
+func (s *SendMessage) OrderingKey() string {
+	return "message:" + s.peerUserId
+}
+
+type SaveMessage struct {
+	cm         *ChatManager
+	owner      string
+	peerUserId string
+	peerName   string
+	messageId  string
+	from       string
+	text       string
+	at         time.Time
+}
+
+func (s *SaveMessage) Execute(ctx context.Context) ([]core.Event, error) {
+	message := &core.Message{UniqueId: s.messageId, SenderId: s.from, Text: s.text, CreatedAt: s.at}
+	if _, err := s.cm.SaveMessage(s.owner, s.peerUserId, s.peerName, message); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// Saving waits for the storage
+func (s *SaveMessage) IsBlocking() bool {
+	return true
+}
+
+// Messages of the same chat are saved in order, so that a message is stored once
+func (s *SaveMessage) OrderingKey() string {
+	return "chat:" + directChannelId(s.owner, s.peerUserId)
+}
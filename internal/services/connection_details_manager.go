@@ -17,6 +17,12 @@ type KeyManager struct {
 	kek []byte
 }
 
+func newKeyManager() *KeyManager {
+	return &KeyManager{
+		kek: []byte("this-is-a-very-secure-key-------"),
+	} // TODO: Hardcoded
+}
+
 func (k *KeyManager) WrapKey(key []byte) ([]byte, error) {
 	block, err := aes.NewCipher(k.kek)
 	if err != nil {
@@ -131,9 +137,7 @@ func NewConnectionDetailsManager(eventEmitter core.EventEmitter, connectionDetai
 	return &ConnectionDetailsManager{
 		eventEmitter,
 		connectionDetailsRepo,
-		&KeyManager{
-			kek: []byte("this-is-a-very-secure-key-------"),
-		}, // TODO: Hardcoded
+		newKeyManager(),
 	}
 }
 
@@ -153,6 +157,11 @@ func (m *ConnectionDetailsManager) Name() string {
 	return "ConnectionDetailsManager"
 }
 
+// Dependencies implements core.DependentService.
+func (m *ConnectionDetailsManager) Dependencies() []string {
+	return []string{"Storage"}
+}
+
 // Run implements core.Service.
 func (m *ConnectionDetailsManager) Run(ctx context.Context, wg *sync.WaitGroup) {
 	// This service does not run any background tasks.
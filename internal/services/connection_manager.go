@@ -2,8 +2,12 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/hop-/gotchat/internal/core"
 	"github.com/hop-/gotchat/pkg/log"
@@ -14,6 +18,8 @@ import (
 const (
 	ConnectionStateKnown   = "KNOWN"
 	ConnectionStateUnknown = "UNKNOWN"
+	// Sent instead of the state when the inbound peer isn't accepted
+	ConnectionStateRejected = "REJECTED"
 )
 
 // ConnectionManager Service
@@ -24,26 +30,70 @@ type ConnectionManager struct {
 
 	eventEmitter core.EventEmitter
 	server       *Server
+	relay        *Relay
 
-	// User controller
-	userController *UserController
+	// Why the server stopped accepting connections, nil while it works
+	serverErr error
+
+	// Abuse protection for inbound connections, nil if disabled
+	guard *AbuseGuard
+
+	// Relay registrations of the logged in users by their unique id
+	relayRegistrations map[string]*relayLink
+
+	// User controllers of the logged in users by their unique id
+	userControllers map[string]*UserController
+
+	// Unique id of the user outbound connections are made for
+	activeUserId string
+
+	// Inbound connections which are not handed to a user controller yet
+	routing atomic.Int32
 
 	// User manager
 	userManager *UserManager
 
 	// Connection details manager
 	connectionDetailsManager *ConnectionDetailsManager
+
+	// Peer policy manager
+	peerPolicyManager *PeerPolicyManager
+
+	// Invite manager
+	inviteManager *InviteManager
+
+	// Device manager
+	deviceManager *DeviceManager
 }
 
-func NewConnectionManager(eventEmitter core.EventEmitter, server *Server, userManager *UserManager, connectionDetailsManager *ConnectionDetailsManager) *ConnectionManager {
+func NewConnectionManager(
+	eventEmitter core.EventEmitter,
+	server *Server,
+	relay *Relay,
+	guard *AbuseGuard,
+	userManager *UserManager,
+	connectionDetailsManager *ConnectionDetailsManager,
+	peerPolicyManager *PeerPolicyManager,
+	inviteManager *InviteManager,
+	deviceManager *DeviceManager,
+) *ConnectionManager {
 	return &ConnectionManager{
 		AtomicRunningStatus{},
 		sync.RWMutex{},
 		eventEmitter,
 		server,
+		relay,
 		nil,
+		guard,
+		make(map[string]*relayLink),
+		make(map[string]*UserController),
+		"",
+		atomic.Int32{},
 		userManager,
 		connectionDetailsManager,
+		peerPolicyManager,
+		inviteManager,
+		deviceManager,
 	}
 }
 
@@ -64,6 +114,17 @@ func (cm *ConnectionManager) Name() string {
 	return "ConnectionManager"
 }
 
+// Dependencies implements core.DependentService.
+func (cm *ConnectionManager) Dependencies() []string {
+	return []string{
+		"UserManager",
+		"ConnectionDetailsManager",
+		"PeerPolicyManager",
+		"InviteManager",
+		"DeviceManager",
+	}
+}
+
 // Run implements core.Service.
 func (cm *ConnectionManager) Run(ctx context.Context, wg *sync.WaitGroup) {
 	if cm.isRunning() {
@@ -81,9 +142,49 @@ func (cm *ConnectionManager) Run(ctx context.Context, wg *sync.WaitGroup) {
 		return
 	}
 
+	wg.Add(1)
 	cm.runServer(ctx, wg)
 }
 
+// Health implements core.HealthChecker.
+func (cm *ConnectionManager) Health() error {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.serverErr
+}
+
+// RestartPolicy implements core.SupervisedService.
+func (cm *ConnectionManager) RestartPolicy() core.RestartPolicy {
+	return core.RestartPolicy{
+		Mode:       core.RestartOnFailure,
+		Backoff:    time.Second,
+		MaxBackoff: time.Minute,
+	}
+}
+
+// Restart implements core.Restarter.
+// Only the server listens again, the connections of the logged in users are kept
+func (cm *ConnectionManager) Restart(ctx context.Context, wg *sync.WaitGroup) error {
+	if cm.server == nil {
+		return nil
+	}
+
+	if err := cm.server.Restart(); err != nil {
+		return fmt.Errorf("failed to restart server: %w", err)
+	}
+
+	cm.mu.Lock()
+	cm.serverErr = nil
+	cm.mu.Unlock()
+
+	// The goroutine is counted before it starts, so the supervisor can't miss it
+	wg.Add(1)
+	go cm.runServer(ctx, wg)
+
+	return nil
+}
+
 // Close implements core.Service.
 func (cm *ConnectionManager) Close() error {
 	cm.setRunningStatus(false)
@@ -91,11 +192,14 @@ func (cm *ConnectionManager) Close() error {
 		cm.server.Close()
 	}
 
-	cm.mu.RLock()
-	defer cm.mu.RUnlock()
-	// Close the user controller if it exists
-	if cm.userController != nil {
-		if err := cm.userController.Close(); err != nil {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	// Close the user controllers of all logged in users
+	for userId, uc := range cm.userControllers {
+		cm.closeRelayRegistration(userId)
+
+		if err := uc.Close(); err != nil {
 			log.Errorf("Failed to close user controller: %v", err)
 		}
 	}
@@ -109,53 +213,138 @@ func (cm *ConnectionManager) MapEventToCommands(event core.Event) []core.Command
 	switch e := event.(type) {
 	case core.ConnectEvent:
 		address := fmt.Sprintf("%s:%s", e.Host, e.Port)
-		commands = append(commands, &Connect{cm, address})
-		// TODO: utilize the returned connection ID
+		commands = append(commands, &Connect{cm, address, e.PeerUserId})
+	case core.JoinEvent:
+		commands = append(commands, &Join{cm, e.URI})
 	case core.UserLoggedInEvent:
-		commands = append(commands, &ChangeUserController{cm, e.User})
+		commands = append(commands, &AddUserController{cm, e.User})
+	case core.SwitchUserEvent:
+		commands = append(commands, &SwitchUserController{cm, e.User.UniqueId})
 	case core.UserLoggedOutEvent:
-		commands = append(commands, &RemoveUserController{cm})
+		commands = append(commands, &RemoveUserController{cm, e.User.UniqueId})
+	case core.ConnectionRequestDecisionEvent:
+		commands = append(commands, &ResolveConnectionRequest{cm, e.RequestId, e.Accept})
+	case core.SendMessageEvent:
+		commands = append(commands, &SendMessage{cm, e.PeerUserId, e.Text, e.MessageId})
 	}
 
 	return commands
 }
 
-func (cm *ConnectionManager) Connect(address string) (string, error) {
+// ActiveUserId returns the unique id of the user outbound connections are made for
+func (cm *ConnectionManager) ActiveUserId() string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.activeUserId
+}
+
+// Connect dials the address directly and falls back to the relay for the given peer if configured
+func (cm *ConnectionManager) Connect(ctx context.Context, address string, peerUserId string) (string, error) {
+	uc, conn, err := cm.dial(ctx, address, peerUserId)
+	if err != nil {
+		cm.emitEvent(ConnectionFailed{err})
+
+		return "", err
+	}
+
+	return uc.RegisterOutbound(conn, peerUserId), nil
+}
+
+// Join makes the first contact with the user who issued the invite
+func (cm *ConnectionManager) Join(ctx context.Context, uri string) (string, error) {
+	invite, err := ParseInviteLink(uri)
+	if err == nil && invite.Expired(time.Now()) {
+		err = ErrInviteExpired
+	}
+	if err != nil {
+		cm.emitEvent(ConnectionFailed{err})
+
+		return "", err
+	}
+
+	uc, conn, err := cm.dial(ctx, invite.Address, invite.UserId)
+	if err != nil {
+		cm.emitEvent(ConnectionFailed{err})
+
+		return "", err
+	}
+
+	return uc.RegisterWithInvite(conn, invite), nil
+}
+
+// dial connects to the address for the active user directly and falls back to the relay for the given peer if configured,
+// the connection belongs to the user who was active when it was started
+func (cm *ConnectionManager) dial(ctx context.Context, address string, peerUserId string) (*UserController, *network.Conn, error) {
 	cm.mu.RLock()
-	if !cm.isRunning() || cm.userController == nil {
+	uc := cm.activeController()
+	if !cm.isRunning() || uc == nil {
 		log.Errorf("ConnectionManager is not running or user controller is not initialized")
 
 		cm.mu.RUnlock()
-		return "", fmt.Errorf("connection manager is not running or user controller is not initialized")
+		return nil, nil, fmt.Errorf("connection manager is not running or user controller is not initialized")
 	}
 	cm.mu.RUnlock()
 
 	client := NewClient(address)
-	conn, err := client.Connect()
+	conn, err := client.Connect(ctx)
+	if err != nil && ctx.Err() == nil && cm.relay != nil && peerUserId != "" {
+		log.Warnf("Failed to connect to %s directly, falling back to relay: %v", address, err)
+		conn, err = cm.relay.Dial(uc.user.UniqueId, peerUserId)
+	}
 	if err != nil {
-		cm.emitEvent(ConnectionFailed{err})
+		return nil, nil, err
+	}
 
-		return "", err
+	// The user could log out while dialing
+	if !uc.isRunning() {
+		conn.Close()
+
+		return nil, nil, fmt.Errorf("user %s is logged out", uc.user.Name)
 	}
 
+	return uc, conn, nil
+}
+
+// SendMessage sends the text to the peer from the active user,
+// the id of the message is generated if empty
+func (cm *ConnectionManager) SendMessage(peerUserId string, text string, messageId string) (string, error) {
+	cm.mu.RLock()
+	uc := cm.activeController()
+	cm.mu.RUnlock()
+
+	if uc == nil {
+		return "", fmt.Errorf("no user is logged in")
+	}
+
+	return uc.SendMessage(peerUserId, text, messageId)
+}
+
+// ResolveConnectionRequest accepts or rejects the inbound connection waiting for one of the users
+func (cm *ConnectionManager) ResolveConnectionRequest(requestId string, accept bool) error {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
-	if cm.userController == nil {
-		conn.Close()
 
-		return "", fmt.Errorf("user controller is not initialized")
+	if len(cm.userControllers) == 0 {
+		return fmt.Errorf("user controller is not initialized")
+	}
+
+	for _, uc := range cm.userControllers {
+		if err := uc.ResolveConnectionRequest(requestId, accept); err == nil {
+			return nil
+		}
 	}
-	connId := cm.userController.Register(conn, true)
 
-	return connId, nil
+	return fmt.Errorf("connection request %s not found", requestId)
 }
 
 func (cm *ConnectionManager) emitEvent(event core.Event) {
 	cm.eventEmitter.Emit(event)
 }
 
+// runServer accepts the connections until the server is closed
+// Note: wg.Add must be called by the caller
 func (cm *ConnectionManager) runServer(ctx context.Context, wg *sync.WaitGroup) {
-	wg.Add(1)
 	defer wg.Done()
 
 	for cm.isRunning() && cm.server.IsInitialized() {
@@ -165,6 +354,18 @@ func (cm *ConnectionManager) runServer(ctx context.Context, wg *sync.WaitGroup)
 			cm.setRunningStatus(false)
 		default:
 			conn, err := cm.server.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				// The listener is gone, the supervisor notices it unless the manager is closing
+				if cm.isRunning() && ctx.Err() == nil {
+					log.Errorf("Server stopped accepting connections: %v", err)
+
+					cm.mu.Lock()
+					cm.serverErr = fmt.Errorf("server stopped accepting connections: %w", err)
+					cm.mu.Unlock()
+				}
+
+				return
+			}
 			if err != nil {
 				log.Errorf("Failed to accept connection: %v", err)
 				cm.emitEvent(ConnectionAcceptError{err})
@@ -172,47 +373,296 @@ func (cm *ConnectionManager) runServer(ctx context.Context, wg *sync.WaitGroup)
 				continue
 			}
 
-			cm.mu.RLock()
-			defer cm.mu.RUnlock()
-			if cm.userController != nil {
-				cm.userController.Register(conn, false)
-			} else {
-				// TODO: Handle connection without user controller
-				log.Infof("No UserController initialized, closing connection")
+			cm.acceptConnection(conn)
+		}
+	}
+}
+
+func (cm *ConnectionManager) acceptConnection(conn *network.Conn) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
 
-				conn.Close()
-			}
+	if len(cm.userControllers) == 0 {
+		// TODO: Handle connection without user controller
+		log.Infof("No UserController initialized, closing connection")
+
+		conn.Close()
+
+		return
+	}
+
+	host := network.RemoteHost(conn.Conn())
+	if err := cm.guard.AllowAccept(host, cm.unauthenticatedCount()); err != nil {
+		log.Warnf("Rejecting connection from %s: %v", host, err)
+
+		conn.Close()
+
+		return
+	}
+	cm.guard.LimitFrames(conn)
+
+	// The peer names the user it wants to reach in the first message
+	cm.routing.Add(1)
+	go cm.routeConnection(conn, host)
+}
+
+// routeConnection reads the introduction of the inbound peer
+// and hands the connection to the controller of the user it's meant for
+func (cm *ConnectionManager) routeConnection(conn *network.Conn, host string) {
+	defer cm.routing.Add(-1)
+
+	// The peer gets limited time to finish the handshake
+	if timeout := cm.guard.HandshakeTimeout(); timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	msg, err := conn.Read()
+	if err == nil && network.ActionOf(msg) == actionLinkDevice {
+		// A new device of a user is being linked, it doesn't need the user to be logged in
+		defer conn.Close()
+		cm.acceptDeviceLink(msg, host, conn)
+
+		return
+	}
+
+	var peer *handshakePeer
+	if err == nil {
+		peer, err = decodeHandshakePeer(msg)
+	}
+	if err != nil {
+		conn.Close()
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			err = cm.guard.ReportViolation(host, ErrHandshakeDeadlineReached)
+		} else {
+			err = cm.guard.CheckReadError(host, err)
 		}
+
+		log.Errorf("Failed to read the introduction of the peer from %s: %v", host, err)
+		cm.emitEvent(ConnectionFailed{err})
+
+		return
+	}
+
+	cm.mu.RLock()
+	uc := cm.routeTarget(peer.Target)
+	cm.mu.RUnlock()
+
+	if uc == nil {
+		log.Infof("Rejecting connection from %s to user %s who isn't logged in", host, peer.Target)
+
+		conn.Close()
+
+		return
 	}
+
+	uc.registerRouted(conn, host, peer)
 }
 
-func (cm *ConnectionManager) changeUserController(user *core.User) {
+// acceptDeviceLink hands the identity over to the new device which knows the link secret
+func (cm *ConnectionManager) acceptDeviceLink(msg *network.Message, host string, conn *network.Conn) {
+	request, err := network.DecodeAs[linkDevicePayload](msg, actionLinkDevice)
+	if err == nil {
+		err = cm.deviceManager.AcceptLink(conn, request)
+	}
+	if err != nil {
+		log.Errorf("Failed to link a new device from %s: %v", host, err)
+		cm.emitEvent(ConnectionFailed{err})
+	}
+}
+
+// routeTarget returns the controller of the target user,
+// peers which don't name the target reach the active user
+// Note: cm.mu must be held by the caller
+func (cm *ConnectionManager) routeTarget(target string) *UserController {
+	if target == "" {
+		return cm.activeController()
+	}
+
+	return cm.userControllers[target]
+}
+
+// activeController returns the controller of the active user, nil if no user is logged in
+// Note: cm.mu must be held by the caller
+func (cm *ConnectionManager) activeController() *UserController {
+	return cm.userControllers[cm.activeUserId]
+}
+
+// unauthenticatedCount returns the number of inbound connections which didn't finish the handshake
+// Note: cm.mu must be held by the caller
+func (cm *ConnectionManager) unauthenticatedCount() int {
+	count := int(cm.routing.Load())
+	for _, uc := range cm.userControllers {
+		count += uc.UnauthenticatedCount()
+	}
+
+	return count
+}
+
+// addUserController logs the user in next to the others and makes it the active one
+func (cm *ConnectionManager) addUserController(user *core.User) {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
-	if cm.userController != nil {
-		log.Warnf("UserController is already initialized, removing previous user controller")
-		if err := cm.userController.Close(); err != nil {
-			log.Errorf("Failed to close previous user controller: %v", err)
-		}
+	if _, ok := cm.userControllers[user.UniqueId]; ok {
+		log.Infof("UserController is already initialized for user %s, making it active", user.Name)
+		cm.activeUserId = user.UniqueId
+
+		return
 	}
-	cm.userController = NewUserController(user, cm.eventEmitter, cm.userManager, cm.connectionDetailsManager)
-	cm.userController.setRunningStatus(true)
+
+	uc := NewUserController(user, cm.eventEmitter, cm.userManager, cm.connectionDetailsManager, cm.guard, cm.peerPolicyManager, cm.inviteManager, cm.deviceManager)
+	uc.setRunningStatus(true)
+	cm.userControllers[user.UniqueId] = uc
+	cm.activeUserId = user.UniqueId
 	log.Infof("UserController initialized for user %s", user.Name)
+
+	if cm.relay != nil {
+		link := &relayLink{make(chan struct{}), nil}
+		cm.relayRegistrations[user.UniqueId] = link
+
+		// The relay is dialed without holding the lock
+		go cm.keepRelayRegistration(uc, link)
+	}
 }
 
-func (cm *ConnectionManager) removeUserController() {
+// switchUserController makes the logged in user the active one
+func (cm *ConnectionManager) switchUserController(userId string) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
-	if cm.userController != nil {
-		log.Infof("UserController is closing for user %s", cm.userController.user.Name)
-		if err := cm.userController.Close(); err != nil {
-			log.Errorf("Failed to close user controller: %v", err)
+	uc, ok := cm.userControllers[userId]
+	if !ok {
+		return fmt.Errorf("user %s is not logged in", userId)
+	}
+
+	cm.activeUserId = userId
+	log.Infof("Switched to user %s", uc.user.Name)
+
+	return nil
+}
+
+func (cm *ConnectionManager) removeUserController(userId string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	uc, ok := cm.userControllers[userId]
+	if !ok {
+		log.Warnf("No UserController initialized for user %s, nothing to close", userId)
+
+		return
+	}
+
+	cm.closeRelayRegistration(userId)
+
+	log.Infof("UserController is closing for user %s", uc.user.Name)
+	if err := uc.Close(); err != nil {
+		log.Errorf("Failed to close user controller: %v", err)
+	}
+	delete(cm.userControllers, userId)
+
+	// The UI picks the next active user
+	if cm.activeUserId == userId {
+		cm.activeUserId = ""
+	}
+}
+
+// keepRelayRegistration registers the user on the relay and accepts relayed connections,
+// the user is registered again whenever the registration is lost until the link is stopped
+func (cm *ConnectionManager) keepRelayRegistration(uc *UserController, link *relayLink) {
+	delay := relayRetryDelay
+	for {
+		registration, err := cm.relay.Register(uc.user.UniqueId)
+		if err != nil {
+			log.Errorf("Failed to register user %s on relay: %v", uc.user.Name, err)
+			cm.emitEvent(RelayRegistrationFailed{err})
+		} else {
+			cm.mu.Lock()
+			stopped := link.stopped()
+			if !stopped {
+				link.registration = registration
+			}
+			cm.mu.Unlock()
+
+			if stopped {
+				registration.Close()
+
+				return
+			}
+
+			cm.emitEvent(RelayRegistered{uc.user.UniqueId})
+			delay = relayRetryDelay
+
+			cm.acceptRelayedConnections(registration, uc)
+
+			cm.mu.Lock()
+			stopped = link.stopped()
+			link.registration = nil
+			cm.mu.Unlock()
+
+			if stopped {
+				return
+			}
+
+			registration.Close()
+			log.Warnf("Relay registration of user %s is lost, registering again", uc.user.Name)
+		}
+
+		select {
+		case <-link.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, relayMaxRetryDelay)
+	}
+}
+
+// closeRelayRegistration stops the relay registration of the user if any
+// Note: cm.mu must be held by the caller
+func (cm *ConnectionManager) closeRelayRegistration(userId string) {
+	link, ok := cm.relayRegistrations[userId]
+	if !ok {
+		return
+	}
+
+	close(link.stop)
+	if link.registration != nil {
+		if err := link.registration.Close(); err != nil {
+			log.Errorf("Failed to close relay registration: %v", err)
 		}
-		cm.userController = nil
-	} else {
-		log.Warnf("No UserController initialized, nothing to close")
+	}
+	delete(cm.relayRegistrations, userId)
+}
+
+func (cm *ConnectionManager) acceptRelayedConnections(registration *network.RelayRegistration, uc *UserController) {
+	for {
+		incoming, err := registration.Next()
+		if err != nil {
+			if !network.IsClosedError(err) {
+				log.Errorf("Relay registration failed: %v", err)
+				cm.emitEvent(RelayRegistrationFailed{err})
+			}
+
+			return
+		}
+
+		log.Infof("Incoming relayed connection from %s", incoming.PeerUserId)
+		conn, err := cm.relay.Accept(incoming.SessionId)
+		if err != nil {
+			log.Errorf("Failed to accept relayed connection: %v", err)
+			cm.emitEvent(ConnectionFailed{err})
+
+			continue
+		}
+
+		if !uc.isRunning() {
+			conn.Close()
+
+			return
+		}
+
+		uc.RegisterRelayed(conn)
 	}
 }
 
@@ -248,6 +698,16 @@ func (s *Server) Init() error {
 	return nil
 }
 
+// Restart listens again after the listener failed, the server must not be accepting meanwhile
+func (s *Server) Restart() error {
+	if s.listener != nil {
+		s.listener.Close()
+		s.listener = nil
+	}
+
+	return s.Init()
+}
+
 func (s *Server) IsInitialized() bool {
 	return s.listener != nil
 }
@@ -284,15 +744,78 @@ func NewClient(address string) *Client {
 	}
 }
 
-func (c *Client) Connect() (*network.Conn, error) {
-	t := network.NewTcpTransport()
+// Connect dials the address unless the context is done first
+func (c *Client) Connect(ctx context.Context) (*network.Conn, error) {
+	var dialer net.Dialer
 
 	log.Infof("Connecting to %s", c.address)
-	conn, err := t.Connect(c.address)
+	conn, err := dialer.DialContext(ctx, "tcp", c.address)
 	if err != nil {
 		return nil, err
 	}
 	log.Infof("Connected successfully to %s", c.address)
 
+	return network.NewConn(conn), nil
+}
+
+// Delays between the attempts to register on the relay
+const (
+	relayRetryDelay    = time.Second
+	relayMaxRetryDelay = time.Minute
+)
+
+// relayLink keeps a logged in user registered on the relay
+type relayLink struct {
+	// Closed once the user logs out
+	stop chan struct{}
+	// Current registration, nil while the user is registering
+	registration *network.RelayRegistration
+}
+
+// stopped reports whether the user logged out
+// Note: cm.mu must be held by the caller
+func (l *relayLink) stopped() bool {
+	select {
+	case <-l.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Network Relay
+type Relay struct {
+	client *network.RelayClient
+}
+
+func NewRelay(address string) *Relay {
+	return &Relay{
+		network.NewRelayClient(network.NewTcpTransport(), address),
+	}
+}
+
+func (r *Relay) Register(userId string) (*network.RelayRegistration, error) {
+	log.Infof("Registering on relay %s", r.client.Address())
+	registration, err := r.client.Register(userId)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Registered successfully on relay %s", r.client.Address())
+
+	return registration, nil
+}
+
+func (r *Relay) Dial(userId string, peerUserId string) (*network.Conn, error) {
+	log.Infof("Connecting to %s through relay %s", peerUserId, r.client.Address())
+	conn, err := r.client.Dial(userId, peerUserId)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Connected successfully to %s through relay", peerUserId)
+
 	return conn, nil
 }
+
+func (r *Relay) Accept(sessionId string) (*network.Conn, error) {
+	return r.client.Accept(sessionId)
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/pkg/network"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestConnectionManager(t *testing.T) *ConnectionManager {
+	eventEmitter := core.NewMockEventEmitter(t)
+	eventEmitter.On("Emit", mock.Anything).Maybe()
+
+	cdm := NewConnectionDetailsManager(eventEmitter, newMemoryConnectionDetailsRepo())
+	cm := NewConnectionManager(eventEmitter, nil, nil, nil, nil, cdm, nil, nil, nil)
+	cm.setRunningStatus(true)
+
+	return cm
+}
+
+// dialTestConnectionManager makes the handshake of the caller with the manager's server side
+func dialTestConnectionManager(t *testing.T, caller *UserController, cm *ConnectionManager, target string) handshakeResult {
+	c1, c2 := newTestConnPair(t)
+
+	cm.acceptConnection(network.NewConn(c2))
+
+	conn, peer, err := caller.handshake("caller-conn", network.NewConn(c1), true, "", target, nil, nil)
+	if err != nil {
+		c1.Close()
+	}
+
+	return newHandshakeResult(conn, peer, err)
+}
+
+func TestConnectionManager_Identities(t *testing.T) {
+	cm := newTestConnectionManager(t)
+	defer cm.Close()
+
+	alice := core.NewUser("alice", "password")
+	bob := core.NewUser("bob", "password")
+
+	cm.addUserController(alice)
+	cm.addUserController(bob)
+
+	// The last logged in user is the active one, the others stay logged in
+	if cm.ActiveUserId() != bob.UniqueId || len(cm.userControllers) != 2 {
+		t.Fatalf("Expected bob to be active next to alice, got %s of %d", cm.ActiveUserId(), len(cm.userControllers))
+	}
+
+	if err := cm.switchUserController(alice.UniqueId); err != nil || cm.ActiveUserId() != alice.UniqueId {
+		t.Errorf("Expected alice to be active, got %s: %v", cm.ActiveUserId(), err)
+	}
+
+	if err := cm.switchUserController("nobody"); err == nil {
+		t.Error("Expected switching to a logged out user to fail")
+	}
+
+	cm.removeUserController(alice.UniqueId)
+	if cm.ActiveUserId() != "" || len(cm.userControllers) != 1 {
+		t.Errorf("Expected no active user and bob logged in, got %s of %d", cm.ActiveUserId(), len(cm.userControllers))
+	}
+
+	// Logging in again only switches
+	uc := cm.userControllers[bob.UniqueId]
+	cm.addUserController(bob)
+	if cm.ActiveUserId() != bob.UniqueId || cm.userControllers[bob.UniqueId] != uc {
+		t.Error("Expected bob's controller to be kept and made active")
+	}
+}
+
+func TestConnectionManager_RouteInbound(t *testing.T) {
+	cm := newTestConnectionManager(t)
+	defer cm.Close()
+
+	alice := core.NewUser("alice", "password")
+	bob := core.NewUser("bob", "password")
+
+	cm.addUserController(alice)
+	cm.addUserController(bob)
+
+	carol := newTestUserController(t, "carol")
+
+	for _, target := range []*core.User{alice, bob} {
+		result := dialTestConnectionManager(t, carol, cm, target.UniqueId)
+		if result.err != nil {
+			t.Fatalf("Expected to reach %s, got %v", target.Name, result.err)
+		}
+		if result.peerUserId != target.UniqueId {
+			t.Errorf("Expected to reach %s, got %s", target.UniqueId, result.peerUserId)
+		}
+		result.conn.Close()
+	}
+
+	// Peers which don't name the target reach the active user
+	result := dialTestConnectionManager(t, carol, cm, "")
+	if result.err != nil || result.peerUserId != bob.UniqueId {
+		t.Errorf("Expected to reach the active user, got %s: %v", result.peerUserId, result.err)
+	}
+	if result.conn != nil {
+		result.conn.Close()
+	}
+
+	// Users who aren't logged in can't be reached
+	result = dialTestConnectionManager(t, carol, cm, "nobody")
+	if result.err == nil {
+		t.Error("Expected the connection to a logged out user to fail")
+	}
+}
+
+func TestConnectionManager_RestartServer(t *testing.T) {
+	eventEmitter := core.NewMockEventEmitter(t)
+	eventEmitter.On("Emit", mock.Anything).Maybe()
+
+	// Free port for the server to listen on again after the restart
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	address := probe.Addr().String()
+	probe.Close()
+
+	server := NewServer(address)
+	cm := NewConnectionManager(eventEmitter, server, nil, nil, nil, nil, nil, nil, nil)
+	if err := cm.Init(); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	defer func() {
+		cancel()
+		cm.Close()
+		wg.Wait()
+	}()
+
+	go cm.Run(ctx, wg)
+
+	// The listener fails while the manager runs
+	time.Sleep(10 * time.Millisecond)
+	server.listener.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for cm.Health() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the server failure to be reported")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := cm.Restart(ctx, wg); err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	if err := cm.Health(); err != nil {
+		t.Errorf("Expected the server to be healthy after restart, got %v", err)
+	}
+
+	// The new listener accepts connections
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("Failed to connect after restart: %v", err)
+	}
+	conn.Close()
+}
+
+// relayTestListener adapts net.Listener to network.BasicListener
+type relayTestListener struct {
+	net.Listener
+}
+
+func (l relayTestListener) Accept() (network.BasicConn, error) {
+	return l.Listener.Accept()
+}
+
+// relayRegistration returns the current relay registration of the user, nil while registering
+func relayRegistration(cm *ConnectionManager, userId string) *network.RelayRegistration {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if link, ok := cm.relayRegistrations[userId]; ok {
+		return link.registration
+	}
+
+	return nil
+}
+
+func TestConnectionManager_RelayRegistration(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	relay := network.NewRelay(network.NewListener(relayTestListener{l}), time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go relay.Serve(ctx)
+
+	cm := newTestConnectionManager(t)
+	cm.relay = NewRelay(l.Addr().String())
+	defer cm.Close()
+
+	alice := core.NewUser("alice", "password")
+	cm.addUserController(alice)
+
+	waitRegistration := func(previous *network.RelayRegistration) *network.RelayRegistration {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if registration := relayRegistration(cm, alice.UniqueId); registration != nil && registration != previous {
+				return registration
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("Expected alice to be registered on the relay")
+
+		return nil
+	}
+
+	// A lost registration is made again
+	registration := waitRegistration(nil)
+	registration.Close()
+	waitRegistration(registration)
+
+	cm.removeUserController(alice.UniqueId)
+	if _, ok := cm.relayRegistrations[alice.UniqueId]; ok {
+		t.Error("Expected the relay registration to be stopped on logout")
+	}
+}
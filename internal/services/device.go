@@ -0,0 +1,73 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	ErrUnknownDevice          = errors.New("unknown device")
+	ErrDeviceIdentityMismatch = errors.New("device is signed by another identity")
+	ErrInvalidSignature       = errors.New("invalid signature")
+)
+
+// deviceStatement is what the identity key signs to vouch for a device
+func deviceStatement(owner string, deviceId string, deviceKey []byte) []byte {
+	return hashParts(
+		[]byte("gotchat-device-v1"),
+		[]byte(owner),
+		[]byte(deviceId),
+		deviceKey,
+	)
+}
+
+// deviceLinkTranscript binds the link to the new device and its key
+func deviceLinkTranscript(linkId string, owner string, device deviceInfo) []byte {
+	return hashParts(
+		[]byte("gotchat-device-link-v1"),
+		[]byte(linkId),
+		[]byte(owner),
+		[]byte(device.Id),
+		[]byte(device.Name),
+		[]byte(device.Key),
+	)
+}
+
+// deviceLinkKeys derives the keys protecting the identity on its way to the new device
+func deviceLinkKeys(secret []byte, transcript []byte) ([]byte, []byte) {
+	toNewDevice := mixInviteKey(secret, append([]byte("to-new-device"), transcript...))
+	toExistingDevice := mixInviteKey(secret, append([]byte("to-existing-device"), transcript...))
+
+	return toNewDevice, toExistingDevice
+}
+
+// messageStatement is what the device key of the sender signs
+func messageStatement(msg *chatMessagePayload) []byte {
+	return hashParts(
+		[]byte("gotchat-message-v1"),
+		[]byte(msg.Id),
+		[]byte(msg.From),
+		[]byte(msg.To),
+		[]byte(msg.Device),
+		[]byte(msg.Text),
+		[]byte(strconv.FormatInt(msg.At, 10)),
+	)
+}
+
+// verifyDeviceInfo checks that the identity vouches for the device and returns the device key
+func verifyDeviceInfo(identityKey ed25519.PublicKey, owner string, device deviceInfo) (ed25519.PublicKey, error) {
+	key, err := identityPublicKey(device.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(device.Signature)
+	if err != nil || !ed25519.Verify(identityKey, deviceStatement(owner, device.Id, key), signature) {
+		return nil, fmt.Errorf("%w: device %s of user %s", ErrInvalidSignature, device.Id, owner)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,625 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/pkg/log"
+	"github.com/hop-/gotchat/pkg/network"
+)
+
+// DeviceManager keeps the devices of the users and links new devices to an identity
+type DeviceManager struct {
+	eventEmitter  core.EventEmitter
+	deviceRepo    core.Repository[core.Device]
+	linkRepo      core.Repository[core.DeviceLink]
+	userManager   *UserManager
+	inviteManager *InviteManager
+	mk            *KeyManager
+
+	// Name of the local device shown to the other devices
+	deviceName string
+
+	// Serializes the creation of devices
+	mu sync.Mutex
+}
+
+func NewDeviceManager(
+	eventEmitter core.EventEmitter,
+	deviceRepo core.Repository[core.Device],
+	linkRepo core.Repository[core.DeviceLink],
+	userManager *UserManager,
+	inviteManager *InviteManager,
+	deviceName string,
+) *DeviceManager {
+	return &DeviceManager{
+		eventEmitter,
+		deviceRepo,
+		linkRepo,
+		userManager,
+		inviteManager,
+		newKeyManager(),
+		deviceName,
+		sync.Mutex{},
+	}
+}
+
+// Init implements core.Service.
+func (m *DeviceManager) Init() error {
+	return nil
+}
+
+// Name implements core.Service.
+func (m *DeviceManager) Name() string {
+	return "DeviceManager"
+}
+
+// Dependencies implements core.DependentService.
+func (m *DeviceManager) Dependencies() []string {
+	return []string{"Storage", "UserManager", "InviteManager"}
+}
+
+// Run implements core.Service.
+func (m *DeviceManager) Run(ctx context.Context, wg *sync.WaitGroup) {
+	// This service does not run any background tasks.
+}
+
+// MapEventToCommands implements core.Service.
+func (m *DeviceManager) MapEventToCommands(event core.Event) []core.Command {
+	return nil
+}
+
+// Close implements core.Service.
+func (m *DeviceManager) Close() error {
+	return nil
+}
+
+// LocalDevice returns the device of the user on this machine with its private key,
+// it's created and signed with the identity key on the first use
+func (m *DeviceManager) LocalDevice(owner string) (*core.Device, ed25519.PrivateKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	devices, err := m.deviceRepo.GetAllBy("owner_unique_id", owner)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, device := range devices {
+		if device.PrivateKey == "" {
+			continue
+		}
+
+		privateKey, err := m.unwrapDeviceKey(device)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return device, privateKey, nil
+	}
+
+	identityKey, err := m.inviteManager.IdentityKey(owner)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	device, err := m.createLocalDevice(owner, generateUuid(), m.deviceName, identityKey, privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Infof("Device %s (%s) created for user %s, key %s", device.Name, device.UniqueId, owner, IdentityFingerprint(publicKey))
+
+	return device, privateKey, nil
+}
+
+// createLocalDevice signs the device key with the identity key and stores it with the wrapped private key
+// Note: m.mu must be held by the caller
+func (m *DeviceManager) createLocalDevice(owner string, deviceId string, name string, identityKey ed25519.PrivateKey, privateKey ed25519.PrivateKey) (*core.Device, error) {
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+
+	wrapped, err := m.mk.WrapKey(privateKey.Seed())
+	if err != nil {
+		return nil, err
+	}
+
+	device := core.NewDevice(
+		deviceId,
+		owner,
+		name,
+		base64.StdEncoding.EncodeToString(publicKey),
+		base64.StdEncoding.EncodeToString(wrapped),
+		base64.StdEncoding.EncodeToString(identityKey.Public().(ed25519.PublicKey)),
+		base64.StdEncoding.EncodeToString(ed25519.Sign(identityKey, deviceStatement(owner, deviceId, publicKey))),
+	)
+	if err := m.deviceRepo.Create(device); err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+func (m *DeviceManager) unwrapDeviceKey(device *core.Device) (ed25519.PrivateKey, error) {
+	wrapped, err := base64.StdEncoding.DecodeString(device.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := m.mk.UnwrapKey(wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// Devices returns all known devices of the user
+func (m *DeviceManager) Devices(owner string) ([]*core.Device, error) {
+	return m.deviceRepo.GetAllBy("owner_unique_id", owner)
+}
+
+// localDeviceId returns the id of the user's device on this machine, empty if devices aren't supported
+func (m *DeviceManager) localDeviceId(owner string) string {
+	if m == nil {
+		return ""
+	}
+
+	device, _, err := m.LocalDevice(owner)
+	if err != nil {
+		log.Errorf("Failed to get the local device of user %s: %v", owner, err)
+
+		return ""
+	}
+
+	return device.UniqueId
+}
+
+// findDevice returns the known device of the user, nil if not known
+func (m *DeviceManager) findDevice(owner string, deviceId string) *core.Device {
+	if m == nil || deviceId == "" {
+		return nil
+	}
+
+	devices, err := m.deviceRepo.GetAllBy("unique_id", deviceId)
+	if err != nil {
+		log.Errorf("Failed to get device %s: %v", deviceId, err)
+
+		return nil
+	}
+
+	for _, device := range devices {
+		if device.OwnerUniqueId == owner {
+			return device
+		}
+	}
+
+	return nil
+}
+
+func (m *DeviceManager) isKnownDevice(owner string, deviceId string) bool {
+	return m.findDevice(owner, deviceId) != nil
+}
+
+// Announcement returns all devices of the user signed by the identity key
+func (m *DeviceManager) Announcement(owner string) (*devicesPayload, error) {
+	if _, _, err := m.LocalDevice(owner); err != nil {
+		return nil, err
+	}
+
+	identityKey, err := m.inviteManager.IdentityKey(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := m.Devices(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	announcement := &devicesPayload{
+		IdentityKey: base64.StdEncoding.EncodeToString(identityKey.Public().(ed25519.PublicKey)),
+		Devices:     make([]deviceInfo, 0, len(devices)),
+	}
+	for _, device := range devices {
+		announcement.Devices = append(announcement.Devices, deviceInfo{device.UniqueId, device.Name, device.PublicKey, device.Signature})
+	}
+
+	return announcement, nil
+}
+
+// StoreAnnouncement stores the newly announced devices of the user,
+// the identity key is pinned by the devices which are already known
+func (m *DeviceManager) StoreAnnouncement(owner string, announcement *devicesPayload) (int, error) {
+	identityKey, err := identityPublicKey(announcement.IdentityKey)
+	if err != nil {
+		return 0, err
+	}
+
+	added, err := m.storeAnnouncedDevices(owner, identityKey, announcement)
+	if added > 0 {
+		m.eventEmitter.Emit(DevicesUpdated{owner, added})
+	}
+
+	return added, err
+}
+
+// storeAnnouncedDevices stores the devices of the announcement which aren't known yet
+func (m *DeviceManager) storeAnnouncedDevices(owner string, identityKey ed25519.PublicKey, announcement *devicesPayload) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	known, err := m.Devices(owner)
+	if err != nil {
+		return 0, err
+	}
+
+	knownIds := make(map[string]bool, len(known))
+	for _, device := range known {
+		if device.IdentityKey != announcement.IdentityKey {
+			return 0, fmt.Errorf("%w: user %s", ErrDeviceIdentityMismatch, owner)
+		}
+		knownIds[device.UniqueId] = true
+	}
+
+	added := 0
+	for _, info := range announcement.Devices {
+		if knownIds[info.Id] {
+			continue
+		}
+
+		if _, err := verifyDeviceInfo(identityKey, owner, info); err != nil {
+			return added, err
+		}
+
+		err := m.deviceRepo.Create(core.NewDevice(info.Id, owner, info.Name, info.Key, "", announcement.IdentityKey, info.Signature))
+		if err != nil {
+			return added, err
+		}
+		knownIds[info.Id] = true
+		added++
+
+		log.Infof("New device %s (%s) of user %s", info.Name, info.Id, owner)
+	}
+
+	return added, nil
+}
+
+// signMessage signs the message with the key of the sender's local device
+func (m *DeviceManager) signMessage(msg *chatMessagePayload) error {
+	if m == nil {
+		return nil
+	}
+
+	device, privateKey, err := m.LocalDevice(msg.From)
+	if err != nil {
+		return err
+	}
+
+	msg.Device = device.UniqueId
+	msg.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, messageStatement(msg)))
+
+	return nil
+}
+
+// verifyMessage checks the signature of the sender's device,
+// messages of peers without devices aren't signed
+func (m *DeviceManager) verifyMessage(msg *chatMessagePayload) error {
+	if m == nil || msg.Device == "" {
+		return nil
+	}
+
+	device := m.findDevice(msg.From, msg.Device)
+	if device == nil {
+		return fmt.Errorf("%w: %s of user %s", ErrUnknownDevice, msg.Device, msg.From)
+	}
+
+	key, err := identityPublicKey(device.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil || !ed25519.Verify(key, messageStatement(msg), signature) {
+		return fmt.Errorf("%w: message %s", ErrInvalidSignature, msg.Id)
+	}
+
+	return nil
+}
+
+// CreateLinkCode issues a one-time code to link a new device of the user reachable at the address
+func (m *DeviceManager) CreateLinkCode(owner string, address string, ttl time.Duration) (*InviteLink, error) {
+	if owner == "" || address == "" || ttl <= 0 {
+		return nil, ErrorInvalidInput
+	}
+
+	if _, _, err := m.LocalDevice(owner); err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := m.inviteManager.Fingerprint(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, inviteSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 9)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := m.mk.WrapKey(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	link := &InviteLink{
+		Address:     address,
+		UserId:      owner,
+		InviteId:    base64.RawURLEncoding.EncodeToString(id),
+		Fingerprint: fingerprint,
+		Secret:      secret,
+		// The link only carries seconds
+		ExpiresAt: time.Now().Add(ttl).Truncate(time.Second),
+	}
+
+	err = m.linkRepo.Create(core.NewDeviceLink(link.InviteId, owner, base64.StdEncoding.EncodeToString(wrapped), link.ExpiresAt))
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Device link %s created for user %s, valid until %s", link.InviteId, owner, link.ExpiresAt.Format(time.RFC3339))
+
+	return link, nil
+}
+
+// findLink returns the pending device link of the user with its secret
+func (m *DeviceManager) findLink(owner string, linkId string) (*core.DeviceLink, []byte, error) {
+	links, err := m.linkRepo.GetAllBy("unique_id", linkId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(links) == 0 || links[0].OwnerUniqueId != owner {
+		return nil, nil, ErrInvalidInvite
+	}
+
+	link := links[0]
+	if !time.Now().Before(link.ExpiresAt) {
+		m.consumeLink(link)
+
+		return nil, nil, ErrInviteExpired
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(link.Secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secret, err := m.mk.UnwrapKey(wrapped)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return link, secret, nil
+}
+
+// consumeLink removes the device link, so it can't be used again
+func (m *DeviceManager) consumeLink(link *core.DeviceLink) {
+	if err := m.linkRepo.Delete(link.Id); err != nil {
+		log.Errorf("Failed to remove device link %s: %v", link.UniqueId, err)
+	}
+}
+
+// AcceptLink answers the new device which proved the knowledge of the link secret,
+// the identity key is handed over encrypted with keys derived from the secret
+func (m *DeviceManager) AcceptLink(conn *network.Conn, request *linkDevicePayload) error {
+	if m == nil {
+		return ErrInvalidInvite
+	}
+
+	link, secret, err := m.findLink(request.User, request.Link)
+	if err != nil {
+		return err
+	}
+
+	transcript := deviceLinkTranscript(link.UniqueId, link.OwnerUniqueId, request.Device)
+	proof, err := base64.StdEncoding.DecodeString(request.Proof)
+	if err != nil || !hmac.Equal(proof, inviteProof(secret, "new-device", transcript)) {
+		return fmt.Errorf("%w: new device doesn't know the secret", ErrInviteVerificationFailed)
+	}
+
+	m.consumeLink(link)
+
+	owner := link.OwnerUniqueId
+	user, err := m.userManager.GetUserByUniqueId(owner)
+	if err != nil {
+		return err
+	}
+
+	deviceKey, err := identityPublicKey(request.Device.Key)
+	if err != nil {
+		return err
+	}
+
+	if request.Device.Id == "" || m.isKnownDevice(owner, request.Device.Id) {
+		return fmt.Errorf("%w: device id %q is taken", ErrInvalidInvite, request.Device.Id)
+	}
+
+	identityKey, err := m.inviteManager.IdentityKey(owner)
+	if err != nil {
+		return err
+	}
+
+	device := request.Device
+	device.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(identityKey, deviceStatement(owner, device.Id, deviceKey)))
+
+	err = m.deviceRepo.Create(core.NewDevice(
+		device.Id,
+		owner,
+		device.Name,
+		device.Key,
+		"",
+		base64.StdEncoding.EncodeToString(identityKey.Public().(ed25519.PublicKey)),
+		device.Signature,
+	))
+	if err != nil {
+		return err
+	}
+
+	announcement, err := m.Announcement(owner)
+	if err != nil {
+		return err
+	}
+
+	toNewDevice, toExistingDevice := deviceLinkKeys(secret, transcript)
+	secureComponent, err := network.NewEncryption(toNewDevice, toExistingDevice)
+	if err != nil {
+		return err
+	}
+
+	err = writeAction(network.NewSecureConn(conn, secureComponent), actionDeviceLinked, deviceLinkedPayload{
+		Name:         user.Name,
+		IdentitySeed: base64.StdEncoding.EncodeToString(identityKey.Seed()),
+		Devices:      *announcement,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Device %s (%s) linked to user %s", device.Name, device.Id, user.Name)
+	m.eventEmitter.Emit(DeviceLinked{owner, device.Id, device.Name})
+
+	return nil
+}
+
+// LinkDevice links this machine as a new device of the user with the link code,
+// the local user is created with the password
+func (m *DeviceManager) LinkDevice(uri string, password string) (*core.User, error) {
+	link, err := ParseDeviceLink(uri)
+	if err == nil && link.Expired(time.Now()) {
+		err = ErrInviteExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := NewClient(link.Address).Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return m.linkDevice(conn, link, password)
+}
+
+func (m *DeviceManager) linkDevice(conn *network.Conn, link *InviteLink, password string) (*core.User, error) {
+	if password == "" {
+		return nil, ErrorInvalidInput
+	}
+
+	if _, err := m.userManager.GetUserByUniqueId(link.UserId); err == nil {
+		return nil, fmt.Errorf("user %s already exists on this device", link.UserId)
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	device := deviceInfo{
+		Id:   generateUuid(),
+		Name: m.deviceName,
+		Key:  base64.StdEncoding.EncodeToString(publicKey),
+	}
+	transcript := deviceLinkTranscript(link.InviteId, link.UserId, device)
+
+	err = writeAction(conn, actionLinkDevice, linkDevicePayload{
+		User:   link.UserId,
+		Link:   link.InviteId,
+		Device: device,
+		Proof:  base64.StdEncoding.EncodeToString(inviteProof(link.Secret, "new-device", transcript)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	toNewDevice, toExistingDevice := deviceLinkKeys(link.Secret, transcript)
+	secureComponent, err := network.NewEncryption(toExistingDevice, toNewDevice)
+	if err != nil {
+		return nil, err
+	}
+
+	linked, err := readAction[deviceLinkedPayload](network.NewSecureConn(conn, secureComponent), actionDeviceLinked)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInviteVerificationFailed, err)
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(linked.IdentitySeed)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%w: bad identity key", ErrInviteVerificationFailed)
+	}
+
+	identityKey := ed25519.NewKeyFromSeed(seed)
+	identityPublic := identityKey.Public().(ed25519.PublicKey)
+	if IdentityFingerprint(identityPublic) != link.Fingerprint {
+		return nil, fmt.Errorf("%w: identity key doesn't match the fingerprint", ErrInviteVerificationFailed)
+	}
+	if linked.Devices.IdentityKey != base64.StdEncoding.EncodeToString(identityPublic) {
+		return nil, fmt.Errorf("%w: devices are signed by another identity", ErrInviteVerificationFailed)
+	}
+
+	// The existing device must have vouched for this device
+	vouched := false
+	for _, info := range linked.Devices.Devices {
+		if info.Id == device.Id && info.Key == device.Key {
+			if _, err := verifyDeviceInfo(identityPublic, link.UserId, info); err != nil {
+				return nil, err
+			}
+			vouched = true
+		}
+	}
+	if !vouched {
+		return nil, fmt.Errorf("%w: device is not signed", ErrInviteVerificationFailed)
+	}
+
+	user, err := m.userManager.CreateLinkedUser(link.UserId, linked.Name, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.inviteManager.importIdentityKey(link.UserId, identityKey); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	_, err = m.createLocalDevice(link.UserId, device.Id, device.Name, identityKey, privateKey)
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := m.StoreAnnouncement(link.UserId, &linked.Devices); err != nil {
+		return nil, err
+	}
+
+	log.Infof("This device %s (%s) is linked to user %s", device.Name, device.Id, user.Name)
+	m.eventEmitter.Emit(DeviceLinked{user.UniqueId, device.Id, device.Name})
+
+	return user, nil
+}
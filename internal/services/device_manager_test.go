@@ -0,0 +1,242 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/pkg/network"
+	"github.com/stretchr/testify/mock"
+)
+
+// testMachine is a machine with its own storage running the device related services
+type testMachine struct {
+	eventEmitter  *core.MockEventEmitter
+	userManager   *UserManager
+	inviteManager *InviteManager
+	deviceManager *DeviceManager
+}
+
+func newTestMachine(t *testing.T, deviceName string) *testMachine {
+	eventEmitter := core.NewMockEventEmitter(t)
+	eventEmitter.On("Emit", mock.Anything).Maybe()
+
+	return newTestMachineWithEmitter(t, deviceName, eventEmitter)
+}
+
+func newTestMachineWithEmitter(t *testing.T, deviceName string, eventEmitter *core.MockEventEmitter) *testMachine {
+	userRepo := newMemoryRepo(
+		func(u *core.User) *int { return &u.Id },
+		func(u *core.User) map[string]any { return map[string]any{"unique_id": u.UniqueId} },
+	)
+	deviceRepo := newMemoryRepo(
+		func(d *core.Device) *int { return &d.Id },
+		func(d *core.Device) map[string]any {
+			return map[string]any{"unique_id": d.UniqueId, "owner_unique_id": d.OwnerUniqueId}
+		},
+	)
+	linkRepo := newMemoryRepo(
+		func(l *core.DeviceLink) *int { return &l.Id },
+		func(l *core.DeviceLink) map[string]any {
+			return map[string]any{"unique_id": l.UniqueId, "owner_unique_id": l.OwnerUniqueId}
+		},
+	)
+
+	userManager := NewUserManager(eventEmitter, userRepo)
+	inviteManager := newTestInviteManager(t)
+	deviceManager := NewDeviceManager(eventEmitter, deviceRepo, linkRepo, userManager, inviteManager, deviceName)
+
+	return &testMachine{eventEmitter, userManager, inviteManager, deviceManager}
+}
+
+// linkTestDevice links the new machine to the user of the existing one
+func linkTestDevice(t *testing.T, existing *testMachine, newDevice *testMachine, owner string) (*core.User, error) {
+	link, err := existing.deviceManager.CreateLinkCode(owner, "127.0.0.1:7665", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create link code: %v", err)
+	}
+
+	return linkTestDeviceWith(t, existing, newDevice, link)
+}
+
+func linkTestDeviceWith(t *testing.T, existing *testMachine, newDevice *testMachine, link *InviteLink) (*core.User, error) {
+	c1, c2 := newTestConnPair(t)
+
+	accepted := make(chan error, 1)
+	go func() {
+		defer c2.Close()
+
+		conn := network.NewConn(c2)
+		msg, err := conn.Read()
+		if err != nil {
+			accepted <- err
+
+			return
+		}
+
+		request, err := network.DecodeAs[linkDevicePayload](msg, actionLinkDevice)
+		if err == nil {
+			err = existing.deviceManager.AcceptLink(conn, request)
+		}
+		accepted <- err
+	}()
+
+	user, err := newDevice.deviceManager.linkDevice(network.NewConn(c1), link, "password")
+	c1.Close()
+
+	if acceptErr := <-accepted; err == nil && acceptErr != nil {
+		err = acceptErr
+	}
+
+	return user, err
+}
+
+func TestDeviceManager_LocalDevice(t *testing.T) {
+	m := newTestMachine(t, "desktop")
+
+	first, _, err := m.deviceManager.LocalDevice("alice")
+	if err != nil {
+		t.Fatalf("Failed to get local device: %v", err)
+	}
+
+	second, _, _ := m.deviceManager.LocalDevice("alice")
+	if first.UniqueId != second.UniqueId || first.Name != "desktop" {
+		t.Errorf("Expected the local device to be stored, got %+v and %+v", first, second)
+	}
+
+	announcement, err := m.deviceManager.Announcement("alice")
+	if err != nil || len(announcement.Devices) != 1 {
+		t.Fatalf("Expected one announced device, got %+v: %v", announcement, err)
+	}
+
+	identityKey, _ := identityPublicKey(announcement.IdentityKey)
+	if _, err := verifyDeviceInfo(identityKey, "alice", announcement.Devices[0]); err != nil {
+		t.Errorf("Expected the device to be signed by the identity, got %v", err)
+	}
+}
+
+func TestDeviceManager_LinkDevice(t *testing.T) {
+	desktop := newTestMachine(t, "desktop")
+	laptop := newTestMachine(t, "laptop")
+
+	alice, err := desktop.userManager.CreateUser("alice", "password")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	user, err := linkTestDevice(t, desktop, laptop, alice.UniqueId)
+	if err != nil {
+		t.Fatalf("Failed to link device: %v", err)
+	}
+
+	// The same identity lives on both devices
+	if user.UniqueId != alice.UniqueId || user.Name != alice.Name {
+		t.Errorf("Expected the linked user to be alice, got %+v", user)
+	}
+
+	desktopFingerprint, _ := desktop.inviteManager.Fingerprint(alice.UniqueId)
+	laptopFingerprint, _ := laptop.inviteManager.Fingerprint(alice.UniqueId)
+	if desktopFingerprint != laptopFingerprint {
+		t.Errorf("Expected the identity key to be transferred, got %s and %s", desktopFingerprint, laptopFingerprint)
+	}
+
+	// Both devices know each other
+	for _, m := range []*testMachine{desktop, laptop} {
+		devices, _ := m.deviceManager.Devices(alice.UniqueId)
+		if len(devices) != 2 {
+			t.Errorf("Expected two devices of alice on %s, got %d", m.deviceManager.deviceName, len(devices))
+		}
+	}
+
+	laptopDevice, _, _ := laptop.deviceManager.LocalDevice(alice.UniqueId)
+	if laptopDevice.Name != "laptop" || !desktop.deviceManager.isKnownDevice(alice.UniqueId, laptopDevice.UniqueId) {
+		t.Errorf("Expected the desktop to know the laptop, got %+v", laptopDevice)
+	}
+}
+
+func TestDeviceManager_LinkDeviceFailures(t *testing.T) {
+	desktop := newTestMachine(t, "desktop")
+
+	alice, _ := desktop.userManager.CreateUser("alice", "password")
+	link, err := desktop.deviceManager.CreateLinkCode(alice.UniqueId, "127.0.0.1:7665", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create link code: %v", err)
+	}
+
+	// A wrong secret doesn't reveal the identity
+	forged := *link
+	forged.Secret = []byte("0123456789abcdef")
+	if _, err := linkTestDeviceWith(t, desktop, newTestMachine(t, "laptop"), &forged); !errors.Is(err, ErrInviteVerificationFailed) {
+		t.Errorf("Expected ErrInviteVerificationFailed for a wrong secret, got %v", err)
+	}
+
+	// The link can be used once
+	if _, err := linkTestDeviceWith(t, desktop, newTestMachine(t, "laptop"), link); err != nil {
+		t.Fatalf("Failed to link device: %v", err)
+	}
+	if _, err := linkTestDeviceWith(t, desktop, newTestMachine(t, "tablet"), link); err == nil {
+		t.Error("Expected the used link to be rejected")
+	}
+}
+
+func TestDeviceManager_StoreAnnouncement(t *testing.T) {
+	alice := newTestMachine(t, "desktop")
+	bob := newTestMachine(t, "phone")
+
+	announcement, err := alice.deviceManager.Announcement("alice")
+	if err != nil {
+		t.Fatalf("Failed to get announcement: %v", err)
+	}
+
+	added, err := bob.deviceManager.StoreAnnouncement("alice", announcement)
+	if err != nil || added != 1 {
+		t.Fatalf("Expected one new device, got %d: %v", added, err)
+	}
+
+	// Known devices aren't added again
+	if added, _ := bob.deviceManager.StoreAnnouncement("alice", announcement); added != 0 {
+		t.Errorf("Expected no new devices, got %d", added)
+	}
+
+	// Devices signed by another identity are rejected once the identity is pinned
+	mallory := newTestMachine(t, "desktop")
+	forged, _ := mallory.deviceManager.Announcement("alice")
+	if _, err := bob.deviceManager.StoreAnnouncement("alice", forged); !errors.Is(err, ErrDeviceIdentityMismatch) {
+		t.Errorf("Expected ErrDeviceIdentityMismatch, got %v", err)
+	}
+
+	// Devices not signed by the identity are rejected
+	tampered := *announcement
+	tampered.Devices = []deviceInfo{forged.Devices[0]}
+	if _, err := newTestMachine(t, "tablet").deviceManager.StoreAnnouncement("alice", &tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestDeviceManager_Messages(t *testing.T) {
+	alice := newTestMachine(t, "desktop")
+	bob := newTestMachine(t, "phone")
+
+	message := &chatMessagePayload{Id: "1", From: "alice", To: "bob", Text: "hello", At: time.Now().UnixMilli()}
+	if err := alice.deviceManager.signMessage(message); err != nil {
+		t.Fatalf("Failed to sign message: %v", err)
+	}
+
+	// Messages of unknown devices are dropped
+	if err := bob.deviceManager.verifyMessage(message); !errors.Is(err, ErrUnknownDevice) {
+		t.Errorf("Expected ErrUnknownDevice, got %v", err)
+	}
+
+	announcement, _ := alice.deviceManager.Announcement("alice")
+	bob.deviceManager.StoreAnnouncement("alice", announcement)
+
+	if err := bob.deviceManager.verifyMessage(message); err != nil {
+		t.Errorf("Expected the message to be verified, got %v", err)
+	}
+
+	message.Text = "goodbye"
+	if err := bob.deviceManager.verifyMessage(message); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a changed message, got %v", err)
+	}
+}
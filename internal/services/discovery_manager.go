@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/pkg/log"
+	"github.com/hop-/gotchat/pkg/network"
+)
+
+const (
+	discoveryAnnounceInterval = 5 * time.Second
+	discoveryPeerTtl          = 20 * time.Second
+)
+
+// DiscoveryManager Service
+// Announces the logged in user on the local network and keeps a list of nearby peers
+type DiscoveryManager struct {
+	AtomicRunningStatus
+
+	eventEmitter core.EventEmitter
+	group        string
+	// Port of the local server, 0 means nothing is announced
+	port int
+
+	announcer *network.Announcer
+	discovery *network.Discovery
+
+	mu     sync.RWMutex
+	userId string
+}
+
+func NewDiscoveryManager(eventEmitter core.EventEmitter, group string, port int) *DiscoveryManager {
+	return &DiscoveryManager{
+		AtomicRunningStatus{},
+		eventEmitter,
+		group,
+		port,
+		nil,
+		nil,
+		sync.RWMutex{},
+		"",
+	}
+}
+
+// Init implements core.Service.
+func (dm *DiscoveryManager) Init() error {
+	discovery, err := network.NewDiscovery(dm.group, discoveryPeerTtl)
+	if err != nil {
+		return err
+	}
+	discovery.OnChange(dm.handlePeerChange)
+	dm.discovery = discovery
+
+	if dm.port > 0 {
+		announcer, err := network.NewAnnouncer(dm.group, discoveryAnnounceInterval)
+		if err != nil {
+			return err
+		}
+		dm.announcer = announcer
+	}
+
+	return nil
+}
+
+// Name implements core.Service.
+func (dm *DiscoveryManager) Name() string {
+	return "DiscoveryManager"
+}
+
+// Run implements core.Service.
+func (dm *DiscoveryManager) Run(ctx context.Context, wg *sync.WaitGroup) {
+	if dm.isRunning() {
+		log.Errorf("DiscoveryManager is already running")
+
+		return
+	}
+
+	dm.setRunningStatus(true)
+
+	if dm.announcer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := dm.announcer.Run(ctx); err != nil {
+				log.Errorf("Discovery announcer stopped: %v", err)
+			}
+		}()
+	}
+
+	wg.Add(1)
+	defer wg.Done()
+
+	// Discovery is optional, the application keeps working without multicast
+	if err := dm.discovery.Run(ctx); err != nil {
+		log.Errorf("Discovery listener stopped: %v", err)
+	}
+}
+
+// Close implements core.Service.
+func (dm *DiscoveryManager) Close() error {
+	dm.setRunningStatus(false)
+
+	// The listener would otherwise wait for its read deadline
+	if dm.discovery != nil {
+		return dm.discovery.Close()
+	}
+
+	return nil
+}
+
+// MapEventToCommands implements core.Service.
+func (dm *DiscoveryManager) MapEventToCommands(event core.Event) []core.Command {
+	var commands []core.Command
+	switch e := event.(type) {
+	case core.UserLoggedInEvent:
+		commands = append(commands, &StartAnnouncing{dm, e.User})
+	case core.SwitchUserEvent:
+		commands = append(commands, &StartAnnouncing{dm, e.User})
+	case core.UserLoggedOutEvent:
+		commands = append(commands, &StopAnnouncing{dm, e.User.UniqueId})
+	}
+
+	return commands
+}
+
+// GetPeers returns nearby peers excluding the current user
+func (dm *DiscoveryManager) GetPeers() []network.DiscoveredPeer {
+	if dm.discovery == nil {
+		return nil
+	}
+
+	dm.mu.RLock()
+	userId := dm.userId
+	dm.mu.RUnlock()
+
+	peers := make([]network.DiscoveredPeer, 0)
+	for _, peer := range dm.discovery.Peers() {
+		if peer.UniqueId != userId {
+			peers = append(peers, peer)
+		}
+	}
+
+	return peers
+}
+
+func (dm *DiscoveryManager) startAnnouncing(user *core.User) {
+	dm.mu.Lock()
+	dm.userId = user.UniqueId
+	dm.mu.Unlock()
+
+	if dm.announcer == nil {
+		return
+	}
+
+	log.Infof("Announcing user %s on the local network", user.Name)
+	dm.announcer.SetAnnouncement(&network.Announcement{
+		Name:     user.Name,
+		UniqueId: user.UniqueId,
+		Port:     dm.port,
+	})
+}
+
+// stopAnnouncing stops announcing the user, another user may be announced already
+func (dm *DiscoveryManager) stopAnnouncing(userId string) {
+	dm.mu.Lock()
+	if dm.userId != userId {
+		dm.mu.Unlock()
+
+		return
+	}
+	dm.userId = ""
+	dm.mu.Unlock()
+
+	if dm.announcer != nil {
+		dm.announcer.SetAnnouncement(nil)
+	}
+}
+
+func (dm *DiscoveryManager) handlePeerChange(peer network.DiscoveredPeer, lost bool) {
+	if lost {
+		log.Debugf("Peer %s (%s) is no longer announced", peer.Name, peer.Address())
+		dm.eventEmitter.Emit(PeerLost{peer})
+
+		return
+	}
+
+	log.Debugf("Discovered peer %s (%s)", peer.Name, peer.Address())
+	dm.eventEmitter.Emit(PeerDiscovered{peer})
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hop-/gotchat/internal/config"
+	"github.com/hop-/gotchat/internal/core"
+)
+
+func TestDiscoveryManager_Name(t *testing.T) {
+	dm := &DiscoveryManager{}
+	if dm.Name() != "DiscoveryManager" {
+		t.Errorf("Expected Name() to return 'DiscoveryManager', got %s", dm.Name())
+	}
+}
+
+func TestDiscoveryManager_Init(t *testing.T) {
+	eventEmitter := core.NewMockEventEmitter(t)
+
+	dm := NewDiscoveryManager(eventEmitter, config.GetDiscoveryGroup(), 7665)
+	if err := dm.Init(); err != nil {
+		t.Fatalf("Expected Init() to return nil, got %v", err)
+	}
+	if dm.discovery == nil {
+		t.Error("Expected discovery to be created")
+	}
+	if dm.announcer == nil {
+		t.Error("Expected announcer to be created when port is set")
+	}
+
+	// No announcer without a server
+	dm = NewDiscoveryManager(eventEmitter, config.GetDiscoveryGroup(), 0)
+	if err := dm.Init(); err != nil {
+		t.Fatalf("Expected Init() to return nil, got %v", err)
+	}
+	if dm.announcer != nil {
+		t.Error("Expected no announcer when port is not set")
+	}
+}
+
+func TestDiscoveryManager_Init_InvalidGroup(t *testing.T) {
+	eventEmitter := core.NewMockEventEmitter(t)
+
+	dm := NewDiscoveryManager(eventEmitter, "invalid", 7665)
+	if err := dm.Init(); err == nil {
+		t.Error("Expected Init() to fail for invalid group")
+	}
+}
+
+func TestDiscoveryManager_Close(t *testing.T) {
+	eventEmitter := core.NewMockEventEmitter(t)
+
+	dm := NewDiscoveryManager(eventEmitter, config.GetDiscoveryGroup(), 0)
+	if err := dm.Init(); err != nil {
+		t.Fatalf("Expected Init() to return nil, got %v", err)
+	}
+
+	wg := &sync.WaitGroup{}
+	done := make(chan struct{})
+	go func() {
+		dm.Run(context.Background(), wg)
+		close(done)
+	}()
+
+	// The listener stops without the context being done
+	time.Sleep(50 * time.Millisecond)
+	if err := dm.Close(); err != nil {
+		t.Errorf("Expected Close() to return nil, got %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Run to return once the manager is closed")
+	}
+}
+
+func TestDiscoveryManager_MapEventToCommands(t *testing.T) {
+	dm := &DiscoveryManager{}
+	user := &core.User{Name: "alice", UniqueId: "id-1"}
+
+	commands := dm.MapEventToCommands(core.UserLoggedInEvent{User: user})
+	if len(commands) != 1 {
+		t.Fatalf("Expected 1 command, got %d", len(commands))
+	}
+	if _, ok := commands[0].(*StartAnnouncing); !ok {
+		t.Errorf("Expected StartAnnouncing command, got %T", commands[0])
+	}
+
+	commands = dm.MapEventToCommands(core.SwitchUserEvent{User: user})
+	if len(commands) != 1 {
+		t.Fatalf("Expected 1 command, got %d", len(commands))
+	}
+	if _, ok := commands[0].(*StartAnnouncing); !ok {
+		t.Errorf("Expected StartAnnouncing command, got %T", commands[0])
+	}
+
+	commands = dm.MapEventToCommands(core.UserLoggedOutEvent{User: user})
+	if len(commands) != 1 {
+		t.Fatalf("Expected 1 command, got %d", len(commands))
+	}
+	if _, ok := commands[0].(*StopAnnouncing); !ok {
+		t.Errorf("Expected StopAnnouncing command, got %T", commands[0])
+	}
+
+	commands = dm.MapEventToCommands(core.QuitEvent{})
+	if len(commands) != 0 {
+		t.Errorf("Expected no commands, got %d", len(commands))
+	}
+}
+
+func TestDiscoveryManager_StartStopAnnouncing(t *testing.T) {
+	eventEmitter := core.NewMockEventEmitter(t)
+	dm := NewDiscoveryManager(eventEmitter, config.GetDiscoveryGroup(), 7665)
+	if err := dm.Init(); err != nil {
+		t.Fatalf("Expected Init() to return nil, got %v", err)
+	}
+
+	user := &core.User{Name: "alice", UniqueId: "id-1"}
+	dm.startAnnouncing(user)
+
+	if dm.userId != "id-1" {
+		t.Errorf("Expected userId to be set, got %s", dm.userId)
+	}
+
+	// Another user's logout doesn't stop the announcement
+	dm.stopAnnouncing("id-2")
+	if dm.userId != "id-1" {
+		t.Errorf("Expected userId to be kept, got %s", dm.userId)
+	}
+
+	dm.stopAnnouncing("id-1")
+	if dm.userId != "" {
+		t.Errorf("Expected userId to be reset, got %s", dm.userId)
+	}
+	if len(dm.GetPeers()) != 0 {
+		t.Errorf("Expected no peers, got %v", dm.GetPeers())
+	}
+}
@@ -7,4 +7,5 @@ var (
 	ErrNotFound             = fmt.Errorf("entity not found")
 	ErrorInvalidInput       = fmt.Errorf("invalid input provided")
 	ErrorInvalidCredentials = fmt.Errorf("invalid credentials provided")
+	ErrPeerNotConnected     = fmt.Errorf("peer is not connected")
 )
@@ -1,12 +1,23 @@
 package services
 
-import "github.com/hop-/gotchat/pkg/network"
+import (
+	"time"
+
+	"github.com/hop-/gotchat/pkg/network"
+)
 
 type NewUnauthenticatedConnection struct {
 	Id   string
 	Conn network.AdvancedConn
 }
 
+// ConnectionStarted is emitted when an outbound connection is dialed, the handshake follows
+type ConnectionStarted struct {
+	Id         string
+	Address    string
+	PeerUserId string
+}
+
 type ConnectionEstablished struct {
 	Id         string
 	Conn       network.AdvancedConn
@@ -17,6 +28,13 @@ type ConnectionClosed struct {
 	Id string
 }
 
+// PeerLeft is emitted when the peer closes the connection on purpose
+type PeerLeft struct {
+	ConnId     string
+	PeerUserId string
+	Reason     string
+}
+
 type ConnectionAcceptError struct {
 	Err error
 }
@@ -25,6 +43,62 @@ type ConnectionFailed struct {
 	Err error
 }
 
+type AbuseViolation struct {
+	Host string
+	Err  error
+}
+
+type HostBanned struct {
+	Host  string
+	Until time.Time
+}
+
+type ConnectionRequested struct {
+	RequestId  string
+	ConnId     string
+	PeerUserId string
+	PeerName   string
+	Host       string
+	// UniqueId of the logged in user the peer wants to reach
+	UserId string
+	// The peer is known but came without the stored keys, accepting replaces them
+	KeysChanged bool
+}
+
+type ConnectionRequestExpired struct {
+	RequestId string
+}
+
+type ConnectionRequestResolved struct {
+	RequestId string
+	Accept    bool
+}
+
+type InviteRedeemed struct {
+	InviteId   string
+	PeerUserId string
+}
+
+type PeerPolicyChanged struct {
+	OwnerUniqueId string
+	Policy        string
+}
+
+type PeerRuleChanged struct {
+	OwnerUniqueId string
+	Kind          string
+	Value         string
+	Removed       bool
+}
+
+type RelayRegistered struct {
+	UserId string
+}
+
+type RelayRegistrationFailed struct {
+	Err error
+}
+
 type NewMessage struct {
 	ConnId string
 	// TODO: add message payload
@@ -34,3 +108,51 @@ type MessageReadError struct {
 	ConnId string
 	Err    error
 }
+
+type PeerDiscovered struct {
+	Peer network.DiscoveredPeer
+}
+
+type PeerLost struct {
+	Peer network.DiscoveredPeer
+}
+
+type DeviceLinked struct {
+	UserId     string
+	DeviceId   string
+	DeviceName string
+}
+
+type DevicesUpdated struct {
+	UserId string
+	// Number of newly known devices
+	Added int
+}
+
+type MessageSent struct {
+	MessageId  string
+	From       string
+	PeerUserId string
+	Text       string
+	At         time.Time
+	// Number of the peer's devices the message was sent to
+	Delivered int
+	// Number of the user's other devices the message was mirrored to
+	Mirrored int
+	// Known devices of the peer which are not connected
+	Undelivered []string
+}
+
+type MessageReceived struct {
+	ConnId    string
+	MessageId string
+	From      string
+	// Name of the peer the message came from
+	FromName string
+	To       string
+	DeviceId string
+	Text     string
+	At       time.Time
+	// Sent by the user from another device
+	Mirrored bool
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	inviteScheme = "gotchat"
+	inviteHost   = "join"
+	// Links a new device of the user instead of making the first contact
+	deviceLinkHost = "link"
+
+	// Length of the one-time secret in bytes
+	inviteSecretSize = 16
+)
+
+var (
+	ErrInvalidInvite            = errors.New("invalid invite")
+	ErrInviteExpired            = errors.New("invite expired")
+	ErrInviteVerificationFailed = errors.New("invite verification failed")
+)
+
+// InviteLink is everything a peer needs to make the first contact with the inviting user
+type InviteLink struct {
+	// Address of the inviting user's server
+	Address string
+	// UniqueId of the inviting user
+	UserId   string
+	InviteId string
+	// Fingerprint of the inviting user's identity key
+	Fingerprint string
+	Secret      []byte
+	ExpiresAt   time.Time
+}
+
+// URI encodes the invite as gotchat://join?...
+func (l *InviteLink) URI() string {
+	return l.uri(inviteHost)
+}
+
+// DeviceLinkURI encodes the device link as gotchat://link?...
+func (l *InviteLink) DeviceLinkURI() string {
+	return l.uri(deviceLinkHost)
+}
+
+func (l *InviteLink) uri(host string) string {
+	query := url.Values{}
+	query.Set("addr", l.Address)
+	query.Set("user", l.UserId)
+	query.Set("id", l.InviteId)
+	query.Set("fp", l.Fingerprint)
+	query.Set("secret", base64.RawURLEncoding.EncodeToString(l.Secret))
+	query.Set("exp", strconv.FormatInt(l.ExpiresAt.Unix(), 10))
+
+	u := url.URL{Scheme: inviteScheme, Host: host, RawQuery: query.Encode()}
+
+	return u.String()
+}
+
+// Expired reports whether the invite can't be used anymore
+func (l *InviteLink) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// ParseInviteLink decodes an invite URI
+func ParseInviteLink(uri string) (*InviteLink, error) {
+	return parseLink(uri, inviteHost)
+}
+
+// ParseDeviceLink decodes a device link URI
+func ParseDeviceLink(uri string) (*InviteLink, error) {
+	return parseLink(uri, deviceLinkHost)
+}
+
+func parseLink(uri string, host string) (*InviteLink, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidInvite, err)
+	}
+
+	if u.Scheme != inviteScheme || u.Host != host {
+		return nil, fmt.Errorf("%w: not a %s://%s link", ErrInvalidInvite, inviteScheme, host)
+	}
+
+	query := u.Query()
+	link := &InviteLink{
+		Address:     query.Get("addr"),
+		UserId:      query.Get("user"),
+		InviteId:    query.Get("id"),
+		Fingerprint: query.Get("fp"),
+	}
+	if link.Address == "" || link.UserId == "" || link.InviteId == "" || link.Fingerprint == "" {
+		return nil, fmt.Errorf("%w: missing fields", ErrInvalidInvite)
+	}
+
+	link.Secret, err = base64.RawURLEncoding.DecodeString(query.Get("secret"))
+	if err != nil || len(link.Secret) < inviteSecretSize {
+		return nil, fmt.Errorf("%w: bad secret", ErrInvalidInvite)
+	}
+
+	expiresAt, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad expiration", ErrInvalidInvite)
+	}
+	link.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return link, nil
+}
+
+// IdentityFingerprint returns the short form of an identity key shown to users
+func IdentityFingerprint(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+
+	return hex.EncodeToString(sum[:16])
+}
+
+// inviteTranscript binds the invite to both peers and the keys they exchanged
+func inviteTranscript(inviteId string, initiatorId string, acceptorId string, initiatorKey []byte, acceptorKey []byte) []byte {
+	return hashParts(
+		[]byte("gotchat-invite-v1"),
+		[]byte(inviteId),
+		[]byte(initiatorId),
+		[]byte(acceptorId),
+		initiatorKey,
+		acceptorKey,
+	)
+}
+
+// hashParts hashes the parts, the length prefix keeps them from running into each other
+func hashParts(parts ...[]byte) []byte {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(strconv.Itoa(len(part)) + ":"))
+		h.Write(part)
+	}
+
+	return h.Sum(nil)
+}
+
+// inviteProof proves the knowledge of the secret for the given role
+func inviteProof(secret []byte, role string, transcript []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(role))
+	mac.Write(transcript)
+
+	return mac.Sum(nil)
+}
+
+// mixInviteKey derives the session key from the exchanged one and the secret,
+// so observing the exchange isn't enough to read the traffic
+func mixInviteKey(secret []byte, key []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("key"))
+	mac.Write(key)
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/pkg/log"
+)
+
+// InviteManager issues one-time invites and keeps the identity keys which sign them
+type InviteManager struct {
+	eventEmitter core.EventEmitter
+	inviteRepo   core.Repository[core.Invite]
+	identityRepo core.Repository[core.IdentityKey]
+	mk           *KeyManager
+
+	// Serializes the creation of identity keys
+	mu sync.Mutex
+
+	// Invites being redeemed by a handshake, a claimed invite can't be used by another one
+	claimsMu sync.Mutex
+	claims   map[string]struct{}
+}
+
+func NewInviteManager(eventEmitter core.EventEmitter, inviteRepo core.Repository[core.Invite], identityRepo core.Repository[core.IdentityKey]) *InviteManager {
+	return &InviteManager{
+		eventEmitter,
+		inviteRepo,
+		identityRepo,
+		newKeyManager(),
+		sync.Mutex{},
+		sync.Mutex{},
+		make(map[string]struct{}),
+	}
+}
+
+// Init implements core.Service.
+func (m *InviteManager) Init() error {
+	return nil
+}
+
+// Name implements core.Service.
+func (m *InviteManager) Name() string {
+	return "InviteManager"
+}
+
+// Dependencies implements core.DependentService.
+func (m *InviteManager) Dependencies() []string {
+	return []string{"Storage"}
+}
+
+// Run implements core.Service.
+func (m *InviteManager) Run(ctx context.Context, wg *sync.WaitGroup) {
+	// This service does not run any background tasks.
+}
+
+// MapEventToCommands implements core.Service.
+func (m *InviteManager) MapEventToCommands(event core.Event) []core.Command {
+	return nil
+}
+
+// Close implements core.Service.
+func (m *InviteManager) Close() error {
+	return nil
+}
+
+// IdentityKey returns the identity key of the user, it's created on the first use
+func (m *InviteManager) IdentityKey(owner string) (ed25519.PrivateKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys, err := m.identityRepo.GetAllBy("owner_unique_id", owner)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) > 0 {
+		wrapped, err := base64.StdEncoding.DecodeString(keys[0].PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		seed, err := m.mk.UnwrapKey(wrapped)
+		if err != nil {
+			return nil, err
+		}
+
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := m.mk.WrapKey(privateKey.Seed())
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.identityRepo.Create(core.NewIdentityKey(
+		owner,
+		base64.StdEncoding.EncodeToString(publicKey),
+		base64.StdEncoding.EncodeToString(wrapped),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Identity key created for user %s", owner)
+
+	return privateKey, nil
+}
+
+// importIdentityKey stores the identity key handed over by another device of the user
+func (m *InviteManager) importIdentityKey(owner string, privateKey ed25519.PrivateKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys, err := m.identityRepo.GetAllBy("owner_unique_id", owner)
+	if err != nil {
+		return err
+	}
+
+	if len(keys) > 0 {
+		return fmt.Errorf("user %s already has an identity key", owner)
+	}
+
+	wrapped, err := m.mk.WrapKey(privateKey.Seed())
+	if err != nil {
+		return err
+	}
+
+	err = m.identityRepo.Create(core.NewIdentityKey(
+		owner,
+		base64.StdEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey)),
+		base64.StdEncoding.EncodeToString(wrapped),
+	))
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Identity key imported for user %s", owner)
+
+	return nil
+}
+
+// Fingerprint returns the fingerprint of the user's identity key
+func (m *InviteManager) Fingerprint(owner string) (string, error) {
+	key, err := m.IdentityKey(owner)
+	if err != nil {
+		return "", err
+	}
+
+	return IdentityFingerprint(key.Public().(ed25519.PublicKey)), nil
+}
+
+// CreateInvite issues a one-time invite to connect to the user at the address
+func (m *InviteManager) CreateInvite(owner string, address string, ttl time.Duration) (*InviteLink, error) {
+	if owner == "" || address == "" || ttl <= 0 {
+		return nil, ErrorInvalidInput
+	}
+
+	fingerprint, err := m.Fingerprint(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	m.removeExpiredInvites(owner)
+
+	secret := make([]byte, inviteSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 9)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := m.mk.WrapKey(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	link := &InviteLink{
+		Address:     address,
+		UserId:      owner,
+		InviteId:    base64.RawURLEncoding.EncodeToString(id),
+		Fingerprint: fingerprint,
+		Secret:      secret,
+		// The link only carries seconds
+		ExpiresAt: time.Now().Add(ttl).Truncate(time.Second),
+	}
+
+	err = m.inviteRepo.Create(core.NewInvite(link.InviteId, owner, base64.StdEncoding.EncodeToString(wrapped), link.ExpiresAt))
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Invite %s created for user %s, valid until %s", link.InviteId, owner, link.ExpiresAt.Format(time.RFC3339))
+
+	return link, nil
+}
+
+// claimInvite takes the pending invite of the user with its secret for a single handshake,
+// releaseInvite gives it back if the handshake doesn't redeem it
+func (m *InviteManager) claimInvite(owner string, inviteId string) (*core.Invite, []byte, error) {
+	if m == nil {
+		return nil, nil, ErrInvalidInvite
+	}
+
+	m.claimsMu.Lock()
+	defer m.claimsMu.Unlock()
+
+	if _, ok := m.claims[inviteId]; ok {
+		return nil, nil, ErrInvalidInvite
+	}
+
+	invites, err := m.inviteRepo.GetAllBy("unique_id", inviteId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(invites) == 0 || invites[0].OwnerUniqueId != owner {
+		return nil, nil, ErrInvalidInvite
+	}
+
+	invite := invites[0]
+	if !time.Now().Before(invite.ExpiresAt) {
+		m.deleteInvite(invite)
+
+		return nil, nil, ErrInviteExpired
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(invite.Secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secret, err := m.mk.UnwrapKey(wrapped)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m.claims[inviteId] = struct{}{}
+
+	return invite, secret, nil
+}
+
+// releaseInvite gives the claimed invite back, so it can be used again
+func (m *InviteManager) releaseInvite(invite *core.Invite) {
+	m.claimsMu.Lock()
+	defer m.claimsMu.Unlock()
+
+	delete(m.claims, invite.UniqueId)
+}
+
+// consumeInvite removes the claimed invite, so it can't be used again
+func (m *InviteManager) consumeInvite(invite *core.Invite) {
+	m.claimsMu.Lock()
+	defer m.claimsMu.Unlock()
+
+	m.deleteInvite(invite)
+	delete(m.claims, invite.UniqueId)
+}
+
+func (m *InviteManager) deleteInvite(invite *core.Invite) {
+	if err := m.inviteRepo.Delete(invite.Id); err != nil {
+		log.Errorf("Failed to remove invite %s: %v", invite.UniqueId, err)
+	}
+}
+
+func (m *InviteManager) removeExpiredInvites(owner string) {
+	invites, err := m.inviteRepo.GetAllBy("owner_unique_id", owner)
+	if err != nil {
+		log.Errorf("Failed to get invites of user %s: %v", owner, err)
+
+		return
+	}
+
+	now := time.Now()
+	for _, invite := range invites {
+		if !now.Before(invite.ExpiresAt) {
+			m.deleteInvite(invite)
+		}
+	}
+}
+
+// identityPublicKey decodes the identity key sent by a peer
+func identityPublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid identity key size %d", len(key))
+	}
+
+	return ed25519.PublicKey(key), nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestInviteManager(t *testing.T) *InviteManager {
+	eventEmitter := core.NewMockEventEmitter(t)
+	eventEmitter.On("Emit", mock.Anything).Maybe()
+
+	inviteRepo := newMemoryRepo(
+		func(i *core.Invite) *int { return &i.Id },
+		func(i *core.Invite) map[string]any {
+			return map[string]any{"unique_id": i.UniqueId, "owner_unique_id": i.OwnerUniqueId}
+		},
+	)
+	identityRepo := newMemoryRepo(
+		func(k *core.IdentityKey) *int { return &k.Id },
+		func(k *core.IdentityKey) map[string]any { return map[string]any{"owner_unique_id": k.OwnerUniqueId} },
+	)
+
+	return NewInviteManager(eventEmitter, inviteRepo, identityRepo)
+}
+
+func TestInviteManager_IdentityKey(t *testing.T) {
+	m := newTestInviteManager(t)
+
+	first, err := m.Fingerprint("alice")
+	if err != nil {
+		t.Fatalf("Failed to get fingerprint: %v", err)
+	}
+
+	second, _ := m.Fingerprint("alice")
+	if first != second {
+		t.Errorf("Expected the identity key to be stored, got %s and %s", first, second)
+	}
+
+	other, _ := m.Fingerprint("bob")
+	if first == other {
+		t.Error("Expected every user to have an own identity key")
+	}
+}
+
+func TestInviteManager_CreateAndClaim(t *testing.T) {
+	m := newTestInviteManager(t)
+
+	link, err := m.CreateInvite("alice", "127.0.0.1:7665", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create invite: %v", err)
+	}
+
+	fingerprint, _ := m.Fingerprint("alice")
+	if link.UserId != "alice" || link.Fingerprint != fingerprint || len(link.Secret) != inviteSecretSize {
+		t.Errorf("Unexpected invite %+v", link)
+	}
+
+	invite, secret, err := m.claimInvite("alice", link.InviteId)
+	if err != nil {
+		t.Fatalf("Failed to claim invite: %v", err)
+	}
+	if string(secret) != string(link.Secret) {
+		t.Error("Expected the stored secret to match the link")
+	}
+
+	// A claimed invite can't be redeemed by another handshake until it's released
+	if _, _, err := m.claimInvite("alice", link.InviteId); !errors.Is(err, ErrInvalidInvite) {
+		t.Errorf("Expected ErrInvalidInvite for a claimed invite, got %v", err)
+	}
+	m.releaseInvite(invite)
+	if invite, _, err = m.claimInvite("alice", link.InviteId); err != nil {
+		t.Fatalf("Expected the released invite to be claimed again, got %v", err)
+	}
+
+	// Invites belong to their owner
+	if _, _, err := m.claimInvite("bob", link.InviteId); !errors.Is(err, ErrInvalidInvite) {
+		t.Errorf("Expected ErrInvalidInvite for another user, got %v", err)
+	}
+
+	// A consumed invite can't be used again
+	m.consumeInvite(invite)
+	if _, _, err := m.claimInvite("alice", link.InviteId); !errors.Is(err, ErrInvalidInvite) {
+		t.Errorf("Expected ErrInvalidInvite after use, got %v", err)
+	}
+}
+
+func TestInviteManager_ConcurrentClaims(t *testing.T) {
+	m := newTestInviteManager(t)
+
+	link, err := m.CreateInvite("alice", "127.0.0.1:7665", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create invite: %v", err)
+	}
+
+	// Only one of the concurrent handshakes can redeem the invite
+	var claimed atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, _, err := m.claimInvite("alice", link.InviteId); err == nil {
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if claimed.Load() != 1 {
+		t.Errorf("Expected the invite to be claimed once, got %d", claimed.Load())
+	}
+}
+
+func TestInviteManager_Expired(t *testing.T) {
+	m := newTestInviteManager(t)
+
+	link, err := m.CreateInvite("alice", "127.0.0.1:7665", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create invite: %v", err)
+	}
+
+	invite, _, _ := m.claimInvite("alice", link.InviteId)
+	invite.ExpiresAt = time.Now().Add(-time.Second)
+	m.releaseInvite(invite)
+
+	if _, _, err := m.claimInvite("alice", link.InviteId); !errors.Is(err, ErrInviteExpired) {
+		t.Errorf("Expected ErrInviteExpired, got %v", err)
+	}
+
+	if _, err := m.CreateInvite("alice", "", time.Minute); !errors.Is(err, ErrorInvalidInput) {
+		t.Errorf("Expected ErrorInvalidInput without address, got %v", err)
+	}
+}
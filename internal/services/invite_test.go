@@ -0,0 +1,74 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInviteLink_RoundTrip(t *testing.T) {
+	link := &InviteLink{
+		Address:     "192.168.1.20:7665",
+		UserId:      "0f8fad5b-d9cb-469f-a165-70867728950e",
+		InviteId:    "abcdefghijkl",
+		Fingerprint: "00112233445566778899aabbccddeeff",
+		Secret:      bytes.Repeat([]byte{7}, inviteSecretSize),
+		ExpiresAt:   time.Unix(1760000000, 0),
+	}
+
+	uri := link.URI()
+	if !strings.HasPrefix(uri, "gotchat://join?") {
+		t.Errorf("Unexpected uri %s", uri)
+	}
+
+	parsed, err := ParseInviteLink(uri)
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", uri, err)
+	}
+
+	if parsed.Address != link.Address || parsed.UserId != link.UserId || parsed.InviteId != link.InviteId ||
+		parsed.Fingerprint != link.Fingerprint || !bytes.Equal(parsed.Secret, link.Secret) || !parsed.ExpiresAt.Equal(link.ExpiresAt) {
+		t.Errorf("Expected %+v, got %+v", link, parsed)
+	}
+
+	if !parsed.Expired(link.ExpiresAt) || parsed.Expired(link.ExpiresAt.Add(-time.Second)) {
+		t.Error("Expected the invite to expire at its expiration time")
+	}
+}
+
+func TestParseInviteLink_Invalid(t *testing.T) {
+	for _, uri := range []string{
+		"",
+		"http://join?addr=a&user=b&id=c&fp=d&secret=AAAAAAAAAAAAAAAAAAAAAA&exp=1",
+		"gotchat://other?addr=a&user=b&id=c&fp=d&secret=AAAAAAAAAAAAAAAAAAAAAA&exp=1",
+		"gotchat://join?user=b&id=c&fp=d&secret=AAAAAAAAAAAAAAAAAAAAAA&exp=1",
+		"gotchat://join?addr=a&user=b&id=c&fp=d&secret=short&exp=1",
+		"gotchat://join?addr=a&user=b&id=c&fp=d&secret=AAAAAAAAAAAAAAAAAAAAAA&exp=soon",
+	} {
+		if _, err := ParseInviteLink(uri); !errors.Is(err, ErrInvalidInvite) {
+			t.Errorf("Expected ErrInvalidInvite for %q, got %v", uri, err)
+		}
+	}
+}
+
+func TestInviteProof(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	transcript := inviteTranscript("invite", "alice", "bob", []byte("key-a"), []byte("key-b"))
+
+	// Roles and transcripts can't be swapped
+	if bytes.Equal(inviteProof(secret, "initiator", transcript), inviteProof(secret, "acceptor", transcript)) {
+		t.Error("Expected proofs of different roles to differ")
+	}
+	if bytes.Equal(transcript, inviteTranscript("invite", "alice", "bob", []byte("key-b"), []byte("key-a"))) {
+		t.Error("Expected transcripts with swapped keys to differ")
+	}
+	if bytes.Equal(transcript, inviteTranscript("invite", "alic", "ebob", []byte("key-a"), []byte("key-b"))) {
+		t.Error("Expected transcripts with shifted ids to differ")
+	}
+
+	if len(mixInviteKey(secret, []byte("key-a"))) != 32 {
+		t.Error("Expected mixed keys of 32 bytes")
+	}
+}
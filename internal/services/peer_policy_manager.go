@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/pkg/log"
+)
+
+// DefaultPeerPolicy is used by users who never picked a policy
+const DefaultPeerPolicy = core.PeerPolicyAskMe
+
+// PeerDecision is the verdict on an inbound peer
+type PeerDecision int
+
+const (
+	PeerDecisionAllow PeerDecision = iota
+	PeerDecisionReject
+	PeerDecisionAsk
+)
+
+// PeerPolicyManager stores the per-user connection policy and the allow/block rules.
+// A nil manager allows everyone.
+type PeerPolicyManager struct {
+	eventEmitter core.EventEmitter
+	policyRepo   core.Repository[core.PeerPolicy]
+	ruleRepo     core.Repository[core.PeerRule]
+
+	// Unique id of the active user which the UI events apply to
+	mu    sync.RWMutex
+	owner string
+}
+
+func NewPeerPolicyManager(eventEmitter core.EventEmitter, policyRepo core.Repository[core.PeerPolicy], ruleRepo core.Repository[core.PeerRule]) *PeerPolicyManager {
+	return &PeerPolicyManager{
+		eventEmitter,
+		policyRepo,
+		ruleRepo,
+		sync.RWMutex{},
+		"",
+	}
+}
+
+// Init implements core.Service.
+func (m *PeerPolicyManager) Init() error {
+	return nil
+}
+
+// Name implements core.Service.
+func (m *PeerPolicyManager) Name() string {
+	return "PeerPolicyManager"
+}
+
+// Dependencies implements core.DependentService.
+func (m *PeerPolicyManager) Dependencies() []string {
+	return []string{"Storage"}
+}
+
+// Run implements core.Service.
+func (m *PeerPolicyManager) Run(ctx context.Context, wg *sync.WaitGroup) {
+	// This service does not run any background tasks.
+}
+
+// Close implements core.Service.
+func (m *PeerPolicyManager) Close() error {
+	return nil
+}
+
+// MapEventToCommands implements core.Service.
+func (m *PeerPolicyManager) MapEventToCommands(event core.Event) []core.Command {
+	var commands []core.Command
+	switch e := event.(type) {
+	case core.UserLoggedInEvent:
+		commands = append(commands, &ChangePeerPolicyOwner{m, e.User.UniqueId})
+	case core.SwitchUserEvent:
+		commands = append(commands, &ChangePeerPolicyOwner{m, e.User.UniqueId})
+	case core.UserLoggedOutEvent:
+		commands = append(commands, &ReleasePeerPolicyOwner{m, e.User.UniqueId})
+	case core.SetPeerPolicyEvent:
+		commands = append(commands, &SetPeerPolicy{m, e.Policy})
+	case core.PeerRuleEvent:
+		commands = append(commands, &UpdatePeerRule{m, e.Kind, e.Value, e.Remove, e.Owner})
+	}
+
+	return commands
+}
+
+func (m *PeerPolicyManager) setOwner(owner string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.owner = owner
+}
+
+// releaseOwner forgets the owner if it's the given user, another logged in user may be the owner already
+func (m *PeerPolicyManager) releaseOwner(owner string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.owner == owner {
+		m.owner = ""
+	}
+}
+
+func (m *PeerPolicyManager) currentOwner() (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.owner == "" {
+		return "", fmt.Errorf("no user is logged in")
+	}
+
+	return m.owner, nil
+}
+
+// GetPolicy returns the policy of the user, DefaultPeerPolicy if none was set
+func (m *PeerPolicyManager) GetPolicy(owner string) (string, error) {
+	if m == nil {
+		return core.PeerPolicyAnyone, nil
+	}
+
+	policy, err := m.getPolicy(owner)
+	if err != nil {
+		return "", err
+	}
+
+	if policy == nil {
+		return DefaultPeerPolicy, nil
+	}
+
+	return policy.Policy, nil
+}
+
+// SetPolicy stores the policy of the user
+func (m *PeerPolicyManager) SetPolicy(owner string, policy string) error {
+	if !core.IsValidPeerPolicy(policy) {
+		return fmt.Errorf("%w: unknown peer policy %q", ErrorInvalidInput, policy)
+	}
+
+	existing, err := m.getPolicy(owner)
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		err = m.policyRepo.Create(core.NewPeerPolicy(owner, policy))
+	} else {
+		existing.Policy = policy
+		existing.UpdatedAt = time.Now()
+		err = m.policyRepo.Update(existing)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Peer policy of user %s changed to %s", owner, policy)
+	m.eventEmitter.Emit(PeerPolicyChanged{owner, policy})
+
+	return nil
+}
+
+// AddRule stores the rule unless it already exists
+func (m *PeerPolicyManager) AddRule(owner string, kind string, value string) error {
+	if err := validatePeerRule(kind, value); err != nil {
+		return err
+	}
+
+	existing, err := m.getRule(owner, kind, value)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+
+	// A user can't be allowed and blocked at the same time
+	if opposite := oppositePeerRule(kind); opposite != "" {
+		if err := m.RemoveRule(owner, opposite, value); err != nil {
+			return err
+		}
+	}
+
+	if err := m.ruleRepo.Create(core.NewPeerRule(owner, kind, value)); err != nil {
+		return err
+	}
+
+	log.Infof("Peer rule %s %s added for user %s", kind, value, owner)
+	m.eventEmitter.Emit(PeerRuleChanged{owner, kind, value, false})
+
+	return nil
+}
+
+// RemoveRule deletes the rule if it exists
+func (m *PeerPolicyManager) RemoveRule(owner string, kind string, value string) error {
+	existing, err := m.getRule(owner, kind, value)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return nil
+	}
+
+	if err := m.ruleRepo.Delete(existing.Id); err != nil {
+		return err
+	}
+
+	log.Infof("Peer rule %s %s removed for user %s", kind, value, owner)
+	m.eventEmitter.Emit(PeerRuleChanged{owner, kind, value, true})
+
+	return nil
+}
+
+// GetRules returns all rules of the user
+func (m *PeerPolicyManager) GetRules(owner string) ([]*core.PeerRule, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	return m.ruleRepo.GetAllBy("owner_unique_id", owner)
+}
+
+// IsAddressBlocked reports whether the user blocked the host
+func (m *PeerPolicyManager) IsAddressBlocked(owner string, host string) (bool, error) {
+	if m == nil || host == "" {
+		return false, nil
+	}
+
+	rule, err := m.getRule(owner, core.PeerRuleBlockAddress, host)
+	if err != nil {
+		return false, err
+	}
+
+	return rule != nil, nil
+}
+
+// Decide returns what to do with an inbound peer,
+// known peers already have stored keys
+func (m *PeerPolicyManager) Decide(owner string, peerUserId string, known bool) (PeerDecision, error) {
+	if m == nil {
+		return PeerDecisionAllow, nil
+	}
+
+	rules, err := m.GetRules(owner)
+	if err != nil {
+		return PeerDecisionReject, err
+	}
+
+	allowed := false
+	for _, rule := range rules {
+		if rule.Value != peerUserId {
+			continue
+		}
+
+		switch rule.Kind {
+		case core.PeerRuleBlockUser:
+			return PeerDecisionReject, nil
+		case core.PeerRuleAllowUser:
+			allowed = true
+		}
+	}
+
+	if known || allowed {
+		return PeerDecisionAllow, nil
+	}
+
+	policy, err := m.GetPolicy(owner)
+	if err != nil {
+		return PeerDecisionReject, err
+	}
+
+	switch policy {
+	case core.PeerPolicyAnyone:
+		return PeerDecisionAllow, nil
+	case core.PeerPolicyKnownOnly:
+		return PeerDecisionReject, nil
+	default:
+		return PeerDecisionAsk, nil
+	}
+}
+
+func (m *PeerPolicyManager) getPolicy(owner string) (*core.PeerPolicy, error) {
+	policies, err := m.policyRepo.GetAllBy("owner_unique_id", owner)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(policies) == 0 {
+		return nil, nil
+	}
+
+	return policies[0], nil
+}
+
+func (m *PeerPolicyManager) getRule(owner string, kind string, value string) (*core.PeerRule, error) {
+	// TODO: use better approach when available (GetOneWhere, GetOneByMany, etc.)
+	rules, err := m.ruleRepo.GetAllBy("owner_unique_id", owner)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		if rule.Kind == kind && rule.Value == value {
+			return rule, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func validatePeerRule(kind string, value string) error {
+	if value == "" {
+		return fmt.Errorf("%w: empty peer rule value", ErrorInvalidInput)
+	}
+
+	switch kind {
+	case core.PeerRuleAllowUser, core.PeerRuleBlockUser, core.PeerRuleBlockAddress:
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown peer rule %q", ErrorInvalidInput, kind)
+	}
+}
+
+func oppositePeerRule(kind string) string {
+	switch kind {
+	case core.PeerRuleAllowUser:
+		return core.PeerRuleBlockUser
+	case core.PeerRuleBlockUser:
+		return core.PeerRuleAllowUser
+	default:
+		return ""
+	}
+}
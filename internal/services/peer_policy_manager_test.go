@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/stretchr/testify/mock"
+)
+
+// memoryRepo is a minimal in-memory repository, fields maps the searchable fields of an entity
+type memoryRepo[T any] struct {
+	mu       sync.Mutex
+	nextId   int
+	entities map[int]*T
+	id       func(*T) *int
+	fields   func(*T) map[string]any
+}
+
+func newMemoryRepo[T any](id func(*T) *int, fields func(*T) map[string]any) *memoryRepo[T] {
+	return &memoryRepo[T]{entities: make(map[int]*T), id: id, fields: fields}
+}
+
+func (r *memoryRepo[T]) GetOne(id int) (*T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.entities[id]; ok {
+		return e, nil
+	}
+
+	return nil, core.ErrEntityNotFound
+}
+
+func (r *memoryRepo[T]) GetOneBy(field string, value any) (*T, error) {
+	all, err := r.GetAllBy(field, value)
+	if err != nil || len(all) == 0 {
+		return nil, core.ErrEntityNotFound
+	}
+
+	return all[0], nil
+}
+
+func (r *memoryRepo[T]) GetAll() ([]*T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	all := make([]*T, 0, len(r.entities))
+	for _, e := range r.entities {
+		all = append(all, e)
+	}
+
+	return all, nil
+}
+
+func (r *memoryRepo[T]) GetAllBy(field string, value any) ([]*T, error) {
+	all, _ := r.GetAll()
+
+	result := make([]*T, 0)
+	for _, e := range all {
+		if r.fields(e)[field] == value {
+			result = append(result, e)
+		}
+	}
+
+	return result, nil
+}
+
+func (r *memoryRepo[T]) Create(entity *T) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextId++
+	*r.id(entity) = r.nextId
+	r.entities[r.nextId] = entity
+
+	return nil
+}
+
+func (r *memoryRepo[T]) Update(entity *T) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entities[*r.id(entity)] = entity
+
+	return nil
+}
+
+func (r *memoryRepo[T]) Delete(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.entities, id)
+
+	return nil
+}
+
+func newTestPeerPolicyManager(t *testing.T) *PeerPolicyManager {
+	eventEmitter := core.NewMockEventEmitter(t)
+	eventEmitter.On("Emit", mock.Anything).Maybe()
+
+	policyRepo := newMemoryRepo(
+		func(p *core.PeerPolicy) *int { return &p.Id },
+		func(p *core.PeerPolicy) map[string]any { return map[string]any{"owner_unique_id": p.OwnerUniqueId} },
+	)
+	ruleRepo := newMemoryRepo(
+		func(r *core.PeerRule) *int { return &r.Id },
+		func(r *core.PeerRule) map[string]any { return map[string]any{"owner_unique_id": r.OwnerUniqueId} },
+	)
+
+	return NewPeerPolicyManager(eventEmitter, policyRepo, ruleRepo)
+}
+
+func TestPeerPolicyManager_Decide(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		rules    [][2]string
+		known    bool
+		expected PeerDecision
+	}{
+		{"default asks", "", nil, false, PeerDecisionAsk},
+		{"anyone", core.PeerPolicyAnyone, nil, false, PeerDecisionAllow},
+		{"known only rejects unknown", core.PeerPolicyKnownOnly, nil, false, PeerDecisionReject},
+		{"known only allows known", core.PeerPolicyKnownOnly, nil, true, PeerDecisionAllow},
+		{"allowlisted", core.PeerPolicyKnownOnly, [][2]string{{core.PeerRuleAllowUser, "peer"}}, false, PeerDecisionAllow},
+		{"blocked known", core.PeerPolicyAnyone, [][2]string{{core.PeerRuleBlockUser, "peer"}}, true, PeerDecisionReject},
+		{"other user blocked", core.PeerPolicyAnyone, [][2]string{{core.PeerRuleBlockUser, "other"}}, false, PeerDecisionAllow},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestPeerPolicyManager(t)
+
+			if test.policy != "" {
+				if err := m.SetPolicy("owner", test.policy); err != nil {
+					t.Fatalf("Failed to set policy: %v", err)
+				}
+			}
+			for _, rule := range test.rules {
+				if err := m.AddRule("owner", rule[0], rule[1]); err != nil {
+					t.Fatalf("Failed to add rule: %v", err)
+				}
+			}
+
+			decision, err := m.Decide("owner", "peer", test.known)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if decision != test.expected {
+				t.Errorf("Expected decision %d, got %d", test.expected, decision)
+			}
+		})
+	}
+}
+
+func TestPeerPolicyManager_Rules(t *testing.T) {
+	m := newTestPeerPolicyManager(t)
+
+	if err := m.AddRule("owner", core.PeerRuleAllowUser, "peer"); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	// Blocking replaces the allow rule, adding it twice is a no-op
+	for i := 0; i < 2; i++ {
+		if err := m.AddRule("owner", core.PeerRuleBlockUser, "peer"); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	rules, _ := m.GetRules("owner")
+	if len(rules) != 1 || rules[0].Kind != core.PeerRuleBlockUser {
+		t.Fatalf("Expected a single block rule, got %v", rules)
+	}
+
+	if err := m.AddRule("owner", core.PeerRuleBlockAddress, "10.0.0.1"); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if blocked, _ := m.IsAddressBlocked("owner", "10.0.0.1"); !blocked {
+		t.Error("Expected address to be blocked")
+	}
+	if blocked, _ := m.IsAddressBlocked("someone", "10.0.0.1"); blocked {
+		t.Error("Expected rules to be per user")
+	}
+
+	if err := m.RemoveRule("owner", core.PeerRuleBlockAddress, "10.0.0.1"); err != nil {
+		t.Fatalf("Failed to remove rule: %v", err)
+	}
+	if blocked, _ := m.IsAddressBlocked("owner", "10.0.0.1"); blocked {
+		t.Error("Expected address to be unblocked")
+	}
+}
+
+func TestPeerPolicyManager_InvalidInput(t *testing.T) {
+	m := newTestPeerPolicyManager(t)
+
+	if err := m.SetPolicy("owner", "everyone"); !errors.Is(err, ErrorInvalidInput) {
+		t.Errorf("Expected ErrorInvalidInput for unknown policy, got %v", err)
+	}
+	if err := m.AddRule("owner", "mute_user", "peer"); !errors.Is(err, ErrorInvalidInput) {
+		t.Errorf("Expected ErrorInvalidInput for unknown rule, got %v", err)
+	}
+	if err := m.AddRule("owner", core.PeerRuleBlockUser, ""); !errors.Is(err, ErrorInvalidInput) {
+		t.Errorf("Expected ErrorInvalidInput for empty value, got %v", err)
+	}
+}
+
+func TestPeerPolicyManager_Nil(t *testing.T) {
+	var m *PeerPolicyManager
+
+	decision, err := m.Decide("owner", "peer", false)
+	if err != nil || decision != PeerDecisionAllow {
+		t.Errorf("Expected nil manager to allow, got %d and %v", decision, err)
+	}
+}
+
+func TestPeerPolicyManager_Owner(t *testing.T) {
+	m := newTestPeerPolicyManager(t)
+	alice := &core.User{Name: "alice", UniqueId: "alice"}
+	bob := &core.User{Name: "bob", UniqueId: "bob"}
+
+	for _, event := range []core.Event{
+		core.UserLoggedInEvent{User: alice},
+		core.UserLoggedInEvent{User: bob},
+		core.SwitchUserEvent{User: alice},
+		// Logging out a user who isn't active keeps the owner
+		core.UserLoggedOutEvent{User: bob},
+	} {
+		for _, command := range m.MapEventToCommands(event) {
+			if _, err := command.Execute(context.Background()); err != nil {
+				t.Fatalf("Failed to execute %T: %v", command, err)
+			}
+		}
+	}
+
+	if owner, err := m.currentOwner(); err != nil || owner != "alice" {
+		t.Errorf("Expected alice to be the owner, got %q: %v", owner, err)
+	}
+
+	m.releaseOwner("alice")
+	if _, err := m.currentOwner(); err == nil {
+		t.Error("Expected no owner after the logout")
+	}
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+
+	"github.com/hop-/gotchat/pkg/network"
+)
+
+// Protocol actions
+const (
+	actionAuthenticate    = "authenticate"
+	actionConnectionState = "connection_state"
+	actionExchangeKeys    = "exchange_keys"
+	actionSendPhrase      = "send_phrase"
+	actionEchoPhrase      = "echo_phrase"
+	actionInviteProof     = "invite_proof"
+	actionLinkDevice      = "link_device"
+	actionDeviceLinked    = "device_linked"
+	actionDevices         = "devices"
+	actionChatMessage     = "chat_message"
+	actionPing            = "ping"
+	actionPong            = "pong"
+	actionGoodbye         = "goodbye"
+)
+
+type authenticatePayload struct {
+	User        string `json:"user"`
+	UserId      string `json:"userId"`
+	Compression string `json:"compression,omitempty"`
+	// Id of the invite the first contact is made with
+	Invite string `json:"invite,omitempty"`
+	// UniqueId of the user the peer wants to reach
+	Target string `json:"target,omitempty"`
+	// Id of the sender's device
+	Device string `json:"device,omitempty"`
+}
+
+type connectionStatePayload struct {
+	State string `json:"state"`
+}
+
+type exchangeKeysPayload struct {
+	Passphrase string `json:"passphrase"`
+}
+
+type phrasePayload struct {
+	Phrase string `json:"phrase"`
+}
+
+// inviteProofPayload proves the knowledge of the invite secret,
+// the inviting peer also signs the handshake with its identity key
+type inviteProofPayload struct {
+	Proof       string `json:"proof"`
+	IdentityKey string `json:"identityKey,omitempty"`
+	Signature   string `json:"signature,omitempty"`
+}
+
+// deviceInfo is a device of the user, signed with the user's identity key
+type deviceInfo struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	Key       string `json:"key"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// devicesPayload announces all devices of the user
+type devicesPayload struct {
+	IdentityKey string       `json:"identityKey"`
+	Devices     []deviceInfo `json:"devices"`
+}
+
+// linkDevicePayload asks to link a new device with a device link
+type linkDevicePayload struct {
+	User   string     `json:"user"`
+	Link   string     `json:"link"`
+	Device deviceInfo `json:"device"`
+	Proof  string     `json:"proof"`
+}
+
+// deviceLinkedPayload hands the identity over to the new device
+type deviceLinkedPayload struct {
+	Name         string         `json:"name"`
+	IdentitySeed string         `json:"identitySeed"`
+	Devices      devicesPayload `json:"devices"`
+}
+
+// chatMessagePayload is a text message signed with the key of the sender's device
+type chatMessagePayload struct {
+	Id     string `json:"id"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Device string `json:"device,omitempty"`
+	Text   string `json:"text"`
+	// Unix time in milliseconds
+	At        int64  `json:"at"`
+	Signature string `json:"signature,omitempty"`
+}
+
+type pingPayload struct{}
+
+// goodbyePayload tells the peer the connection is closed on purpose
+type goodbyePayload struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// protocolCodec knows all payload types exchanged between peers
+var protocolCodec = newProtocolCodec()
+
+func newProtocolCodec() *network.Codec {
+	codec := network.NewCodec()
+
+	network.MustRegisterAction[authenticatePayload](codec, actionAuthenticate)
+	network.MustRegisterAction[connectionStatePayload](codec, actionConnectionState)
+	network.MustRegisterAction[exchangeKeysPayload](codec, actionExchangeKeys)
+	network.MustRegisterAction[phrasePayload](codec, actionSendPhrase)
+	network.MustRegisterAction[phrasePayload](codec, actionEchoPhrase)
+	network.MustRegisterAction[inviteProofPayload](codec, actionInviteProof)
+	network.MustRegisterAction[linkDevicePayload](codec, actionLinkDevice)
+	network.MustRegisterAction[deviceLinkedPayload](codec, actionDeviceLinked)
+	network.MustRegisterAction[devicesPayload](codec, actionDevices)
+	network.MustRegisterAction[chatMessagePayload](codec, actionChatMessage)
+	network.MustRegisterAction[pingPayload](codec, actionPing)
+	network.MustRegisterAction[pingPayload](codec, actionPong)
+	network.MustRegisterAction[goodbyePayload](codec, actionGoodbye)
+
+	return codec
+}
+
+// newProtocolRouter creates a router for messages received after the handshake
+func newProtocolRouter() *network.Router {
+	return network.NewRouter(protocolCodec)
+}
+
+// callAction sends the request and decodes the response of the expected action
+func callAction[T any](ctx context.Context, rpc *network.RpcConn, action string, payload any, responseAction string) (*T, error) {
+	msg, err := protocolCodec.Encode(action, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := rpc.Call(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return network.DecodeAs[T](response, responseAction)
+}
+
+// replyAction answers the request received from the peer
+func replyAction(rpc *network.RpcConn, request *network.Message, action string, payload any) error {
+	msg, err := protocolCodec.Encode(action, payload)
+	if err != nil {
+		return err
+	}
+
+	return rpc.Reply(request, msg)
+}
+
+// sendAction sends a message which isn't answered over the established connection
+func sendAction(rpc *network.RpcConn, action string, payload any) error {
+	msg, err := protocolCodec.Encode(action, payload)
+	if err != nil {
+		return err
+	}
+
+	return rpc.Write(msg)
+}
+
+// sendActionContext sends a message which isn't answered unless the context is done first
+func sendActionContext(ctx context.Context, rpc *network.RpcConn, action string, payload any) error {
+	msg, err := protocolCodec.Encode(action, payload)
+	if err != nil {
+		return err
+	}
+
+	return rpc.WriteContext(ctx, msg)
+}
+
+func writeAction(conn network.AdvancedConn, action string, payload any) error {
+	msg, err := protocolCodec.Encode(action, payload)
+	if err != nil {
+		return err
+	}
+
+	return conn.Write(msg)
+}
+
+func readAction[T any](conn network.AdvancedConn, action string) (*T, error) {
+	msg, err := conn.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	return network.DecodeAs[T](msg, action)
+}
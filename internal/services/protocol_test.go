@@ -0,0 +1,55 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/hop-/gotchat/pkg/network"
+)
+
+func TestProtocol_WriteReadAction(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	sender := network.NewConn(c1)
+	receiver := network.NewConn(c2)
+
+	go writeAction(sender, actionConnectionState, connectionStatePayload{ConnectionStateKnown})
+
+	payload, err := readAction[connectionStatePayload](receiver, actionConnectionState)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if payload.State != ConnectionStateKnown {
+		t.Errorf("Expected state %s, got %s", ConnectionStateKnown, payload.State)
+	}
+}
+
+func TestProtocol_ReadActionMismatch(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	sender := network.NewConn(c1)
+	receiver := network.NewConn(c2)
+
+	go writeAction(sender, actionSendPhrase, phrasePayload{"1234-5678-9012-3456"})
+
+	_, err := readAction[phrasePayload](receiver, actionEchoPhrase)
+	if !errors.Is(err, network.ErrActionMismatch) {
+		t.Errorf("Expected ErrActionMismatch, got %v", err)
+	}
+}
+
+func TestProtocol_WriteActionWrongPayload(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	err := writeAction(network.NewConn(c1), actionAuthenticate, phrasePayload{})
+	if !errors.Is(err, network.ErrPayloadTypeMismatch) {
+		t.Errorf("Expected ErrPayloadTypeMismatch, got %v", err)
+	}
+}
@@ -1,19 +1,39 @@
 package services
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"net"
 	"sync"
+	"time"
 
 	"github.com/hop-/gotchat/internal/core"
 	"github.com/hop-/gotchat/pkg/log"
 	"github.com/hop-/gotchat/pkg/network"
 )
 
+// Time the user has to answer an inbound connection request
+const connectionRequestTimeout = 2 * time.Minute
+
+// Time the peers have to take the goodbye before the connections are closed
+const goodbyeTimeout = time.Second
+
+// Reason of the goodbye sent when the controller is closed
+const goodbyeReasonClosed = "closed"
+
+var ErrConnectionRejected = errors.New("connection rejected")
+
 type ConnectionInfo struct {
 	Conn          network.AdvancedConn
 	Authenticated bool
 	peerUserId    string
+	rpc           *network.RpcConn
+	// Device of the peer, empty if the peer doesn't support devices
+	peerDeviceId string
 }
 
 // User Controller
@@ -34,9 +54,34 @@ type UserController struct {
 
 	// Connection details manager
 	connectionDetailsManager *ConnectionDetailsManager
+
+	// Abuse protection, nil if disabled
+	guard *AbuseGuard
+
+	// Peer policy, nil allows everyone
+	peerPolicyManager *PeerPolicyManager
+
+	// Invites for the first contact, nil if not supported
+	inviteManager *InviteManager
+
+	// Devices of the users, nil if not supported
+	deviceManager *DeviceManager
+
+	// Inbound connections waiting for the user's decision
+	pendingRequests map[string]chan bool
+	requestTimeout  time.Duration
 }
 
-func NewUserController(user *core.User, eventEmitter core.EventEmitter, userManager *UserManager, connectionDetailsManager *ConnectionDetailsManager) *UserController {
+func NewUserController(
+	user *core.User,
+	eventEmitter core.EventEmitter,
+	userManager *UserManager,
+	connectionDetailsManager *ConnectionDetailsManager,
+	guard *AbuseGuard,
+	peerPolicyManager *PeerPolicyManager,
+	inviteManager *InviteManager,
+	deviceManager *DeviceManager,
+) *UserController {
 	return &UserController{
 		AtomicRunningStatus{},
 		sync.RWMutex{},
@@ -45,22 +90,91 @@ func NewUserController(user *core.User, eventEmitter core.EventEmitter, userMana
 		eventEmitter,
 		userManager,
 		connectionDetailsManager,
+		guard,
+		peerPolicyManager,
+		inviteManager,
+		deviceManager,
+		make(map[string]chan bool),
+		connectionRequestTimeout,
 	}
 }
 
 func (uc *UserController) Register(conn *network.Conn, isInitator bool) string {
+	return uc.register(conn, isInitator, network.RemoteHost(conn.Conn()), "", nil, nil)
+}
+
+// RegisterOutbound registers an outbound connection to the given peer,
+// the peer user id is optional and lets the remote server route the connection
+func (uc *UserController) RegisterOutbound(conn *network.Conn, peerUserId string) string {
+	return uc.register(conn, true, network.RemoteHost(conn.Conn()), peerUserId, nil, nil)
+}
+
+// RegisterRelayed registers an inbound connection coming through the relay,
+// the remote host is the relay itself so it's not held responsible for the peer
+func (uc *UserController) RegisterRelayed(conn *network.Conn) string {
+	return uc.register(conn, false, "", "", nil, nil)
+}
+
+// RegisterWithInvite registers an outbound connection making the first contact with the invite
+func (uc *UserController) RegisterWithInvite(conn *network.Conn, invite *InviteLink) string {
+	return uc.register(conn, true, network.RemoteHost(conn.Conn()), invite.UserId, invite, nil)
+}
+
+// registerRouted registers an inbound connection whose introduction was already read while routing it
+func (uc *UserController) registerRouted(conn *network.Conn, host string, peer *handshakePeer) string {
+	return uc.register(conn, false, host, "", nil, peer)
+}
+
+func (uc *UserController) register(conn *network.Conn, isInitator bool, host string, target string, invite *InviteLink, peer *handshakePeer) string {
 	log.Debugf("Registering new connection for user %s", uc.user.Name)
 	connId := uc.addUnauthenticatiedConnection(conn)
-	go uc.handleConnection(connId, conn, isInitator)
+	go uc.handleConnection(connId, conn, isInitator, host, target, invite, peer)
 
 	return connId
 }
 
+// UnauthenticatedCount returns the number of connections which didn't finish the handshake
+func (uc *UserController) UnauthenticatedCount() int {
+	uc.mu.RLock()
+	defer uc.mu.RUnlock()
+
+	count := 0
+	for _, connInfo := range uc.connectionInfos {
+		if !connInfo.Authenticated {
+			count++
+		}
+	}
+
+	return count
+}
+
 func (uc *UserController) Close() error {
 	uc.setRunningStatus(false)
 
+	uc.mu.Lock()
+	// Pending requests are rejected
+	for id, decision := range uc.pendingRequests {
+		close(decision)
+		delete(uc.pendingRequests, id)
+	}
+	uc.mu.Unlock()
+
+	uc.mu.RLock()
+	conns := make([]network.AdvancedConn, 0, len(uc.connectionInfos))
+	rpcs := make([]*network.RpcConn, 0, len(uc.connectionInfos))
 	for _, connInfo := range uc.connectionInfos {
-		if err := connInfo.Conn.Close(); err != nil {
+		conns = append(conns, connInfo.Conn)
+		if connInfo.Authenticated && connInfo.rpc != nil {
+			rpcs = append(rpcs, connInfo.rpc)
+		}
+	}
+	uc.mu.RUnlock()
+
+	// Peers learn the connections aren't lost before they are closed
+	uc.sayGoodbye(rpcs, goodbyeReasonClosed)
+
+	for _, conn := range conns {
+		if err := conn.Close(); err != nil {
 			log.Errorf("Failed to close connection: %v", err)
 		}
 	}
@@ -68,190 +182,557 @@ func (uc *UserController) Close() error {
 	return nil
 }
 
+// sayGoodbye sends the goodbye to the peers, a peer which doesn't take it in time is skipped
+func (uc *UserController) sayGoodbye(rpcs []*network.RpcConn, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), goodbyeTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, rpc := range rpcs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := sendActionContext(ctx, rpc, actionGoodbye, goodbyePayload{reason}); err != nil {
+				log.Debugf("Failed to send goodbye: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// emitEvent emits the event, uc.mu must not be held as a slow listener would stall the other connections
 func (uc *UserController) emitEvent(event core.Event) {
 	uc.eventEmitter.Emit(event)
 }
 
 func (uc *UserController) addUnauthenticatiedConnection(conn *network.Conn) string {
-	uc.mu.Lock()
-	defer uc.mu.Unlock()
 	id := generateUuid()
-	uc.connectionInfos[id] = &ConnectionInfo{conn, false, ""}
+
+	uc.mu.Lock()
+	uc.connectionInfos[id] = &ConnectionInfo{conn, false, "", nil, ""}
+	uc.mu.Unlock()
 
 	uc.emitEvent(NewUnauthenticatedConnection{id, conn})
 
 	return id
 }
 
-func (uc *UserController) upgradeConnection(connId string, conn network.AdvancedConn, peerUserId string) {
+func (uc *UserController) upgradeConnection(connId string, conn network.AdvancedConn, rpc *network.RpcConn, peer *handshakePeer) {
 	uc.mu.Lock()
-	defer uc.mu.Unlock()
-
 	if connInfo, ok := uc.connectionInfos[connId]; ok {
 		connInfo.Conn = conn
 		connInfo.Authenticated = true
-		connInfo.peerUserId = peerUserId
+		connInfo.peerUserId = peer.UserId
+		connInfo.rpc = rpc
+		connInfo.peerDeviceId = peer.Device
 	}
+	uc.mu.Unlock()
 
 	// Emit connection established event
-	uc.emitEvent(ConnectionEstablished{connId, conn, peerUserId})
+	uc.emitEvent(ConnectionEstablished{connId, conn, peer.UserId})
 }
 
 func (uc *UserController) removeConnection(id string) {
 	uc.mu.Lock()
-	defer uc.mu.Unlock()
-
 	delete(uc.connectionInfos, id)
+	uc.mu.Unlock()
 
 	uc.emitEvent(ConnectionClosed{id})
 }
 
-func (uc *UserController) handleConnection(connId string, conn *network.Conn, isInitiator bool) {
+func (uc *UserController) handleConnection(connId string, conn *network.Conn, isInitiator bool, host string, target string, invite *InviteLink, peer *handshakePeer) {
 	// Ensure the connection is removed when done
 	defer uc.removeConnection(connId)
 
+	uc.guard.LimitFrames(conn)
+
+	if !isInitiator {
+		blocked, err := uc.peerPolicyManager.IsAddressBlocked(uc.user.UniqueId, host)
+		if err != nil {
+			log.Errorf("Failed to check the blocklist for %s: %v", host, err)
+		}
+		if blocked || err != nil {
+			log.Infof("Rejecting connection %s from blocked address %s", connId, host)
+			conn.Close()
+
+			return
+		}
+
+		// The peer gets limited time to finish the handshake,
+		// routed connections are under the deadline since they were accepted
+		if peer == nil {
+			uc.setHandshakeDeadline(conn)
+		}
+	}
+
 	// Handshake
-	secureConn, peerUserId, err := uc.handshake(connId, conn, isInitiator)
+	secureConn, peer, err := uc.handshake(connId, conn, isInitiator, host, target, invite, peer)
 	if err != nil {
 		// Close the original connection
 		conn.Close()
 
+		var netErr net.Error
+		if !isInitiator && errors.As(err, &netErr) && netErr.Timeout() {
+			err = uc.guard.ReportViolation(host, ErrHandshakeDeadlineReached)
+		} else {
+			err = uc.guard.CheckReadError(host, err)
+		}
+
 		log.Errorf("Handshake failed for connection %s: %v", connId, err)
 		uc.emitEvent(ConnectionFailed{err})
 
 		return
 	}
 
+	conn.SetDeadline(time.Time{})
+
 	log.Infof("Handshake was successful, connection accepted %s", connId)
 
 	// Ensure the connection is upgraded
 	defer secureConn.Close()
 
-	// Upgrade the connection
-	uc.upgradeConnection(connId, secureConn, peerUserId)
+	router := newProtocolRouter()
 
-	// Read messages from the secure connection
-	for uc.isRunning() {
-		m, err := secureConn.Read()
-		if err != nil {
-			// Check connection close
-			if network.IsClosedError(err) {
-				log.Infof("Connection %s closed", connId)
-
-				// Exit the loop
-				break
+	var rpc *network.RpcConn
+	rpc = network.NewRpcConn(secureConn, func(msg *network.Message) error {
+		// Messages over the limit are dropped, banned hosts are disconnected
+		if err := uc.guard.AllowMessage(peer.UserId, host); err != nil {
+			if errors.Is(err, ErrHostBanned) {
+				rpc.Close()
 			}
 
-			uc.emitEvent(MessageReadError{connId, err})
+			return nil
+		}
+
+		return router.Dispatch(msg)
+	})
+	uc.guard.LimitRequests(rpc)
+	rpc.OnReadError(func(err error) {
+		log.Errorf("Failed to handle message on connection %s: %v", connId, err)
+		uc.emitEvent(MessageReadError{connId, err})
+	})
+
+	network.HandleAction(router, actionPing, func(_ *pingPayload, msg *network.Message) error {
+		return replyAction(rpc, msg, actionPong, pingPayload{})
+	})
+	network.HandleAction(router, actionGoodbye, func(goodbye *goodbyePayload, _ *network.Message) error {
+		log.Infof("Peer %s closed connection %s: %s", peer.UserId, connId, goodbye.Reason)
+		uc.emitEvent(PeerLeft{connId, peer.UserId, goodbye.Reason})
+
+		return rpc.Close()
+	})
+	network.HandleAction(router, actionDevices, func(announcement *devicesPayload, _ *network.Message) error {
+		if uc.deviceManager == nil {
+			return nil
 		}
 
+		_, err := uc.deviceManager.StoreAnnouncement(peer.UserId, announcement)
+
+		return err
+	})
+	network.HandleAction(router, actionChatMessage, func(message *chatMessagePayload, _ *network.Message) error {
+		return uc.receiveMessage(connId, peer, message)
+	})
+	router.Fallback(func(msg *network.Message) error {
 		// TODO: Handle the message and emit an event
-		_ = m
 		uc.emitEvent(NewMessage{connId})
+
+		return nil
+	})
+
+	// Upgrade the connection
+	uc.upgradeConnection(connId, secureConn, rpc, peer)
+
+	// The peer learns the devices it has to send the messages to
+	uc.announceDevices(connId, rpc)
+
+	// Read messages from the secure connection until it's closed
+	if err := rpc.Run(); err != nil {
+		err = uc.guard.CheckReadError(host, err)
+		log.Warnf("Connection %s failed: %v", connId, err)
+	}
+
+	log.Infof("Connection %s closed", connId)
+}
+
+// Ping measures the round trip time to the peer of the authenticated connection
+func (uc *UserController) Ping(ctx context.Context, connId string) (time.Duration, error) {
+	uc.mu.RLock()
+	var rpc *network.RpcConn
+	if connInfo, ok := uc.connectionInfos[connId]; ok {
+		rpc = connInfo.rpc
+	}
+	uc.mu.RUnlock()
+
+	if rpc == nil {
+		return 0, fmt.Errorf("connection %s is not established", connId)
+	}
+
+	start := time.Now()
+	_, err := callAction[pingPayload](ctx, rpc, actionPing, pingPayload{}, actionPong)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Since(start), nil
+}
+
+// SendMessage sends the text to all connected devices of the peer
+// and mirrors it to the other connected devices of the user, the id of the message is generated if empty
+func (uc *UserController) SendMessage(peerUserId string, text string, messageId string) (string, error) {
+	if peerUserId == "" || text == "" {
+		return "", ErrorInvalidInput
+	}
+
+	if messageId == "" {
+		messageId = generateUuid()
+	}
+
+	message := &chatMessagePayload{
+		Id:   messageId,
+		From: uc.user.UniqueId,
+		To:   peerUserId,
+		Text: text,
+		At:   time.Now().UnixMilli(),
+	}
+	if err := uc.deviceManager.signMessage(message); err != nil {
+		return "", err
+	}
+
+	type target struct {
+		rpc      *network.RpcConn
+		deviceId string
+		mirror   bool
+	}
+
+	uc.mu.RLock()
+	targets := make([]target, 0)
+	connected := false
+	for _, connInfo := range uc.connectionInfos {
+		if connInfo.rpc == nil {
+			continue
+		}
+
+		switch connInfo.peerUserId {
+		case peerUserId:
+			targets = append(targets, target{connInfo.rpc, connInfo.peerDeviceId, false})
+			connected = true
+		case uc.user.UniqueId:
+			targets = append(targets, target{connInfo.rpc, connInfo.peerDeviceId, true})
+		}
+	}
+	uc.mu.RUnlock()
+
+	// Nothing is mirrored if the peer can't get the message
+	if !connected {
+		return "", fmt.Errorf("%w: %s", ErrPeerNotConnected, peerUserId)
+	}
+
+	sent := MessageSent{MessageId: message.Id, From: message.From, PeerUserId: peerUserId, Text: text, At: time.UnixMilli(message.At)}
+	reached := make(map[string]bool)
+	for _, t := range targets {
+		if err := sendAction(t.rpc, actionChatMessage, message); err != nil {
+			log.Errorf("Failed to send message %s to device %s: %v", message.Id, t.deviceId, err)
+
+			continue
+		}
+
+		if t.mirror {
+			sent.Mirrored++
+		} else {
+			sent.Delivered++
+			reached[t.deviceId] = true
+		}
+	}
+
+	// Known devices of the peer which are offline miss the message
+	if uc.deviceManager != nil {
+		devices, err := uc.deviceManager.Devices(peerUserId)
+		if err != nil {
+			log.Errorf("Failed to get devices of user %s: %v", peerUserId, err)
+		}
+		for _, device := range devices {
+			if !reached[device.UniqueId] {
+				sent.Undelivered = append(sent.Undelivered, device.UniqueId)
+			}
+		}
+	}
+
+	log.Debugf("Message %s sent to %d devices of %s, mirrored to %d own devices", message.Id, sent.Delivered, peerUserId, sent.Mirrored)
+	uc.emitEvent(sent)
+
+	return message.Id, nil
+}
+
+// receiveMessage checks the message received from the peer,
+// messages from the other devices of the user are the mirrored ones sent by the user
+func (uc *UserController) receiveMessage(connId string, peer *handshakePeer, message *chatMessagePayload) error {
+	mirrored := peer.UserId == uc.user.UniqueId
+
+	if message.From != peer.UserId || (!mirrored && message.To != uc.user.UniqueId) {
+		return fmt.Errorf("message %s from %s to %s doesn't belong to connection %s", message.Id, message.From, message.To, connId)
+	}
+
+	if message.Device != peer.Device {
+		return fmt.Errorf("message %s is from device %s, not %s", message.Id, message.Device, peer.Device)
+	}
+
+	if err := uc.deviceManager.verifyMessage(message); err != nil {
+		return err
+	}
+
+	uc.emitEvent(MessageReceived{
+		connId,
+		message.Id,
+		message.From,
+		peer.Name,
+		message.To,
+		message.Device,
+		message.Text,
+		time.UnixMilli(message.At),
+		mirrored,
+	})
+
+	return nil
+}
+
+// announceDevices sends the devices of the user to the peer
+func (uc *UserController) announceDevices(connId string, rpc *network.RpcConn) {
+	if uc.deviceManager == nil {
+		return
+	}
+
+	announcement, err := uc.deviceManager.Announcement(uc.user.UniqueId)
+	if err == nil {
+		err = sendAction(rpc, actionDevices, announcement)
+	}
+	if err != nil {
+		log.Errorf("Failed to announce devices on connection %s: %v", connId, err)
+	}
+}
+
+// ResolveConnectionRequest passes the user's decision to the waiting inbound connection
+func (uc *UserController) ResolveConnectionRequest(requestId string, accept bool) error {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	decision, ok := uc.pendingRequests[requestId]
+	if !ok {
+		return fmt.Errorf("connection request %s not found", requestId)
+	}
+
+	delete(uc.pendingRequests, requestId)
+	decision <- accept
+
+	return nil
+}
+
+func (uc *UserController) setHandshakeDeadline(conn *network.Conn) {
+	if timeout := uc.guard.HandshakeTimeout(); timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+}
+
+// authorizePeer applies the peer policy to an inbound peer,
+// the keys of a known peer are replaced only with the user's consent
+func (uc *UserController) authorizePeer(connId string, conn *network.Conn, peer *handshakePeer, host string, known bool, keysChanged bool) (bool, error) {
+	decision, err := uc.peerPolicyManager.Decide(uc.user.UniqueId, peer.UserId, known)
+	if err != nil {
+		return false, err
+	}
+
+	switch decision {
+	case PeerDecisionAllow:
+		if !keysChanged {
+			return true, nil
+		}
+
+		// Anyone can claim to be a known peer who lost the keys
+		log.Warnf("Peer %s of connection %s wants to replace the stored keys", peer.UserId, connId)
+
+		return uc.requestApproval(connId, conn, peer, host, true)
+	case PeerDecisionAsk:
+		return uc.requestApproval(connId, conn, peer, host, keysChanged)
+	default:
+		return false, nil
+	}
+}
+
+// requestApproval asks the user to accept the inbound peer and waits for the decision,
+// the pending requests are limited by the abuse guard as they aren't covered by the handshake deadline
+func (uc *UserController) requestApproval(connId string, conn *network.Conn, peer *handshakePeer, host string, keysChanged bool) (bool, error) {
+	if err := uc.guard.AcquirePendingRequest(host); err != nil {
+		return false, err
+	}
+	defer uc.guard.ReleasePendingRequest(host)
+
+	requestId := generateUuid()
+	decision := make(chan bool, 1)
+
+	uc.mu.Lock()
+	uc.pendingRequests[requestId] = decision
+	uc.mu.Unlock()
+
+	// The handshake deadline doesn't cover the time the user needs to answer
+	conn.SetDeadline(time.Time{})
+	defer uc.setHandshakeDeadline(conn)
+
+	log.Infof("Asking to accept connection %s from %s (%s)", connId, peer.Name, peer.UserId)
+	uc.emitEvent(ConnectionRequested{requestId, connId, peer.UserId, peer.Name, host, uc.user.UniqueId, keysChanged})
+
+	timer := time.NewTimer(uc.requestTimeout)
+	defer timer.Stop()
+
+	select {
+	case accept, ok := <-decision:
+		return ok && accept, nil
+	case <-timer.C:
+		uc.mu.Lock()
+		delete(uc.pendingRequests, requestId)
+		uc.mu.Unlock()
+
+		log.Infof("Connection request %s expired", requestId)
+		uc.emitEvent(ConnectionRequestExpired{requestId})
+
+		return false, nil
 	}
 }
 
-func (uc *UserController) handshake(connId string, conn *network.Conn, isInitiator bool) (network.AdvancedConn, string, error) {
-	var clientUserId string
+func (uc *UserController) handshake(connId string, conn *network.Conn, isInitiator bool, host string, target string, invite *InviteLink, peer *handshakePeer) (network.AdvancedConn, *handshakePeer, error) {
 	var secureConn *network.SecureConn
-	var peerUserId string
 	var err error
 
 	if isInitiator {
-		clientUserId, err = uc.initiateAuthentication(connId, conn)
+		peer, err = uc.initiateAuthentication(connId, conn, target, invite)
 		if err != nil {
-			return conn, "", err
+			return conn, nil, err
 		}
 
-		secureConn, peerUserId, err = uc.initiateAndHandleAuthenticationAndUpgrade(clientUserId, connId, conn)
+		secureConn, err = uc.initiateAndHandleAuthenticationAndUpgrade(peer, connId, conn, invite)
 		if err != nil {
-			return conn, "", err
+			return conn, nil, err
 		}
 	} else {
-		clientUserId, err = uc.acceptAuthentication(connId, conn)
+		peer, err = uc.acceptAuthentication(connId, conn, peer)
 		if err != nil {
-			return conn, "", err
+			return conn, nil, err
 		}
 
-		secureConn, peerUserId, err = uc.acceptAndHandleAuthenticationAndUpgrade(clientUserId, connId, conn)
+		secureConn, err = uc.acceptAndHandleAuthenticationAndUpgrade(peer, connId, conn, host)
 		if err != nil {
-			return conn, "", err
+			return conn, nil, err
 		}
 	}
 
-	return secureConn, peerUserId, nil
+	// Both peers have finished the handshake at this point, so switching is safe
+	compression := peer.Compression
+	if compression != network.CompressionNone {
+		log.Debugf("Enabling %s compression for connection %s", compression, connId)
+		secureConn.EnableCompression(compression, network.DefaultCompressionThreshold)
+	}
+
+	return secureConn, peer, nil
 }
 
-func (uc *UserController) initiateAuthentication(connId string, conn *network.Conn) (string, error) {
+func (uc *UserController) initiateAuthentication(connId string, conn *network.Conn, target string, invite *InviteLink) (*handshakePeer, error) {
 	if !uc.isRunning() {
 		log.Errorf("UserController is not running")
 
-		return "", fmt.Errorf("user controller is not running")
+		return nil, fmt.Errorf("user controller is not running")
 	}
 	if uc.user == nil {
 		log.Errorf("User is not set")
 
-		return "", fmt.Errorf("user is not set")
+		return nil, fmt.Errorf("user is not set")
 	}
 
 	log.Infof("Initiating handshake for connection %s with user %s", connId, uc.user.Name)
 
+	inviteId := ""
+	if invite != nil {
+		inviteId = invite.InviteId
+	}
+
 	// Send a handshake message to the peer
-	err := uc.sendHandshakeUserInfo(connId, conn)
+	err := uc.sendHandshakeUserInfo(connId, conn, inviteId, target)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Receive the handshake response
-	userId, err := uc.receiveHandshakeUserInfo(conn)
+	peer, err := uc.receiveHandshakeUserInfo(conn)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	log.Debugf("Handshake user ID: %s", peer.UserId)
+
+	if invite != nil && peer.UserId != invite.UserId {
+		return nil, fmt.Errorf("%w: expected user %s, got %s", ErrInviteVerificationFailed, invite.UserId, peer.UserId)
 	}
-	log.Debugf("Handshake user ID: %s", userId)
 
-	return userId, nil
+	if target != "" && peer.UserId != target {
+		return nil, fmt.Errorf("expected user %s, got %s", target, peer.UserId)
+	}
+
+	return peer, nil
 }
 
-func (uc *UserController) acceptAuthentication(connId string, conn *network.Conn) (string, error) {
+// acceptAuthentication reads the introduction of the peer unless it was read while routing the connection
+func (uc *UserController) acceptAuthentication(connId string, conn *network.Conn, peer *handshakePeer) (*handshakePeer, error) {
 	if !uc.isRunning() {
 		log.Errorf("UserController is not running")
 
-		return "", fmt.Errorf("user controller is not running")
+		return nil, fmt.Errorf("user controller is not running")
 	}
 
 	if uc.user == nil {
 		log.Errorf("User is not set")
 
-		return "", fmt.Errorf("user is not set")
+		return nil, fmt.Errorf("user is not set")
 	}
 
 	log.Infof("Accepting handshake for connection %s", connId)
 
 	// Receive the handshake response
-	userId, err := uc.receiveHandshakeUserInfo(conn)
+	var err error
+	if peer == nil {
+		peer, err = uc.receiveHandshakeUserInfo(conn)
+	} else {
+		err = uc.validateHandshakePeer(peer)
+	}
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	log.Debugf("Handshake user ID: %s", peer.UserId)
+
+	if peer.Target != "" && peer.Target != uc.user.UniqueId {
+		return nil, fmt.Errorf("peer wants to reach user %s, not %s", peer.Target, uc.user.UniqueId)
 	}
-	log.Debugf("Handshake user ID: %s", userId)
 
 	// Send a handshake message to the peer
-	err = uc.sendHandshakeUserInfo(connId, conn)
+	err = uc.sendHandshakeUserInfo(connId, conn, "", "")
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return userId, nil
+	return peer, nil
 }
 
-func (uc *UserController) initiateAndHandleAuthenticationAndUpgrade(clientUserId string, connId string, conn *network.Conn) (*network.SecureConn, string, error) {
+func (uc *UserController) initiateAndHandleAuthenticationAndUpgrade(peer *handshakePeer, connId string, conn *network.Conn, invite *InviteLink) (*network.SecureConn, error) {
+	clientUserId := peer.UserId
+	// Every device of the peer has own keys
+	clientId := peer.detailsId()
+
 	// Get the connection details for the client user id
-	connectionDetails, err := uc.connectionDetailsManager.GetConnectionDetails(uc.user.UniqueId, clientUserId)
+	connectionDetails, err := uc.connectionDetailsManager.GetConnectionDetails(uc.user.UniqueId, clientId)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	var connState string
-	if connectionDetails == nil {
+	if connectionDetails == nil || invite != nil {
+		// The keys are always renewed on the first contact with an invite
 		connState = ConnectionStateUnknown
 	} else {
 		connState = ConnectionStateKnown
@@ -259,103 +740,126 @@ func (uc *UserController) initiateAndHandleAuthenticationAndUpgrade(clientUserId
 
 	// Send state of the connection to the peer
 	log.Debugf("Sending connection state %s to peer for connection %s", connState, connId)
-	err = conn.Write(network.NewMessage(map[string]string{
-		"action": "connection_state",
-		"state":  connState,
-	}, nil))
+	err = writeAction(conn, actionConnectionState, connectionStatePayload{connState})
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	// Read the response from the peer about the connection state
-	msg, err := conn.Read()
+	peerState, err := readAction[connectionStatePayload](conn, actionConnectionState)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	peerConnState := msg.Headers()["state"]
+	peerConnState := peerState.State
+
+	if peerConnState == ConnectionStateRejected {
+		return nil, ErrConnectionRejected
+	}
 
 	if connState == ConnectionStateUnknown && peerConnState != ConnectionStateUnknown {
-		return nil, "", fmt.Errorf("peer connection state is not unknown, expected %s, got %s", ConnectionStateUnknown, peerConnState)
+		return nil, fmt.Errorf("peer connection state is not unknown, expected %s, got %s", ConnectionStateUnknown, peerConnState)
 	}
 
+	renewed := false
 	if peerConnState == ConnectionStateUnknown {
 		// Handle unknown connection
 		encryptionKey, decryptionKey, err := uc.generateAndExchangeKeys(connId, conn)
 		if err != nil {
-			return nil, "", err
+			return nil, err
 		}
 
-		connectionDetails, err = uc.connectionDetailsManager.UpsertConnectionDetails(uc.user.UniqueId, clientUserId, encryptionKey, decryptionKey)
+		if invite != nil {
+			encryptionKey, decryptionKey, err = uc.proveInvite(conn, invite, clientUserId, encryptionKey, decryptionKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		encryptionKey, decryptionKey, err = uc.bindOwnDeviceKeys(peer, encryptionKey, decryptionKey)
 		if err != nil {
-			return nil, "", err
+			return nil, err
 		}
+
+		// The new keys are stored only once the peer has proven them
+		connectionDetails = &ConnectionDetails{uc.user.UniqueId, clientId, encryptionKey, decryptionKey}
+		renewed = true
 	}
 
 	if connectionDetails == nil {
-		return nil, "", fmt.Errorf("connection details not found for user %s and client %s", uc.user.UniqueId, clientUserId)
+		return nil, fmt.Errorf("connection details not found for user %s and client %s", uc.user.UniqueId, clientId)
 	}
 
 	// Create the secure component for the connection
 	secureComponent, err := network.NewEncryption(connectionDetails.EncryptionKey, connectionDetails.DecryptionKey)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	secureConn := network.NewSecureConn(*conn, secureComponent)
+	secureConn := network.NewSecureConn(conn, secureComponent)
 
 	// Generate a random phrase to send to the peer
 	randomPhrase := generateRandomString()
 
 	// Send the random phrase to the peer
 	log.Debugf("Sending random phrase to peer with connection id %s: %s", connId, randomPhrase)
-	err = secureConn.Write(network.NewMessage(map[string]string{
-		"action": "send_phrase",
-		"phrase": randomPhrase,
-	}, nil))
+	err = writeAction(secureConn, actionSendPhrase, phrasePayload{randomPhrase})
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	// Receive the echoed phrase from the peer
 	log.Debugf("Waiting for echoed phrase from peer with connection id %s", connId)
-	msg, err = secureConn.Read()
+	echo, err := readAction[phrasePayload](secureConn, actionEchoPhrase)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	echoedPhrase := msg.Headers()["phrase"]
+	echoedPhrase := echo.Phrase
 
 	// Check if the echoed phrase matches the original random phrase
 	if echoedPhrase != randomPhrase {
 		log.Debugf("Echoed phrase does not match original phrase: %s != %s", echoedPhrase, randomPhrase)
-		err := uc.connectionDetailsManager.RemoveConnectionDetails(uc.user.UniqueId, clientUserId)
-		if err != nil {
-			return nil, "", err
+		if !renewed {
+			err := uc.connectionDetailsManager.RemoveConnectionDetails(uc.user.UniqueId, clientId)
+			if err != nil {
+				return nil, err
+			}
 		}
 
-		return nil, "", fmt.Errorf("echoed phrase does not match original phrase")
+		return nil, fmt.Errorf("echoed phrase does not match original phrase")
 	}
 
 	log.Debugf("Echoed phrase matches original phrase: %s", echoedPhrase)
 
-	return secureConn, clientUserId, nil
+	if renewed {
+		_, err = uc.connectionDetailsManager.UpsertConnectionDetails(uc.user.UniqueId, clientId, connectionDetails.EncryptionKey, connectionDetails.DecryptionKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return secureConn, nil
 }
 
-func (uc *UserController) acceptAndHandleAuthenticationAndUpgrade(clientUserId string, connId string, conn *network.Conn) (*network.SecureConn, string, error) {
+func (uc *UserController) acceptAndHandleAuthenticationAndUpgrade(peer *handshakePeer, connId string, conn *network.Conn, host string) (*network.SecureConn, error) {
+	clientUserId := peer.UserId
+	// Every device of the peer has own keys
+	clientId := peer.detailsId()
+
 	// Read the response from the peer about the connection state
-	msg, err := conn.Read()
+	peerState, err := readAction[connectionStatePayload](conn, actionConnectionState)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	// Get the connection details for the client user id
-	connectionDetails, err := uc.connectionDetailsManager.GetConnectionDetails(uc.user.UniqueId, clientUserId)
+	connectionDetails, err := uc.connectionDetailsManager.GetConnectionDetails(uc.user.UniqueId, clientId)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	peerConnState := msg.Headers()["state"]
+	peerConnState := peerState.State
 	var connState string
 
 	if peerConnState == ConnectionStateUnknown {
@@ -368,63 +872,202 @@ func (uc *UserController) acceptAndHandleAuthenticationAndUpgrade(clientUserId s
 		}
 	}
 
+	// The invite already has the user's consent, only the blocklist applies
+	var invite *core.Invite
+	var inviteSecret []byte
+	if peer.InviteId != "" {
+		invite, inviteSecret, err = uc.inviteManager.claimInvite(uc.user.UniqueId, peer.InviteId)
+		if err != nil {
+			log.Warnf("Connection %s from %s with invalid invite: %v", connId, clientUserId, err)
+			if writeErr := writeAction(conn, actionConnectionState, connectionStatePayload{ConnectionStateRejected}); writeErr != nil {
+				log.Debugf("Failed to notify the peer about the rejection: %v", writeErr)
+			}
+
+			return nil, err
+		}
+		// The invite is given back unless the peer has proven it, consumed invites are gone already
+		defer uc.inviteManager.releaseInvite(invite)
+
+		connState = ConnectionStateUnknown
+	}
+
+	// Keys of rejected peers are never exchanged nor stored,
+	// only the stored keys of the device or an invite prove that the peer is known
+	known := connState == ConnectionStateKnown || invite != nil
+	keysChanged := connectionDetails != nil && connState == ConnectionStateUnknown && invite == nil
+	allowed, err := uc.authorizePeer(connId, conn, peer, host, known, keysChanged)
+	if err != nil || !allowed {
+		log.Infof("Rejecting connection %s from %s", connId, clientUserId)
+		if writeErr := writeAction(conn, actionConnectionState, connectionStatePayload{ConnectionStateRejected}); writeErr != nil {
+			log.Debugf("Failed to notify the peer about the rejection: %v", writeErr)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrConnectionRejected
+	}
+
 	// Send the connection state to the peer
 	log.Debugf("Sending connection state %s to peer for connection %s", connState, connId)
-	err = conn.Write(network.NewMessage(map[string]string{
-		"action": "connection_state",
-		"state":  connState,
-	}, nil))
+	err = writeAction(conn, actionConnectionState, connectionStatePayload{connState})
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
+	renewed := false
 	if connState == ConnectionStateUnknown {
 		// handle unknown connection
 		encryptionKey, decryptionKey, err := uc.generateAndExchangeKeys(connId, conn)
 		if err != nil {
-			return nil, "", err
+			return nil, err
 		}
 
-		connectionDetails, err = uc.connectionDetailsManager.UpsertConnectionDetails(uc.user.UniqueId, clientUserId, encryptionKey, decryptionKey)
+		if invite != nil {
+			encryptionKey, decryptionKey, err = uc.verifyInvite(conn, invite, inviteSecret, clientUserId, encryptionKey, decryptionKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		encryptionKey, decryptionKey, err = uc.bindOwnDeviceKeys(peer, encryptionKey, decryptionKey)
 		if err != nil {
-			return nil, "", err
+			return nil, err
 		}
+
+		// The new keys are stored only once the peer has proven them
+		connectionDetails = &ConnectionDetails{uc.user.UniqueId, clientId, encryptionKey, decryptionKey}
+		renewed = true
 	}
 
 	if connectionDetails == nil {
-		return nil, "", fmt.Errorf("connection details not found for user %s and client %s", uc.user.UniqueId, clientUserId)
+		return nil, fmt.Errorf("connection details not found for user %s and client %s", uc.user.UniqueId, clientId)
 	}
 
 	// Create the secure component for the connection
 	secureComponent, err := network.NewEncryption(connectionDetails.EncryptionKey, connectionDetails.DecryptionKey)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	secureConn := network.NewSecureConn(*conn, secureComponent)
+	secureConn := network.NewSecureConn(conn, secureComponent)
 
 	// Reading first phrase from secure connection
 	log.Debugf("Waiting for phrase from peer with connection id %s", connId)
-	msg, err = secureConn.Read()
+	hello, err := readAction[phrasePayload](secureConn, actionSendPhrase)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	helloPhrase := msg.Headers()["phrase"]
+	helloPhrase := hello.Phrase
 
 	// Sending the phrase back to the peer
 	log.Debugf("Sending echoed phrase back to peer with connection id %s: %s", connId, helloPhrase)
-	err = secureConn.Write(network.NewMessage(map[string]string{
-		"action": "echo_phrase",
-		"phrase": helloPhrase,
-	}, nil))
+	err = writeAction(secureConn, actionEchoPhrase, phrasePayload{helloPhrase})
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	log.Debugf("Echoed phrase back to peer: %s", helloPhrase)
 
-	return secureConn, clientUserId, nil
+	if renewed {
+		_, err = uc.connectionDetailsManager.UpsertConnectionDetails(uc.user.UniqueId, clientId, connectionDetails.EncryptionKey, connectionDetails.DecryptionKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return secureConn, nil
+}
+
+// bindOwnDeviceKeys derives the session keys with another device of the user from the shared identity key,
+// so only the devices linked to the identity agree on them
+func (uc *UserController) bindOwnDeviceKeys(peer *handshakePeer, encryptionKey []byte, decryptionKey []byte) ([]byte, []byte, error) {
+	if peer.UserId != uc.user.UniqueId {
+		return encryptionKey, decryptionKey, nil
+	}
+
+	identityKey, err := uc.inviteManager.IdentityKey(uc.user.UniqueId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return mixInviteKey(identityKey.Seed(), encryptionKey), mixInviteKey(identityKey.Seed(), decryptionKey), nil
+}
+
+// proveInvite authenticates the key exchange with the invite and checks the identity of the inviting peer,
+// it returns the session keys derived from the exchanged ones
+func (uc *UserController) proveInvite(conn *network.Conn, invite *InviteLink, peerUserId string, encryptionKey []byte, decryptionKey []byte) ([]byte, []byte, error) {
+	transcript := inviteTranscript(invite.InviteId, uc.user.UniqueId, peerUserId, encryptionKey, decryptionKey)
+
+	err := writeAction(conn, actionInviteProof, inviteProofPayload{
+		Proof: base64.StdEncoding.EncodeToString(inviteProof(invite.Secret, "initiator", transcript)),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	answer, err := readAction[inviteProofPayload](conn, actionInviteProof)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	proof, err := base64.StdEncoding.DecodeString(answer.Proof)
+	if err != nil || !hmac.Equal(proof, inviteProof(invite.Secret, "acceptor", transcript)) {
+		return nil, nil, fmt.Errorf("%w: peer doesn't know the secret", ErrInviteVerificationFailed)
+	}
+
+	identityKey, err := identityPublicKey(answer.IdentityKey)
+	if err != nil || IdentityFingerprint(identityKey) != invite.Fingerprint {
+		return nil, nil, fmt.Errorf("%w: identity key doesn't match the fingerprint", ErrInviteVerificationFailed)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(answer.Signature)
+	if err != nil || !ed25519.Verify(identityKey, transcript, signature) {
+		return nil, nil, fmt.Errorf("%w: bad identity signature", ErrInviteVerificationFailed)
+	}
+
+	log.Infof("Invite %s verified, peer %s matches fingerprint %s", invite.InviteId, peerUserId, invite.Fingerprint)
+
+	return mixInviteKey(invite.Secret, encryptionKey), mixInviteKey(invite.Secret, decryptionKey), nil
+}
+
+// verifyInvite checks that the peer knows the secret of the claimed invite, answers with the own proof
+// and consumes the invite, it returns the session keys derived from the exchanged ones
+func (uc *UserController) verifyInvite(conn *network.Conn, invite *core.Invite, secret []byte, peerUserId string, encryptionKey []byte, decryptionKey []byte) ([]byte, []byte, error) {
+	transcript := inviteTranscript(invite.UniqueId, peerUserId, uc.user.UniqueId, decryptionKey, encryptionKey)
+
+	request, err := readAction[inviteProofPayload](conn, actionInviteProof)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	proof, err := base64.StdEncoding.DecodeString(request.Proof)
+	if err != nil || !hmac.Equal(proof, inviteProof(secret, "initiator", transcript)) {
+		return nil, nil, fmt.Errorf("%w: peer doesn't know the secret", ErrInviteVerificationFailed)
+	}
+
+	identityKey, err := uc.inviteManager.IdentityKey(uc.user.UniqueId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = writeAction(conn, actionInviteProof, inviteProofPayload{
+		Proof:       base64.StdEncoding.EncodeToString(inviteProof(secret, "acceptor", transcript)),
+		IdentityKey: base64.StdEncoding.EncodeToString(identityKey.Public().(ed25519.PublicKey)),
+		Signature:   base64.StdEncoding.EncodeToString(ed25519.Sign(identityKey, transcript)),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uc.inviteManager.consumeInvite(invite)
+
+	log.Infof("Invite %s redeemed by %s", invite.UniqueId, peerUserId)
+	uc.emitEvent(InviteRedeemed{invite.UniqueId, peerUserId})
+
+	return mixInviteKey(secret, encryptionKey), mixInviteKey(secret, decryptionKey), nil
 }
 
 func (uc *UserController) generateAndExchangeKeys(connId string, conn *network.Conn) ([]byte, []byte, error) {
@@ -440,22 +1083,19 @@ func (uc *UserController) generateAndExchangeKeys(connId string, conn *network.C
 
 	// Send the keys to the peer
 	log.Debugf("Sending encryption key to peer for connection %s", connId)
-	err = conn.Write(network.NewMessage(map[string]string{
-		"action":     "exchange_keys",
-		"passphrase": passphrase,
-	}, nil))
+	err = writeAction(conn, actionExchangeKeys, exchangeKeysPayload{passphrase})
 	if err != nil {
 		return nil, nil, err
 	}
 
 	log.Debugf("Waiting for decryption key from peer for connection %s", connId)
-	msg, err := conn.Read()
+	peerKeys, err := readAction[exchangeKeysPayload](conn, actionExchangeKeys)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	// Get the decryption key from the response
-	passphrase = msg.Headers()["passphrase"]
+	passphrase = peerKeys.Passphrase
 
 	decryptionKey, err := base64.StdEncoding.DecodeString(passphrase)
 	if err != nil {
@@ -471,12 +1111,15 @@ func (uc *UserController) generateAndExchangeKeys(connId string, conn *network.C
 	return encryptionKey, decryptionKey, nil
 }
 
-func (uc *UserController) sendHandshakeUserInfo(connId string, conn *network.Conn) error {
-	err := conn.Write(network.NewMessage(map[string]string{
-		"action": "authenticate",
-		"user":   uc.user.Name,
-		"userId": uc.user.UniqueId,
-	}, nil))
+func (uc *UserController) sendHandshakeUserInfo(connId string, conn *network.Conn, inviteId string, target string) error {
+	err := writeAction(conn, actionAuthenticate, authenticatePayload{
+		User:        uc.user.Name,
+		UserId:      uc.user.UniqueId,
+		Compression: network.SupportedCompressions(),
+		Invite:      inviteId,
+		Target:      target,
+		Device:      uc.deviceManager.localDeviceId(uc.user.UniqueId),
+	})
 	if err != nil {
 		if network.IsClosedError(err) {
 			log.Infof("Connection %s closed by peer before the handshake", connId)
@@ -488,31 +1131,84 @@ func (uc *UserController) sendHandshakeUserInfo(connId string, conn *network.Con
 	return nil
 }
 
-func (uc *UserController) receiveHandshakeUserInfo(conn *network.Conn) (string, error) {
+// handshakePeer is the peer as introduced during the handshake
+type handshakePeer struct {
+	UserId      string
+	Name        string
+	Compression network.CompressionCodec
+	InviteId    string
+	// UniqueId of the user the peer wants to reach, empty if not named
+	Target string
+	// Device of the peer, empty if the peer doesn't support devices
+	Device string
+}
+
+// detailsId identifies the keys of the peer, every device of the peer has own keys
+func (p *handshakePeer) detailsId() string {
+	if p.Device == "" {
+		return p.UserId
+	}
+
+	return p.UserId + "/" + p.Device
+}
+
+func (uc *UserController) receiveHandshakeUserInfo(conn *network.Conn) (*handshakePeer, error) {
+	peer, err := readHandshakePeer(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := uc.validateHandshakePeer(peer); err != nil {
+		return nil, err
+	}
+
+	return peer, nil
+}
+
+func (uc *UserController) validateHandshakePeer(peer *handshakePeer) error {
+	// Validate user ID, only the other devices of the user share it
+	if peer.UserId == uc.user.UniqueId {
+		if uc.deviceManager == nil || peer.Device == "" {
+			return fmt.Errorf("handshake user ID matches the current user: %s", peer.UserId)
+		}
+
+		if peer.Device == uc.deviceManager.localDeviceId(uc.user.UniqueId) {
+			return fmt.Errorf("handshake device matches the current device: %s", peer.Device)
+		}
+	}
+
+	return nil
+}
+
+// readHandshakePeer reads the introduction the peer starts the handshake with
+func readHandshakePeer(conn *network.Conn) (*handshakePeer, error) {
 	msg, err := conn.Read()
 	if err != nil {
 		if network.IsClosedError(err) {
 			log.Infof("Connection closed by peer before the handshake")
 		}
 
-		return "", err
+		return nil, err
 	}
 
+	return decodeHandshakePeer(msg)
+}
+
+// decodeHandshakePeer decodes the introduction of the peer
+func decodeHandshakePeer(msg *network.Message) (*handshakePeer, error) {
 	// Checking message
-	if action, ok := msg.Headers()["action"]; !ok || action != "authenticate" {
-		return "", fmt.Errorf("handshake response missing or invalid action: %s", action)
+	authentication, err := network.DecodeAs[authenticatePayload](msg, actionAuthenticate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid handshake response: %w", err)
 	}
 
-	var userId string
-	var ok bool
-	if userId, ok = msg.Headers()["userId"]; !ok {
-		return "", fmt.Errorf("handshake response missing userId")
+	userId := authentication.UserId
+	if userId == "" {
+		return nil, fmt.Errorf("handshake response missing userId")
 	}
 
-	// Validate user ID
-	if userId == uc.user.UniqueId {
-		return "", fmt.Errorf("handshake user ID matches the current user: %s", userId)
-	}
+	// Peers without the header don't support compression
+	compression := network.NegotiateCompression(authentication.Compression)
 
-	return userId, nil
+	return &handshakePeer{userId, authentication.User, compression, authentication.Invite, authentication.Target, authentication.Device}, nil
 }
@@ -0,0 +1,660 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/pkg/network"
+	"github.com/stretchr/testify/mock"
+)
+
+// memoryConnectionDetailsRepo is a minimal in-memory repository for handshake tests
+type memoryConnectionDetailsRepo struct {
+	mu      sync.Mutex
+	nextId  int
+	details map[int]*core.ConnectionDetails
+}
+
+func newMemoryConnectionDetailsRepo() *memoryConnectionDetailsRepo {
+	return &memoryConnectionDetailsRepo{details: make(map[int]*core.ConnectionDetails)}
+}
+
+func (r *memoryConnectionDetailsRepo) GetOne(id int) (*core.ConnectionDetails, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if d, ok := r.details[id]; ok {
+		return d, nil
+	}
+
+	return nil, core.ErrEntityNotFound
+}
+
+func (r *memoryConnectionDetailsRepo) GetOneBy(field string, value any) (*core.ConnectionDetails, error) {
+	all, err := r.GetAllBy(field, value)
+	if err != nil || len(all) == 0 {
+		return nil, core.ErrEntityNotFound
+	}
+
+	return all[0], nil
+}
+
+func (r *memoryConnectionDetailsRepo) GetAll() ([]*core.ConnectionDetails, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	all := make([]*core.ConnectionDetails, 0, len(r.details))
+	for _, d := range r.details {
+		all = append(all, d)
+	}
+
+	return all, nil
+}
+
+func (r *memoryConnectionDetailsRepo) GetAllBy(field string, value any) ([]*core.ConnectionDetails, error) {
+	all, _ := r.GetAll()
+
+	result := make([]*core.ConnectionDetails, 0)
+	for _, d := range all {
+		if field == "host_unique_id" && d.HostUniqueId == value {
+			result = append(result, d)
+		}
+	}
+
+	return result, nil
+}
+
+func (r *memoryConnectionDetailsRepo) Create(entity *core.ConnectionDetails) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextId++
+	entity.Id = r.nextId
+	r.details[entity.Id] = entity
+
+	return nil
+}
+
+func (r *memoryConnectionDetailsRepo) Update(entity *core.ConnectionDetails) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.details[entity.Id] = entity
+
+	return nil
+}
+
+func (r *memoryConnectionDetailsRepo) Delete(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.details, id)
+
+	return nil
+}
+
+func newTestUserController(t *testing.T, name string) *UserController {
+	eventEmitter := core.NewMockEventEmitter(t)
+	eventEmitter.On("Emit", mock.Anything).Maybe()
+
+	cdm := NewConnectionDetailsManager(eventEmitter, newMemoryConnectionDetailsRepo())
+	user := core.NewUser(name, "password")
+
+	uc := NewUserController(user, eventEmitter, nil, cdm, nil, nil, nil, nil)
+	uc.setRunningStatus(true)
+
+	return uc
+}
+
+type handshakeResult struct {
+	conn       network.AdvancedConn
+	peerUserId string
+	err        error
+}
+
+func newHandshakeResult(conn network.AdvancedConn, peer *handshakePeer, err error) handshakeResult {
+	if peer == nil {
+		return handshakeResult{conn, "", err}
+	}
+
+	return handshakeResult{conn, peer.UserId, err}
+}
+
+// newTestConnPair returns both ends of a loopback TCP connection,
+// net.Pipe can't be used as both peers write at the same time during the key exchange
+func newTestConnPair(t *testing.T) (net.Conn, net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := l.Accept()
+		accepted <- c
+	}()
+
+	c1, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	c2 := <-accepted
+
+	t.Cleanup(func() {
+		c1.Close()
+		c2.Close()
+	})
+
+	return c1, c2
+}
+
+func runTestHandshake(t *testing.T, alice *UserController, bob *UserController) (handshakeResult, handshakeResult) {
+	return runTestInviteHandshake(t, alice, bob, nil)
+}
+
+// runTestInviteHandshake connects alice to bob, alice joins with the invite if it's set
+func runTestInviteHandshake(t *testing.T, alice *UserController, bob *UserController, invite *InviteLink) (handshakeResult, handshakeResult) {
+	c1, c2 := newTestConnPair(t)
+
+	results := make(chan handshakeResult, 1)
+	go func() {
+		conn, peer, err := bob.handshake("bob-conn", network.NewConn(c2), false, "", "", nil, nil)
+		if err != nil {
+			// As the controller does, the peer must not wait for a failed side
+			c2.Close()
+		}
+		results <- newHandshakeResult(conn, peer, err)
+	}()
+
+	target := ""
+	if invite != nil {
+		target = invite.UserId
+	}
+
+	conn, peer, err := alice.handshake("alice-conn", network.NewConn(c1), true, "", target, invite, nil)
+	if err != nil {
+		c1.Close()
+	}
+
+	return newHandshakeResult(conn, peer, err), <-results
+}
+
+func TestUserController_Handshake(t *testing.T) {
+	alice := newTestUserController(t, "alice")
+	bob := newTestUserController(t, "bob")
+
+	// First contact exchanges keys, the second one reuses them
+	for i := 0; i < 2; i++ {
+		aliceResult, bobResult := runTestHandshake(t, alice, bob)
+		if aliceResult.err != nil || bobResult.err != nil {
+			t.Fatalf("Expected handshake to succeed, got %v and %v", aliceResult.err, bobResult.err)
+		}
+
+		if aliceResult.peerUserId != bob.user.UniqueId {
+			t.Errorf("Expected alice's peer to be bob, got %s", aliceResult.peerUserId)
+		}
+		if bobResult.peerUserId != alice.user.UniqueId {
+			t.Errorf("Expected bob's peer to be alice, got %s", bobResult.peerUserId)
+		}
+
+		// The upgraded connections can talk to each other
+		go aliceResult.conn.Write(network.NewMessage(map[string]string{"action": "ping"}, nil))
+		msg, err := bobResult.conn.Read()
+		if err != nil {
+			t.Fatalf("Expected to read from secure connection, got %v", err)
+		}
+		if network.ActionOf(msg) != "ping" {
+			t.Errorf("Expected ping, got %s", network.ActionOf(msg))
+		}
+
+		aliceResult.conn.Close()
+		bobResult.conn.Close()
+	}
+}
+
+func TestUserController_Ping(t *testing.T) {
+	alice := newTestUserController(t, "alice")
+	bob := newTestUserController(t, "bob")
+	defer alice.Close()
+	defer bob.Close()
+
+	c1, c2 := newTestConnPair(t)
+	aliceConnId := alice.Register(network.NewConn(c1), true)
+	bobConnId := bob.Register(network.NewConn(c2), false)
+
+	// Wait for the handshake to finish on both sides
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, aliceErr := alice.Ping(context.Background(), aliceConnId)
+		_, bobErr := bob.Ping(context.Background(), bobConnId)
+		if aliceErr == nil && bobErr == nil {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected ping to succeed, got %v and %v", aliceErr, bobErr)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Both peers can call each other at the same time
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := alice.Ping(context.Background(), aliceConnId); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := bob.Ping(context.Background(), bobConnId); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Expected concurrent pings to succeed, got %v", err)
+	}
+
+	if _, err := alice.Ping(context.Background(), "unknown"); err == nil {
+		t.Error("Expected error for unknown connection, got nil")
+	}
+}
+
+func TestUserController_HandshakeDeadline(t *testing.T) {
+	events := make(chan core.Event, 10)
+	eventEmitter := core.NewMockEventEmitter(t)
+	eventEmitter.On("Emit", mock.Anything).Run(func(args mock.Arguments) {
+		events <- args.Get(0).(core.Event)
+	}).Maybe()
+
+	limits := DefaultAbuseLimits()
+	limits.HandshakeTimeout = 50 * time.Millisecond
+	guard := NewAbuseGuard(eventEmitter, limits)
+
+	cdm := NewConnectionDetailsManager(eventEmitter, newMemoryConnectionDetailsRepo())
+	uc := NewUserController(core.NewUser("bob", "password"), eventEmitter, nil, cdm, guard, nil, nil, nil)
+	uc.setRunningStatus(true)
+	defer uc.Close()
+
+	// The peer connects but never starts the handshake
+	_, c2 := newTestConnPair(t)
+	uc.Register(network.NewConn(c2), false)
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if failed, ok := event.(ConnectionFailed); ok {
+				if !errors.Is(failed.Err, ErrHandshakeDeadlineReached) {
+					t.Errorf("Expected ErrHandshakeDeadlineReached, got %v", failed.Err)
+				}
+
+				return
+			}
+		case <-timeout:
+			t.Fatal("Expected the handshake to fail on deadline")
+		}
+	}
+}
+
+func TestUserController_ConnectionApproval(t *testing.T) {
+	requests := make(chan ConnectionRequested, 1)
+	eventEmitter := core.NewMockEventEmitter(t)
+	eventEmitter.On("Emit", mock.Anything).Run(func(args mock.Arguments) {
+		if request, ok := args.Get(0).(ConnectionRequested); ok {
+			requests <- request
+		}
+	}).Maybe()
+
+	alice := newTestUserController(t, "alice")
+	cdm := NewConnectionDetailsManager(eventEmitter, newMemoryConnectionDetailsRepo())
+	bob := NewUserController(core.NewUser("bob", "password"), eventEmitter, nil, cdm, nil, newTestPeerPolicyManager(t), nil, nil)
+	bob.setRunningStatus(true)
+
+	// Bob rejects first and accepts the second request
+	for _, accept := range []bool{false, true} {
+		go func() {
+			request := <-requests
+			if request.PeerUserId != alice.user.UniqueId || request.PeerName != "alice" {
+				t.Errorf("Expected request from alice, got %+v", request)
+			}
+
+			if err := bob.ResolveConnectionRequest(request.RequestId, accept); err != nil {
+				t.Errorf("Failed to resolve request: %v", err)
+			}
+		}()
+
+		aliceResult, bobResult := runTestHandshake(t, alice, bob)
+		if accept {
+			if aliceResult.err != nil || bobResult.err != nil {
+				t.Fatalf("Expected accepted handshake to succeed, got %v and %v", aliceResult.err, bobResult.err)
+			}
+
+			continue
+		}
+
+		if !errors.Is(aliceResult.err, ErrConnectionRejected) || !errors.Is(bobResult.err, ErrConnectionRejected) {
+			t.Fatalf("Expected rejected handshake, got %v and %v", aliceResult.err, bobResult.err)
+		}
+
+		// No keys are stored for the rejected peer
+		if details, _ := cdm.GetConnectionDetails(bob.user.UniqueId, alice.user.UniqueId); details != nil {
+			t.Error("Expected no connection details for rejected peer")
+		}
+	}
+
+	// A peer claiming alice's id without her keys is asked for again and can't replace them
+	stored, _ := cdm.GetConnectionDetails(bob.user.UniqueId, alice.user.UniqueId)
+	impostor := newTestUserController(t, "mallory")
+	impostor.user.UniqueId = alice.user.UniqueId
+	go func() {
+		request := <-requests
+		if err := bob.ResolveConnectionRequest(request.RequestId, false); err != nil {
+			t.Errorf("Failed to resolve request: %v", err)
+		}
+	}()
+
+	impostorResult, bobResult := runTestHandshake(t, impostor, bob)
+	if !errors.Is(impostorResult.err, ErrConnectionRejected) || !errors.Is(bobResult.err, ErrConnectionRejected) {
+		t.Fatalf("Expected the impostor to be rejected, got %v and %v", impostorResult.err, bobResult.err)
+	}
+
+	details, _ := cdm.GetConnectionDetails(bob.user.UniqueId, alice.user.UniqueId)
+	if details == nil || string(details.EncryptionKey) != string(stored.EncryptionKey) {
+		t.Error("Expected alice's keys to stay unchanged")
+	}
+
+	if err := bob.ResolveConnectionRequest("unknown", true); err == nil {
+		t.Error("Expected error for unknown request, got nil")
+	}
+}
+
+func TestUserController_KeysChangedApproval(t *testing.T) {
+	requests := make(chan ConnectionRequested, 1)
+	eventEmitter := core.NewMockEventEmitter(t)
+	eventEmitter.On("Emit", mock.Anything).Run(func(args mock.Arguments) {
+		if request, ok := args.Get(0).(ConnectionRequested); ok {
+			requests <- request
+		}
+	}).Maybe()
+
+	alice := newTestUserController(t, "alice")
+	cdm := NewConnectionDetailsManager(eventEmitter, newMemoryConnectionDetailsRepo())
+	policy := newTestPeerPolicyManager(t)
+	bob := NewUserController(core.NewUser("bob", "password"), eventEmitter, nil, cdm, nil, policy, nil, nil)
+	bob.setRunningStatus(true)
+
+	// Bob lets anyone in without asking
+	if err := policy.SetPolicy(bob.user.UniqueId, core.PeerPolicyAnyone); err != nil {
+		t.Fatalf("Failed to set the policy: %v", err)
+	}
+
+	aliceResult, bobResult := runTestHandshake(t, alice, bob)
+	if aliceResult.err != nil || bobResult.err != nil {
+		t.Fatalf("Expected handshake to succeed, got %v and %v", aliceResult.err, bobResult.err)
+	}
+	stored, _ := cdm.GetConnectionDetails(bob.user.UniqueId, alice.user.UniqueId)
+	if stored == nil {
+		t.Fatal("Expected alice's keys to be stored")
+	}
+
+	// The policy doesn't let a peer claiming alice's id without her keys replace them
+	impostor := newTestUserController(t, "mallory")
+	impostor.user.UniqueId = alice.user.UniqueId
+	go func() {
+		request := <-requests
+		if !request.KeysChanged {
+			t.Errorf("Expected the request to tell that the keys have changed, got %+v", request)
+		}
+
+		if err := bob.ResolveConnectionRequest(request.RequestId, false); err != nil {
+			t.Errorf("Failed to resolve request: %v", err)
+		}
+	}()
+
+	impostorResult, bobResult := runTestHandshake(t, impostor, bob)
+	if !errors.Is(impostorResult.err, ErrConnectionRejected) || !errors.Is(bobResult.err, ErrConnectionRejected) {
+		t.Fatalf("Expected the impostor to be rejected, got %v and %v", impostorResult.err, bobResult.err)
+	}
+
+	details, _ := cdm.GetConnectionDetails(bob.user.UniqueId, alice.user.UniqueId)
+	if details == nil || string(details.EncryptionKey) != string(stored.EncryptionKey) {
+		t.Error("Expected alice's keys to stay unchanged")
+	}
+}
+
+func TestUserController_InviteHandshake(t *testing.T) {
+	eventEmitter := core.NewMockEventEmitter(t)
+	eventEmitter.On("Emit", mock.Anything).Maybe()
+
+	alice := newTestUserController(t, "alice")
+	policies := newTestPeerPolicyManager(t)
+	invites := newTestInviteManager(t)
+	cdm := NewConnectionDetailsManager(eventEmitter, newMemoryConnectionDetailsRepo())
+	bob := NewUserController(core.NewUser("bob", "password"), eventEmitter, nil, cdm, nil, policies, invites, nil)
+	bob.setRunningStatus(true)
+
+	// Unknown peers would need an approval without the invite
+	if err := policies.SetPolicy(bob.user.UniqueId, core.PeerPolicyKnownOnly); err != nil {
+		t.Fatalf("Failed to set policy: %v", err)
+	}
+
+	newInvite := func() *InviteLink {
+		invite, err := invites.CreateInvite(bob.user.UniqueId, "127.0.0.1:7665", time.Minute)
+		if err != nil {
+			t.Fatalf("Failed to create invite: %v", err)
+		}
+
+		return invite
+	}
+
+	t.Run("wrong secret", func(t *testing.T) {
+		invite := newInvite()
+		forged := *invite
+		forged.Secret = []byte("0000000000000000")
+
+		aliceResult, bobResult := runTestInviteHandshake(t, alice, bob, &forged)
+		if !errors.Is(bobResult.err, ErrInviteVerificationFailed) {
+			t.Errorf("Expected bob to detect the forged secret, got %v", bobResult.err)
+		}
+		if aliceResult.err == nil {
+			t.Error("Expected alice's handshake to fail")
+		}
+	})
+
+	t.Run("wrong fingerprint", func(t *testing.T) {
+		invite := newInvite()
+		invite.Fingerprint = "00000000000000000000000000000000"
+
+		aliceResult, _ := runTestInviteHandshake(t, alice, bob, invite)
+		if !errors.Is(aliceResult.err, ErrInviteVerificationFailed) {
+			t.Errorf("Expected alice to detect the wrong identity, got %v", aliceResult.err)
+		}
+	})
+
+	t.Run("one-time", func(t *testing.T) {
+		invite := newInvite()
+
+		aliceResult, bobResult := runTestInviteHandshake(t, alice, bob, invite)
+		if aliceResult.err != nil || bobResult.err != nil {
+			t.Fatalf("Expected invite handshake to succeed, got %v and %v", aliceResult.err, bobResult.err)
+		}
+
+		// The derived keys work on both sides
+		go aliceResult.conn.Write(network.NewMessage(map[string]string{"action": "ping"}, nil))
+		if _, err := bobResult.conn.Read(); err != nil {
+			t.Fatalf("Expected to read from secure connection, got %v", err)
+		}
+		aliceResult.conn.Close()
+		bobResult.conn.Close()
+
+		aliceResult, bobResult = runTestInviteHandshake(t, alice, bob, invite)
+		if !errors.Is(bobResult.err, ErrInvalidInvite) || !errors.Is(aliceResult.err, ErrConnectionRejected) {
+			t.Errorf("Expected the used invite to be rejected, got %v and %v", aliceResult.err, bobResult.err)
+		}
+
+		// Bob knows alice now, so the policy lets her in without an invite
+		aliceResult, bobResult = runTestHandshake(t, alice, bob)
+		if aliceResult.err != nil || bobResult.err != nil {
+			t.Errorf("Expected known peer to connect, got %v and %v", aliceResult.err, bobResult.err)
+		}
+	})
+}
+
+// newTestMessagingMachine creates a machine which passes the received messages to the channel
+func newTestMessagingMachine(t *testing.T, deviceName string, received chan<- MessageReceived) *testMachine {
+	eventEmitter := core.NewMockEventEmitter(t)
+	eventEmitter.On("Emit", mock.Anything).Run(func(args mock.Arguments) {
+		if e, ok := args.Get(0).(MessageReceived); ok {
+			received <- e
+		}
+	}).Maybe()
+
+	return newTestMachineWithEmitter(t, deviceName, eventEmitter)
+}
+
+// newTestMachineController runs the user on the machine
+func newTestMachineController(t *testing.T, m *testMachine, user *core.User) *UserController {
+	cdm := NewConnectionDetailsManager(m.eventEmitter, newMemoryConnectionDetailsRepo())
+
+	uc := NewUserController(user, m.eventEmitter, m.userManager, cdm, nil, nil, m.inviteManager, m.deviceManager)
+	uc.setRunningStatus(true)
+	t.Cleanup(func() { uc.Close() })
+
+	return uc
+}
+
+// connectTestControllers connects both controllers and waits until the connection is established on both sides
+func connectTestControllers(t *testing.T, initiator *UserController, acceptor *UserController) {
+	c1, c2 := newTestConnPair(t)
+
+	initiatorConn := initiator.Register(network.NewConn(c1), true)
+	acceptorConn := acceptor.Register(network.NewConn(c2), false)
+
+	established := func(uc *UserController, connId string) bool {
+		uc.mu.RLock()
+		defer uc.mu.RUnlock()
+
+		connInfo, ok := uc.connectionInfos[connId]
+
+		return ok && connInfo.rpc != nil
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !established(initiator, initiatorConn) || !established(acceptor, acceptorConn) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Connection of %s and %s wasn't established", initiator.user.Name, acceptor.user.Name)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func receiveTestMessage(t *testing.T, received <-chan MessageReceived) MessageReceived {
+	select {
+	case e := <-received:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("Message wasn't received")
+
+		return MessageReceived{}
+	}
+}
+
+func TestUserController_MultiDeviceMessages(t *testing.T) {
+	desktopReceived := make(chan MessageReceived, 4)
+	laptopReceived := make(chan MessageReceived, 4)
+	bobReceived := make(chan MessageReceived, 4)
+
+	desktopMachine := newTestMessagingMachine(t, "desktop", desktopReceived)
+	alice, err := desktopMachine.userManager.CreateUser("alice", "password")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	desktop := newTestMachineController(t, desktopMachine, alice)
+
+	laptopMachine := newTestMessagingMachine(t, "laptop", laptopReceived)
+	linked, err := linkTestDevice(t, desktopMachine, laptopMachine, alice.UniqueId)
+	if err != nil {
+		t.Fatalf("Failed to link device: %v", err)
+	}
+	laptop := newTestMachineController(t, laptopMachine, linked)
+
+	bob := newTestMachineController(t, newTestMessagingMachine(t, "phone", bobReceived), core.NewUser("bob", "password"))
+
+	connectTestControllers(t, desktop, bob)
+	connectTestControllers(t, laptop, bob)
+	connectTestControllers(t, laptop, desktop)
+
+	// Messages reach all devices of the peer
+	if _, err := bob.SendMessage(alice.UniqueId, "hi alice", ""); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	for _, received := range []chan MessageReceived{desktopReceived, laptopReceived} {
+		e := receiveTestMessage(t, received)
+		if e.Text != "hi alice" || e.From != bob.user.UniqueId || e.Mirrored {
+			t.Errorf("Unexpected message %+v", e)
+		}
+	}
+
+	// Sent messages are mirrored to the other devices of the user
+	if _, err := desktop.SendMessage(bob.user.UniqueId, "hi bob", ""); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	if e := receiveTestMessage(t, bobReceived); e.Text != "hi bob" || e.From != alice.UniqueId || e.Mirrored {
+		t.Errorf("Unexpected message %+v", e)
+	}
+	if e := receiveTestMessage(t, laptopReceived); e.Text != "hi bob" || e.To != bob.user.UniqueId || !e.Mirrored {
+		t.Errorf("Expected the mirrored message, got %+v", e)
+	}
+
+	// Peers without a connection can't be reached
+	if _, err := desktop.SendMessage("carol", "hi carol", ""); !errors.Is(err, ErrPeerNotConnected) {
+		t.Errorf("Expected ErrPeerNotConnected, got %v", err)
+	}
+}
+
+func TestUserController_Goodbye(t *testing.T) {
+	left := make(chan PeerLeft, 1)
+	bobEmitter := core.NewMockEventEmitter(t)
+	bobEmitter.On("Emit", mock.Anything).Run(func(args mock.Arguments) {
+		if e, ok := args.Get(0).(PeerLeft); ok {
+			left <- e
+		}
+	}).Maybe()
+
+	aliceMachine := newTestMachine(t, "desktop")
+	alice, err := aliceMachine.userManager.CreateUser("alice", "password")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	aliceController := newTestMachineController(t, aliceMachine, alice)
+	bob := newTestMachineController(t, newTestMachineWithEmitter(t, "phone", bobEmitter), core.NewUser("bob", "password"))
+
+	connectTestControllers(t, aliceController, bob)
+
+	// Closing says goodbye to the peers before the connections are closed
+	aliceController.Close()
+
+	select {
+	case e := <-left:
+		if e.PeerUserId != alice.UniqueId || e.Reason != goodbyeReasonClosed {
+			t.Errorf("Unexpected goodbye %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Goodbye wasn't received")
+	}
+}
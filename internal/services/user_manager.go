@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -28,6 +29,11 @@ func (u *UserManager) Name() string {
 	return "UserManager"
 }
 
+// Dependencies implements core.DependentService.
+func (u *UserManager) Dependencies() []string {
+	return []string{"Storage"}
+}
+
 func (u *UserManager) Run(ctx context.Context, wg *sync.WaitGroup) {
 	// This service does not run any background tasks.
 }
@@ -116,6 +122,59 @@ func (u *UserManager) CreateUser(name string, password string) (*core.User, erro
 	return user, nil
 }
 
+// DeleteUser deletes the user after checking its password
+func (u *UserManager) DeleteUser(user *core.User, password string) error {
+	if user == nil {
+		return ErrorInvalidInput
+	}
+
+	if !u.checkPasswordByUser(user, password) {
+		return ErrorInvalidCredentials
+	}
+
+	if err := u.userRepo.Delete(user.Id); err != nil {
+		return err
+	}
+
+	u.eventEmitter.Emit(core.UserDeletedEvent{
+		User: user,
+	})
+
+	return nil
+}
+
+// CreateLinkedUser creates the local user of an identity linked from another device
+func (u *UserManager) CreateLinkedUser(uniqueId string, name string, password string) (*core.User, error) {
+	if uniqueId == "" || name == "" || password == "" {
+		return nil, ErrorInvalidInput
+	}
+
+	existing, err := u.userRepo.GetAllBy("unique_id", uniqueId)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return nil, fmt.Errorf("user %s already exists", uniqueId)
+	}
+
+	passwordHash, err := core.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := core.NewUser(name, passwordHash)
+	user.UniqueId = uniqueId
+	if err := u.userRepo.Create(user); err != nil {
+		return nil, err
+	}
+
+	u.eventEmitter.Emit(core.UserCreatedEvent{
+		User: user,
+	})
+
+	return user, nil
+}
+
 func (u *UserManager) checkPasswordByUser(user *core.User, password string) bool {
 	if user == nil {
 		return false
@@ -2,10 +2,12 @@ package services
 
 import (
 	"context"
+	"path/filepath"
 	"sync"
 	"testing"
 
 	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/storage"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -317,6 +319,133 @@ func TestUserManager_LoginUser_NilUser(t *testing.T) {
 	}
 }
 
+func TestUserManager_DeleteUser(t *testing.T) {
+	eventEmitter := core.NewMockEventEmitter(t)
+	userRepo := core.NewMockRepository[core.User](t)
+
+	// Setup create user mock
+	userRepo.On("Create", mock.AnythingOfType("*core.User")).Return(nil).Run(func(args mock.Arguments) {
+		user := args[0].(*core.User)
+		user.Id = 1
+	})
+	userRepo.On("Delete", 1).Return(nil).Once()
+	eventEmitter.On("Emit", mock.AnythingOfType("core.UserCreatedEvent")).Return()
+	eventEmitter.On("Emit", mock.AnythingOfType("core.UserDeletedEvent")).Return().Once()
+
+	um := NewUserManager(eventEmitter, userRepo)
+
+	// Create a user first
+	user, _ := um.CreateUser("testuser", "password123")
+
+	if err := um.DeleteUser(user, "wrongpassword"); err != ErrorInvalidCredentials {
+		t.Errorf("Expected ErrorInvalidCredentials, got %v", err)
+	}
+	if err := um.DeleteUser(user, "password123"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestUserManager_DeleteUser_Storage(t *testing.T) {
+	s := storage.NewStorage(filepath.Join(t.TempDir(), "gotchat.db"))
+	if err := s.Init(); err != nil {
+		t.Fatalf("Failed to init storage: %v", err)
+	}
+	defer s.Close()
+
+	eventEmitter := core.NewMockEventEmitter(t)
+	eventEmitter.On("Emit", mock.Anything).Return()
+
+	userRepo := s.GetUserRepository()
+	um := NewUserManager(eventEmitter, userRepo)
+	createUser := func(name string) *core.User {
+		created, err := um.CreateUser(name, "secret")
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		user, err := userRepo.GetOneBy("unique_id", created.UniqueId)
+		if err != nil {
+			t.Fatalf("Failed to get user: %v", err)
+		}
+
+		return user
+	}
+	alice := createUser("alice")
+	bob := createUser("bob")
+
+	// Alice has a chat of her own and one with bob
+	channelRepo := s.GetChannelRepository()
+	createChannel := func(name string) *core.Channel {
+		created := core.NewChannel(name)
+		if err := channelRepo.Create(created); err != nil {
+			t.Fatalf("Failed to create channel: %v", err)
+		}
+		channel, err := channelRepo.GetOneBy("unique_id", created.UniqueId)
+		if err != nil {
+			t.Fatalf("Failed to get channel: %v", err)
+		}
+
+		return channel
+	}
+	own := createChannel("own")
+	shared := createChannel("shared")
+
+	attendanceRepo := s.GetAttendanceRepository()
+	for _, a := range []*core.Attendance{core.NewAttendance(alice.Id, own.Id), core.NewAttendance(alice.Id, shared.Id), core.NewAttendance(bob.Id, shared.Id)} {
+		if err := attendanceRepo.Create(a); err != nil {
+			t.Fatalf("Failed to create attendance: %v", err)
+		}
+	}
+	for _, m := range []*core.Message{core.NewMessage(alice.Id, own.Id, "note"), core.NewMessage(alice.Id, shared.Id, "hi bob"), core.NewMessage(bob.Id, shared.Id, "hi alice")} {
+		if err := s.GetMessageRepository().Create(m); err != nil {
+			t.Fatalf("Failed to create message: %v", err)
+		}
+	}
+
+	s.GetIdentityKeyRepository().Create(core.NewIdentityKey(alice.UniqueId, "public", "private"))
+	s.GetPeerRuleRepository().Create(core.NewPeerRule(alice.UniqueId, "block", "10.0.0.2"))
+	s.GetConnectionDetailsRepository().Create(core.NewConnectionDetails(alice.UniqueId, bob.UniqueId, "enc", "dec", "salt"))
+
+	if err := um.DeleteUser(alice, "secret"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if users, _ := userRepo.GetAll(); len(users) != 1 || users[0].Id != bob.Id {
+		t.Errorf("Expected only bob to be left, got %v", users)
+	}
+	if _, err := channelRepo.GetOne(own.Id); err == nil {
+		t.Error("Expected alice's own chat to be deleted")
+	}
+	if _, err := channelRepo.GetOne(shared.Id); err != nil {
+		t.Errorf("Expected the chat with bob to be kept, got %v", err)
+	}
+	if attendances, _ := attendanceRepo.GetAll(); len(attendances) != 1 || attendances[0].UserId != bob.Id {
+		t.Errorf("Expected only bob's attendance to be left, got %v", attendances)
+	}
+	if messages, _ := s.GetMessageRepository().GetAll(); len(messages) != 1 || messages[0].UserId != bob.Id {
+		t.Errorf("Expected only bob's message to be left, got %v", messages)
+	}
+	if keys, _ := s.GetIdentityKeyRepository().GetAll(); len(keys) != 0 {
+		t.Errorf("Expected the identity key to be deleted, got %v", keys)
+	}
+	if rules, _ := s.GetPeerRuleRepository().GetAll(); len(rules) != 0 {
+		t.Errorf("Expected the peer rules to be deleted, got %v", rules)
+	}
+	if details, _ := s.GetConnectionDetailsRepository().GetAll(); len(details) != 0 {
+		t.Errorf("Expected the connection details to be deleted, got %v", details)
+	}
+}
+
+func TestUserManager_DeleteUser_NilUser(t *testing.T) {
+	eventEmitter := core.NewMockEventEmitter(t)
+	userRepo := core.NewMockRepository[core.User](t)
+
+	um := NewUserManager(eventEmitter, userRepo)
+
+	if err := um.DeleteUser(nil, "password"); err != ErrorInvalidInput {
+		t.Errorf("Expected ErrorInvalidInput, got %v", err)
+	}
+}
+
 func TestUserManager_GetAllUsers(t *testing.T) {
 	eventEmitter := core.NewMockEventEmitter(t)
 	userRepo := core.NewMockRepository[core.User](t)
@@ -0,0 +1,123 @@
+package storage
+
+import "github.com/hop-/gotchat/internal/core"
+
+type DeviceLinkRepository struct {
+	StorageDb
+}
+
+func newDeviceLinkRepository(storage StorageDb) *DeviceLinkRepository {
+	return &DeviceLinkRepository{storage}
+}
+
+func (r *DeviceLinkRepository) GetOne(id int) (*core.DeviceLink, error) {
+	row := r.Db().QueryRow("SELECT id, unique_id, owner_unique_id, secret, expires_at, created_at FROM device_links WHERE id = ?", id)
+	if row == nil {
+		return nil, core.ErrEntityNotFound
+	}
+
+	var e core.DeviceLink
+	err := row.Scan(&e.Id, &e.UniqueId, &e.OwnerUniqueId, &e.Secret, &e.ExpiresAt, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (r *DeviceLinkRepository) GetOneBy(field string, value any) (*core.DeviceLink, error) {
+	if !isFieldExist[core.DeviceLink](field) {
+		return nil, core.ErrEntityFieldNotExist
+	}
+	row := r.Db().QueryRow("SELECT id, unique_id, owner_unique_id, secret, expires_at, created_at FROM device_links WHERE "+field+" = ?", value)
+	if row == nil {
+		return nil, core.ErrEntityNotFound
+	}
+
+	var e core.DeviceLink
+	err := row.Scan(&e.Id, &e.UniqueId, &e.OwnerUniqueId, &e.Secret, &e.ExpiresAt, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (r *DeviceLinkRepository) GetAll() ([]*core.DeviceLink, error) {
+	rows, err := queryWithRetry(r.Db(), "SELECT id, unique_id, owner_unique_id, secret, expires_at, created_at FROM device_links")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []*core.DeviceLink
+	for rows.Next() {
+		var e core.DeviceLink
+		err := rows.Scan(&e.Id, &e.UniqueId, &e.OwnerUniqueId, &e.Secret, &e.ExpiresAt, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, &e)
+	}
+
+	return entities, nil
+}
+
+func (r *DeviceLinkRepository) GetAllBy(field string, value any) ([]*core.DeviceLink, error) {
+	if !isFieldExist[core.DeviceLink](field) {
+		return nil, core.ErrEntityFieldNotExist
+	}
+
+	rows, err := queryWithRetry(r.Db(), "SELECT id, unique_id, owner_unique_id, secret, expires_at, created_at FROM device_links WHERE "+field+" = ?", value)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []*core.DeviceLink
+	for rows.Next() {
+		var e core.DeviceLink
+		err := rows.Scan(&e.Id, &e.UniqueId, &e.OwnerUniqueId, &e.Secret, &e.ExpiresAt, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, &e)
+	}
+
+	return entities, nil
+}
+
+func (r *DeviceLinkRepository) Create(link *core.DeviceLink) error {
+	_, err := execWithRetry(
+		r.Db(),
+		"INSERT INTO device_links (unique_id, owner_unique_id, secret, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		link.UniqueId,
+		link.OwnerUniqueId,
+		link.Secret,
+		link.ExpiresAt,
+		link.CreatedAt,
+	)
+
+	return err
+}
+
+func (r *DeviceLinkRepository) Update(link *core.DeviceLink) error {
+	_, err := execWithRetry(
+		r.Db(),
+		"UPDATE device_links SET unique_id = ?, owner_unique_id = ?, secret = ?, expires_at = ?, created_at = ? WHERE id = ?",
+		link.UniqueId,
+		link.OwnerUniqueId,
+		link.Secret,
+		link.ExpiresAt,
+		link.CreatedAt,
+		link.Id,
+	)
+
+	return err
+}
+
+func (r *DeviceLinkRepository) Delete(id int) error {
+	_, err := execWithRetry(r.Db(), "DELETE FROM device_links WHERE id = ?", id)
+
+	return err
+}
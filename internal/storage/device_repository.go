@@ -0,0 +1,129 @@
+package storage
+
+import "github.com/hop-/gotchat/internal/core"
+
+type DeviceRepository struct {
+	StorageDb
+}
+
+func newDeviceRepository(storage StorageDb) *DeviceRepository {
+	return &DeviceRepository{storage}
+}
+
+func (r *DeviceRepository) GetOne(id int) (*core.Device, error) {
+	row := r.Db().QueryRow("SELECT id, unique_id, owner_unique_id, name, public_key, private_key, identity_key, signature, created_at FROM devices WHERE id = ?", id)
+	if row == nil {
+		return nil, core.ErrEntityNotFound
+	}
+
+	var e core.Device
+	err := row.Scan(&e.Id, &e.UniqueId, &e.OwnerUniqueId, &e.Name, &e.PublicKey, &e.PrivateKey, &e.IdentityKey, &e.Signature, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (r *DeviceRepository) GetOneBy(field string, value any) (*core.Device, error) {
+	if !isFieldExist[core.Device](field) {
+		return nil, core.ErrEntityFieldNotExist
+	}
+	row := r.Db().QueryRow("SELECT id, unique_id, owner_unique_id, name, public_key, private_key, identity_key, signature, created_at FROM devices WHERE "+field+" = ?", value)
+	if row == nil {
+		return nil, core.ErrEntityNotFound
+	}
+
+	var e core.Device
+	err := row.Scan(&e.Id, &e.UniqueId, &e.OwnerUniqueId, &e.Name, &e.PublicKey, &e.PrivateKey, &e.IdentityKey, &e.Signature, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (r *DeviceRepository) GetAll() ([]*core.Device, error) {
+	rows, err := queryWithRetry(r.Db(), "SELECT id, unique_id, owner_unique_id, name, public_key, private_key, identity_key, signature, created_at FROM devices")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []*core.Device
+	for rows.Next() {
+		var e core.Device
+		err := rows.Scan(&e.Id, &e.UniqueId, &e.OwnerUniqueId, &e.Name, &e.PublicKey, &e.PrivateKey, &e.IdentityKey, &e.Signature, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, &e)
+	}
+
+	return entities, nil
+}
+
+func (r *DeviceRepository) GetAllBy(field string, value any) ([]*core.Device, error) {
+	if !isFieldExist[core.Device](field) {
+		return nil, core.ErrEntityFieldNotExist
+	}
+
+	rows, err := queryWithRetry(r.Db(), "SELECT id, unique_id, owner_unique_id, name, public_key, private_key, identity_key, signature, created_at FROM devices WHERE "+field+" = ?", value)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []*core.Device
+	for rows.Next() {
+		var e core.Device
+		err := rows.Scan(&e.Id, &e.UniqueId, &e.OwnerUniqueId, &e.Name, &e.PublicKey, &e.PrivateKey, &e.IdentityKey, &e.Signature, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, &e)
+	}
+
+	return entities, nil
+}
+
+func (r *DeviceRepository) Create(device *core.Device) error {
+	_, err := execWithRetry(
+		r.Db(),
+		"INSERT INTO devices (unique_id, owner_unique_id, name, public_key, private_key, identity_key, signature, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		device.UniqueId,
+		device.OwnerUniqueId,
+		device.Name,
+		device.PublicKey,
+		device.PrivateKey,
+		device.IdentityKey,
+		device.Signature,
+		device.CreatedAt,
+	)
+
+	return err
+}
+
+func (r *DeviceRepository) Update(device *core.Device) error {
+	_, err := execWithRetry(
+		r.Db(),
+		"UPDATE devices SET unique_id = ?, owner_unique_id = ?, name = ?, public_key = ?, private_key = ?, identity_key = ?, signature = ?, created_at = ? WHERE id = ?",
+		device.UniqueId,
+		device.OwnerUniqueId,
+		device.Name,
+		device.PublicKey,
+		device.PrivateKey,
+		device.IdentityKey,
+		device.Signature,
+		device.CreatedAt,
+		device.Id,
+	)
+
+	return err
+}
+
+func (r *DeviceRepository) Delete(id int) error {
+	_, err := execWithRetry(r.Db(), "DELETE FROM devices WHERE id = ?", id)
+
+	return err
+}
@@ -0,0 +1,121 @@
+package storage
+
+import "github.com/hop-/gotchat/internal/core"
+
+type IdentityKeyRepository struct {
+	StorageDb
+}
+
+func newIdentityKeyRepository(storage StorageDb) *IdentityKeyRepository {
+	return &IdentityKeyRepository{storage}
+}
+
+func (r *IdentityKeyRepository) GetOne(id int) (*core.IdentityKey, error) {
+	row := r.Db().QueryRow("SELECT id, owner_unique_id, public_key, private_key, created_at FROM identity_keys WHERE id = ?", id)
+	if row == nil {
+		return nil, core.ErrEntityNotFound
+	}
+
+	var e core.IdentityKey
+	err := row.Scan(&e.Id, &e.OwnerUniqueId, &e.PublicKey, &e.PrivateKey, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (r *IdentityKeyRepository) GetOneBy(field string, value any) (*core.IdentityKey, error) {
+	if !isFieldExist[core.IdentityKey](field) {
+		return nil, core.ErrEntityFieldNotExist
+	}
+	row := r.Db().QueryRow("SELECT id, owner_unique_id, public_key, private_key, created_at FROM identity_keys WHERE "+field+" = ?", value)
+	if row == nil {
+		return nil, core.ErrEntityNotFound
+	}
+
+	var e core.IdentityKey
+	err := row.Scan(&e.Id, &e.OwnerUniqueId, &e.PublicKey, &e.PrivateKey, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (r *IdentityKeyRepository) GetAll() ([]*core.IdentityKey, error) {
+	rows, err := queryWithRetry(r.Db(), "SELECT id, owner_unique_id, public_key, private_key, created_at FROM identity_keys")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []*core.IdentityKey
+	for rows.Next() {
+		var e core.IdentityKey
+		err := rows.Scan(&e.Id, &e.OwnerUniqueId, &e.PublicKey, &e.PrivateKey, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, &e)
+	}
+
+	return entities, nil
+}
+
+func (r *IdentityKeyRepository) GetAllBy(field string, value any) ([]*core.IdentityKey, error) {
+	if !isFieldExist[core.IdentityKey](field) {
+		return nil, core.ErrEntityFieldNotExist
+	}
+
+	rows, err := queryWithRetry(r.Db(), "SELECT id, owner_unique_id, public_key, private_key, created_at FROM identity_keys WHERE "+field+" = ?", value)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []*core.IdentityKey
+	for rows.Next() {
+		var e core.IdentityKey
+		err := rows.Scan(&e.Id, &e.OwnerUniqueId, &e.PublicKey, &e.PrivateKey, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, &e)
+	}
+
+	return entities, nil
+}
+
+func (r *IdentityKeyRepository) Create(key *core.IdentityKey) error {
+	_, err := execWithRetry(
+		r.Db(),
+		"INSERT INTO identity_keys (owner_unique_id, public_key, private_key, created_at) VALUES (?, ?, ?, ?)",
+		key.OwnerUniqueId,
+		key.PublicKey,
+		key.PrivateKey,
+		key.CreatedAt,
+	)
+
+	return err
+}
+
+func (r *IdentityKeyRepository) Update(key *core.IdentityKey) error {
+	_, err := execWithRetry(
+		r.Db(),
+		"UPDATE identity_keys SET owner_unique_id = ?, public_key = ?, private_key = ?, created_at = ? WHERE id = ?",
+		key.OwnerUniqueId,
+		key.PublicKey,
+		key.PrivateKey,
+		key.CreatedAt,
+		key.Id,
+	)
+
+	return err
+}
+
+func (r *IdentityKeyRepository) Delete(id int) error {
+	_, err := execWithRetry(r.Db(), "DELETE FROM identity_keys WHERE id = ?", id)
+
+	return err
+}
@@ -0,0 +1,123 @@
+package storage
+
+import "github.com/hop-/gotchat/internal/core"
+
+type InviteRepository struct {
+	StorageDb
+}
+
+func newInviteRepository(storage StorageDb) *InviteRepository {
+	return &InviteRepository{storage}
+}
+
+func (r *InviteRepository) GetOne(id int) (*core.Invite, error) {
+	row := r.Db().QueryRow("SELECT id, unique_id, owner_unique_id, secret, expires_at, created_at FROM invites WHERE id = ?", id)
+	if row == nil {
+		return nil, core.ErrEntityNotFound
+	}
+
+	var e core.Invite
+	err := row.Scan(&e.Id, &e.UniqueId, &e.OwnerUniqueId, &e.Secret, &e.ExpiresAt, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (r *InviteRepository) GetOneBy(field string, value any) (*core.Invite, error) {
+	if !isFieldExist[core.Invite](field) {
+		return nil, core.ErrEntityFieldNotExist
+	}
+	row := r.Db().QueryRow("SELECT id, unique_id, owner_unique_id, secret, expires_at, created_at FROM invites WHERE "+field+" = ?", value)
+	if row == nil {
+		return nil, core.ErrEntityNotFound
+	}
+
+	var e core.Invite
+	err := row.Scan(&e.Id, &e.UniqueId, &e.OwnerUniqueId, &e.Secret, &e.ExpiresAt, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (r *InviteRepository) GetAll() ([]*core.Invite, error) {
+	rows, err := queryWithRetry(r.Db(), "SELECT id, unique_id, owner_unique_id, secret, expires_at, created_at FROM invites")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []*core.Invite
+	for rows.Next() {
+		var e core.Invite
+		err := rows.Scan(&e.Id, &e.UniqueId, &e.OwnerUniqueId, &e.Secret, &e.ExpiresAt, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, &e)
+	}
+
+	return entities, nil
+}
+
+func (r *InviteRepository) GetAllBy(field string, value any) ([]*core.Invite, error) {
+	if !isFieldExist[core.Invite](field) {
+		return nil, core.ErrEntityFieldNotExist
+	}
+
+	rows, err := queryWithRetry(r.Db(), "SELECT id, unique_id, owner_unique_id, secret, expires_at, created_at FROM invites WHERE "+field+" = ?", value)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []*core.Invite
+	for rows.Next() {
+		var e core.Invite
+		err := rows.Scan(&e.Id, &e.UniqueId, &e.OwnerUniqueId, &e.Secret, &e.ExpiresAt, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, &e)
+	}
+
+	return entities, nil
+}
+
+func (r *InviteRepository) Create(invite *core.Invite) error {
+	_, err := execWithRetry(
+		r.Db(),
+		"INSERT INTO invites (unique_id, owner_unique_id, secret, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		invite.UniqueId,
+		invite.OwnerUniqueId,
+		invite.Secret,
+		invite.ExpiresAt,
+		invite.CreatedAt,
+	)
+
+	return err
+}
+
+func (r *InviteRepository) Update(invite *core.Invite) error {
+	_, err := execWithRetry(
+		r.Db(),
+		"UPDATE invites SET unique_id = ?, owner_unique_id = ?, secret = ?, expires_at = ?, created_at = ? WHERE id = ?",
+		invite.UniqueId,
+		invite.OwnerUniqueId,
+		invite.Secret,
+		invite.ExpiresAt,
+		invite.CreatedAt,
+		invite.Id,
+	)
+
+	return err
+}
+
+func (r *InviteRepository) Delete(id int) error {
+	_, err := execWithRetry(r.Db(), "DELETE FROM invites WHERE id = ?", id)
+
+	return err
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"database/sql"
+
 	"github.com/hop-/gotchat/internal/core"
 )
 
@@ -13,40 +15,29 @@ func newMessageRepository(storage StorageDb) *MessageRepository {
 }
 
 func (r *MessageRepository) GetOne(id int) (*core.Message, error) {
-	row := r.Db().QueryRow("SELECT * FROM messages WHERE id = ?", id)
+	row := r.Db().QueryRow("SELECT id, unique_id, user_id, sender_id, channel_id, content, timestamp FROM messages WHERE id = ?", id)
 	if row == nil {
 		return nil, core.ErrEntityNotFound
 	}
-	var message core.Message
-	err := row.Scan(&message.Id, &message.UserId, &message.ChannelId, &message.Text, &message.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
 
-	return &message, nil
+	return scanMessage(row)
 }
 
 func (r *MessageRepository) GetOneBy(field string, value any) (*core.Message, error) {
-	if !isFieldExist[core.Channel](field) {
+	if !isFieldExist[core.Message](field) {
 		return nil, core.ErrEntityFieldNotExist
 	}
 
-	row := r.Db().QueryRow("SELECT * FROM messages WHERE "+field+" = ?", value)
+	row := r.Db().QueryRow("SELECT id, unique_id, user_id, sender_id, channel_id, content, timestamp FROM messages WHERE "+field+" = ?", value)
 	if row == nil {
 		return nil, core.ErrEntityNotFound
 	}
 
-	var message core.Message
-	err := row.Scan(&message.Id, &message.UserId, &message.ChannelId, &message.Text, &message.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
-
-	return &message, nil
+	return scanMessage(row)
 }
 
 func (r *MessageRepository) GetAll() ([]*core.Message, error) {
-	rows, err := queryWithRetry(r.Db(), "SELECT * FROM messages")
+	rows, err := queryWithRetry(r.Db(), "SELECT id, unique_id, user_id, sender_id, channel_id, content, timestamp FROM messages")
 	if err != nil {
 		return nil, err
 	}
@@ -54,12 +45,11 @@ func (r *MessageRepository) GetAll() ([]*core.Message, error) {
 
 	var messages []*core.Message
 	for rows.Next() {
-		var message core.Message
-		err := rows.Scan(&message.Id, &message.UserId, &message.ChannelId, &message.Text, &message.CreatedAt)
+		message, err := scanMessage(rows)
 		if err != nil {
 			return nil, err
 		}
-		messages = append(messages, &message)
+		messages = append(messages, message)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -70,11 +60,11 @@ func (r *MessageRepository) GetAll() ([]*core.Message, error) {
 }
 
 func (r *MessageRepository) GetAllBy(field string, value any) ([]*core.Message, error) {
-	if !isFieldExist[core.Channel](field) {
+	if !isFieldExist[core.Message](field) {
 		return nil, core.ErrEntityFieldNotExist
 	}
 
-	rows, err := queryWithRetry(r.Db(), "SELECT * FROM messages WHERE "+field+" = ?", value)
+	rows, err := queryWithRetry(r.Db(), "SELECT id, unique_id, user_id, sender_id, channel_id, content, timestamp FROM messages WHERE "+field+" = ? ORDER BY timestamp, id", value)
 	if err != nil {
 		return nil, err
 	}
@@ -82,12 +72,11 @@ func (r *MessageRepository) GetAllBy(field string, value any) ([]*core.Message,
 
 	var messages []*core.Message
 	for rows.Next() {
-		var message core.Message
-		err := rows.Scan(&message.Id, &message.UserId, &message.ChannelId, &message.Text, &message.CreatedAt)
+		message, err := scanMessage(rows)
 		if err != nil {
 			return nil, err
 		}
-		messages = append(messages, &message)
+		messages = append(messages, message)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -100,8 +89,10 @@ func (r *MessageRepository) GetAllBy(field string, value any) ([]*core.Message,
 func (r *MessageRepository) Create(entity *core.Message) error {
 	_, err := execWithRetry(
 		r.Db(),
-		"INSERT INTO messages (user_id, channel_id, text, created_at) VALUES (?, ?, ?, ?)",
-		entity.UserId,
+		"INSERT INTO messages (unique_id, user_id, sender_id, channel_id, content, timestamp) VALUES (?, ?, ?, ?, ?, ?)",
+		entity.UniqueId,
+		nullableId(entity.UserId),
+		entity.SenderId,
 		entity.ChannelId,
 		entity.Text,
 		entity.CreatedAt,
@@ -113,8 +104,10 @@ func (r *MessageRepository) Create(entity *core.Message) error {
 func (r *MessageRepository) Update(entity *core.Message) error {
 	_, err := execWithRetry(
 		r.Db(),
-		"UPDATE messages SET user_id = ?, channel_id = ?, text = ?, created_at = ? WHERE id = ?",
-		entity.UserId,
+		"UPDATE messages SET unique_id = ?, user_id = ?, sender_id = ?, channel_id = ?, content = ?, timestamp = ? WHERE id = ?",
+		entity.UniqueId,
+		nullableId(entity.UserId),
+		entity.SenderId,
 		entity.ChannelId,
 		entity.Text,
 		entity.CreatedAt,
@@ -129,3 +122,30 @@ func (r *MessageRepository) Delete(id int) error {
 
 	return err
 }
+
+// scanMessage reads a message, the user id is zero for the messages of the peers
+func scanMessage(row interface{ Scan(dest ...any) error }) (*core.Message, error) {
+	var message core.Message
+	var userId sql.NullInt64
+	var uniqueId, senderId sql.NullString
+
+	err := row.Scan(&message.Id, &uniqueId, &userId, &senderId, &message.ChannelId, &message.Text, &message.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	message.UniqueId = uniqueId.String
+	message.UserId = int(userId.Int64)
+	message.SenderId = senderId.String
+
+	return &message, nil
+}
+
+// nullableId stores a missing reference as NULL to satisfy the foreign key
+func nullableId(id int) any {
+	if id == 0 {
+		return nil
+	}
+
+	return id
+}
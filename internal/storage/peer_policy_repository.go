@@ -0,0 +1,119 @@
+package storage
+
+import "github.com/hop-/gotchat/internal/core"
+
+type PeerPolicyRepository struct {
+	StorageDb
+}
+
+func newPeerPolicyRepository(storage StorageDb) *PeerPolicyRepository {
+	return &PeerPolicyRepository{storage}
+}
+
+func (r *PeerPolicyRepository) GetOne(id int) (*core.PeerPolicy, error) {
+	row := r.Db().QueryRow("SELECT id, owner_unique_id, policy, updated_at FROM peer_policies WHERE id = ?", id)
+	if row == nil {
+		return nil, core.ErrEntityNotFound
+	}
+
+	var p core.PeerPolicy
+	err := row.Scan(&p.Id, &p.OwnerUniqueId, &p.Policy, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (r *PeerPolicyRepository) GetOneBy(field string, value any) (*core.PeerPolicy, error) {
+	if !isFieldExist[core.PeerPolicy](field) {
+		return nil, core.ErrEntityFieldNotExist
+	}
+	row := r.Db().QueryRow("SELECT id, owner_unique_id, policy, updated_at FROM peer_policies WHERE "+field+" = ?", value)
+	if row == nil {
+		return nil, core.ErrEntityNotFound
+	}
+
+	var p core.PeerPolicy
+	err := row.Scan(&p.Id, &p.OwnerUniqueId, &p.Policy, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (r *PeerPolicyRepository) GetAll() ([]*core.PeerPolicy, error) {
+	rows, err := queryWithRetry(r.Db(), "SELECT id, owner_unique_id, policy, updated_at FROM peer_policies")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []*core.PeerPolicy
+	for rows.Next() {
+		var p core.PeerPolicy
+		err := rows.Scan(&p.Id, &p.OwnerUniqueId, &p.Policy, &p.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, &p)
+	}
+
+	return policies, nil
+}
+
+func (r *PeerPolicyRepository) GetAllBy(field string, value any) ([]*core.PeerPolicy, error) {
+	if !isFieldExist[core.PeerPolicy](field) {
+		return nil, core.ErrEntityFieldNotExist
+	}
+
+	rows, err := queryWithRetry(r.Db(), "SELECT id, owner_unique_id, policy, updated_at FROM peer_policies WHERE "+field+" = ?", value)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []*core.PeerPolicy
+	for rows.Next() {
+		var p core.PeerPolicy
+		err := rows.Scan(&p.Id, &p.OwnerUniqueId, &p.Policy, &p.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, &p)
+	}
+
+	return policies, nil
+}
+
+func (r *PeerPolicyRepository) Create(policy *core.PeerPolicy) error {
+	_, err := execWithRetry(
+		r.Db(),
+		"INSERT INTO peer_policies (owner_unique_id, policy, updated_at) VALUES (?, ?, ?)",
+		policy.OwnerUniqueId,
+		policy.Policy,
+		policy.UpdatedAt,
+	)
+
+	return err
+}
+
+func (r *PeerPolicyRepository) Update(policy *core.PeerPolicy) error {
+	_, err := execWithRetry(
+		r.Db(),
+		"UPDATE peer_policies SET owner_unique_id = ?, policy = ?, updated_at = ? WHERE id = ?",
+		policy.OwnerUniqueId,
+		policy.Policy,
+		policy.UpdatedAt,
+		policy.Id,
+	)
+
+	return err
+}
+
+func (r *PeerPolicyRepository) Delete(id int) error {
+	_, err := execWithRetry(r.Db(), "DELETE FROM peer_policies WHERE id = ?", id)
+
+	return err
+}
@@ -0,0 +1,121 @@
+package storage
+
+import "github.com/hop-/gotchat/internal/core"
+
+type PeerRuleRepository struct {
+	StorageDb
+}
+
+func newPeerRuleRepository(storage StorageDb) *PeerRuleRepository {
+	return &PeerRuleRepository{storage}
+}
+
+func (r *PeerRuleRepository) GetOne(id int) (*core.PeerRule, error) {
+	row := r.Db().QueryRow("SELECT id, owner_unique_id, kind, value, created_at FROM peer_rules WHERE id = ?", id)
+	if row == nil {
+		return nil, core.ErrEntityNotFound
+	}
+
+	var rule core.PeerRule
+	err := row.Scan(&rule.Id, &rule.OwnerUniqueId, &rule.Kind, &rule.Value, &rule.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+func (r *PeerRuleRepository) GetOneBy(field string, value any) (*core.PeerRule, error) {
+	if !isFieldExist[core.PeerRule](field) {
+		return nil, core.ErrEntityFieldNotExist
+	}
+	row := r.Db().QueryRow("SELECT id, owner_unique_id, kind, value, created_at FROM peer_rules WHERE "+field+" = ?", value)
+	if row == nil {
+		return nil, core.ErrEntityNotFound
+	}
+
+	var rule core.PeerRule
+	err := row.Scan(&rule.Id, &rule.OwnerUniqueId, &rule.Kind, &rule.Value, &rule.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+func (r *PeerRuleRepository) GetAll() ([]*core.PeerRule, error) {
+	rows, err := queryWithRetry(r.Db(), "SELECT id, owner_unique_id, kind, value, created_at FROM peer_rules")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*core.PeerRule
+	for rows.Next() {
+		var rule core.PeerRule
+		err := rows.Scan(&rule.Id, &rule.OwnerUniqueId, &rule.Kind, &rule.Value, &rule.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, &rule)
+	}
+
+	return rules, nil
+}
+
+func (r *PeerRuleRepository) GetAllBy(field string, value any) ([]*core.PeerRule, error) {
+	if !isFieldExist[core.PeerRule](field) {
+		return nil, core.ErrEntityFieldNotExist
+	}
+
+	rows, err := queryWithRetry(r.Db(), "SELECT id, owner_unique_id, kind, value, created_at FROM peer_rules WHERE "+field+" = ?", value)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*core.PeerRule
+	for rows.Next() {
+		var rule core.PeerRule
+		err := rows.Scan(&rule.Id, &rule.OwnerUniqueId, &rule.Kind, &rule.Value, &rule.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, &rule)
+	}
+
+	return rules, nil
+}
+
+func (r *PeerRuleRepository) Create(rule *core.PeerRule) error {
+	_, err := execWithRetry(
+		r.Db(),
+		"INSERT INTO peer_rules (owner_unique_id, kind, value, created_at) VALUES (?, ?, ?, ?)",
+		rule.OwnerUniqueId,
+		rule.Kind,
+		rule.Value,
+		rule.CreatedAt,
+	)
+
+	return err
+}
+
+func (r *PeerRuleRepository) Update(rule *core.PeerRule) error {
+	_, err := execWithRetry(
+		r.Db(),
+		"UPDATE peer_rules SET owner_unique_id = ?, kind = ?, value = ?, created_at = ? WHERE id = ?",
+		rule.OwnerUniqueId,
+		rule.Kind,
+		rule.Value,
+		rule.CreatedAt,
+		rule.Id,
+	)
+
+	return err
+}
+
+func (r *PeerRuleRepository) Delete(id int) error {
+	_, err := execWithRetry(r.Db(), "DELETE FROM peer_rules WHERE id = ?", id)
+
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/hop-/gotchat/internal/core"
@@ -24,10 +25,16 @@ type Storage struct {
 	attendanceRepo core.Repository[core.Attendance]
 	messageRepo    core.Repository[core.Message]
 	connectionRepo core.Repository[core.ConnectionDetails]
+	peerPolicyRepo core.Repository[core.PeerPolicy]
+	peerRuleRepo   core.Repository[core.PeerRule]
+	inviteRepo     core.Repository[core.Invite]
+	identityRepo   core.Repository[core.IdentityKey]
+	deviceRepo     core.Repository[core.Device]
+	deviceLinkRepo core.Repository[core.DeviceLink]
 }
 
 func NewStorage(path string) *Storage {
-	return &Storage{path, nil, nil, nil, nil, nil, nil}
+	return &Storage{path, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}
 }
 
 func (s *Storage) Db() *sql.DB {
@@ -123,6 +130,54 @@ func (s *Storage) GetMessageRepository() core.Repository[core.Message] {
 	return s.messageRepo
 }
 
+func (s *Storage) GetPeerPolicyRepository() core.Repository[core.PeerPolicy] {
+	if s.peerPolicyRepo == nil {
+		s.peerPolicyRepo = newPeerPolicyRepository(s)
+	}
+
+	return s.peerPolicyRepo
+}
+
+func (s *Storage) GetPeerRuleRepository() core.Repository[core.PeerRule] {
+	if s.peerRuleRepo == nil {
+		s.peerRuleRepo = newPeerRuleRepository(s)
+	}
+
+	return s.peerRuleRepo
+}
+
+func (s *Storage) GetInviteRepository() core.Repository[core.Invite] {
+	if s.inviteRepo == nil {
+		s.inviteRepo = newInviteRepository(s)
+	}
+
+	return s.inviteRepo
+}
+
+func (s *Storage) GetIdentityKeyRepository() core.Repository[core.IdentityKey] {
+	if s.identityRepo == nil {
+		s.identityRepo = newIdentityKeyRepository(s)
+	}
+
+	return s.identityRepo
+}
+
+func (s *Storage) GetDeviceRepository() core.Repository[core.Device] {
+	if s.deviceRepo == nil {
+		s.deviceRepo = newDeviceRepository(s)
+	}
+
+	return s.deviceRepo
+}
+
+func (s *Storage) GetDeviceLinkRepository() core.Repository[core.DeviceLink] {
+	if s.deviceLinkRepo == nil {
+		s.deviceLinkRepo = newDeviceLinkRepository(s)
+	}
+
+	return s.deviceLinkRepo
+}
+
 func (s *Storage) Name() string {
 	return "Storage"
 }
@@ -175,6 +230,36 @@ func (s *Storage) createTables() error {
 		return err
 	}
 
+	err = createPeerPolicyTable(s.db)
+	if err != nil {
+		return err
+	}
+
+	err = createPeerRuleTable(s.db)
+	if err != nil {
+		return err
+	}
+
+	err = createInviteTable(s.db)
+	if err != nil {
+		return err
+	}
+
+	err = createIdentityKeyTable(s.db)
+	if err != nil {
+		return err
+	}
+
+	err = createDeviceTable(s.db)
+	if err != nil {
+		return err
+	}
+
+	err = createDeviceLinkTable(s.db)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -260,9 +345,143 @@ func createMessageTable(db *sql.DB) error {
 		channel_id INTEGER,
 		content TEXT NOT NULL,
 		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		unique_id TEXT,
+		sender_id TEXT,
 		FOREIGN KEY (user_id) REFERENCES users(id),
 		FOREIGN KEY (channel_id) REFERENCES channels(id)
 	)`)
+	if err != nil {
+		return err
+	}
+
+	// Tables created before the messages had ids get the new columns
+	for _, column := range []string{"unique_id TEXT", "sender_id TEXT"} {
+		if err := addColumnIfMissing(db, "messages", column); err != nil {
+			return err
+		}
+	}
+
+	// A message is stored once per chat
+	_, err = db.Exec(`
+	CREATE UNIQUE INDEX IF NOT EXISTS uniq_messages_channel_unique_id ON messages (channel_id, unique_id)`)
+
+	return err
+}
+
+// addColumnIfMissing adds the column, given with its definition, to an existing table
+func addColumnIfMissing(db *sql.DB, table string, column string) error {
+	name, _, _ := strings.Cut(column, " ")
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, name).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column)
+
+	return err
+}
+
+func createPeerPolicyTable(db *sql.DB) error {
+	// Create the peer_policies table if it doesn't exist
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS peer_policies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner_unique_id TEXT UNIQUE,
+		policy TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	return err
+}
+
+func createPeerRuleTable(db *sql.DB) error {
+	// Create the peer_rules table if it doesn't exist
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS peer_rules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner_unique_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		value TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	if err != nil {
+		return err
+	}
+
+	// Create a unique index so that a rule is stored once per owner
+	_, err = db.Exec(`
+	CREATE UNIQUE INDEX IF NOT EXISTS uniq_peer_rules_owner_kind_value ON peer_rules (owner_unique_id, kind, value)`)
+
+	return err
+}
+
+func createInviteTable(db *sql.DB) error {
+	// Create the invites table if it doesn't exist
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS invites (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		unique_id TEXT UNIQUE,
+		owner_unique_id TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	return err
+}
+
+func createIdentityKeyTable(db *sql.DB) error {
+	// Create the identity_keys table if it doesn't exist
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS identity_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner_unique_id TEXT UNIQUE,
+		public_key TEXT NOT NULL,
+		private_key TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	return err
+}
+
+func createDeviceTable(db *sql.DB) error {
+	// Create the devices table if it doesn't exist
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS devices (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		unique_id TEXT NOT NULL,
+		owner_unique_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		public_key TEXT NOT NULL,
+		private_key TEXT NOT NULL DEFAULT '',
+		identity_key TEXT NOT NULL,
+		signature TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+	CREATE UNIQUE INDEX IF NOT EXISTS uniq_devices_owner_unique_id ON devices (owner_unique_id, unique_id)`)
+
+	return err
+}
+
+func createDeviceLinkTable(db *sql.DB) error {
+	// Create the device_links table if it doesn't exist
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS device_links (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		unique_id TEXT UNIQUE,
+		owner_unique_id TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
 
 	return err
 }
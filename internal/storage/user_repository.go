@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"database/sql"
+
 	"github.com/hop-/gotchat/internal/core"
 )
 
@@ -116,8 +118,83 @@ func (r *UserRepository) Update(user *core.User) error {
 	return err
 }
 
+// Delete deletes the user with everything it owns in one transaction,
+// the chats are deleted when no other user attends them
 func (r *UserRepository) Delete(id int) error {
-	_, err := execWithRetry(r.Db(), "DELETE FROM users WHERE id = ?", id)
+	tx, err := r.Db().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	return err
+	var uniqueId string
+	err = tx.QueryRow("SELECT unique_id FROM users WHERE id = ?", id).Scan(&uniqueId)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	channelIds, err := r.ownChannelIds(tx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, channelId := range channelIds {
+		if _, err := tx.Exec("DELETE FROM messages WHERE channel_id = ?", channelId); err != nil {
+			return err
+		}
+	}
+
+	statements := []struct {
+		query string
+		arg   any
+	}{
+		{"DELETE FROM messages WHERE user_id = ?", id},
+		{"DELETE FROM attendances WHERE user_id = ?", id},
+		{"DELETE FROM connection_details WHERE host_unique_id = ?", uniqueId},
+		{"DELETE FROM peer_policies WHERE owner_unique_id = ?", uniqueId},
+		{"DELETE FROM peer_rules WHERE owner_unique_id = ?", uniqueId},
+		{"DELETE FROM invites WHERE owner_unique_id = ?", uniqueId},
+		{"DELETE FROM identity_keys WHERE owner_unique_id = ?", uniqueId},
+		{"DELETE FROM devices WHERE owner_unique_id = ?", uniqueId},
+		{"DELETE FROM device_links WHERE owner_unique_id = ?", uniqueId},
+		{"DELETE FROM users WHERE id = ?", id},
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement.query, statement.arg); err != nil {
+			return err
+		}
+	}
+
+	for _, channelId := range channelIds {
+		if _, err := tx.Exec("DELETE FROM channels WHERE id = ?", channelId); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ownChannelIds returns the channels attended by the user only
+func (r *UserRepository) ownChannelIds(tx *sql.Tx, id int) ([]int, error) {
+	rows, err := tx.Query(`
+	SELECT DISTINCT channel_id FROM attendances
+	WHERE user_id = ? AND channel_id NOT IN (SELECT channel_id FROM attendances WHERE user_id != ?)`, id, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channelIds []int
+	for rows.Next() {
+		var channelId int
+		if err := rows.Scan(&channelId); err != nil {
+			return nil, err
+		}
+		channelIds = append(channelIds, channelId)
+	}
+
+	return channelIds, rows.Err()
 }
@@ -0,0 +1,33 @@
+package ui
+
+import (
+	"context"
+	"sync"
+)
+
+// Headless is the UI of the daemon, it shows nothing and runs until the application quits
+type Headless struct{}
+
+func NewHeadless() *Headless {
+	return &Headless{}
+}
+
+// Init implements UI.
+func (h *Headless) Init() error {
+	return nil
+}
+
+// Run implements UI.
+func (h *Headless) Run(ctx context.Context, wg *sync.WaitGroup) error {
+	wg.Add(1)
+	defer wg.Done()
+
+	<-ctx.Done()
+
+	return nil
+}
+
+// Close implements UI.
+func (h *Headless) Close() error {
+	return nil
+}
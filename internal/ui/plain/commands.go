@@ -0,0 +1,498 @@
+package plain
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+)
+
+// command is a chat command, the lines starting with / run them
+type command struct {
+	usage string
+	help  string
+	run   func(p *Plain, args []string) error
+}
+
+func builtinCommands() map[string]command {
+	quit := command{"/quit", "quit the application", func(p *Plain, args []string) error {
+		return errQuit
+	}}
+
+	return map[string]command{
+		"help": {"/help", "show the commands", (*Plain).help},
+		"quit": quit,
+		"exit": quit,
+		"q":    quit,
+
+		"login":  {"/login <name | number | user-id>", "log in one more user", (*Plain).loginCommand},
+		"signup": {"/signup <name>", "create a user and log it in", (*Plain).signupCommand},
+		"users":  {"/users", "list the local users", (*Plain).listUsers},
+		"logout": {"/logout", "log out the active user", (*Plain).logout},
+		"switch": {"/switch [name | user-id]", "make another logged in user the active one", (*Plain).switchUser},
+
+		"chats":   {"/chats", "list the chats of the active user", (*Plain).listChats},
+		"history": {"/history <chat> [count]", "print the last messages of a chat", (*Plain).history},
+		"to":      {"/to <user-id>", "send the lines without a command to the peer", (*Plain).setPeer},
+		"msg":     {"/msg <user-id> <text>", "send a message to the peer", (*Plain).sendTo},
+
+		"connect": {"/connect [host:port | host port] [user-id]", "connect to a peer", (*Plain).connect},
+		"join":    {"/join <gotchat://join?...>", "connect with an invite link", (*Plain).join},
+		"accept":  {"/accept <request-id>", "accept a connection request", (*Plain).accept},
+		"reject":  {"/reject <request-id>", "reject a connection request", (*Plain).reject},
+
+		"policy":  {"/policy anyone|ask|known", "set who may connect", (*Plain).setPolicy},
+		"block":   {"/block <user-id | ip>", "block a peer or an address", (*Plain).block},
+		"unblock": {"/unblock <user-id | ip>", "unblock a peer or an address", (*Plain).unblock},
+		"allow":   {"/allow <user-id>", "let a peer connect without asking", (*Plain).allow},
+
+		"services": {"/services", "show the states of the services", (*Plain).showServices},
+	}
+}
+
+// execute runs the command of the line or sends the line to the chosen peer
+func (p *Plain) execute(line string) error {
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+
+	// A line starting with // sends the text with a single /
+	if !strings.HasPrefix(line, "/") || strings.HasPrefix(line, "//") {
+		p.mu.Lock()
+		peerUserId := p.peerUserId
+		p.mu.Unlock()
+
+		if peerUserId == "" {
+			return fmt.Errorf("choose the peer with /to <user-id> or use /msg <user-id> <text>")
+		}
+
+		return p.send(peerUserId, strings.TrimPrefix(line, "/"))
+	}
+
+	fields := strings.Fields(line[1:])
+	if len(fields) == 0 {
+		return nil
+	}
+	name, args := fields[0], fields[1:]
+
+	command, ok := p.commands[name]
+	if !ok {
+		return fmt.Errorf("chat command '%s' not found, type /help for the commands", name)
+	}
+
+	return command.run(p, args)
+}
+
+func (p *Plain) help(args []string) error {
+	names := make([]string, 0, len(p.commands))
+	for name, command := range p.commands {
+		// The aliases of quit are listed once
+		if command.usage == "/"+name || strings.HasPrefix(command.usage, "/"+name+" ") {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	p.println("Commands:")
+	for _, name := range names {
+		p.printf("  %-45s %s\n", p.commands[name].usage, p.commands[name].help)
+	}
+	p.println("Lines without a command are sent to the peer chosen with /to, start them with // to send a /")
+
+	return nil
+}
+
+func (p *Plain) loginCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: /login <name | number | user-id>")
+	}
+
+	return p.login(args[0])
+}
+
+func (p *Plain) signupCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: /signup <name>")
+	}
+
+	return p.signup(args[0])
+}
+
+func (p *Plain) listUsers(args []string) error {
+	users, err := p.userManager.GetAllUsers()
+	if err != nil {
+		return fmt.Errorf("failed to get users: %w", err)
+	}
+
+	p.mu.Lock()
+	loggedIn := make(map[string]bool, len(p.users))
+	for _, user := range p.users {
+		loggedIn[user.UniqueId] = true
+	}
+	activeUserId := p.activeUserId
+	p.mu.Unlock()
+
+	for i, user := range users {
+		status := ""
+		switch {
+		case user.UniqueId == activeUserId:
+			status = " (active)"
+		case loggedIn[user.UniqueId]:
+			status = " (logged in)"
+		}
+		p.printf("  %d. %s %s%s\n", i+1, user.Name, user.UniqueId, status)
+	}
+
+	return nil
+}
+
+func (p *Plain) logout(args []string) error {
+	p.mu.Lock()
+	var user *core.User
+	for _, u := range p.users {
+		if u.UniqueId == p.activeUserId {
+			user = u
+		}
+	}
+	if user == nil {
+		p.mu.Unlock()
+
+		return fmt.Errorf("no user is logged in")
+	}
+
+	p.users = p.removeUser(user.UniqueId)
+	p.activeUserId = ""
+	var next *core.User
+	if len(p.users) > 0 {
+		next = p.users[0]
+		p.activeUserId = next.UniqueId
+	}
+	p.mu.Unlock()
+
+	p.em.Emit(core.UserLoggedOutEvent{User: user})
+	p.printf("Logged out %s\n", user.Name)
+
+	// Another logged in user becomes the active one
+	if next != nil {
+		p.em.Emit(core.SwitchUserEvent{User: next})
+		p.printf("Active user is %s\n", next.Name)
+	}
+
+	return nil
+}
+
+func (p *Plain) switchUser(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: /switch [name | user-id]")
+	}
+
+	p.mu.Lock()
+	if len(p.users) == 0 {
+		p.mu.Unlock()
+
+		return fmt.Errorf("no user is logged in")
+	}
+
+	// The next user after the active one if none is given
+	var user *core.User
+	for i, u := range p.users {
+		if len(args) == 0 && u.UniqueId == p.activeUserId {
+			user = p.users[(i+1)%len(p.users)]
+
+			break
+		}
+		if len(args) == 1 && (u.UniqueId == args[0] || u.Name == args[0]) {
+			user = u
+
+			break
+		}
+	}
+	if user == nil && len(args) == 0 {
+		user = p.users[0]
+	}
+	if user == nil {
+		p.mu.Unlock()
+
+		return fmt.Errorf("user '%s' is not logged in", args[0])
+	}
+
+	switched := user.UniqueId != p.activeUserId
+	p.activeUserId = user.UniqueId
+	p.mu.Unlock()
+
+	if switched {
+		p.em.Emit(core.SwitchUserEvent{User: user})
+	}
+	p.printf("Active user is %s\n", user.Name)
+
+	return nil
+}
+
+func (p *Plain) listChats(args []string) error {
+	user := p.activeUser()
+	if user == nil {
+		return fmt.Errorf("no user is logged in")
+	}
+
+	chats, err := p.chatManager.GetChatsByUserId(user.Id)
+	if err != nil {
+		return fmt.Errorf("failed to get chats: %w", err)
+	}
+	if len(chats) == 0 {
+		p.printf("%s has no chats\n", user.Name)
+
+		return nil
+	}
+
+	for _, chat := range chats {
+		p.printf("  %s %s\n", chat.Id, chat.Name)
+	}
+
+	return nil
+}
+
+func (p *Plain) history(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: /history <chat> [count]")
+	}
+
+	count := 20
+	if len(args) == 2 {
+		var err error
+		if count, err = strconv.Atoi(args[1]); err != nil || count <= 0 {
+			return fmt.Errorf("the count must be a positive number")
+		}
+	}
+
+	user := p.activeUser()
+	if user == nil {
+		return fmt.Errorf("no user is logged in")
+	}
+
+	// Only the chats of the active user are readable
+	chats, err := p.chatManager.GetChatsByUserId(user.Id)
+	if err != nil {
+		return fmt.Errorf("failed to get chats: %w", err)
+	}
+	chatId := ""
+	for _, chat := range chats {
+		if chat.Id == args[0] || chat.Name == args[0] {
+			chatId = chat.Id
+
+			break
+		}
+	}
+	if chatId == "" {
+		return fmt.Errorf("chat %s not found", args[0])
+	}
+
+	messages, err := p.chatManager.GetChatMessagesByChatId(chatId)
+	if err != nil {
+		return fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	if len(messages) > count {
+		messages = messages[len(messages)-count:]
+	}
+	for _, message := range messages {
+		p.printf("[%s] %s: %s\n", message.At.Format(time.DateTime), message.Member, message.Text)
+	}
+
+	return nil
+}
+
+func (p *Plain) setPeer(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: /to <user-id>")
+	}
+
+	p.mu.Lock()
+	p.peerUserId = args[0]
+	p.mu.Unlock()
+
+	p.printf("Lines are sent to %s\n", args[0])
+
+	return nil
+}
+
+func (p *Plain) sendTo(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: /msg <user-id> <text>")
+	}
+
+	return p.send(args[0], strings.Join(args[1:], " "))
+}
+
+// send sends the text from the active user, the failures come as events
+func (p *Plain) send(peerUserId string, text string) error {
+	if p.activeUser() == nil {
+		return fmt.Errorf("log in to send messages")
+	}
+
+	p.em.Emit(core.SendMessageEvent{
+		PeerUserId: peerUserId,
+		Text:       text,
+	})
+
+	return nil
+}
+
+func (p *Plain) connect(args []string) error {
+	if len(args) > 3 {
+		return fmt.Errorf("usage: /connect [host:port | host port] [user-id]")
+	}
+
+	host, port, peerUserId := "localhost", "7665", ""
+	switch {
+	case len(args) == 0:
+	case strings.Contains(args[0], ":") && len(args) <= 2:
+		var err error
+		if host, port, err = net.SplitHostPort(args[0]); err != nil {
+			return fmt.Errorf("connect command requires host:port format")
+		}
+		if len(args) == 2 {
+			peerUserId = args[1]
+		}
+	case len(args) >= 2:
+		host, port = args[0], args[1]
+		if len(args) == 3 {
+			peerUserId = args[2]
+		}
+	default:
+		return fmt.Errorf("usage: /connect [host:port | host port] [user-id]")
+	}
+	if host == "" || port == "" {
+		return fmt.Errorf("connect command requires non-empty host and port")
+	}
+
+	p.em.Emit(core.ConnectEvent{
+		Host:       host,
+		Port:       port,
+		PeerUserId: peerUserId,
+	})
+	p.printf("Connecting to %s\n", net.JoinHostPort(host, port))
+
+	return nil
+}
+
+func (p *Plain) join(args []string) error {
+	if len(args) != 1 || !strings.HasPrefix(args[0], "gotchat://") {
+		return fmt.Errorf("join command requires a gotchat:// invite link")
+	}
+
+	p.em.Emit(core.JoinEvent{URI: args[0]})
+
+	return nil
+}
+
+func (p *Plain) accept(args []string) error {
+	return p.decide(args, true)
+}
+
+func (p *Plain) reject(args []string) error {
+	return p.decide(args, false)
+}
+
+// decide answers the waiting connection request
+func (p *Plain) decide(args []string, accept bool) error {
+	if len(args) != 1 {
+		return fmt.Errorf("the request id is required")
+	}
+
+	p.mu.Lock()
+	request, ok := p.requests[args[0]]
+	delete(p.requests, args[0])
+	p.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("there is no connection request %s", args[0])
+	}
+
+	p.em.Emit(core.ConnectionRequestDecisionEvent{
+		RequestId: request.RequestId,
+		Accept:    accept,
+	})
+
+	return nil
+}
+
+func (p *Plain) setPolicy(args []string) error {
+	if len(args) != 1 || !core.IsValidPeerPolicy(args[0]) {
+		return fmt.Errorf("policy command requires one of: anyone, ask, known")
+	}
+
+	p.em.Emit(core.SetPeerPolicyEvent{Policy: args[0]})
+
+	return nil
+}
+
+func (p *Plain) block(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("block command requires a user id or an address")
+	}
+
+	return p.updatePeerRule(blockRuleKind(args[0]), args[0], false)
+}
+
+func (p *Plain) unblock(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("unblock command requires a user id or an address")
+	}
+
+	return p.updatePeerRule(blockRuleKind(args[0]), args[0], true)
+}
+
+func (p *Plain) allow(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("allow command requires a user id")
+	}
+
+	return p.updatePeerRule(core.PeerRuleAllowUser, args[0], false)
+}
+
+// updatePeerRule changes the rule of the active user
+func (p *Plain) updatePeerRule(kind string, value string, remove bool) error {
+	p.em.Emit(core.PeerRuleEvent{
+		Kind:   kind,
+		Value:  value,
+		Remove: remove,
+	})
+
+	return nil
+}
+
+// blockRuleKind tells addresses and user ids apart
+func blockRuleKind(value string) string {
+	if net.ParseIP(value) != nil {
+		return core.PeerRuleBlockAddress
+	}
+
+	return core.PeerRuleBlockUser
+}
+
+func (p *Plain) showServices(args []string) error {
+	p.mu.Lock()
+	states := slices.Clone(p.serviceStates)
+	p.mu.Unlock()
+
+	if len(states) == 0 {
+		p.println("No service has reported its state yet")
+
+		return nil
+	}
+
+	for _, s := range states {
+		if s.Err != nil {
+			p.printf("  %-30s %s: %v\n", s.Service, s.State, s.Err)
+
+			continue
+		}
+		p.printf("  %-30s %s\n", s.Service, s.State)
+	}
+
+	return nil
+}
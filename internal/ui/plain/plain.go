@@ -0,0 +1,463 @@
+// Package plain is a line oriented UI for terminals without the alternate screen, e.g. serial
+// consoles, screen readers and pipes. It reads the commands line by line and prints the events
+// as timestamped lines, it never moves the cursor.
+package plain
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/services"
+)
+
+// Time format of the printed events
+const timeFormat = "15:04:05"
+
+// errQuit stops reading the input
+var errQuit = errors.New("quit")
+
+type Plain struct {
+	em          core.EventBus
+	userManager *services.UserManager
+	chatManager *services.ChatManager
+
+	in     io.Reader
+	reader *bufio.Reader
+	out    io.Writer
+	// Lines of the events and of the commands don't interleave
+	outMu sync.Mutex
+
+	commands map[string]command
+
+	mu sync.Mutex
+	// Logged in users in the order they logged in
+	users []*core.User
+	// Unique id of the active user
+	activeUserId string
+	// Unique id of the peer the lines without a command are sent to
+	peerUserId string
+	// Connection requests waiting for a decision
+	requests map[string]services.ConnectionRequested
+	// Last reported states of the services in the order they were first reported
+	serviceStates []core.ServiceStateChanged
+}
+
+func New(
+	em core.EventBus,
+	userManager *services.UserManager,
+	chatManager *services.ChatManager,
+	in io.Reader,
+	out io.Writer,
+) *Plain {
+	return &Plain{
+		em,
+		userManager,
+		chatManager,
+		in,
+		bufio.NewReader(in),
+		out,
+		sync.Mutex{},
+		builtinCommands(),
+		sync.Mutex{},
+		nil,
+		"",
+		"",
+		make(map[string]services.ConnectionRequested),
+		nil,
+	}
+}
+
+// Init implements ui.UI.
+func (p *Plain) Init() error {
+	return nil
+}
+
+// Run implements ui.UI.
+func (p *Plain) Run(ctx context.Context, wg *sync.WaitGroup) error {
+	wg.Add(1)
+	defer wg.Done()
+
+	// Only the events shown by the UI are delivered,
+	// the emitter waits a bit for the UI rather than losing a connection request
+	listener := p.em.SubscribeWith(ctx, core.ListenerOptions{
+		Name: "plain",
+		Filter: core.AnyOf(
+			core.OfType[services.MessageReceived](),
+			core.OfType[services.MessageSent](),
+			core.OfType[services.ConnectionEstablished](),
+			core.OfType[services.PeerLeft](),
+			core.OfType[services.ConnectionRequested](),
+			core.OfType[services.ConnectionRequestExpired](),
+			core.OfType[core.CommandFailed](),
+			core.OfType[core.ServiceStateChanged](),
+		),
+		Policy: core.Block,
+	})
+	go p.printEvents(listener)
+
+	// The input can't be interrupted, it's left behind when the application quits
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.readInput()
+	}()
+
+	select {
+	case <-ctx.Done():
+	case <-done:
+		// Send a quit event to the event manager when the input ends or the user quits
+		p.em.Emit(core.QuitEvent{})
+	}
+
+	return nil
+}
+
+// Close implements ui.UI.
+func (p *Plain) Close() error {
+	return nil
+}
+
+// AddChatCommand adds a command which doesn't know about the UI, e.g. of a plugin,
+// the events it returns are emitted
+func (p *Plain) AddChatCommand(name string, run func(args ...string) ([]core.Event, error)) error {
+	if _, exists := p.commands[name]; exists {
+		return fmt.Errorf("chat command '%s' already exists", name)
+	}
+
+	p.commands[name] = command{
+		"/" + name + " ...",
+		"command of a plugin",
+		func(p *Plain, args []string) error {
+			events, err := run(args...)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			for _, e := range events {
+				p.em.Emit(e)
+			}
+
+			return nil
+		},
+	}
+
+	return nil
+}
+
+func (p *Plain) printf(format string, args ...any) {
+	p.outMu.Lock()
+	defer p.outMu.Unlock()
+
+	fmt.Fprintf(p.out, format, args...)
+}
+
+func (p *Plain) println(args ...any) {
+	p.outMu.Lock()
+	defer p.outMu.Unlock()
+
+	fmt.Fprintln(p.out, args...)
+}
+
+// readInput logs in a user and executes the lines until the input ends or the user quits
+func (p *Plain) readInput() {
+	p.println("Welcome to gotchat, type /help for the commands")
+	if err := p.loginOnStart(); err != nil {
+		p.reportError(err)
+		if errors.Is(err, errQuit) || errors.Is(err, io.EOF) {
+			return
+		}
+	}
+
+	for {
+		line, err := p.readLine("", false)
+		if err != nil {
+			return
+		}
+
+		if err := p.execute(line); err != nil {
+			if errors.Is(err, errQuit) || errors.Is(err, io.EOF) {
+				return
+			}
+			p.reportError(err)
+		}
+	}
+}
+
+// readLine prints the prompt and reads a line, without echo if it's secret and the input is a terminal
+func (p *Plain) readLine(prompt string, secret bool) (string, error) {
+	if prompt != "" {
+		p.printf("%s", prompt)
+	}
+
+	if f, ok := p.in.(*os.File); ok && secret && term.IsTerminal(f.Fd()) {
+		line, err := term.ReadPassword(f.Fd())
+		p.println()
+
+		return string(line), err
+	}
+
+	line, err := p.reader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (p *Plain) reportError(err error) {
+	if errors.Is(err, errQuit) || errors.Is(err, io.EOF) {
+		return
+	}
+
+	p.println("Error:", err)
+}
+
+// loginOnStart asks for the user to log in, or to create if there are none
+func (p *Plain) loginOnStart() error {
+	users, err := p.userManager.GetAllUsers()
+	if errors.Is(err, services.ErrNotFound) {
+		name, err := p.readLine("There are no users yet, name of the new user (empty to skip): ", false)
+		if err != nil || name == "" {
+			return err
+		}
+
+		return p.signup(name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get users: %w", err)
+	}
+
+	p.println("Users:")
+	for i, user := range users {
+		p.printf("  %d. %s\n", i+1, user.Name)
+	}
+
+	nameOrId, err := p.readLine("Log in as (name or number, empty to skip): ", false)
+	if err != nil || nameOrId == "" {
+		return err
+	}
+
+	return p.login(nameOrId)
+}
+
+// findUser finds the local user by name, unique id or number in the users list
+func (p *Plain) findUser(nameOrId string) (*core.User, error) {
+	users, err := p.userManager.GetAllUsers()
+	if errors.Is(err, services.ErrNotFound) {
+		return nil, fmt.Errorf("there are no users, create one with /signup <name>")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	if number, err := strconv.Atoi(nameOrId); err == nil {
+		if number < 1 || number > len(users) {
+			return nil, fmt.Errorf("there is no user number %d", number)
+		}
+
+		return users[number-1], nil
+	}
+
+	var found *core.User
+	for _, user := range users {
+		if user.UniqueId == nameOrId {
+			return user, nil
+		}
+		if user.Name == nameOrId {
+			if found != nil {
+				return nil, fmt.Errorf("several users are named %s, use the id", nameOrId)
+			}
+			found = user
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("user %s not found", nameOrId)
+	}
+
+	return found, nil
+}
+
+// login asks for the password of the user and makes it the active one
+func (p *Plain) login(nameOrId string) error {
+	user, err := p.findUser(nameOrId)
+	if err != nil {
+		return err
+	}
+
+	password, err := p.readLine(fmt.Sprintf("Password of %s: ", user.Name), true)
+	if err != nil {
+		return err
+	}
+
+	return p.loginUser(user, password)
+}
+
+// signup creates the user and logs it in
+func (p *Plain) signup(name string) error {
+	password, err := p.readLine(fmt.Sprintf("Password of %s: ", name), true)
+	if err != nil {
+		return err
+	}
+	repeated, err := p.readLine("Repeat the password: ", true)
+	if err != nil {
+		return err
+	}
+	if password != repeated {
+		return fmt.Errorf("the passwords don't match")
+	}
+
+	user, err := p.userManager.CreateUser(name, password)
+	if errors.Is(err, services.ErrorInvalidInput) {
+		return fmt.Errorf("the name and the password can't be empty")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	p.printf("Created %s (%s)\n", user.Name, user.UniqueId)
+
+	return p.loginUser(user, password)
+}
+
+// loginUser logs the user in, the services make it the active one
+func (p *Plain) loginUser(user *core.User, password string) error {
+	user, err := p.userManager.LoginUser(user, password)
+	if errors.Is(err, services.ErrorInvalidInput) || errors.Is(err, services.ErrorInvalidCredentials) {
+		return fmt.Errorf("invalid credentials")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to log in: %w", err)
+	}
+
+	p.mu.Lock()
+	p.users = append(p.removeUser(user.UniqueId), user)
+	p.activeUserId = user.UniqueId
+	p.mu.Unlock()
+
+	p.printf("Logged in as %s (%s)\n", user.Name, user.UniqueId)
+
+	return nil
+}
+
+// removeUser returns the logged in users without the user
+// Note: p.mu must be held by the caller
+func (p *Plain) removeUser(uniqueId string) []*core.User {
+	users := make([]*core.User, 0, len(p.users))
+	for _, user := range p.users {
+		if user.UniqueId != uniqueId {
+			users = append(users, user)
+		}
+	}
+
+	return users
+}
+
+// activeUser returns the active user, nil if nobody is logged in
+func (p *Plain) activeUser() *core.User {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, user := range p.users {
+		if user.UniqueId == p.activeUserId {
+			return user
+		}
+	}
+
+	return nil
+}
+
+// userName returns the name of the logged in user, the id if it's somebody else
+func (p *Plain) userName(uniqueId string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, user := range p.users {
+		if user.UniqueId == uniqueId {
+			return user.Name
+		}
+	}
+
+	return uniqueId
+}
+
+// printEvents prints the events as timestamped lines
+func (p *Plain) printEvents(listener core.EventListener) {
+	for event := range listener {
+		now := time.Now().Format(timeFormat)
+
+		switch event := event.(type) {
+		case services.MessageReceived:
+			at := event.At.Format(timeFormat)
+			if event.Mirrored {
+				p.printf("[%s] %s -> %s (from another device): %s\n", at, p.userName(event.From), event.To, event.Text)
+
+				continue
+			}
+			p.printf("[%s] %s -> %s: %s\n", at, event.From, p.userName(event.To), event.Text)
+		case services.MessageSent:
+			// Sent messages are only reported when some devices didn't get them
+			if len(event.Undelivered) > 0 {
+				p.printf("[%s] Message to %s isn't delivered to %d device(s) yet\n", now, event.PeerUserId, len(event.Undelivered))
+			}
+		case services.ConnectionEstablished:
+			if event.PeerUserId != "" {
+				p.printf("[%s] Connected to %s\n", now, event.PeerUserId)
+			}
+		case services.PeerLeft:
+			p.printf("[%s] %s left: %s\n", now, event.PeerUserId, event.Reason)
+		case services.ConnectionRequested:
+			p.mu.Lock()
+			p.requests[event.RequestId] = event
+			p.mu.Unlock()
+
+			if event.KeysChanged {
+				p.printf("[%s] Warning: %s (%s) is known but its keys have changed, accepting replaces them\n", now, event.PeerName, event.PeerUserId)
+			}
+			p.printf(
+				"[%s] %s (%s) at %s wants to connect to %s, answer with /accept %s or /reject %s\n",
+				now, event.PeerName, event.PeerUserId, event.Host, p.userName(event.UserId), event.RequestId, event.RequestId,
+			)
+		case services.ConnectionRequestExpired:
+			p.mu.Lock()
+			_, waiting := p.requests[event.RequestId]
+			delete(p.requests, event.RequestId)
+			p.mu.Unlock()
+
+			if waiting {
+				p.printf("[%s] Connection request %s expired\n", now, event.RequestId)
+			}
+		case core.CommandFailed:
+			p.printf("[%s] Error: %s failed: %v\n", now, event.Command, event.Err)
+		case core.ServiceStateChanged:
+			p.updateServiceState(event)
+
+			// Only the failures are printed, the states are shown by /services
+			if event.State == core.ServiceDegraded || event.Err != nil {
+				p.printf("[%s] Service %s is %s: %v\n", now, event.Service, event.State, event.Err)
+			}
+		}
+	}
+}
+
+func (p *Plain) updateServiceState(event core.ServiceStateChanged) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, s := range p.serviceStates {
+		if s.Service == event.Service {
+			p.serviceStates[i] = event
+
+			return
+		}
+	}
+	p.serviceStates = append(p.serviceStates, event)
+}
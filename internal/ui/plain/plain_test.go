@@ -0,0 +1,185 @@
+package plain
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/services"
+	"github.com/stretchr/testify/mock"
+)
+
+// syncBuffer collects the output written by the input and the event goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+// waitForOutput waits until the output contains the text
+func waitForOutput(t *testing.T, out *syncBuffer, text string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), text) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected output %q, got:\n%s", text, out.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func receiveTestEvent[T any](t *testing.T, events <-chan T) T {
+	t.Helper()
+
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		var zero T
+		t.Fatalf("Event %T wasn't emitted", zero)
+
+		return zero
+	}
+}
+
+// startTestPlain runs the UI for the user "alice" with the password "secret"
+func startTestPlain(t *testing.T) (*core.EventManager, io.WriteCloser, *syncBuffer, chan error) {
+	hash, err := core.HashPassword("secret")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	alice := &core.User{BaseEntity: core.BaseEntity{Id: 1}, UniqueId: "alice-id", Name: "alice", Password: hash}
+
+	em := core.NewEventManager(10)
+
+	userRepo := core.NewMockRepository[core.User](t)
+	userRepo.On("GetAll").Return([]*core.User{alice}, nil).Maybe()
+	userRepo.On("Update", mock.Anything).Return(nil).Maybe()
+	userManager := services.NewUserManager(em, userRepo)
+
+	in, input := io.Pipe()
+	out := &syncBuffer{}
+	p := New(em, userManager, nil, in, out)
+
+	// A command of a plugin
+	p.AddChatCommand("invite", func(args ...string) ([]core.Event, error) {
+		return []core.Event{core.JoinEvent{URI: "gotchat://join?" + strings.Join(args, "&")}}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Run(ctx, wg)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		input.Close()
+		wg.Wait()
+	})
+
+	return em, input, out, done
+}
+
+func TestPlain_Login(t *testing.T) {
+	_, input, out, _ := startTestPlain(t)
+
+	waitForOutput(t, out, "1. alice")
+	io.WriteString(input, "alice\nwrong\n")
+	waitForOutput(t, out, "Error: invalid credentials")
+
+	io.WriteString(input, "/login 1\nsecret\n")
+	waitForOutput(t, out, "Logged in as alice (alice-id)")
+
+	io.WriteString(input, "/users\n")
+	waitForOutput(t, out, "1. alice alice-id (active)")
+}
+
+func TestPlain_Messages(t *testing.T) {
+	em, input, out, _ := startTestPlain(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sent := core.SubscribeTo[core.SendMessageEvent](ctx, em)
+
+	waitForOutput(t, out, "Log in as")
+	io.WriteString(input, "alice\nsecret\nhello\n")
+	waitForOutput(t, out, "Error: choose the peer with /to")
+
+	io.WriteString(input, "/to bob-id\nhello bob\n//help\n/msg carol-id hi carol\n")
+	if e := receiveTestEvent(t, sent); e.PeerUserId != "bob-id" || e.Text != "hello bob" {
+		t.Errorf("Expected the line to be sent to bob, got %+v", e)
+	}
+	if e := receiveTestEvent(t, sent); e.PeerUserId != "bob-id" || e.Text != "/help" {
+		t.Errorf("Expected the escaped line to be sent, got %+v", e)
+	}
+	if e := receiveTestEvent(t, sent); e.PeerUserId != "carol-id" || e.Text != "hi carol" {
+		t.Errorf("Expected the message to be sent to carol, got %+v", e)
+	}
+
+	at := time.Date(2025, 1, 2, 15, 4, 5, 0, time.Local)
+	em.Emit(services.MessageReceived{From: "bob-id", To: "alice-id", Text: "hi alice", At: at})
+	waitForOutput(t, out, "[15:04:05] bob-id -> alice: hi alice")
+
+	em.Emit(core.CommandFailed{Command: "services.SendMessage", Err: services.ErrPeerNotConnected})
+	waitForOutput(t, out, "Error: services.SendMessage failed: ")
+}
+
+func TestPlain_Commands(t *testing.T) {
+	em, input, out, done := startTestPlain(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	decisions := core.SubscribeTo[core.ConnectionRequestDecisionEvent](ctx, em)
+	joins := core.SubscribeTo[core.JoinEvent](ctx, em)
+	quits := core.SubscribeTo[core.QuitEvent](ctx, em)
+
+	waitForOutput(t, out, "Log in as")
+	io.WriteString(input, "\n/help\n")
+	waitForOutput(t, out, "/invite ...")
+
+	em.Emit(services.ConnectionRequested{RequestId: "r1", PeerUserId: "bob-id", PeerName: "bob", Host: "10.0.0.2", UserId: "alice-id"})
+	waitForOutput(t, out, "bob (bob-id) at 10.0.0.2 wants to connect to alice-id, answer with /accept r1 or /reject r1")
+
+	io.WriteString(input, "/accept r1\n")
+	if e := receiveTestEvent(t, decisions); e.RequestId != "r1" || !e.Accept {
+		t.Errorf("Expected the request to be accepted, got %+v", e)
+	}
+	io.WriteString(input, "/reject r1\n")
+	waitForOutput(t, out, "Error: there is no connection request r1")
+
+	io.WriteString(input, "/invite a b\n")
+	if e := receiveTestEvent(t, joins); e.URI != "gotchat://join?a&b" {
+		t.Errorf("Expected the event of the plugin command, got %+v", e)
+	}
+
+	io.WriteString(input, "/nope\n")
+	waitForOutput(t, out, "Error: chat command 'nope' not found")
+
+	// The application quits when the user quits
+	io.WriteString(input, "/quit\n")
+	receiveTestEvent(t, quits)
+	if err := receiveTestEvent(t, done); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
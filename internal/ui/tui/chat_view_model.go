@@ -1,6 +1,8 @@
 package tui
 
 import (
+	"fmt"
+
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -61,10 +63,11 @@ func newChatViewModel(
 	user *core.User,
 	userManager *services.UserManager,
 	chatManager *services.ChatManager,
+	discoveryManager *services.DiscoveryManager,
 ) *ChatViewModel {
 	// Initialize chat list
 	chats := components.NewItemList([]list.Item{})
-	chats.Title = "Chats"
+	chats.Title = fmt.Sprintf("Chats of %s", user.Name)
 
 	// Initialize chat history
 	chatHistory := components.NewChatHistory("You", "TheOtherOne")
@@ -76,6 +79,7 @@ func newChatViewModel(
 	chatInput.SetWidth(20)
 
 	newConnectionButton := components.NewButton("New Connection")
+	newConnectionButton.OnAction(commands.PushPage(newDiscoveredPeersModel(discoveryManager)))
 
 	return &ChatViewModel{
 		components.Frame{},
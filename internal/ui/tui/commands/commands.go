@@ -2,6 +2,7 @@ package commands
 
 import (
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hop-/gotchat/internal/core"
 )
 
 type SetNewPageMsg struct {
@@ -23,8 +24,9 @@ type ErrorMsg struct {
 }
 
 type ConnectMsg struct {
-	Host string
-	Port string
+	Host       string
+	Port       string
+	PeerUserId string
 }
 
 // Custom commands and command factories
@@ -59,8 +61,136 @@ func Error(msg string) tea.Cmd {
 	}
 }
 
-func Connect(host string, port string) tea.Cmd {
+func Connect(host string, port string, peerUserId string) tea.Cmd {
 	return func() tea.Msg {
-		return ConnectMsg{host, port}
+		return ConnectMsg{host, port, peerUserId}
+	}
+}
+
+type JoinMsg struct {
+	URI string
+}
+
+type ConnectionRequestMsg struct {
+	RequestId  string
+	PeerUserId string
+	PeerName   string
+	Host       string
+	// Unique id of the logged in user the peer wants to reach
+	UserId string
+	// Accepting replaces the stored keys of the known peer
+	KeysChanged bool
+}
+
+type ConnectionRequestExpiredMsg struct {
+	RequestId string
+}
+
+type ResolveConnectionRequestMsg struct {
+	RequestId string
+	Accept    bool
+}
+
+type SetPeerPolicyMsg struct {
+	Policy string
+}
+
+type UpdatePeerRuleMsg struct {
+	Kind   string
+	Value  string
+	Remove bool
+	// Unique id of the user the rule belongs to, the active user if empty
+	Owner string
+}
+
+// UserLoggedInMsg opens the page of the user who has just logged in, the other users stay logged in
+type UserLoggedInMsg struct {
+	User *core.User
+	Page tea.Model
+}
+
+// SwitchUserMsg switches to the logged in user by name or id, to the next one if empty
+type SwitchUserMsg struct {
+	NameOrId string
+}
+
+// AddUserMsg opens the login page to log in one more user
+type AddUserMsg struct{}
+
+// LogoutMsg logs out the active user
+type LogoutMsg struct{}
+
+// SendMessageMsg sends the text to the peer from the active user
+type SendMessageMsg struct {
+	PeerUserId string
+	Text       string
+}
+
+// ServiceStateMsg is the new state of a service, Error is the cause of the degraded and stopped states
+type ServiceStateMsg struct {
+	Service string
+	State   string
+	Error   string
+}
+
+// ShowServicesMsg opens the page with the states of the services
+type ShowServicesMsg struct{}
+
+// EmitEventsMsg emits the events of a chat command which doesn't know about the TUI
+type EmitEventsMsg struct {
+	Events []core.Event
+}
+
+func Join(uri string) tea.Cmd {
+	return func() tea.Msg {
+		return JoinMsg{uri}
+	}
+}
+
+func ResolveConnectionRequest(requestId string, accept bool) tea.Cmd {
+	return func() tea.Msg {
+		return ResolveConnectionRequestMsg{requestId, accept}
+	}
+}
+
+func SetPeerPolicy(policy string) tea.Cmd {
+	return func() tea.Msg {
+		return SetPeerPolicyMsg{policy}
+	}
+}
+
+func UpdatePeerRule(kind string, value string, remove bool, owner string) tea.Cmd {
+	return func() tea.Msg {
+		return UpdatePeerRuleMsg{kind, value, remove, owner}
+	}
+}
+
+func SwitchUser(nameOrId string) tea.Cmd {
+	return func() tea.Msg {
+		return SwitchUserMsg{nameOrId}
+	}
+}
+
+func AddUser() tea.Msg {
+	return AddUserMsg{}
+}
+
+func Logout() tea.Msg {
+	return LogoutMsg{}
+}
+
+func SendMessage(peerUserId string, text string) tea.Cmd {
+	return func() tea.Msg {
+		return SendMessageMsg{peerUserId, text}
+	}
+}
+
+func ShowServices() tea.Msg {
+	return ShowServicesMsg{}
+}
+
+func EmitEvents(events ...core.Event) tea.Cmd {
+	return func() tea.Msg {
+		return EmitEventsMsg{events}
 	}
 }
@@ -2,9 +2,11 @@ package components
 
 import (
 	"fmt"
+	"net"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hop-/gotchat/internal/core"
 	"github.com/hop-/gotchat/internal/ui/tui/commands"
 )
 
@@ -27,37 +29,134 @@ func init() {
 	chatCommands["q"] = exitCommand
 
 	// Add the connect command
+	// Usage: /connect [host:port | host port] [peer-user-id]
 	connectCommand := func(args ...string) tea.Cmd {
-		if len(args) > 2 {
+		if len(args) > 3 {
 			return commands.Error("connect command requires host and port")
 		}
 
-		var host, port string
+		var host, port, peerUserId string
 
 		if len(args) == 0 {
 			host = "localhost"
 			port = "7665"
-		} else if len(args) == 1 && strings.Contains(args[0], ":") {
-			// If only one argument is provided, it should be in the format "host:port"
+		} else if strings.Contains(args[0], ":") && len(args) <= 2 {
+			// The first argument should be in the format "host:port"
 			parts := strings.SplitN(args[0], ":", 2)
 			if len(parts) != 2 {
 				return commands.Error("connect command requires host:port format")
 			}
 			host = parts[0]
 			port = parts[1]
-		} else if len(args) == 2 {
+			if len(args) == 2 {
+				peerUserId = args[1]
+			}
+		} else if len(args) >= 2 {
 			host = args[0]
 			port = args[1]
+			if len(args) == 3 {
+				peerUserId = args[2]
+			}
 		}
 		if host == "" || port == "" {
 			return commands.Error("connect command requires non-empty host and port")
 		}
 
-		return commands.Connect(host, port)
+		return commands.Connect(host, port, peerUserId)
 	}
 	chatCommands["connect"] = connectCommand
 	chatCommands["dail"] = connectCommand
 	chatCommands["c"] = connectCommand
+
+	// Add the join command
+	// Usage: /join gotchat://join?...
+	chatCommands["join"] = func(args ...string) tea.Cmd {
+		if len(args) != 1 || !strings.HasPrefix(args[0], "gotchat://") {
+			return commands.Error("join command requires a gotchat:// invite link")
+		}
+
+		return commands.Join(args[0])
+	}
+
+	// Add the peer policy command
+	// Usage: /policy anyone|ask|known
+	chatCommands["policy"] = func(args ...string) tea.Cmd {
+		if len(args) != 1 || !core.IsValidPeerPolicy(args[0]) {
+			return commands.Error("policy command requires one of: anyone, ask, known")
+		}
+
+		return commands.SetPeerPolicy(args[0])
+	}
+
+	// Add the block, unblock and allow commands
+	// Usage: /block <user-id | ip>, /unblock <user-id | ip>, /allow <user-id>
+	chatCommands["block"] = func(args ...string) tea.Cmd {
+		if len(args) != 1 {
+			return commands.Error("block command requires a user id or an address")
+		}
+
+		return commands.UpdatePeerRule(blockRuleKind(args[0]), args[0], false, "")
+	}
+	chatCommands["unblock"] = func(args ...string) tea.Cmd {
+		if len(args) != 1 {
+			return commands.Error("unblock command requires a user id or an address")
+		}
+
+		return commands.UpdatePeerRule(blockRuleKind(args[0]), args[0], true, "")
+	}
+	chatCommands["allow"] = func(args ...string) tea.Cmd {
+		if len(args) != 1 {
+			return commands.Error("allow command requires a user id")
+		}
+
+		return commands.UpdatePeerRule(core.PeerRuleAllowUser, args[0], false, "")
+	}
+
+	// Add the identity commands
+	// Usage: /switch [name | user-id], /login, /logout
+	chatCommands["switch"] = func(args ...string) tea.Cmd {
+		if len(args) > 1 {
+			return commands.Error("switch command accepts only a name or a user id")
+		}
+
+		nameOrId := ""
+		if len(args) == 1 {
+			nameOrId = args[0]
+		}
+
+		return commands.SwitchUser(nameOrId)
+	}
+	chatCommands["login"] = func(args ...string) tea.Cmd {
+		return commands.AddUser
+	}
+	chatCommands["logout"] = func(args ...string) tea.Cmd {
+		return commands.Logout
+	}
+
+	// Add the message command, the message reaches all connected devices of the peer
+	// Usage: /msg <user-id> <text>
+	chatCommands["msg"] = func(args ...string) tea.Cmd {
+		if len(args) < 2 {
+			return commands.Error("msg command requires a user id and a text")
+		}
+
+		return commands.SendMessage(args[0], strings.Join(args[1:], " "))
+	}
+
+	// Add the services command, it shows the states reported by the supervisor
+	// Usage: /services
+	chatCommands["services"] = func(args ...string) tea.Cmd {
+		return commands.ShowServices
+	}
+}
+
+// blockRuleKind tells addresses and user ids apart
+func blockRuleKind(value string) string {
+	if net.ParseIP(value) != nil {
+		return core.PeerRuleBlockAddress
+	}
+
+	return core.PeerRuleBlockUser
 }
 
 func chatCommandExecuted(name string, args ...string) tea.Cmd {
@@ -79,3 +178,20 @@ func AddChatCommand(name string, command ChatCommand) error {
 
 	return nil
 }
+
+// EventChatCommand is a chat command which doesn't know about the TUI, e.g. of a plugin,
+// it runs off the UI loop and the events it returns are emitted
+type EventChatCommand = func(args ...string) ([]core.Event, error)
+
+func AddEventChatCommand(name string, command EventChatCommand) error {
+	return AddChatCommand(name, func(args ...string) tea.Cmd {
+		return func() tea.Msg {
+			events, err := command(args...)
+			if err != nil {
+				return commands.ErrorMsg{Message: fmt.Sprintf("%s: %v", name, err)}
+			}
+
+			return commands.EmitEventsMsg{Events: events}
+		}
+	})
+}
@@ -21,3 +21,7 @@ func (l *Label) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (l *Label) View() string {
 	return l.text
 }
+
+func (l *Label) SetText(text string) {
+	l.text = text
+}
@@ -0,0 +1,87 @@
+package tui
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hop-/gotchat/internal/core"
+	"github.com/hop-/gotchat/internal/ui/tui/commands"
+	"github.com/hop-/gotchat/internal/ui/tui/components"
+)
+
+type ConnectionRequestModel struct {
+	// Frame component
+	components.Frame
+	// Focusable container
+	*components.FocusContainer
+
+	// Stack component
+	stack *components.Stack
+
+	requestId string
+}
+
+func newConnectionRequestModel(request commands.ConnectionRequestMsg, userName string) *ConnectionRequestModel {
+	from := request.PeerUserId
+	if request.Host != "" {
+		from = fmt.Sprintf("%s, %s", from, request.Host)
+	}
+	text := fmt.Sprintf("%s wants to connect to %s (%s)", request.PeerName, userName, from)
+	if request.KeysChanged {
+		text += ", the peer is known but its keys have changed"
+	}
+	title := components.NewLabel(text)
+
+	acceptButton := components.NewButton("Accept")
+	acceptButton.SetActive(true)
+	acceptButton.OnAction(tea.Sequence(
+		commands.ResolveConnectionRequest(request.RequestId, true),
+		commands.PopPage,
+	))
+
+	rejectButton := components.NewButton("Reject")
+	rejectButton.SetActive(true)
+	rejectButton.OnAction(tea.Sequence(
+		commands.ResolveConnectionRequest(request.RequestId, false),
+		commands.PopPage,
+	))
+
+	blockButton := components.NewButton("Block")
+	blockButton.SetActive(true)
+	blockButton.OnAction(tea.Sequence(
+		commands.UpdatePeerRule(core.PeerRuleBlockUser, request.PeerUserId, false, request.UserId),
+		commands.ResolveConnectionRequest(request.RequestId, false),
+		commands.PopPage,
+	))
+
+	return &ConnectionRequestModel{
+		components.Frame{},
+		components.NewFocusContainer(acceptButton, rejectButton, blockButton),
+		components.NewStack(
+			components.Vertical, 2,
+			title, components.NewStack(
+				components.Horizontal, 3,
+				acceptButton, rejectButton, blockButton,
+			),
+		),
+		request.RequestId,
+	}
+}
+
+func (m *ConnectionRequestModel) Init() tea.Cmd {
+	return tea.Batch(m.FocusContainer.Init(), m.stack.Init())
+}
+
+func (m *ConnectionRequestModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	// Handle updates on frame
+	frameCmd := m.Frame.Update(msg)
+
+	fc, cmd := m.FocusContainer.Update(msg)
+	m.FocusContainer = fc
+
+	return m, tea.Batch(frameCmd, cmd)
+}
+
+func (m *ConnectionRequestModel) View() string {
+	return m.Frame.View(m.stack.View())
+}
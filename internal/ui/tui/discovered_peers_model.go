@@ -0,0 +1,121 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hop-/gotchat/internal/services"
+	"github.com/hop-/gotchat/internal/ui/tui/commands"
+	"github.com/hop-/gotchat/internal/ui/tui/components"
+	"github.com/hop-/gotchat/pkg/network"
+)
+
+const discoveredPeersRefreshInterval = 2 * time.Second
+
+type refreshDiscoveredPeersMsg struct{}
+
+func refreshDiscoveredPeers() tea.Cmd {
+	return tea.Tick(discoveredPeersRefreshInterval, func(time.Time) tea.Msg {
+		return refreshDiscoveredPeersMsg{}
+	})
+}
+
+type DiscoveredPeer struct {
+	network.DiscoveredPeer
+}
+
+func (p DiscoveredPeer) Title() string { return p.Name }
+func (p DiscoveredPeer) Description() string {
+	return fmt.Sprintf("%s, seen %s", p.Address(), FormatLastLogin(p.LastSeen))
+}
+func (p DiscoveredPeer) FilterValue() string { return p.Name }
+
+type DiscoveredPeersModel struct {
+	// Frame component
+	components.Frame
+	// Focusable component
+	*components.FocusContainer
+
+	// Component
+	list *components.ItemList
+
+	// Stack
+	stack *components.Stack
+
+	// Services
+	discoveryManager *services.DiscoveryManager
+}
+
+func newDiscoveredPeersModel(discoveryManager *services.DiscoveryManager) *DiscoveredPeersModel {
+	l := components.NewItemList([]list.Item{})
+	l.Title = "Nearby Peers"
+	l.OnSelect(func(item list.Item) tea.Cmd {
+		if peer, ok := item.(DiscoveredPeer); ok {
+			return tea.Sequence(
+				commands.Connect(peer.Host, fmt.Sprint(peer.Port), peer.UniqueId),
+				commands.PopPage,
+			)
+		}
+
+		return nil
+	})
+
+	backButton := components.NewButton("Back")
+	backButton.SetActive(true)
+	backButton.OnAction(commands.PopPage)
+
+	return &DiscoveredPeersModel{
+		components.Frame{},
+		components.NewFocusContainer(l, backButton),
+		l,
+		components.NewStack(
+			components.Vertical, 2,
+			l, backButton,
+		),
+		discoveryManager,
+	}
+}
+
+func (m *DiscoveredPeersModel) Init() tea.Cmd {
+	m.list.SetSize(m.Frame.Width()/2, m.Frame.Height()/2)
+	m.list.SetItems(m.getPeers())
+
+	return tea.Batch(m.FocusContainer.Init(), m.stack.Init(), refreshDiscoveredPeers())
+}
+
+func (m *DiscoveredPeersModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	// Handle updates on frame
+	frameCmd := m.Frame.Update(msg)
+	cmds := []tea.Cmd{frameCmd}
+
+	switch msg.(type) {
+	case tea.WindowSizeMsg:
+		m.list.SetSize(m.Frame.Width()/2, m.Frame.Height()/2)
+	case refreshDiscoveredPeersMsg:
+		m.list.SetItems(m.getPeers())
+		cmds = append(cmds, refreshDiscoveredPeers())
+	}
+
+	fc, cmd := m.FocusContainer.Update(msg)
+	m.FocusContainer = fc
+	cmds = append(cmds, cmd)
+
+	return m, tea.Batch(cmds...)
+}
+
+func (m *DiscoveredPeersModel) View() string {
+	return m.Frame.View(m.stack.View())
+}
+
+func (m *DiscoveredPeersModel) getPeers() []list.Item {
+	peers := m.discoveryManager.GetPeers()
+
+	items := make([]list.Item, len(peers))
+	for i, peer := range peers {
+		items[i] = DiscoveredPeer{peer}
+	}
+
+	return items
+}
@@ -1,20 +1,44 @@
 package tui
 
 import (
+	"fmt"
+	"strings"
+
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/hop-/gotchat/internal/core"
 	"github.com/hop-/gotchat/internal/ui/tui/commands"
 )
 
+// session is the chat page of a logged in user
+type session struct {
+	user *core.User
+	page tea.Model
+}
+
 type RootModel struct {
 	pageStack []tea.Model
 	emitter   core.EventEmitter
+
+	// Logged in users, the pages are kept while another user is active
+	sessions []*session
+	// Unique id of the active user
+	activeUserId string
+
+	// Creates the page to log in a user
+	loginPage func() tea.Model
+
+	// Last reported states of the services in the order they were first reported
+	services []commands.ServiceStateMsg
 }
 
-func newRootModel(initialPage tea.Model, emitter core.EventEmitter) *RootModel {
+func newRootModel(loginPage func() tea.Model, emitter core.EventEmitter) *RootModel {
 	return &RootModel{
-		[]tea.Model{initialPage},
+		[]tea.Model{loginPage()},
 		emitter,
+		nil,
+		"",
+		loginPage,
+		nil,
 	}
 }
 
@@ -42,6 +66,124 @@ func (m *RootModel) popPage() {
 	m.pageStack = m.pageStack[:len(m.pageStack)-1]
 }
 
+// updateServiceState records the state and refreshes the services page if it's open
+func (m *RootModel) updateServiceState(msg commands.ServiceStateMsg) {
+	found := false
+	for i, s := range m.services {
+		if s.Service == msg.Service {
+			m.services[i] = msg
+			found = true
+
+			break
+		}
+	}
+	if !found {
+		m.services = append(m.services, msg)
+	}
+
+	for _, page := range m.pageStack {
+		if services, ok := page.(*ServicesModel); ok {
+			services.setStates(m.services)
+		}
+	}
+}
+
+// removeConnectionRequestPage drops the page of an expired request wherever it's in the stack
+func (m *RootModel) removeConnectionRequestPage(requestId string) {
+	pages := make([]tea.Model, 0, len(m.pageStack))
+	for _, page := range m.pageStack {
+		if request, ok := page.(*ConnectionRequestModel); ok && request.requestId == requestId {
+			continue
+		}
+		pages = append(pages, page)
+	}
+
+	if len(pages) > 0 {
+		m.pageStack = pages
+	}
+}
+
+// findSession returns the index of the logged in user by name or id, -1 if not found
+func (m *RootModel) findSession(nameOrId string) int {
+	for i, s := range m.sessions {
+		if s.user.UniqueId == nameOrId || s.user.Name == nameOrId {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (m *RootModel) sessionNames() string {
+	names := make([]string, len(m.sessions))
+	for i, s := range m.sessions {
+		names[i] = s.user.Name
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// openSession makes the user active and shows its page
+func (m *RootModel) openSession(s *session) tea.Cmd {
+	m.activeUserId = s.user.UniqueId
+	m.pageStack = []tea.Model{s.page}
+
+	return m.currentPage().Init()
+}
+
+func (m *RootModel) addSession(user *core.User, page tea.Model) tea.Cmd {
+	s := &session{user, page}
+	if i := m.findSession(user.UniqueId); i >= 0 {
+		m.sessions[i] = s
+	} else {
+		m.sessions = append(m.sessions, s)
+	}
+
+	return m.openSession(s)
+}
+
+func (m *RootModel) switchSession(nameOrId string) tea.Cmd {
+	if len(m.sessions) == 0 {
+		return commands.Error("no user is logged in")
+	}
+
+	i := m.findSession(nameOrId)
+	if nameOrId == "" {
+		// The next user after the active one
+		i = (m.findSession(m.activeUserId) + 1) % len(m.sessions)
+	}
+	if i < 0 {
+		return commands.Error(fmt.Sprintf("user '%s' is not logged in, logged in: %s", nameOrId, m.sessionNames()))
+	}
+
+	s := m.sessions[i]
+	if s.user.UniqueId != m.activeUserId {
+		m.emitter.Emit(core.SwitchUserEvent{User: s.user})
+	}
+
+	return m.openSession(s)
+}
+
+// logout logs out the active user and switches to another logged in user if any
+func (m *RootModel) logout() tea.Cmd {
+	i := m.findSession(m.activeUserId)
+	if i < 0 {
+		return commands.Error("no user is logged in")
+	}
+
+	m.emitter.Emit(core.UserLoggedOutEvent{User: m.sessions[i].user})
+	m.sessions = append(m.sessions[:i], m.sessions[i+1:]...)
+	m.activeUserId = ""
+
+	if len(m.sessions) == 0 {
+		m.pageStack = []tea.Model{m.loginPage()}
+
+		return m.currentPage().Init()
+	}
+
+	return m.switchSession(m.sessions[0].user.UniqueId)
+}
+
 func (m *RootModel) Init() tea.Cmd {
 	return m.currentPage().Init()
 }
@@ -65,8 +207,58 @@ func (m *RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	case commands.ConnectMsg:
 		m.emitter.Emit(core.ConnectEvent{
-			Host: msg.Host,
-			Port: msg.Port,
+			Host:       msg.Host,
+			Port:       msg.Port,
+			PeerUserId: msg.PeerUserId,
+		})
+	case commands.JoinMsg:
+		m.emitter.Emit(core.JoinEvent{URI: msg.URI})
+	case commands.UserLoggedInMsg:
+		return m, m.addSession(msg.User, msg.Page)
+	case commands.SwitchUserMsg:
+		return m, m.switchSession(msg.NameOrId)
+	case commands.AddUserMsg:
+		m.pushPage(m.loginPage())
+
+		return m, m.currentPage().Init()
+	case commands.LogoutMsg:
+		return m, m.logout()
+	case commands.SendMessageMsg:
+		m.emitter.Emit(core.SendMessageEvent{
+			PeerUserId: msg.PeerUserId,
+			Text:       msg.Text,
+		})
+	case commands.ConnectionRequestMsg:
+		userName := msg.UserId
+		if i := m.findSession(msg.UserId); i >= 0 {
+			userName = m.sessions[i].user.Name
+		}
+		m.pushPage(newConnectionRequestModel(msg, userName))
+
+		return m, m.currentPage().Init()
+	case commands.ServiceStateMsg:
+		m.updateServiceState(msg)
+
+		return m, nil
+	case commands.ShowServicesMsg:
+		m.pushPage(newServicesModel(m.services))
+
+		return m, m.currentPage().Init()
+	case commands.ConnectionRequestExpiredMsg:
+		m.removeConnectionRequestPage(msg.RequestId)
+	case commands.ResolveConnectionRequestMsg:
+		m.emitter.Emit(core.ConnectionRequestDecisionEvent{
+			RequestId: msg.RequestId,
+			Accept:    msg.Accept,
+		})
+	case commands.SetPeerPolicyMsg:
+		m.emitter.Emit(core.SetPeerPolicyEvent{Policy: msg.Policy})
+	case commands.UpdatePeerRuleMsg:
+		m.emitter.Emit(core.PeerRuleEvent{
+			Kind:   msg.Kind,
+			Value:  msg.Value,
+			Remove: msg.Remove,
+			Owner:  msg.Owner,
 		})
 	case commands.ShutdownMsg:
 		// Setup shutdown screen
@@ -75,6 +267,12 @@ func (m *RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, m.currentPage().Init()
 	case commands.InternalQuitMsg:
 		m.emitter.Emit(core.QuitEvent{})
+	case commands.EmitEventsMsg:
+		for _, e := range msg.Events {
+			m.emitter.Emit(e)
+		}
+
+		return m, nil
 	}
 
 	page, cmd := m.currentPage().Update(msg)
@@ -0,0 +1,77 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hop-/gotchat/internal/ui/tui/commands"
+	"github.com/hop-/gotchat/internal/ui/tui/components"
+)
+
+type ServicesModel struct {
+	// Frame component
+	components.Frame
+	// Focusable container
+	*components.FocusContainer
+
+	// Stack component
+	stack *components.Stack
+
+	states *components.Label
+}
+
+func newServicesModel(states []commands.ServiceStateMsg) *ServicesModel {
+	title := components.NewLabel("Services")
+
+	backButton := components.NewButton("Back")
+	backButton.SetActive(true)
+	backButton.OnAction(commands.PopPage)
+
+	m := &ServicesModel{
+		components.Frame{},
+		components.NewFocusContainer(backButton),
+		nil,
+		components.NewLabel(""),
+	}
+	m.stack = components.NewStack(components.Vertical, 1, title, m.states, backButton)
+	m.setStates(states)
+
+	return m
+}
+
+// setStates shows the states of the services
+func (m *ServicesModel) setStates(states []commands.ServiceStateMsg) {
+	if len(states) == 0 {
+		m.states.SetText("No state is reported yet")
+
+		return
+	}
+
+	lines := make([]string, len(states))
+	for i, s := range states {
+		lines[i] = fmt.Sprintf("%-26s %s", s.Service, s.State)
+		if s.Error != "" {
+			lines[i] += ": " + s.Error
+		}
+	}
+	m.states.SetText(strings.Join(lines, "\n"))
+}
+
+func (m *ServicesModel) Init() tea.Cmd {
+	return tea.Batch(m.FocusContainer.Init(), m.stack.Init())
+}
+
+func (m *ServicesModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	// Handle updates on frame
+	frameCmd := m.Frame.Update(msg)
+
+	fc, cmd := m.FocusContainer.Update(msg)
+	m.FocusContainer = fc
+
+	return m, tea.Batch(frameCmd, cmd)
+}
+
+func (m *ServicesModel) View() string {
+	return m.Frame.View(m.stack.View())
+}
@@ -32,6 +32,7 @@ func newSigninModel(
 	user *core.User,
 	userManager *services.UserManager,
 	chatManager *services.ChatManager,
+	discoveryManager *services.DiscoveryManager,
 ) *SigninModel {
 	usernameLabel := components.NewLabel(user.Name)
 
@@ -56,7 +57,7 @@ func newSigninModel(
 			return commands.ErrorMsg{Message: "An error occurred while logging in"}
 		}
 
-		return commands.SetNewPageMsg{Page: newChatViewModel(user, userManager, chatManager)}
+		return commands.UserLoggedInMsg{User: user, Page: newChatViewModel(user, userManager, chatManager, discoveryManager)}
 	})
 
 	backButton := components.NewButton("Back")
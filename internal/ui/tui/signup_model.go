@@ -30,6 +30,7 @@ type SignupModel struct {
 func newSignupModel(
 	userManager *services.UserManager,
 	chatManager *services.ChatManager,
+	discoveryManager *services.DiscoveryManager,
 ) *SignupModel {
 	usernameInput := components.NewTextInput("Username")
 	usernameInput.Placeholder = "Enter your nickname"
@@ -59,7 +60,7 @@ func newSignupModel(
 			return commands.ErrorMsg{Message: "An error occurred while logging in"}
 		}
 
-		return commands.SetNewPageMsg{Page: newChatViewModel(user, userManager, chatManager)}
+		return commands.UserLoggedInMsg{User: user, Page: newChatViewModel(user, userManager, chatManager, discoveryManager)}
 	})
 
 	backButton := components.NewButton("Back")
@@ -8,19 +8,24 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/hop-/gotchat/internal/core"
 	"github.com/hop-/gotchat/internal/services"
+	"github.com/hop-/gotchat/internal/ui/tui/commands"
 )
 
 type Tui struct {
 	p  *tea.Program
-	em core.EventDispatcher
+	em core.EventBus
 }
 
 func New(
-	em core.EventDispatcher,
+	em core.EventBus,
 	userManager *services.UserManager,
 	chatManager *services.ChatManager,
+	discoveryManager *services.DiscoveryManager,
 ) *Tui {
-	rootModel := newRootModel(newUsersListModel(userManager, chatManager), em)
+	loginPage := func() tea.Model {
+		return newUsersListModel(userManager, chatManager, discoveryManager)
+	}
+	rootModel := newRootModel(loginPage, em)
 	p := tea.NewProgram(rootModel, tea.WithAltScreen())
 
 	return &Tui{p, em}
@@ -43,7 +48,19 @@ func (ui *Tui) Run(ctx context.Context, wg *sync.WaitGroup) error {
 		ui.p.Quit()
 	}()
 
-	listener := ui.em.Register(ctx)
+	// Only the events shown by the TUI are delivered,
+	// the emitter waits a bit for the TUI rather than losing a connection request
+	listener := ui.em.SubscribeWith(ctx, core.ListenerOptions{
+		Name: "tui",
+		Filter: core.AnyOf(
+			core.OfType[core.NewMessageEvent](),
+			core.OfType[services.ConnectionRequested](),
+			core.OfType[services.ConnectionRequestExpired](),
+			core.OfType[core.CommandFailed](),
+			core.OfType[core.ServiceStateChanged](),
+		),
+		Policy: core.Block,
+	})
 
 	// Filter events and send to TUI program
 	go ui.runEventFilter(listener)
@@ -71,6 +88,25 @@ func (ui *Tui) runEventFilter(listener core.EventListener) {
 		case core.NewMessageEvent:
 			// TODO
 			fmt.Println("New message event received:", event.Message)
+		case services.ConnectionRequested:
+			ui.p.Send(commands.ConnectionRequestMsg{
+				RequestId:   event.RequestId,
+				PeerUserId:  event.PeerUserId,
+				PeerName:    event.PeerName,
+				Host:        event.Host,
+				UserId:      event.UserId,
+				KeysChanged: event.KeysChanged,
+			})
+		case services.ConnectionRequestExpired:
+			ui.p.Send(commands.ConnectionRequestExpiredMsg{RequestId: event.RequestId})
+		case core.CommandFailed:
+			ui.p.Send(commands.ErrorMsg{Message: fmt.Sprintf("%s failed: %v", event.Command, event.Err)})
+		case core.ServiceStateChanged:
+			msg := commands.ServiceStateMsg{Service: event.Service, State: string(event.State)}
+			if event.Err != nil {
+				msg.Error = event.Err.Error()
+			}
+			ui.p.Send(msg)
 		}
 	}
 }
@@ -35,6 +35,7 @@ type UsersListModel struct {
 func newUsersListModel(
 	userManager *services.UserManager,
 	chatManager *services.ChatManager,
+	discoveryManager *services.DiscoveryManager,
 ) *UsersListModel {
 	l := components.NewItemList([]list.Item{})
 	l.Title = "Users"
@@ -45,7 +46,7 @@ func newUsersListModel(
 				return commands.Error(err.Error())
 			}
 
-			return commands.PushPage(newSigninModel(user, userManager, chatManager))
+			return commands.PushPage(newSigninModel(user, userManager, chatManager, discoveryManager))
 		}
 
 		return nil
@@ -53,7 +54,7 @@ func newUsersListModel(
 
 	newLoginButton := components.NewButton("New Login")
 	newLoginButton.SetActive(true)
-	newLoginButton.OnAction(commands.PushPage(newSignupModel(userManager, chatManager)))
+	newLoginButton.OnAction(commands.PushPage(newSignupModel(userManager, chatManager, discoveryManager)))
 
 	exitButton := components.NewButton("Exit")
 	exitButton.SetActive(true)
@@ -1,7 +1,13 @@
 package main
 
-import "github.com/hop-/gotchat/internal/cmd"
+import (
+	"os"
+
+	"github.com/hop-/gotchat/internal/cmd"
+	// Plugins compiled in register themselves when imported, e.g.
+	// _ "github.com/hop-/gotchat/plugins/weather"
+)
 
 func main() {
-	cmd.Execute()
+	os.Exit(cmd.Execute())
 }
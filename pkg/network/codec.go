@@ -0,0 +1,127 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ActionHeader is the header which names the payload type of a message
+const ActionHeader = "action"
+
+var (
+	ErrUnknownAction       = errors.New("unknown action")
+	ErrActionMismatch      = errors.New("unexpected action")
+	ErrActionRegistered    = errors.New("action is already registered")
+	ErrPayloadTypeMismatch = errors.New("payload type does not match the registered type")
+)
+
+// Codec maps action names to Go payload types
+type Codec struct {
+	mu    sync.RWMutex
+	types map[string]reflect.Type
+}
+
+func NewCodec() *Codec {
+	return &Codec{
+		sync.RWMutex{},
+		make(map[string]reflect.Type),
+	}
+}
+
+// RegisterAction registers the payload type T for the action
+func RegisterAction[T any](c *Codec, action string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if registered, ok := c.types[action]; ok {
+		if registered == t {
+			return nil
+		}
+
+		return fmt.Errorf("%w: %s", ErrActionRegistered, action)
+	}
+
+	c.types[action] = t
+
+	return nil
+}
+
+// MustRegisterAction is like RegisterAction but panics if the action is registered for another type,
+// it's meant for the codecs set up at init
+func MustRegisterAction[T any](c *Codec, action string) {
+	if err := RegisterAction[T](c, action); err != nil {
+		panic(err)
+	}
+}
+
+func (c *Codec) payloadType(action string) (reflect.Type, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	t, ok := c.types[action]
+
+	return t, ok
+}
+
+// Encode builds a message for the action with the payload encoded in the body
+func (c *Codec) Encode(action string, payload any) (*Message, error) {
+	t, ok := c.payloadType(action)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAction, action)
+	}
+
+	payloadType := reflect.TypeOf(payload)
+	if payloadType != t && (payloadType == nil || payloadType.Kind() != reflect.Pointer || payloadType.Elem() != t) {
+		return nil, fmt.Errorf("%w: %s expects %s, got %v", ErrPayloadTypeMismatch, action, t, payloadType)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s payload: %w", action, err)
+	}
+
+	return NewMessage(map[string]string{ActionHeader: action}, body), nil
+}
+
+// Decode decodes the message body into a new value of the registered payload type
+// The returned payload is a pointer to the registered type
+func (c *Codec) Decode(msg *Message) (string, any, error) {
+	action := ActionOf(msg)
+
+	t, ok := c.payloadType(action)
+	if !ok {
+		return action, nil, fmt.Errorf("%w: %s", ErrUnknownAction, action)
+	}
+
+	payload := reflect.New(t).Interface()
+	if err := msg.BodyTo(payload); err != nil {
+		return action, nil, err
+	}
+
+	return action, payload, nil
+}
+
+// ActionOf returns the action of the message or empty string
+func ActionOf(msg *Message) string {
+	action, _ := msg.GetHeader(ActionHeader)
+
+	return action
+}
+
+// DecodeAs checks that the message has the expected action and decodes its payload
+func DecodeAs[T any](msg *Message, action string) (*T, error) {
+	if got := ActionOf(msg); got != action {
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrActionMismatch, action, got)
+	}
+
+	payload := new(T)
+	if err := msg.BodyTo(payload); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,155 @@
+package network
+
+import (
+	"errors"
+	"testing"
+)
+
+type testPayload struct {
+	Text string `json:"text"`
+}
+
+type otherPayload struct {
+	Count int `json:"count"`
+}
+
+func TestCodec_EncodeDecode(t *testing.T) {
+	codec := NewCodec()
+	if err := RegisterAction[testPayload](codec, "test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	msg, err := codec.Encode("test", testPayload{"hello"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ActionOf(msg) != "test" {
+		t.Errorf("expected action 'test', got '%s'", ActionOf(msg))
+	}
+
+	// Pointers to the payload type are accepted too
+	if _, err := codec.Encode("test", &testPayload{"hello"}); err != nil {
+		t.Errorf("unexpected error for pointer payload: %v", err)
+	}
+
+	action, payload, err := codec.Decode(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if action != "test" {
+		t.Errorf("expected action 'test', got '%s'", action)
+	}
+	p, ok := payload.(*testPayload)
+	if !ok || p.Text != "hello" {
+		t.Errorf("unexpected payload %#v", payload)
+	}
+}
+
+func TestCodec_Errors(t *testing.T) {
+	codec := NewCodec()
+	RegisterAction[testPayload](codec, "test")
+
+	// Registering the same type again is fine, another type is not
+	if err := RegisterAction[testPayload](codec, "test"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := RegisterAction[otherPayload](codec, "test"); !errors.Is(err, ErrActionRegistered) {
+		t.Errorf("expected ErrActionRegistered, got %v", err)
+	}
+
+	func() {
+		defer func() {
+			if err, ok := recover().(error); !ok || !errors.Is(err, ErrActionRegistered) {
+				t.Errorf("expected a panic with ErrActionRegistered, got %v", err)
+			}
+		}()
+		MustRegisterAction[otherPayload](codec, "test")
+	}()
+
+	if _, err := codec.Encode("unknown", testPayload{}); !errors.Is(err, ErrUnknownAction) {
+		t.Errorf("expected ErrUnknownAction, got %v", err)
+	}
+	if _, err := codec.Encode("test", otherPayload{}); !errors.Is(err, ErrPayloadTypeMismatch) {
+		t.Errorf("expected ErrPayloadTypeMismatch, got %v", err)
+	}
+
+	msg := NewMessage(map[string]string{ActionHeader: "unknown"}, []byte("{}"))
+	if _, _, err := codec.Decode(msg); !errors.Is(err, ErrUnknownAction) {
+		t.Errorf("expected ErrUnknownAction, got %v", err)
+	}
+}
+
+func TestDecodeAs(t *testing.T) {
+	codec := NewCodec()
+	RegisterAction[testPayload](codec, "test")
+
+	msg, _ := codec.Encode("test", testPayload{"hello"})
+
+	payload, err := DecodeAs[testPayload](msg, "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if payload.Text != "hello" {
+		t.Errorf("expected text 'hello', got '%s'", payload.Text)
+	}
+
+	if _, err := DecodeAs[testPayload](msg, "other"); !errors.Is(err, ErrActionMismatch) {
+		t.Errorf("expected ErrActionMismatch, got %v", err)
+	}
+}
+
+func TestRouter_Dispatch(t *testing.T) {
+	router := NewRouter(NewCodec())
+
+	var received *testPayload
+	err := HandleAction(router, "test", func(payload *testPayload, msg *Message) error {
+		received = payload
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := HandleAction(router, "test", func(*testPayload, *Message) error { return nil }); err == nil {
+		t.Error("expected error for duplicate handler, got nil")
+	}
+
+	msg, err := router.Codec().Encode("test", testPayload{"routed"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := router.Dispatch(msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if received == nil || received.Text != "routed" {
+		t.Errorf("expected routed payload, got %#v", received)
+	}
+
+	// Unknown actions fail without a fallback
+	unknown := NewMessage(map[string]string{ActionHeader: "unknown"}, nil)
+	if err := router.Dispatch(unknown); !errors.Is(err, ErrUnknownAction) {
+		t.Errorf("expected ErrUnknownAction, got %v", err)
+	}
+
+	var fallbackMsg *Message
+	router.Fallback(func(msg *Message) error {
+		fallbackMsg = msg
+
+		return nil
+	})
+
+	if err := router.Dispatch(unknown); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fallbackMsg != unknown {
+		t.Error("expected unknown message to reach the fallback")
+	}
+
+	// Malformed payloads are reported
+	malformed := NewMessage(map[string]string{ActionHeader: "test"}, []byte("not json"))
+	if err := router.Dispatch(malformed); err == nil {
+		t.Error("expected error for malformed payload, got nil")
+	}
+}
@@ -0,0 +1,117 @@
+package network
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CompressionCodec identifies how a frame payload is compressed
+type CompressionCodec byte
+
+const (
+	CompressionNone    CompressionCodec = 0
+	CompressionDeflate CompressionCodec = 1
+)
+
+const (
+	// DefaultCompressionThreshold is the minimal payload size worth compressing
+	DefaultCompressionThreshold = 1024
+
+	maxDecompressedFrameSize = 64 << 20 // 64 MiB
+)
+
+var (
+	ErrUnknownCompression  = errors.New("unknown compression codec")
+	ErrDecompressedTooLong = errors.New("decompressed frame is too long")
+)
+
+var compressionNames = map[CompressionCodec]string{
+	CompressionDeflate: "deflate",
+}
+
+func (c CompressionCodec) String() string {
+	if name, ok := compressionNames[c]; ok {
+		return name
+	}
+
+	return "none"
+}
+
+// SupportedCompressions returns the comma separated codecs to advertise during the handshake
+func SupportedCompressions() string {
+	return CompressionDeflate.String()
+}
+
+// NegotiateCompression picks the first codec from the peer's advertisement which is supported locally
+func NegotiateCompression(advertised string) CompressionCodec {
+	for _, name := range strings.Split(advertised, ",") {
+		name = strings.TrimSpace(name)
+		for codec, codecName := range compressionNames {
+			if name == codecName {
+				return codec
+			}
+		}
+	}
+
+	return CompressionNone
+}
+
+// compressFrame prefixes the data with the codec used, data below the threshold is left as is
+func compressFrame(codec CompressionCodec, threshold int, data []byte) ([]byte, error) {
+	if codec == CompressionDeflate && len(data) >= threshold {
+		var buf bytes.Buffer
+		buf.WriteByte(byte(CompressionDeflate))
+
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		// Only use the compressed data when it's actually smaller
+		if buf.Len() < len(data)+1 {
+			return buf.Bytes(), nil
+		}
+	}
+
+	frame := make([]byte, len(data)+1)
+	frame[0] = byte(CompressionNone)
+	copy(frame[1:], data)
+
+	return frame, nil
+}
+
+func decompressFrame(frame []byte) ([]byte, error) {
+	if len(frame) == 0 {
+		return nil, fmt.Errorf("compressed frame is empty")
+	}
+
+	switch CompressionCodec(frame[0]) {
+	case CompressionNone:
+		return frame[1:], nil
+	case CompressionDeflate:
+		r := flate.NewReader(bytes.NewReader(frame[1:]))
+		defer r.Close()
+
+		data, err := io.ReadAll(io.LimitReader(r, maxDecompressedFrameSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress frame: %w", err)
+		}
+		if len(data) > maxDecompressedFrameSize {
+			return nil, ErrDecompressedTooLong
+		}
+
+		return data, nil
+	default:
+		return nil, ErrUnknownCompression
+	}
+}
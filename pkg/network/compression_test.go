@@ -0,0 +1,114 @@
+package network
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateCompression(t *testing.T) {
+	tests := []struct {
+		advertised string
+		expected   CompressionCodec
+	}{
+		{"deflate", CompressionDeflate},
+		{"zstd, deflate", CompressionDeflate},
+		{"zstd", CompressionNone},
+		{"", CompressionNone},
+	}
+
+	for _, tt := range tests {
+		if got := NegotiateCompression(tt.advertised); got != tt.expected {
+			t.Errorf("NegotiateCompression(%q) = %v, want %v", tt.advertised, got, tt.expected)
+		}
+	}
+
+	if NegotiateCompression(SupportedCompressions()) == CompressionNone {
+		t.Error("expected own advertisement to be negotiable")
+	}
+}
+
+func TestCompressFrame_RoundTrip(t *testing.T) {
+	large := []byte(strings.Repeat("compressible log line\n", 200))
+	small := []byte("hi")
+
+	frame, err := compressFrame(CompressionDeflate, DefaultCompressionThreshold, large)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if CompressionCodec(frame[0]) != CompressionDeflate {
+		t.Errorf("expected large frame to be compressed, got codec %v", CompressionCodec(frame[0]))
+	}
+	if len(frame) >= len(large) {
+		t.Errorf("expected compressed frame to be smaller, got %d >= %d", len(frame), len(large))
+	}
+
+	data, err := decompressFrame(frame)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(data, large) {
+		t.Error("decompressed data does not match original")
+	}
+
+	// Below the threshold the data is not compressed
+	frame, err = compressFrame(CompressionDeflate, DefaultCompressionThreshold, small)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if CompressionCodec(frame[0]) != CompressionNone {
+		t.Errorf("expected small frame to be left uncompressed, got codec %v", CompressionCodec(frame[0]))
+	}
+
+	data, err = decompressFrame(frame)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(data, small) {
+		t.Error("decompressed data does not match original")
+	}
+}
+
+func TestDecompressFrame_Invalid(t *testing.T) {
+	if _, err := decompressFrame(nil); err == nil {
+		t.Error("expected error for empty frame, got nil")
+	}
+
+	if _, err := decompressFrame([]byte{42, 1, 2, 3}); err != ErrUnknownCompression {
+		t.Errorf("expected ErrUnknownCompression, got %v", err)
+	}
+
+	if _, err := decompressFrame([]byte{byte(CompressionDeflate), 0xff, 0xff}); err == nil {
+		t.Error("expected error for corrupted frame, got nil")
+	}
+}
+
+func TestSecureConn_Compression(t *testing.T) {
+	key1, _ := GenerateKey()
+	key2, _ := GenerateKey()
+
+	enc1, _ := NewEncryption(key1, key2)
+	enc2, _ := NewEncryption(key2, key1)
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	sender := NewSecureConn(NewConn(c1), enc1)
+	receiver := NewSecureConn(NewConn(c2), enc2)
+
+	sender.EnableCompression(CompressionDeflate, DefaultCompressionThreshold)
+	receiver.EnableCompression(CompressionDeflate, DefaultCompressionThreshold)
+
+	body := []byte(strings.Repeat("history sync ", 500))
+	go sender.Write(NewMessage(map[string]string{"action": "sync"}, body))
+
+	msg, err := receiver.Read()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Headers()["action"] != "sync" || !bytes.Equal(msg.Body(), body) {
+		t.Error("received message does not match the sent one")
+	}
+}
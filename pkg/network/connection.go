@@ -1,11 +1,15 @@
 package network
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"net"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
 type BasicConn interface {
@@ -21,12 +25,61 @@ type AdvancedConn interface {
 	Close() error
 }
 
+// ContextWriter is implemented by connections which can cancel a write
+type ContextWriter interface {
+	WriteContext(ctx context.Context, m *Message) error
+}
+
+// deadlineConn is implemented by connections which support write deadlines (net.Conn)
+type deadlineConn interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// DefaultMaxFrameSize limits the size of a frame read from the peer
+const DefaultMaxFrameSize = 16 << 20 // 16 MiB
+
+var (
+	ErrConnBroken    = errors.New("connection is broken by a cancelled write")
+	ErrFrameTooLarge = errors.New("frame is too large")
+)
+
+// DecodeError is returned for a frame which was read whole but can't be decoded,
+// the next frames can still be read
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return "failed to decode message: " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Conn is a message connection, writes are safe for concurrent use
 type Conn struct {
 	conn BasicConn
+
+	// writeLock serializes frames, it's a channel so that waiting writers can give up
+	writeLock chan struct{}
+	// writeErr is set when a cancelled write left a partial frame on the stream
+	writeErr error
+
+	// maxFrameSize limits the frames read from the peer, the frame is checked before it's allocated
+	maxFrameSize atomic.Uint64
 }
 
 func NewConn(conn BasicConn) *Conn {
-	return &Conn{conn}
+	c := &Conn{conn, make(chan struct{}, 1), nil, atomic.Uint64{}}
+	c.maxFrameSize.Store(DefaultMaxFrameSize)
+
+	return c
+}
+
+// SetMaxFrameSize limits the size of the frames read from the peer
+func (c *Conn) SetMaxFrameSize(size uint64) {
+	c.maxFrameSize.Store(size)
 }
 
 func (c *Conn) Conn() BasicConn {
@@ -41,10 +94,20 @@ func (c *Conn) Read() (*Message, error) {
 	}
 
 	// Deserialize the message
-	return DeserializeMessage(messageData)
+	m, err := DeserializeMessage(messageData)
+	if err != nil {
+		return nil, &DecodeError{err}
+	}
+
+	return m, nil
 }
 
 func (c *Conn) Write(m *Message) error {
+	return c.WriteContext(context.Background(), m)
+}
+
+// WriteContext writes the message unless the context is done first
+func (c *Conn) WriteContext(ctx context.Context, m *Message) error {
 	// Serialize the message
 	messageData, err := SerializeMessage(m)
 	if err != nil {
@@ -52,7 +115,16 @@ func (c *Conn) Write(m *Message) error {
 	}
 
 	// Write the message frame
-	return c.WriteFrame(messageData)
+	return c.writeFrame(ctx, messageData)
+}
+
+// SetDeadline sets the read and write deadlines if the underlying connection supports them
+func (c *Conn) SetDeadline(t time.Time) error {
+	if dc, ok := c.conn.(interface{ SetDeadline(t time.Time) error }); ok {
+		return dc.SetDeadline(t)
+	}
+
+	return nil
 }
 
 func (c *Conn) Close() error {
@@ -67,6 +139,11 @@ func (c *Conn) readFrame() ([]byte, error) {
 		return nil, err
 	}
 
+	// The stream can't be resynchronized, so the frame isn't skipped
+	if limit := c.maxFrameSize.Load(); frameSize > limit {
+		return nil, fmt.Errorf("%w: %d bytes, the limit is %d", ErrFrameTooLarge, frameSize, limit)
+	}
+
 	frameData := make([]byte, frameSize)
 	// Read the frame data
 	err = c.readAll(frameData)
@@ -95,31 +172,85 @@ func (c *Conn) readAll(b []byte) error {
 }
 
 func (c *Conn) WriteFrame(frame []byte) error {
-	// Write the frame size
-	err := binary.Write(c.conn, binary.LittleEndian, uint64(len(frame)))
-	if err != nil {
+	return c.writeFrame(context.Background(), frame)
+}
+
+func (c *Conn) writeFrame(ctx context.Context, frame []byte) error {
+	// Wait for the other writers
+	select {
+	case c.writeLock <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-c.writeLock }()
+
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+
+	// The frame size and the frame data are written at once
+	data := make([]byte, 8+len(frame))
+	binary.LittleEndian.PutUint64(data, uint64(len(frame)))
+	copy(data[8:], frame)
+
+	dc, ok := c.conn.(deadlineConn)
+	if !ok || ctx.Done() == nil {
+		_, err := c.writeAll(data)
+
 		return err
 	}
 
-	// Write the frame data
-	return c.writeAll(frame)
+	// Interrupt the blocked write when the context is done
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+
+		select {
+		case <-ctx.Done():
+			dc.SetWriteDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+
+	written, err := c.writeAll(data)
+	close(done)
+	<-exited
+
+	if ctx.Err() == nil {
+		return err
+	}
+
+	// The deadline may be set even if the write has finished first
+	dc.SetWriteDeadline(time.Time{})
+
+	if err == nil {
+		return nil
+	}
+
+	if written > 0 {
+		// The peer can't find the next frame anymore
+		c.writeErr = ErrConnBroken
+	}
+
+	return ctx.Err()
 }
 
-func (c *Conn) writeAll(b []byte) error {
+func (c *Conn) writeAll(b []byte) (int, error) {
 	offset := 0
 
 	// Write whole message
 	for offset < len(b) {
 		size, err := c.conn.Write(b[offset:])
+		offset += size
 		if err != nil {
-			return err
+			return offset, err
 		}
 
-		offset += size
 		// TODO: check size == 0 case
 	}
 
-	return nil
+	return offset, nil
 }
 
 func IsClosedError(err error) bool {
@@ -127,7 +258,8 @@ func IsClosedError(err error) bool {
 	case
 		errors.Is(err, net.ErrClosed),
 		errors.Is(err, io.EOF),
-		errors.Is(err, syscall.EPIPE):
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, syscall.ECONNRESET):
 		return true
 	default:
 		return false
@@ -0,0 +1,125 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConn_ConcurrentWrites(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	sender := NewConn(c1)
+	receiver := NewConn(c2)
+
+	const writers, messages = 8, 25
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < messages; i++ {
+				body := []byte(fmt.Sprintf("writer-%d-message-%d", w, i))
+				if err := sender.Write(NewMessage(map[string]string{"action": "chat"}, body)); err != nil {
+					t.Errorf("failed to write: %v", err)
+
+					return
+				}
+			}
+		}(w)
+	}
+
+	// Every frame must arrive intact and in order per writer
+	next := make(map[int]int)
+	for i := 0; i < writers*messages; i++ {
+		msg, err := receiver.Read()
+		if err != nil {
+			t.Fatalf("failed to read message %d: %v", i, err)
+		}
+
+		var w, n int
+		if _, err := fmt.Sscanf(string(msg.Body()), "writer-%d-message-%d", &w, &n); err != nil {
+			t.Fatalf("corrupted message body %q", msg.Body())
+		}
+		if next[w] != n {
+			t.Errorf("expected message %d from writer %d, got %d", next[w], w, n)
+		}
+		next[w] = n + 1
+	}
+
+	wg.Wait()
+}
+
+func TestConn_WriteContext_Cancelled(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	conn := NewConn(c1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := conn.WriteContext(ctx, NewMessage(nil, nil)); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestConn_WriteContext_Timeout(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	conn := NewConn(c1)
+
+	// Nobody reads from the other end so the write blocks
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := conn.WriteContext(ctx, NewMessage(map[string]string{"action": "chat"}, nil))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("expected the write to be interrupted, took %v", time.Since(start))
+	}
+
+	// Waiting writers give up as well
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := conn.WriteContext(ctx, NewMessage(nil, nil)); err == nil {
+		t.Error("expected error after timeout, got nil")
+	}
+}
+
+func TestConn_Read_FrameTooLarge(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	conn := NewConn(c2)
+	conn.SetMaxFrameSize(1024)
+
+	// Only the header is sent, the frame must be refused before it's allocated
+	go func() {
+		var header [8]byte
+		binary.LittleEndian.PutUint64(header[:], math.MaxUint64)
+		c1.Write(header[:])
+	}()
+
+	if _, err := conn.Read(); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("expected ErrFrameTooLarge, got %v", err)
+	}
+}
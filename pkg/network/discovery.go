@@ -0,0 +1,286 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const maxAnnouncementSize = 1024
+
+// Announcement is periodically sent to the multicast group by peers running a server
+type Announcement struct {
+	Name     string `json:"name"`
+	UniqueId string `json:"uniqueId"`
+	Port     int    `json:"port"`
+}
+
+// DiscoveredPeer is a peer which recently announced itself
+type DiscoveredPeer struct {
+	Announcement
+	Host     string
+	LastSeen time.Time
+}
+
+// Address returns host:port of the peer's server
+func (p DiscoveredPeer) Address() string {
+	return net.JoinHostPort(p.Host, fmt.Sprint(p.Port))
+}
+
+// Announcer sends announcements to a multicast group
+type Announcer struct {
+	group    *net.UDPAddr
+	interval time.Duration
+
+	mu           sync.RWMutex
+	announcement *Announcement
+}
+
+func NewAnnouncer(group string, interval time.Duration) (*Announcer, error) {
+	groupAddr, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return nil, fmt.Errorf("invalid discovery group %s: %w", group, err)
+	}
+
+	return &Announcer{
+		groupAddr,
+		interval,
+		sync.RWMutex{},
+		nil,
+	}, nil
+}
+
+// SetAnnouncement changes what is announced, nil stops announcing
+func (a *Announcer) SetAnnouncement(announcement *Announcement) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.announcement = announcement
+}
+
+func (a *Announcer) getAnnouncement() *Announcement {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.announcement
+}
+
+// Run sends the current announcement every interval until the context is done
+func (a *Announcer) Run(ctx context.Context) error {
+	conn, err := net.DialUDP("udp4", nil, a.group)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		if announcement := a.getAnnouncement(); announcement != nil {
+			data, err := json.Marshal(announcement)
+			if err != nil {
+				return err
+			}
+
+			// Ignore send errors, the network may come back later
+			conn.Write(data)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// DiscoveryHandler is notified when a peer is discovered or expired
+type DiscoveryHandler func(peer DiscoveredPeer, lost bool)
+
+// Discovery listens to announcements on a multicast group and keeps a list of nearby peers
+type Discovery struct {
+	group *net.UDPAddr
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu      sync.RWMutex
+	peers   map[string]*DiscoveredPeer
+	handler DiscoveryHandler
+	// Connection of the running listener, closing it stops Run
+	conn   *net.UDPConn
+	closed bool
+}
+
+func NewDiscovery(group string, ttl time.Duration) (*Discovery, error) {
+	groupAddr, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return nil, fmt.Errorf("invalid discovery group %s: %w", group, err)
+	}
+
+	return &Discovery{
+		groupAddr,
+		ttl,
+		time.Now,
+		sync.RWMutex{},
+		make(map[string]*DiscoveredPeer),
+		nil,
+		nil,
+		false,
+	}, nil
+}
+
+// OnChange sets the handler which is called when a peer is discovered or lost
+func (d *Discovery) OnChange(handler DiscoveryHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.handler = handler
+}
+
+// Run listens to the multicast group until the context is done or the discovery is closed
+func (d *Discovery) Run(ctx context.Context) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, d.group)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+
+		return nil
+	}
+	d.conn = conn
+	d.mu.Unlock()
+
+	buf := make([]byte, maxAnnouncementSize)
+	for ctx.Err() == nil {
+		// Wake up regularly to expire peers and check the context
+		conn.SetReadDeadline(time.Now().Add(d.ttl / 2))
+
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				d.expire()
+
+				continue
+			}
+
+			if ctx.Err() != nil || d.isClosed() {
+				return nil
+			}
+
+			return err
+		}
+
+		// Malformed announcements are ignored
+		d.handleAnnouncement(buf[:n], from)
+		d.expire()
+	}
+
+	return nil
+}
+
+// Close stops the listener without waiting for its read deadline
+func (d *Discovery) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	if d.conn == nil {
+		return nil
+	}
+
+	return d.conn.Close()
+}
+
+func (d *Discovery) isClosed() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.closed
+}
+
+// Peers returns the peers which are not expired sorted by name
+func (d *Discovery) Peers() []DiscoveredPeer {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	now := d.now()
+	peers := make([]DiscoveredPeer, 0, len(d.peers))
+	for _, peer := range d.peers {
+		if now.Sub(peer.LastSeen) <= d.ttl {
+			peers = append(peers, *peer)
+		}
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].Name == peers[j].Name {
+			return peers[i].UniqueId < peers[j].UniqueId
+		}
+
+		return peers[i].Name < peers[j].Name
+	})
+
+	return peers
+}
+
+func (d *Discovery) handleAnnouncement(data []byte, from *net.UDPAddr) error {
+	var announcement Announcement
+	if err := json.Unmarshal(data, &announcement); err != nil {
+		return fmt.Errorf("malformed announcement: %w", err)
+	}
+
+	if announcement.UniqueId == "" || announcement.Port <= 0 || announcement.Port > 65535 {
+		return fmt.Errorf("invalid announcement from %s", from)
+	}
+
+	d.mu.Lock()
+	peer, known := d.peers[announcement.UniqueId]
+	if !known {
+		peer = &DiscoveredPeer{}
+		d.peers[announcement.UniqueId] = peer
+	}
+	peer.Announcement = announcement
+	peer.Host = from.IP.String()
+	peer.LastSeen = d.now()
+	discovered := *peer
+	handler := d.handler
+	d.mu.Unlock()
+
+	if !known && handler != nil {
+		handler(discovered, false)
+	}
+
+	return nil
+}
+
+func (d *Discovery) expire() {
+	d.mu.Lock()
+	now := d.now()
+	lost := make([]DiscoveredPeer, 0)
+	for uniqueId, peer := range d.peers {
+		if now.Sub(peer.LastSeen) > d.ttl {
+			lost = append(lost, *peer)
+			delete(d.peers, uniqueId)
+		}
+	}
+	handler := d.handler
+	d.mu.Unlock()
+
+	if handler == nil {
+		return
+	}
+
+	for _, peer := range lost {
+		handler(peer, true)
+	}
+}
@@ -0,0 +1,150 @@
+package network
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// Multicast group of the tests
+const testDiscoveryGroup = "239.255.76.65:7667"
+
+func newTestDiscovery(t *testing.T, now *time.Time) *Discovery {
+	d, err := NewDiscovery(testDiscoveryGroup, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create discovery: %v", err)
+	}
+	d.now = func() time.Time { return *now }
+
+	return d
+}
+
+func TestNewDiscovery_InvalidGroup(t *testing.T) {
+	_, err := NewDiscovery("not a group", time.Minute)
+	if err == nil {
+		t.Error("expected error for invalid group, got nil")
+	}
+
+	_, err = NewAnnouncer("not a group", time.Second)
+	if err == nil {
+		t.Error("expected error for invalid group, got nil")
+	}
+}
+
+func TestDiscovery_HandleAnnouncement(t *testing.T) {
+	now := time.Now()
+	d := newTestDiscovery(t, &now)
+
+	var discovered []DiscoveredPeer
+	d.OnChange(func(peer DiscoveredPeer, lost bool) {
+		if !lost {
+			discovered = append(discovered, peer)
+		}
+	})
+
+	from := &net.UDPAddr{IP: net.ParseIP("192.168.1.37"), Port: 40000}
+	err := d.handleAnnouncement([]byte(`{"name":"alice","uniqueId":"id-1","port":7665}`), from)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Repeated announcements only refresh the peer
+	err = d.handleAnnouncement([]byte(`{"name":"alice","uniqueId":"id-1","port":7665}`), from)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(discovered) != 1 {
+		t.Fatalf("expected 1 discovered notification, got %d", len(discovered))
+	}
+
+	peers := d.Peers()
+	if len(peers) != 1 {
+		t.Fatalf("expected 1 peer, got %d", len(peers))
+	}
+	if peers[0].Name != "alice" || peers[0].UniqueId != "id-1" {
+		t.Errorf("unexpected peer %+v", peers[0])
+	}
+	if peers[0].Address() != "192.168.1.37:7665" {
+		t.Errorf("expected address 192.168.1.37:7665, got %s", peers[0].Address())
+	}
+}
+
+func TestDiscovery_HandleAnnouncement_Invalid(t *testing.T) {
+	now := time.Now()
+	d := newTestDiscovery(t, &now)
+	from := &net.UDPAddr{IP: net.ParseIP("192.168.1.37"), Port: 40000}
+
+	invalid := []string{
+		`not json`,
+		`{"name":"alice","port":7665}`,
+		`{"name":"alice","uniqueId":"id-1","port":0}`,
+		`{"name":"alice","uniqueId":"id-1","port":70000}`,
+	}
+	for _, data := range invalid {
+		if err := d.handleAnnouncement([]byte(data), from); err == nil {
+			t.Errorf("expected error for announcement %s, got nil", data)
+		}
+	}
+
+	if len(d.Peers()) != 0 {
+		t.Errorf("expected no peers, got %v", d.Peers())
+	}
+}
+
+func TestDiscovery_Expire(t *testing.T) {
+	now := time.Now()
+	d := newTestDiscovery(t, &now)
+
+	var lostPeers []DiscoveredPeer
+	d.OnChange(func(peer DiscoveredPeer, lost bool) {
+		if lost {
+			lostPeers = append(lostPeers, peer)
+		}
+	})
+
+	from := &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 40000}
+	d.handleAnnouncement([]byte(`{"name":"bob","uniqueId":"id-2","port":7665}`), from)
+
+	now = now.Add(30 * time.Second)
+	d.handleAnnouncement([]byte(`{"name":"alice","uniqueId":"id-1","port":7665}`), from)
+
+	peers := d.Peers()
+	if len(peers) != 2 || peers[0].Name != "alice" || peers[1].Name != "bob" {
+		t.Fatalf("expected peers sorted by name, got %v", peers)
+	}
+
+	// bob's announcement becomes too old
+	now = now.Add(45 * time.Second)
+	d.expire()
+
+	if len(lostPeers) != 1 || lostPeers[0].UniqueId != "id-2" {
+		t.Fatalf("expected bob to be lost, got %v", lostPeers)
+	}
+
+	peers = d.Peers()
+	if len(peers) != 1 || peers[0].UniqueId != "id-1" {
+		t.Errorf("expected only alice to remain, got %v", peers)
+	}
+}
+
+func TestDiscovery_Close(t *testing.T) {
+	now := time.Now()
+	d := newTestDiscovery(t, &now)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Run(context.Background())
+	}()
+
+	// Let the listener start, closing it before works as well
+	time.Sleep(50 * time.Millisecond)
+	d.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Run to stop once the discovery is closed")
+	}
+}
@@ -4,22 +4,73 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
 )
 
+const (
+	// MaxHeadersSize limits the encoded size of a header section
+	MaxHeadersSize = 64 << 10 // 64 KiB
+
+	binaryHeadersMagic   byte = 0x00
+	binaryHeadersVersion byte = 0x01
+)
+
+var (
+	ErrHeadersTooLarge = errors.New("headers section is too large")
+)
+
+// Header is a single header entry, a key may appear several times
+type Header struct {
+	Key   string
+	Value string
+}
+
 type Message struct {
-	headers map[string]string
+	headers []Header
 	body    []byte
 }
 
+// NewMessage creates a message, headers are ordered by key to keep the wire output deterministic
 func NewMessage(headers map[string]string, body []byte) *Message {
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	headerList := make([]Header, 0, len(keys))
+	for _, key := range keys {
+		headerList = append(headerList, Header{key, headers[key]})
+	}
+
+	return NewMessageWithHeaders(headerList, body)
+}
+
+// NewMessageWithHeaders creates a message keeping the given header order
+func NewMessageWithHeaders(headers []Header, body []byte) *Message {
 	return &Message{
 		headers: headers,
 		body:    body,
 	}
 }
 
+// Headers returns the headers as a map, only the first value is kept for multi-valued headers
 func (m *Message) Headers() map[string]string {
+	headers := make(map[string]string, len(m.headers))
+	for _, h := range m.headers {
+		if _, exists := headers[h.Key]; !exists {
+			headers[h.Key] = h.Value
+		}
+	}
+
+	return headers
+}
+
+// HeaderList returns all headers in wire order
+func (m *Message) HeaderList() []Header {
 	return m.headers
 }
 
@@ -40,17 +91,62 @@ func (m *Message) BodyTo(v any) error {
 	return nil
 }
 
+// SetHeader replaces all values of the header with a single value
 func (m *Message) SetHeader(key, value string) {
-	m.headers[key] = value
+	for i, h := range m.headers {
+		if h.Key == key {
+			m.headers[i].Value = value
+			m.deleteHeaderFrom(key, i+1)
+
+			return
+		}
+	}
+
+	m.headers = append(m.headers, Header{key, value})
+}
+
+// AddHeader appends a value to the header keeping the existing ones
+func (m *Message) AddHeader(key, value string) {
+	m.headers = append(m.headers, Header{key, value})
 }
 
+// GetHeader returns the first value of the header
 func (m *Message) GetHeader(key string) (string, bool) {
-	value, exists := m.headers[key]
-	return value, exists
+	for _, h := range m.headers {
+		if h.Key == key {
+			return h.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// GetHeaderValues returns all values of the header in wire order
+func (m *Message) GetHeaderValues(key string) []string {
+	var values []string
+	for _, h := range m.headers {
+		if h.Key == key {
+			values = append(values, h.Value)
+		}
+	}
+
+	return values
 }
 
+// DeleteHeader removes all values of the header
 func (m *Message) DeleteHeader(key string) {
-	delete(m.headers, key)
+	m.deleteHeaderFrom(key, 0)
+}
+
+func (m *Message) deleteHeaderFrom(key string, from int) {
+	headers := m.headers[:from]
+	for _, h := range m.headers[from:] {
+		if h.Key != key {
+			headers = append(headers, h)
+		}
+	}
+
+	m.headers = headers
 }
 
 func DeserializeMessage(data []byte) (*Message, error) {
@@ -62,7 +158,13 @@ func DeserializeMessage(data []byte) (*Message, error) {
 	headersSize := binary.LittleEndian.Uint64(data[:8])
 	bodySize := binary.LittleEndian.Uint64(data[8:16])
 
-	if (headersSize + bodySize + 16) > uint64(len(data)) {
+	if headersSize > MaxHeadersSize {
+		return nil, ErrHeadersTooLarge
+	}
+
+	// The sizes are checked one at a time as their sum can overflow
+	available := uint64(len(data) - 16)
+	if headersSize > available || bodySize > available-headersSize {
 		return nil, fmt.Errorf("data is too short for headers and body sizes")
 	}
 
@@ -75,6 +177,9 @@ func DeserializeMessage(data []byte) (*Message, error) {
 
 func SerializeMessage(m *Message) ([]byte, error) {
 	headersData, bodyData := m.toBytes()
+	if len(headersData) > MaxHeadersSize {
+		return nil, ErrHeadersTooLarge
+	}
 
 	var buf bytes.Buffer
 	err := binary.Write(&buf, binary.LittleEndian, uint64(len(headersData)))
@@ -117,8 +222,97 @@ func (m *Message) toBytes() ([]byte, []byte) {
 	return headersData, m.body
 }
 
-func bytesToHeaders(headerData []byte) (map[string]string, error) {
-	headers := make(map[string]string)
+// bytesToHeaders decodes both the binary and the legacy text header encodings
+func bytesToHeaders(headerData []byte) ([]Header, error) {
+	if len(headerData) > 0 && headerData[0] == binaryHeadersMagic {
+		return binaryBytesToHeaders(headerData)
+	}
+
+	return legacyBytesToHeaders(headerData)
+}
+
+// headersToBytes encodes headers as
+// magic (1 byte) | version (1 byte) | count (uvarint) | [key length (uvarint) | key | value length (uvarint) | value]...
+func headersToBytes(headers []Header) []byte {
+	if len(headers) == 0 {
+		return []byte{}
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteByte(binaryHeadersMagic)
+	buffer.WriteByte(binaryHeadersVersion)
+
+	buffer.Write(binary.AppendUvarint(nil, uint64(len(headers))))
+	for _, h := range headers {
+		buffer.Write(binary.AppendUvarint(nil, uint64(len(h.Key))))
+		buffer.WriteString(h.Key)
+		buffer.Write(binary.AppendUvarint(nil, uint64(len(h.Value))))
+		buffer.WriteString(h.Value)
+	}
+
+	return buffer.Bytes()
+}
+
+func binaryBytesToHeaders(headerData []byte) ([]Header, error) {
+	if len(headerData) < 2 {
+		return nil, fmt.Errorf("binary headers are too short")
+	}
+	if headerData[1] != binaryHeadersVersion {
+		return nil, fmt.Errorf("unsupported binary headers version %d", headerData[1])
+	}
+
+	reader := bytes.NewReader(headerData[2:])
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header count: %w", err)
+	}
+
+	// Each header takes at least 2 bytes, reject counts that can't fit
+	if count > uint64(reader.Len())/2 {
+		return nil, fmt.Errorf("invalid header count %d", count)
+	}
+
+	readString := func() (string, error) {
+		size, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return "", err
+		}
+		if size > uint64(reader.Len()) {
+			return "", fmt.Errorf("header field is longer than the data")
+		}
+
+		b := make([]byte, size)
+		if _, err := io.ReadFull(reader, b); err != nil {
+			return "", err
+		}
+
+		return string(b), nil
+	}
+
+	headers := make([]Header, 0, count)
+	for i := uint64(0); i < count; i++ {
+		key, err := readString()
+		if err != nil {
+			return nil, fmt.Errorf("invalid header key: %w", err)
+		}
+		value, err := readString()
+		if err != nil {
+			return nil, fmt.Errorf("invalid header value: %w", err)
+		}
+
+		headers = append(headers, Header{key, value})
+	}
+
+	if reader.Len() != 0 {
+		return nil, fmt.Errorf("unexpected data after headers")
+	}
+
+	return headers, nil
+}
+
+// legacyBytesToHeaders decodes the "key:value\r\n" text encoding used by older versions
+func legacyBytesToHeaders(headerData []byte) ([]Header, error) {
+	headers := make([]Header, 0)
 	lines := bytes.Split(headerData, []byte("\r\n"))
 
 	for _, line := range lines {
@@ -129,21 +323,8 @@ func bytesToHeaders(headerData []byte) (map[string]string, error) {
 		if len(parts) != 2 {
 			return nil, fmt.Errorf("invalid header line: %s", line)
 		}
-		headers[string(parts[0])] = string(parts[1])
+		headers = append(headers, Header{string(parts[0]), string(parts[1])})
 	}
 
 	return headers, nil
 }
-
-func headersToBytes(headers map[string]string) []byte {
-	var buffer bytes.Buffer
-
-	for key, value := range headers {
-		buffer.WriteString(key)
-		buffer.WriteString(":")
-		buffer.WriteString(value)
-		buffer.WriteString("\r\n")
-	}
-
-	return buffer.Bytes()
-}
@@ -3,6 +3,7 @@ package network
 import (
 	"bytes"
 	"encoding/binary"
+	"math"
 	"reflect"
 	"testing"
 )
@@ -135,15 +136,144 @@ func TestToBytes(t *testing.T) {
 	message := NewMessage(headers, body)
 	headersData, bodyData := message.toBytes()
 
-	expectedHeadersData := []byte("Content-Type:application/json\r\nAuthorization:Bearer token\r\n")
-	expectedHeadersDataWithAnotherOrder := []byte("Authorization:Bearer token\r\nContent-Type:application/json\r\n")
-	if !bytes.Equal(headersData, expectedHeadersData) && !bytes.Equal(headersData, expectedHeadersDataWithAnotherOrder) {
-		t.Errorf("expected headers data %s, got %s", expectedHeadersData, headersData)
+	// Headers are ordered by key when created from a map
+	expectedHeadersData := []byte{binaryHeadersMagic, binaryHeadersVersion, 2}
+	expectedHeadersData = append(expectedHeadersData, 13)
+	expectedHeadersData = append(expectedHeadersData, "Authorization"...)
+	expectedHeadersData = append(expectedHeadersData, 12)
+	expectedHeadersData = append(expectedHeadersData, "Bearer token"...)
+	expectedHeadersData = append(expectedHeadersData, 12)
+	expectedHeadersData = append(expectedHeadersData, "Content-Type"...)
+	expectedHeadersData = append(expectedHeadersData, 16)
+	expectedHeadersData = append(expectedHeadersData, "application/json"...)
+	if !bytes.Equal(headersData, expectedHeadersData) {
+		t.Errorf("expected headers data %v, got %v", expectedHeadersData, headersData)
 	}
 
 	if !bytes.Equal(bodyData, body) {
 		t.Errorf("expected body data %s, got %s", body, bodyData)
 	}
+
+	// The same message is always encoded the same way
+	for i := 0; i < 10; i++ {
+		data, _ := NewMessage(headers, body).toBytes()
+		if !bytes.Equal(data, headersData) {
+			t.Fatalf("expected deterministic headers data, got %v and %v", headersData, data)
+		}
+	}
+}
+
+func TestBytesToHeaders_Binary(t *testing.T) {
+	headers := []Header{
+		{"action", "send"},
+		{"value", "line1\r\nline2:with colon"},
+		{"tag", "a"},
+		{"tag", "b"},
+		{"empty", ""},
+	}
+
+	decoded, err := bytesToHeaders(headersToBytes(headers))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, headers) {
+		t.Errorf("expected headers %v, got %v", headers, decoded)
+	}
+}
+
+func TestBytesToHeaders_Invalid(t *testing.T) {
+	valid := headersToBytes([]Header{{"key", "value"}})
+
+	invalid := [][]byte{
+		{binaryHeadersMagic},
+		{binaryHeadersMagic, 0x7f, 0},
+		{binaryHeadersMagic, binaryHeadersVersion, 100, 1, 'a'},
+		valid[:len(valid)-1],
+		append(append([]byte{}, valid...), 'x'),
+		[]byte("no colon here\r\n"),
+	}
+
+	for _, data := range invalid {
+		if _, err := bytesToHeaders(data); err == nil {
+			t.Errorf("expected error for headers data %v, got nil", data)
+		}
+	}
+}
+
+func TestMultiValuedHeaders(t *testing.T) {
+	message := NewMessage(map[string]string{"action": "send"}, nil)
+	message.AddHeader("recipient", "alice")
+	message.AddHeader("recipient", "bob")
+
+	values := message.GetHeaderValues("recipient")
+	if !reflect.DeepEqual(values, []string{"alice", "bob"}) {
+		t.Errorf("expected recipients [alice bob], got %v", values)
+	}
+
+	value, exists := message.GetHeader("recipient")
+	if !exists || value != "alice" {
+		t.Errorf("expected first recipient alice, got %v", value)
+	}
+
+	// Round trip keeps order and duplicates
+	data, err := SerializeMessage(message)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	decoded, err := DeserializeMessage(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.HeaderList(), message.HeaderList()) {
+		t.Errorf("expected headers %v, got %v", message.HeaderList(), decoded.HeaderList())
+	}
+
+	// SetHeader collapses the values into one
+	message.SetHeader("recipient", "carol")
+	values = message.GetHeaderValues("recipient")
+	if !reflect.DeepEqual(values, []string{"carol"}) {
+		t.Errorf("expected recipients [carol], got %v", values)
+	}
+
+	message.DeleteHeader("recipient")
+	if values := message.GetHeaderValues("recipient"); len(values) != 0 {
+		t.Errorf("expected no recipients, got %v", values)
+	}
+}
+
+func TestSerializeMessage_HeadersTooLarge(t *testing.T) {
+	message := NewMessage(map[string]string{
+		"large": string(make([]byte, MaxHeadersSize)),
+	}, nil)
+
+	_, err := SerializeMessage(message)
+	if err != ErrHeadersTooLarge {
+		t.Errorf("expected ErrHeadersTooLarge, got %v", err)
+	}
+
+	// Oversized header sections are rejected on read as well
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint64(MaxHeadersSize+1))
+	binary.Write(&buf, binary.LittleEndian, uint64(0))
+	buf.Write(make([]byte, MaxHeadersSize+1))
+
+	_, err = DeserializeMessage(buf.Bytes())
+	if err != ErrHeadersTooLarge {
+		t.Errorf("expected ErrHeadersTooLarge, got %v", err)
+	}
+}
+
+func TestDeserializeMessage_OverflowingSizes(t *testing.T) {
+	// The sum of the sizes wraps around to fit the data
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint64(8))
+	binary.Write(&buf, binary.LittleEndian, uint64(math.MaxUint64-15))
+	buf.Write(make([]byte, 8))
+
+	if _, err := DeserializeMessage(buf.Bytes()); err == nil {
+		t.Error("expected error for overflowing sizes, got nil")
+	}
 }
 
 func TestDeserializeMessage(t *testing.T) {
@@ -154,7 +284,7 @@ func TestDeserializeMessage(t *testing.T) {
 	}
 	body := []byte(`{"key":"value"}`)
 
-	headersData := headersToBytes(headers)
+	headersData := headersToBytes(NewMessage(headers, nil).HeaderList())
 	headersSize := uint64(len(headersData))
 	bodySize := uint64(len(body))
 
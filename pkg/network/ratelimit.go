@@ -0,0 +1,71 @@
+package network
+
+import (
+	"net"
+	"time"
+)
+
+// TokenBucket allows bursts up to its capacity and refills at a constant rate.
+// It is not safe for concurrent use, callers keep it under their own lock.
+type TokenBucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewTokenBucket creates a full bucket refilling rate tokens per second
+func NewTokenBucket(rate float64, capacity int, now time.Time) *TokenBucket {
+	return &TokenBucket{
+		rate,
+		float64(capacity),
+		float64(capacity),
+		now,
+	}
+}
+
+// Allow takes a token if one is available at the given time
+func (b *TokenBucket) Allow(now time.Time) bool {
+	b.refill(now)
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
+
+// Full reports whether the bucket has refilled completely, full buckets can be forgotten
+func (b *TokenBucket) Full(now time.Time) bool {
+	b.refill(now)
+
+	return b.tokens >= b.capacity
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	b.tokens = min(b.capacity, b.tokens+elapsed*b.rate)
+	b.last = now
+}
+
+// RemoteHost returns the IP address of the peer or empty string if it's unknown
+func RemoteHost(conn BasicConn) string {
+	withAddr, ok := conn.(interface{ RemoteAddr() net.Addr })
+	if !ok || withAddr.RemoteAddr() == nil {
+		return ""
+	}
+
+	address := withAddr.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+
+	return host
+}
@@ -0,0 +1,60 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	bucket := NewTokenBucket(2, 3, now)
+
+	// The burst is allowed at once
+	for i := 0; i < 3; i++ {
+		if !bucket.Allow(now) {
+			t.Fatalf("expected token %d to be allowed", i)
+		}
+	}
+	if bucket.Allow(now) {
+		t.Error("expected empty bucket to refuse")
+	}
+
+	// Two tokens per second
+	now = now.Add(500 * time.Millisecond)
+	if !bucket.Allow(now) {
+		t.Error("expected refilled token to be allowed")
+	}
+	if bucket.Allow(now) {
+		t.Error("expected bucket to be empty again")
+	}
+
+	if bucket.Full(now) {
+		t.Error("expected bucket not to be full")
+	}
+	if !bucket.Full(now.Add(time.Hour)) {
+		t.Error("expected bucket to be full after a long pause")
+	}
+}
+
+func TestRemoteHost(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c.Close()
+
+	if host := RemoteHost(c); host != "127.0.0.1" {
+		t.Errorf("expected 127.0.0.1, got %s", host)
+	}
+
+	if host := RemoteHost(NewMockBasicConn(t)); host != "" {
+		t.Errorf("expected empty host for connection without address, got %s", host)
+	}
+}
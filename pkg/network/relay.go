@@ -0,0 +1,455 @@
+package network
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Relay protocol actions
+const (
+	relayActionRegister   = "relay_register"
+	relayActionRegistered = "relay_registered"
+	relayActionConnect    = "relay_connect"
+	relayActionIncoming   = "relay_incoming"
+	relayActionAccept     = "relay_accept"
+	relayActionConnected  = "relay_connected"
+	relayActionError      = "relay_error"
+)
+
+var (
+	ErrRelayPeerNotRegistered = errors.New("relay peer is not registered")
+	ErrRelaySessionNotFound   = errors.New("relay session not found")
+	ErrRelayAcceptTimeout     = errors.New("relay peer did not accept in time")
+	ErrRelayUnexpectedMessage = errors.New("unexpected relay message")
+	ErrRelayAlreadyRegistered = errors.New("relay peer is already registered")
+)
+
+// relayErrors are the errors the relay reports to the clients
+var relayErrors = []error{
+	ErrRelayPeerNotRegistered,
+	ErrRelaySessionNotFound,
+	ErrRelayAcceptTimeout,
+	ErrRelayUnexpectedMessage,
+	ErrRelayAlreadyRegistered,
+}
+
+const (
+	// How long the client waits for the relay to answer a request
+	relayRequestTimeout = 10 * time.Second
+	// How long the client waits for a relayed connection, the peer has to accept it meanwhile
+	relayDialTimeout = time.Minute
+	// How long the relay waits for the first message of a new connection
+	relayFirstMessageTimeout = 10 * time.Second
+)
+
+// relayPeer is a registered peer with its control connection
+type relayPeer struct {
+	conn *Conn
+}
+
+// relaySession is a pending relayed connection waiting for the target peer,
+// the accepting connection is handed over while the session is removed, so it's either paired or timed out
+type relaySession struct {
+	fromUserId string
+	paired     chan *Conn
+}
+
+// Relay pipes opaque frames between two peers which can't reach each other directly.
+// Peers register their user id over a control connection and get notified about
+// incoming sessions, then open a new connection to accept each of them.
+type Relay struct {
+	listener      *Listener
+	acceptTimeout time.Duration
+
+	mu       sync.Mutex
+	peers    map[string]*relayPeer
+	sessions map[string]*relaySession
+}
+
+func NewRelay(listener *Listener, acceptTimeout time.Duration) *Relay {
+	return &Relay{
+		listener,
+		acceptTimeout,
+		sync.Mutex{},
+		make(map[string]*relayPeer),
+		make(map[string]*relaySession),
+	}
+}
+
+// Serve accepts connections until the context is done or the listener is closed
+func (r *Relay) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		r.Close()
+	}()
+
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || IsClosedError(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		go r.handle(ctx, conn)
+	}
+}
+
+func (r *Relay) Close() error {
+	r.mu.Lock()
+	for userId, peer := range r.peers {
+		peer.conn.Close()
+		delete(r.peers, userId)
+	}
+	r.mu.Unlock()
+
+	return r.listener.Close()
+}
+
+func (r *Relay) handle(ctx context.Context, conn *Conn) {
+	// Idle connections don't hold the relay
+	conn.SetDeadline(time.Now().Add(relayFirstMessageTimeout))
+
+	msg, err := conn.Read()
+	if err != nil {
+		conn.Close()
+
+		return
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	switch msg.Headers()["action"] {
+	case relayActionRegister:
+		r.handleRegister(conn, msg.Headers()["userId"])
+	case relayActionConnect:
+		r.handleConnect(ctx, conn, msg.Headers()["userId"], msg.Headers()["target"])
+	case relayActionAccept:
+		r.handleAccept(conn, msg.Headers()["session"])
+	default:
+		writeRelayError(conn, ErrRelayUnexpectedMessage)
+		conn.Close()
+	}
+}
+
+func (r *Relay) handleRegister(conn *Conn, userId string) {
+	defer conn.Close()
+
+	if userId == "" {
+		writeRelayError(conn, fmt.Errorf("user id is required"))
+
+		return
+	}
+
+	peer := &relayPeer{conn: conn}
+
+	r.mu.Lock()
+	if _, ok := r.peers[userId]; ok {
+		// The first registration is kept while it's live, otherwise anyone could take over the user id
+		r.mu.Unlock()
+		writeRelayError(conn, ErrRelayAlreadyRegistered)
+
+		return
+	}
+	r.peers[userId] = peer
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.peers[userId] == peer {
+			delete(r.peers, userId)
+		}
+	}()
+
+	err := peer.conn.Write(NewMessage(map[string]string{
+		"action": relayActionRegistered,
+	}, nil))
+	if err != nil {
+		return
+	}
+
+	// Keep the registration until the peer goes away
+	for {
+		if _, err := conn.Read(); err != nil {
+			return
+		}
+	}
+}
+
+func (r *Relay) handleConnect(ctx context.Context, conn *Conn, fromUserId string, targetUserId string) {
+	r.mu.Lock()
+	peer, ok := r.peers[targetUserId]
+	r.mu.Unlock()
+
+	if !ok {
+		writeRelayError(conn, ErrRelayPeerNotRegistered)
+		conn.Close()
+
+		return
+	}
+
+	sessionId, err := generateSessionId()
+	if err != nil {
+		writeRelayError(conn, err)
+		conn.Close()
+
+		return
+	}
+
+	session := &relaySession{fromUserId, make(chan *Conn, 1)}
+	r.mu.Lock()
+	r.sessions[sessionId] = session
+	r.mu.Unlock()
+
+	removeSession := func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		delete(r.sessions, sessionId)
+	}
+
+	// Notify the target peer about the incoming session
+	err = peer.conn.Write(NewMessage(map[string]string{
+		"action":  relayActionIncoming,
+		"session": sessionId,
+		"userId":  fromUserId,
+	}, nil))
+	if err != nil {
+		removeSession()
+		writeRelayError(conn, ErrRelayPeerNotRegistered)
+		conn.Close()
+
+		return
+	}
+
+	timer := time.NewTimer(r.acceptTimeout)
+	defer timer.Stop()
+
+	var peerConn *Conn
+	select {
+	case peerConn = <-session.paired:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	if peerConn == nil {
+		r.mu.Lock()
+		_, pending := r.sessions[sessionId]
+		delete(r.sessions, sessionId)
+		r.mu.Unlock()
+
+		// The peer has accepted just in time, its connection is handed over already
+		if !pending {
+			peerConn = <-session.paired
+		}
+	}
+
+	if peerConn == nil {
+		writeRelayError(conn, ErrRelayAcceptTimeout)
+		conn.Close()
+
+		return
+	}
+
+	err = peerConn.Write(NewMessage(map[string]string{
+		"action": relayActionConnected,
+		"userId": fromUserId,
+	}, nil))
+	if err == nil {
+		err = conn.Write(NewMessage(map[string]string{
+			"action": relayActionConnected,
+		}, nil))
+	}
+	if err != nil {
+		conn.Close()
+		peerConn.Close()
+
+		return
+	}
+
+	relayPipe(conn.Conn(), peerConn.Conn())
+}
+
+func (r *Relay) handleAccept(conn *Conn, sessionId string) {
+	r.mu.Lock()
+	session, ok := r.sessions[sessionId]
+	if ok {
+		// Hand over the connection to the dialer side which answers both peers and does the piping
+		delete(r.sessions, sessionId)
+		session.paired <- conn
+	}
+	r.mu.Unlock()
+
+	if !ok {
+		writeRelayError(conn, ErrRelaySessionNotFound)
+		conn.Close()
+	}
+}
+
+// relayPipe copies raw bytes in both directions until one of the sides is closed
+func relayPipe(a BasicConn, b BasicConn) {
+	done := make(chan struct{}, 2)
+	pipe := func(dst BasicConn, src BasicConn) {
+		io.Copy(dst, src)
+		done <- struct{}{}
+	}
+
+	go pipe(a, b)
+	go pipe(b, a)
+
+	<-done
+	a.Close()
+	b.Close()
+	<-done
+}
+
+func writeRelayError(conn *Conn, err error) {
+	conn.Write(NewMessage(map[string]string{
+		"action": relayActionError,
+		"error":  err.Error(),
+	}, nil))
+}
+
+func generateSessionId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// RelayIncoming is a notification about a peer which wants to connect through the relay
+type RelayIncoming struct {
+	SessionId  string
+	PeerUserId string
+}
+
+// RelayRegistration is a control connection to the relay for a registered user
+type RelayRegistration struct {
+	conn *Conn
+}
+
+// Next blocks until the relay announces the next incoming session
+func (r *RelayRegistration) Next() (*RelayIncoming, error) {
+	for {
+		msg, err := r.conn.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		if msg.Headers()["action"] != relayActionIncoming {
+			continue
+		}
+
+		return &RelayIncoming{msg.Headers()["session"], msg.Headers()["userId"]}, nil
+	}
+}
+
+func (r *RelayRegistration) Close() error {
+	return r.conn.Close()
+}
+
+// RelayClient talks to a relay on behalf of a user
+type RelayClient struct {
+	transport Transport
+	address   string
+}
+
+func NewRelayClient(transport Transport, address string) *RelayClient {
+	return &RelayClient{transport, address}
+}
+
+func (c *RelayClient) Address() string {
+	return c.address
+}
+
+// Register registers the user on the relay to receive incoming sessions
+func (c *RelayClient) Register(userId string) (*RelayRegistration, error) {
+	conn, err := c.request(NewMessage(map[string]string{
+		"action": relayActionRegister,
+		"userId": userId,
+	}, nil), relayActionRegistered, relayRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RelayRegistration{conn}, nil
+}
+
+// Dial opens a relayed connection to the target user
+func (c *RelayClient) Dial(userId string, targetUserId string) (*Conn, error) {
+	return c.request(NewMessage(map[string]string{
+		"action": relayActionConnect,
+		"userId": userId,
+		"target": targetUserId,
+	}, nil), relayActionConnected, relayDialTimeout)
+}
+
+// Accept opens a connection for the incoming session announced by the relay
+func (c *RelayClient) Accept(sessionId string) (*Conn, error) {
+	return c.request(NewMessage(map[string]string{
+		"action":  relayActionAccept,
+		"session": sessionId,
+	}, nil), relayActionConnected, relayRequestTimeout)
+}
+
+func (c *RelayClient) request(m *Message, expectedAction string, timeout time.Duration) (*Conn, error) {
+	conn, err := c.transport.Connect(c.address)
+	if err != nil {
+		return nil, err
+	}
+
+	// The relay must answer in time, the deadline is cleared once it does
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	err = conn.Write(m)
+	if err != nil {
+		conn.Close()
+
+		return nil, err
+	}
+
+	msg, err := conn.Read()
+	if err != nil {
+		conn.Close()
+
+		return nil, err
+	}
+
+	switch msg.Headers()["action"] {
+	case expectedAction:
+		conn.SetDeadline(time.Time{})
+
+		return conn, nil
+	case relayActionError:
+		conn.Close()
+
+		return nil, relayError(msg.Headers()["error"])
+	default:
+		conn.Close()
+
+		return nil, ErrRelayUnexpectedMessage
+	}
+}
+
+// relayError restores the error reported by the relay
+func relayError(message string) error {
+	for _, err := range relayErrors {
+		if err.Error() == message {
+			return fmt.Errorf("relay error: %w", err)
+		}
+	}
+
+	return fmt.Errorf("relay error: %s", message)
+}
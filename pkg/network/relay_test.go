@@ -0,0 +1,207 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func startTestRelay(t *testing.T, acceptTimeout time.Duration) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	relay := NewRelay(NewListener(&basicListenerWrapper{l}), acceptTimeout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go relay.Serve(ctx)
+
+	return l.Addr().String()
+}
+
+func TestRelay_DialAndAccept(t *testing.T) {
+	address := startTestRelay(t, time.Second)
+	client := NewRelayClient(NewTcpTransport(), address)
+
+	registration, err := client.Register("alice")
+	if err != nil {
+		t.Fatalf("expected no error on register, got %v", err)
+	}
+	defer registration.Close()
+
+	type dialResult struct {
+		conn *Conn
+		err  error
+	}
+	dialed := make(chan dialResult, 1)
+	go func() {
+		conn, err := client.Dial("bob", "alice")
+		dialed <- dialResult{conn, err}
+	}()
+
+	incoming, err := registration.Next()
+	if err != nil {
+		t.Fatalf("expected incoming session, got %v", err)
+	}
+	if incoming.PeerUserId != "bob" {
+		t.Errorf("expected peer user id 'bob', got '%s'", incoming.PeerUserId)
+	}
+
+	aliceConn, err := client.Accept(incoming.SessionId)
+	if err != nil {
+		t.Fatalf("expected no error on accept, got %v", err)
+	}
+	defer aliceConn.Close()
+
+	result := <-dialed
+	if result.err != nil {
+		t.Fatalf("expected no error on dial, got %v", result.err)
+	}
+	bobConn := result.conn
+	defer bobConn.Close()
+
+	// Frames are piped in both directions
+	err = bobConn.Write(NewMessage(map[string]string{"action": "ping"}, []byte("hello")))
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	msg, err := aliceConn.Read()
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if msg.Headers()["action"] != "ping" || string(msg.Body()) != "hello" {
+		t.Errorf("unexpected message %v %s", msg.Headers(), msg.Body())
+	}
+
+	err = aliceConn.Write(NewMessage(map[string]string{"action": "pong"}, nil))
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	msg, err = bobConn.Read()
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if msg.Headers()["action"] != "pong" {
+		t.Errorf("expected 'pong', got %v", msg.Headers())
+	}
+}
+
+func TestRelay_DialUnregisteredPeer(t *testing.T) {
+	address := startTestRelay(t, time.Second)
+	client := NewRelayClient(NewTcpTransport(), address)
+
+	conn, err := client.Dial("bob", "nobody")
+	if err == nil {
+		conn.Close()
+		t.Fatal("expected error for unregistered peer, got nil")
+	}
+}
+
+func TestRelay_DuplicateRegistration(t *testing.T) {
+	address := startTestRelay(t, time.Second)
+	client := NewRelayClient(NewTcpTransport(), address)
+
+	registration, err := client.Register("alice")
+	if err != nil {
+		t.Fatalf("expected no error on register, got %v", err)
+	}
+
+	// The live registration isn't taken over
+	if duplicate, err := client.Register("alice"); !errors.Is(err, ErrRelayAlreadyRegistered) {
+		if duplicate != nil {
+			duplicate.Close()
+		}
+		t.Fatalf("expected ErrRelayAlreadyRegistered, got %v", err)
+	}
+
+	// The user id is free again once the first registration is gone
+	registration.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		registration, err = client.Register("alice")
+		if err == nil {
+			registration.Close()
+
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the user to register again, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRelay_AcceptTimeout(t *testing.T) {
+	address := startTestRelay(t, 50*time.Millisecond)
+	client := NewRelayClient(NewTcpTransport(), address)
+
+	registration, err := client.Register("alice")
+	if err != nil {
+		t.Fatalf("expected no error on register, got %v", err)
+	}
+	defer registration.Close()
+
+	conn, err := client.Dial("bob", "alice")
+	if err == nil {
+		conn.Close()
+		t.Fatal("expected error when peer does not accept, got nil")
+	}
+}
+
+func TestRelay_AcceptUnknownSession(t *testing.T) {
+	address := startTestRelay(t, time.Second)
+	client := NewRelayClient(NewTcpTransport(), address)
+
+	conn, err := client.Accept("unknown")
+	if err == nil {
+		conn.Close()
+		t.Fatal("expected error for unknown session, got nil")
+	}
+}
+
+func TestRelay_AcceptAtTimeout(t *testing.T) {
+	address := startTestRelay(t, 10*time.Millisecond)
+	client := NewRelayClient(NewTcpTransport(), address)
+
+	registration, err := client.Register("alice")
+	if err != nil {
+		t.Fatalf("expected no error on register, got %v", err)
+	}
+	defer registration.Close()
+
+	// Accepting around the timeout either pairs both sides or fails both of them
+	for i := 0; i < 20; i++ {
+		dialed := make(chan error, 1)
+		go func() {
+			conn, err := client.Dial("bob", "alice")
+			if err == nil {
+				conn.Close()
+			}
+			dialed <- err
+		}()
+
+		incoming, err := registration.Next()
+		if err != nil {
+			t.Fatalf("expected incoming session, got %v", err)
+		}
+
+		time.Sleep(time.Duration(i) * time.Millisecond)
+
+		conn, acceptErr := client.Accept(incoming.SessionId)
+		if acceptErr == nil {
+			conn.Close()
+		}
+
+		if dialErr := <-dialed; (dialErr == nil) != (acceptErr == nil) {
+			t.Errorf("expected both sides to agree, got dial error %v and accept error %v", dialErr, acceptErr)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package network
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MessageHandler handles a raw message
+type MessageHandler func(msg *Message) error
+
+// Router dispatches incoming messages to handlers by action
+type Router struct {
+	codec *Codec
+
+	mu       sync.RWMutex
+	handlers map[string]func(payload any, msg *Message) error
+	fallback MessageHandler
+}
+
+func NewRouter(codec *Codec) *Router {
+	return &Router{
+		codec,
+		sync.RWMutex{},
+		make(map[string]func(payload any, msg *Message) error),
+		nil,
+	}
+}
+
+// Codec returns the codec used by the router
+func (r *Router) Codec() *Codec {
+	return r.codec
+}
+
+// HandleAction registers the payload type T for the action and its handler
+func HandleAction[T any](r *Router, action string, handler func(payload *T, msg *Message) error) error {
+	if err := RegisterAction[T](r.codec, action); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.handlers[action]; exists {
+		return fmt.Errorf("handler for action %s already exists", action)
+	}
+
+	r.handlers[action] = func(payload any, msg *Message) error {
+		return handler(payload.(*T), msg)
+	}
+
+	return nil
+}
+
+// Fallback sets the handler for messages without a registered handler
+func (r *Router) Fallback(handler MessageHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.fallback = handler
+}
+
+// Dispatch routes the message to the handler of its action
+func (r *Router) Dispatch(msg *Message) error {
+	action := ActionOf(msg)
+
+	r.mu.RLock()
+	handler, ok := r.handlers[action]
+	fallback := r.fallback
+	r.mu.RUnlock()
+
+	if !ok {
+		if fallback == nil {
+			return fmt.Errorf("%w: %s", ErrUnknownAction, action)
+		}
+
+		return fallback(msg)
+	}
+
+	_, payload, err := r.codec.Decode(msg)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %w", action, err)
+	}
+
+	return handler(payload, msg)
+}
@@ -0,0 +1,275 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// CorrelationIdHeader identifies a request
+	CorrelationIdHeader = "correlation-id"
+	// ReplyToHeader marks a message as the response to the request with the same correlation id
+	ReplyToHeader = "reply-to"
+
+	// DefaultCallTimeout is used for calls whose context has no deadline
+	DefaultCallTimeout = 10 * time.Second
+
+	// DefaultMaxConcurrentRequests limits the requests of the peer served at once
+	DefaultMaxConcurrentRequests = 16
+)
+
+var (
+	ErrRpcClosed           = errors.New("rpc connection is closed")
+	ErrMissingCorrelation  = errors.New("message has no correlation id")
+	ErrUnexpectedRpcAnswer = errors.New("response does not match any pending call")
+)
+
+// RpcConn adds request/response calls on top of a message connection whose writes
+// are safe for concurrent use.
+// A background reader started with Run routes responses to the pending calls
+// and passes every other message to the handler, so both peers can issue
+// calls concurrently on the same connection.
+type RpcConn struct {
+	conn    AdvancedConn
+	handler MessageHandler
+	nextId  atomic.Uint64
+
+	mu           sync.Mutex
+	pending      map[string]chan *Message
+	closed       bool
+	errorHandler func(err error)
+
+	// Slots of the requests being served, the reader waits for a free one
+	requests chan struct{}
+}
+
+func NewRpcConn(conn AdvancedConn, handler MessageHandler) *RpcConn {
+	return &RpcConn{
+		conn,
+		handler,
+		atomic.Uint64{},
+		sync.Mutex{},
+		make(map[string]chan *Message),
+		false,
+		nil,
+		make(chan struct{}, DefaultMaxConcurrentRequests),
+	}
+}
+
+// SetMaxConcurrentRequests limits the requests of the peer served at once, it must be called before Run
+func (c *RpcConn) SetMaxConcurrentRequests(limit int) {
+	c.requests = make(chan struct{}, max(limit, 1))
+}
+
+// OnReadError sets the handler for read and handler errors which don't close the connection
+func (c *RpcConn) OnReadError(handler func(err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.errorHandler = handler
+}
+
+// Run reads messages until the connection is closed or fails.
+// Messages which can't be decoded are reported and skipped, a transport error
+// closes the connection and is returned.
+// Unsolicited messages are handled on the reader goroutine, so their handler
+// must not wait for a Call on the same connection.
+func (c *RpcConn) Run() error {
+	defer c.failPending()
+
+	for {
+		msg, err := c.conn.Read()
+		if err != nil {
+			if IsClosedError(err) || errors.Is(err, io.ErrUnexpectedEOF) || c.isClosed() {
+				return nil
+			}
+
+			var decodeErr *DecodeError
+			if errors.As(err, &decodeErr) {
+				c.reportError(err)
+
+				continue
+			}
+
+			c.Close()
+
+			return err
+		}
+
+		if replyTo, ok := msg.GetHeader(ReplyToHeader); ok {
+			if !c.resolve(replyTo, msg) {
+				c.reportError(ErrUnexpectedRpcAnswer)
+			}
+
+			continue
+		}
+
+		if c.handler == nil {
+			continue
+		}
+
+		// Requests are served concurrently so a slow reply never blocks the reader,
+		// other messages keep their order.
+		// Once all slots are taken the reader waits, so a peer pipelining requests is slowed down
+		if _, ok := msg.GetHeader(CorrelationIdHeader); ok {
+			c.requests <- struct{}{}
+			go func() {
+				defer func() { <-c.requests }()
+
+				c.handle(msg)
+			}()
+
+			continue
+		}
+
+		c.handle(msg)
+	}
+}
+
+func (c *RpcConn) handle(msg *Message) {
+	if err := c.handler(msg); err != nil {
+		c.reportError(err)
+	}
+}
+
+// Call sends the request and waits for the matching response.
+// DefaultCallTimeout applies when the context has no deadline.
+func (c *RpcConn) Call(ctx context.Context, request *Message) (*Message, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultCallTimeout)
+		defer cancel()
+	}
+
+	id := strconv.FormatUint(c.nextId.Add(1), 10)
+	responses := make(chan *Message, 1)
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+
+		return nil, ErrRpcClosed
+	}
+	c.pending[id] = responses
+	c.mu.Unlock()
+
+	defer c.removePending(id)
+
+	request.SetHeader(CorrelationIdHeader, id)
+	if err := c.WriteContext(ctx, request); err != nil {
+		return nil, err
+	}
+
+	select {
+	case response, ok := <-responses:
+		if !ok {
+			return nil, ErrRpcClosed
+		}
+
+		return response, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Reply sends the response to the request received by the handler
+func (c *RpcConn) Reply(request *Message, response *Message) error {
+	id, ok := request.GetHeader(CorrelationIdHeader)
+	if !ok {
+		return ErrMissingCorrelation
+	}
+
+	response.SetHeader(ReplyToHeader, id)
+
+	return c.Write(response)
+}
+
+// Write sends a message which doesn't expect a response
+func (c *RpcConn) Write(m *Message) error {
+	return c.conn.Write(m)
+}
+
+// WriteContext sends a message unless the context is done first,
+// the context is only honored when the underlying connection supports it
+func (c *RpcConn) WriteContext(ctx context.Context, m *Message) error {
+	if cw, ok := c.conn.(ContextWriter); ok {
+		return cw.WriteContext(ctx, m)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return c.conn.Write(m)
+}
+
+func (c *RpcConn) Conn() BasicConn {
+	return c.conn.Conn()
+}
+
+// Close closes the underlying connection and fails the pending calls
+func (c *RpcConn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	c.failPending()
+
+	return c.conn.Close()
+}
+
+func (c *RpcConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closed
+}
+
+func (c *RpcConn) resolve(id string, response *Message) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	responses, ok := c.pending[id]
+	if !ok {
+		// The caller may have given up already
+		return false
+	}
+
+	delete(c.pending, id)
+	responses <- response
+
+	return true
+}
+
+func (c *RpcConn) removePending(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pending, id)
+}
+
+func (c *RpcConn) failPending() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	for id, responses := range c.pending {
+		close(responses)
+		delete(c.pending, id)
+	}
+}
+
+func (c *RpcConn) reportError(err error) {
+	c.mu.Lock()
+	handler := c.errorHandler
+	c.mu.Unlock()
+
+	if handler != nil {
+		handler(err)
+	}
+}
@@ -0,0 +1,233 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestRpcPair returns two connected rpc connections answering "echo" requests
+func newTestRpcPair(t *testing.T, unsolicited chan<- *Message) (*RpcConn, *RpcConn) {
+	c1, c2 := net.Pipe()
+
+	newPeer := func(c net.Conn) *RpcConn {
+		var rpc *RpcConn
+		rpc = NewRpcConn(NewConn(c), func(msg *Message) error {
+			if ActionOf(msg) == "echo" {
+				return rpc.Reply(msg, NewMessage(map[string]string{"action": "echoed"}, msg.Body()))
+			}
+
+			if unsolicited != nil {
+				unsolicited <- msg
+			}
+
+			return nil
+		})
+		go rpc.Run()
+
+		return rpc
+	}
+
+	a, b := newPeer(c1), newPeer(c2)
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+
+	return a, b
+}
+
+func TestRpcConn_ConcurrentCalls(t *testing.T) {
+	a, b := newTestRpcPair(t, nil)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		for _, caller := range []*RpcConn{a, b} {
+			wg.Add(1)
+			go func(caller *RpcConn, i int) {
+				defer wg.Done()
+
+				body := fmt.Sprintf("call-%d", i)
+				response, err := caller.Call(context.Background(), NewMessage(map[string]string{"action": "echo"}, []byte(body)))
+				if err != nil {
+					errs <- err
+
+					return
+				}
+
+				if string(response.Body()) != body {
+					errs <- fmt.Errorf("expected response %s, got %s", body, response.Body())
+				}
+			}(caller, i)
+		}
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestRpcConn_UnsolicitedMessages(t *testing.T) {
+	unsolicited := make(chan *Message, 1)
+	a, _ := newTestRpcPair(t, unsolicited)
+
+	err := a.Write(NewMessage(map[string]string{"action": "receipt"}, nil))
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	select {
+	case msg := <-unsolicited:
+		if ActionOf(msg) != "receipt" {
+			t.Errorf("expected receipt, got %s", ActionOf(msg))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected unsolicited message to reach the handler")
+	}
+}
+
+func TestRpcConn_CallTimeout(t *testing.T) {
+	unsolicited := make(chan *Message, 1)
+	a, _ := newTestRpcPair(t, unsolicited)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Nobody answers this action
+	_, err := a.Call(ctx, NewMessage(map[string]string{"action": "ignored"}, nil))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestRpcConn_CallAfterClose(t *testing.T) {
+	a, _ := newTestRpcPair(t, nil)
+	a.Close()
+
+	_, err := a.Call(context.Background(), NewMessage(map[string]string{"action": "echo"}, nil))
+	if !errors.Is(err, ErrRpcClosed) {
+		t.Errorf("expected ErrRpcClosed, got %v", err)
+	}
+}
+
+func TestRpcConn_ReplyWithoutCorrelation(t *testing.T) {
+	a, _ := newTestRpcPair(t, nil)
+
+	err := a.Reply(NewMessage(map[string]string{"action": "echo"}, nil), NewMessage(nil, nil))
+	if !errors.Is(err, ErrMissingCorrelation) {
+		t.Errorf("expected ErrMissingCorrelation, got %v", err)
+	}
+}
+
+func TestRpcConn_ReadErrors(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+
+	unsolicited := make(chan *Message, 1)
+	decodeErrors := make(chan error, 1)
+	rpc := NewRpcConn(NewConn(c2), func(msg *Message) error {
+		unsolicited <- msg
+
+		return nil
+	})
+	rpc.OnReadError(func(err error) {
+		decodeErrors <- err
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- rpc.Run()
+	}()
+
+	// A frame which can't be decoded is skipped
+	peer := NewConn(c1)
+	if err := peer.WriteFrame([]byte("garbage")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if err := peer.Write(NewMessage(map[string]string{"action": "receipt"}, nil)); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	var decodeErr *DecodeError
+	if err := <-decodeErrors; !errors.As(err, &decodeErr) {
+		t.Errorf("expected DecodeError, got %v", err)
+	}
+	if msg := <-unsolicited; ActionOf(msg) != "receipt" {
+		t.Errorf("expected receipt, got %s", ActionOf(msg))
+	}
+
+	// A transport error stops the reader and closes the connection
+	c2.SetReadDeadline(time.Now())
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected the transport error, got nil")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the reader to stop")
+	}
+	if !rpc.isClosed() {
+		t.Error("expected the connection to be closed")
+	}
+}
+
+func TestRpcConn_ConcurrentRequestsLimit(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+
+	var active, peak atomic.Int32
+	release := make(chan struct{})
+	handled := make(chan struct{}, 4)
+	rpc := NewRpcConn(NewConn(c2), func(msg *Message) error {
+		if n := active.Add(1); n > peak.Load() {
+			peak.Store(n)
+		}
+		<-release
+		active.Add(-1)
+		handled <- struct{}{}
+
+		return nil
+	})
+	rpc.SetMaxConcurrentRequests(2)
+	defer rpc.Close()
+	go rpc.Run()
+
+	// The peer pipelines more requests than the connection serves at once
+	peer := NewConn(c1)
+	go func() {
+		for i := 0; i < 4; i++ {
+			request := NewMessage(map[string]string{"action": "slow"}, nil)
+			request.SetHeader(CorrelationIdHeader, fmt.Sprint(i))
+			if err := peer.Write(request); err != nil {
+				return
+			}
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if n := active.Load(); n != 2 {
+		t.Errorf("expected 2 requests to be served, got %d", n)
+	}
+
+	close(release)
+	for i := 0; i < 4; i++ {
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Fatalf("expected request %d to be served", i)
+		}
+	}
+
+	if n := peak.Load(); n > 2 {
+		t.Errorf("expected at most 2 requests at once, got %d", n)
+	}
+}
@@ -1,17 +1,31 @@
 package network
 
+import "context"
+
 type SecureComponent interface {
 	Encrypt(data []byte) ([]byte, error)
 	Decrypt(data []byte) ([]byte, error)
 }
 
+// SecureConn is an encrypted message connection, writes are safe for concurrent use
 type SecureConn struct {
-	conn Conn
+	conn *Conn
 	sc   SecureComponent
+
+	// Compression negotiated with the peer
+	compression          CompressionCodec
+	compressionThreshold int
+}
+
+func NewSecureConn(conn *Conn, sc SecureComponent) *SecureConn {
+	return &SecureConn{conn, sc, CompressionNone, 0}
 }
 
-func NewSecureConn(conn Conn, sc SecureComponent) *SecureConn {
-	return &SecureConn{conn, sc}
+// EnableCompression switches to compressed framing, both peers must enable it at the same point
+// and before the connection is shared between goroutines
+func (c *SecureConn) EnableCompression(codec CompressionCodec, threshold int) {
+	c.compression = codec
+	c.compressionThreshold = threshold
 }
 
 func (c *SecureConn) Conn() BasicConn {
@@ -28,20 +42,46 @@ func (c *SecureConn) Read() (*Message, error) {
 	// Decrypt the message
 	messageData, err := c.sc.Decrypt(encryptedMessageData)
 	if err != nil {
-		return nil, err
+		return nil, &DecodeError{err}
+	}
+
+	// Decompress the message
+	if c.compression != CompressionNone {
+		messageData, err = decompressFrame(messageData)
+		if err != nil {
+			return nil, &DecodeError{err}
+		}
 	}
 
 	// Deserialize the message
-	return DeserializeMessage(messageData)
+	m, err := DeserializeMessage(messageData)
+	if err != nil {
+		return nil, &DecodeError{err}
+	}
+
+	return m, nil
 }
 
 func (c *SecureConn) Write(m *Message) error {
+	return c.WriteContext(context.Background(), m)
+}
+
+// WriteContext writes the message unless the context is done first
+func (c *SecureConn) WriteContext(ctx context.Context, m *Message) error {
 	// Serialize the message
 	messageData, err := SerializeMessage(m)
 	if err != nil {
 		return err
 	}
 
+	// Compress the message
+	if c.compression != CompressionNone {
+		messageData, err = compressFrame(c.compression, c.compressionThreshold, messageData)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Encrypt the message
 	encryptedMessageData, err := c.sc.Encrypt(messageData)
 	if err != nil {
@@ -49,7 +89,7 @@ func (c *SecureConn) Write(m *Message) error {
 	}
 
 	// Write the message frame
-	return c.conn.WriteFrame(encryptedMessageData)
+	return c.conn.writeFrame(ctx, encryptedMessageData)
 }
 
 func (c *SecureConn) Close() error {
@@ -0,0 +1,154 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultSendQueueCloseTimeout is the time Close gives the queued messages to be written
+const DefaultSendQueueCloseTimeout = 5 * time.Second
+
+var ErrSendQueueClosed = errors.New("send queue is closed")
+
+// SendQueue buffers outgoing messages and writes them in order from a single goroutine.
+// Send blocks while the queue is full, so fast producers are slowed down to the
+// speed of the connection.
+type SendQueue struct {
+	conn  AdvancedConn
+	queue chan *Message
+
+	// exited is closed when the writer goroutine stops
+	exited chan struct{}
+	// done is closed when the queue stops accepting messages
+	done chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+	err    error
+	// Senders which passed the closed check, the queue is closed once they are gone
+	senders sync.WaitGroup
+}
+
+func NewSendQueue(conn AdvancedConn, capacity int) *SendQueue {
+	q := &SendQueue{
+		conn,
+		make(chan *Message, capacity),
+		make(chan struct{}),
+		make(chan struct{}),
+		sync.RWMutex{},
+		false,
+		nil,
+		sync.WaitGroup{},
+	}
+
+	go q.run()
+
+	return q
+}
+
+// Send queues the message, it waits for free space until the context is done or the queue is closed
+func (q *SendQueue) Send(ctx context.Context, m *Message) error {
+	// The lock is only held to register the sender, so waiting senders don't hold Close
+	q.mu.RLock()
+	if q.closed {
+		q.mu.RUnlock()
+
+		return ErrSendQueueClosed
+	}
+	q.senders.Add(1)
+	q.mu.RUnlock()
+
+	defer q.senders.Done()
+
+	// Don't queue anything after a failed write
+	select {
+	case <-q.exited:
+		return q.Err()
+	default:
+	}
+
+	select {
+	case q.queue <- m:
+		return nil
+	case <-q.done:
+		return ErrSendQueueClosed
+	case <-q.exited:
+		return q.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Len returns the number of messages waiting to be written
+func (q *SendQueue) Len() int {
+	return len(q.queue)
+}
+
+// Err returns the error which stopped the queue
+func (q *SendQueue) Err() error {
+	select {
+	case <-q.exited:
+	default:
+		return nil
+	}
+
+	if q.err != nil {
+		return q.err
+	}
+
+	return ErrSendQueueClosed
+}
+
+// Close stops accepting messages and waits up to DefaultSendQueueCloseTimeout
+// until the queued ones are written
+func (q *SendQueue) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultSendQueueCloseTimeout)
+	defer cancel()
+
+	return q.CloseContext(ctx)
+}
+
+// CloseContext stops accepting messages and waits until the queued ones are written.
+// The connection itself is not closed, unless the context is done first,
+// then it's closed to unblock the writer and the context error is returned.
+func (q *SendQueue) CloseContext(ctx context.Context) error {
+	q.mu.Lock()
+	first := !q.closed
+	if first {
+		q.closed = true
+		close(q.done)
+	}
+	q.mu.Unlock()
+
+	if first {
+		// The waiting senders give up, then nobody can send to the closed queue
+		q.senders.Wait()
+		close(q.queue)
+	}
+
+	select {
+	case <-q.exited:
+		return q.err
+	case <-ctx.Done():
+	}
+
+	// A peer which doesn't read must not hold the shutdown
+	q.conn.Close()
+	<-q.exited
+
+	return ctx.Err()
+}
+
+func (q *SendQueue) run() {
+	defer close(q.exited)
+
+	for m := range q.queue {
+		if err := q.conn.Write(m); err != nil {
+			q.err = err
+
+			return
+		}
+	}
+}
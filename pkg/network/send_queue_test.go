@@ -0,0 +1,116 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSendQueue_WritesInOrder(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	queue := NewSendQueue(NewConn(c1), 4)
+	receiver := NewConn(c2)
+
+	received := make(chan string, 10)
+	go func() {
+		for i := 0; i < 10; i++ {
+			msg, err := receiver.Read()
+			if err != nil {
+				return
+			}
+			received <- string(msg.Body())
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		if err := queue.Send(context.Background(), NewMessage(nil, []byte(fmt.Sprint(i)))); err != nil {
+			t.Fatalf("failed to send: %v", err)
+		}
+	}
+
+	if err := queue.Close(); err != nil {
+		t.Fatalf("expected no error on close, got %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if body := <-received; body != fmt.Sprint(i) {
+			t.Errorf("expected message %d, got %s", i, body)
+		}
+	}
+
+	if err := queue.Send(context.Background(), NewMessage(nil, nil)); !errors.Is(err, ErrSendQueueClosed) {
+		t.Errorf("expected ErrSendQueueClosed, got %v", err)
+	}
+}
+
+func TestSendQueue_Backpressure(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	queue := NewSendQueue(NewConn(c1), 2)
+
+	// Nobody reads, so one message blocks the writer and two more fill the queue
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := queue.Send(ctx, NewMessage(nil, nil))
+		cancel()
+		if err != nil {
+			t.Fatalf("expected message %d to be queued, got %v", i, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := queue.Send(ctx, NewMessage(nil, nil)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded on a full queue, got %v", err)
+	}
+
+	// A broken connection stops the queue
+	c1.Close()
+	if err := queue.Close(); err == nil {
+		t.Error("expected the write error on close, got nil")
+	}
+}
+
+func TestSendQueue_CloseTimeout(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	queue := NewSendQueue(NewConn(c1), 1)
+
+	// Nobody reads, so the writer blocks and the next sender waits for room
+	for i := 0; i < 2; i++ {
+		if err := queue.Send(context.Background(), NewMessage(nil, nil)); err != nil {
+			t.Fatalf("expected message %d to be queued, got %v", i, err)
+		}
+	}
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- queue.Send(context.Background(), NewMessage(nil, nil))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := queue.CloseContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	if err := <-sent; !errors.Is(err, ErrSendQueueClosed) {
+		t.Errorf("expected the waiting sender to give up with ErrSendQueueClosed, got %v", err)
+	}
+
+	// The connection is closed to unblock the writer
+	if _, err := c1.Write([]byte{0}); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("expected the connection to be closed, got %v", err)
+	}
+}
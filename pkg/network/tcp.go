@@ -1,6 +1,12 @@
 package network
 
-import "net"
+import (
+	"net"
+	"time"
+)
+
+// DefaultDialTimeout is how long the transport waits for a connection to be established
+const DefaultDialTimeout = 10 * time.Second
 
 // basicListenerWrapper adapts net.Listener to BasicListener.
 type basicListenerWrapper struct {
@@ -20,7 +26,7 @@ func NewTcpTransport() Transport {
 
 // Connect implements Transport.
 func (t *tcpTransport) Connect(address string) (*Conn, error) {
-	c, err := net.Dial("tcp", address)
+	c, err := net.DialTimeout("tcp", address, DefaultDialTimeout)
 	if err != nil {
 		return nil, err
 	}
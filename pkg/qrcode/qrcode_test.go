@@ -0,0 +1,226 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" as version 1-M from the standard's worked example
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	expected := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	ec := reedSolomonRemainder(data, reedSolomonDivisor(len(expected)))
+	if !bytes.Equal(ec, expected) {
+		t.Errorf("Expected %v, got %v", expected, ec)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	if bits := formatBits(0); bits != 0b111011111000100 {
+		t.Errorf("Unexpected format bits for L with mask 0: %015b", bits)
+	}
+	if bits := formatBits(7); bits != 0b110100101110110 {
+		t.Errorf("Unexpected format bits for L with mask 7: %015b", bits)
+	}
+	if bits := versionBits(7); bits != 0b000111110010010100 {
+		t.Errorf("Unexpected version bits for version 7: %018b", bits)
+	}
+}
+
+func TestEncode_Size(t *testing.T) {
+	tests := []struct {
+		length int
+		size   int
+	}{
+		{0, 21},
+		{17, 21},
+		{18, 25},
+		{134, 41},
+		{135, 45},
+		{271, 57},
+	}
+
+	for _, test := range tests {
+		code, err := Encode(bytes.Repeat([]byte("a"), test.length))
+		if err != nil {
+			t.Fatalf("Failed to encode %d bytes: %v", test.length, err)
+		}
+
+		if code.Size() != test.size {
+			t.Errorf("Expected size %d for %d bytes, got %d", test.size, test.length, code.Size())
+		}
+	}
+
+	if _, err := Encode(bytes.Repeat([]byte("a"), 272)); !errors.Is(err, ErrDataTooLong) {
+		t.Errorf("Expected ErrDataTooLong, got %v", err)
+	}
+}
+
+// decode reads the data back from the symbol following the placement rules
+func decode(t *testing.T, c *Code) []byte {
+	t.Helper()
+
+	version := (c.size - 17) / 4
+
+	// Format bits around the top left finder
+	bits := 0
+	for i := 0; i <= 5; i++ {
+		bits |= b2i(c.modules[i][8]) << i
+	}
+	bits |= b2i(c.modules[7][8]) << 6
+	bits |= b2i(c.modules[8][8]) << 7
+	bits |= b2i(c.modules[8][7]) << 8
+	for i := 9; i < 15; i++ {
+		bits |= b2i(c.modules[8][14-i]) << i
+	}
+
+	mask := -1
+	for m := 0; m < 8; m++ {
+		if formatBits(m) == bits {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("Invalid format bits %015b", bits)
+	}
+
+	// Function patterns are the same regardless of the data
+	reference := newCode(version)
+	reference.drawFunctionPatterns(version)
+
+	unmasked := &Code{c.size, c.modules, reference.function}
+	unmasked.applyMask(mask)
+	defer unmasked.applyMask(mask)
+
+	var stream bitBuffer
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.size; vert++ {
+			y := vert
+			if upward {
+				y = c.size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				if !reference.function[y][right-j] {
+					stream = append(stream, c.modules[y][right-j])
+				}
+			}
+		}
+	}
+	codewords := stream.bytes()
+
+	// Deinterleave the data codewords
+	v := versions[version]
+	blocks := make([][]byte, len(v.blocks))
+	k := 0
+	for i := 0; i < v.blocks[len(v.blocks)-1]; i++ {
+		for b, n := range v.blocks {
+			if i < n {
+				blocks[b] = append(blocks[b], codewords[k])
+				k++
+			}
+		}
+	}
+
+	// Every block must match its error correction
+	for b := range blocks {
+		ec := make([]byte, v.ecPerBlock)
+		for i := range ec {
+			ec[i] = codewords[k+i*len(blocks)+b]
+		}
+		if !bytes.Equal(ec, reedSolomonRemainder(blocks[b], reedSolomonDivisor(v.ecPerBlock))) {
+			t.Fatalf("Error correction of block %d doesn't match", b)
+		}
+	}
+
+	var data bitBuffer
+	for _, block := range blocks {
+		for _, cw := range block {
+			data.append(int(cw), 8)
+		}
+	}
+
+	if mode := readBits(data, 0, 4); mode != 0b0100 {
+		t.Fatalf("Expected byte mode, got %04b", mode)
+	}
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	length := readBits(data, 4, countBits)
+
+	result := make([]byte, length)
+	for i := range result {
+		result[i] = byte(readBits(data, 4+countBits+i*8, 8))
+	}
+
+	return result
+}
+
+func readBits(bits bitBuffer, from int, length int) int {
+	value := 0
+	for i := from; i < from+length; i++ {
+		value = value<<1 | b2i(bits[i])
+	}
+
+	return value
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"hello",
+		"gotchat://join?addr=192.168.1.20:7665&user=0f8fad5b-d9cb-469f-a165-70867728950e",
+		strings.Repeat("0123456789", 27),
+	} {
+		code, err := Encode([]byte(data))
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+
+		if decoded := decode(t, code); string(decoded) != data {
+			t.Errorf("Expected %q, got %q", data, decoded)
+		}
+
+		// Finder corners are dark, the module next to the separator is light
+		for _, corner := range [][2]int{{0, 0}, {code.Size() - 1, 0}, {0, code.Size() - 1}} {
+			if !code.Dark(corner[0], corner[1]) {
+				t.Errorf("Expected dark finder corner at %v", corner)
+			}
+		}
+		if !code.Dark(8, code.Size()-8) {
+			t.Error("Expected the dark module to be set")
+		}
+	}
+}
+
+func TestCode_String(t *testing.T) {
+	code, err := Encode([]byte("hello"))
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(code.String(), "\n"), "\n")
+	if len(lines) != (code.Size()+4+1)/2 {
+		t.Errorf("Expected %d lines, got %d", (code.Size()+4+1)/2, len(lines))
+	}
+	for _, line := range lines {
+		if n := len([]rune(line)); n != code.Size()+4 {
+			t.Fatalf("Expected lines of %d runes, got %d", code.Size()+4, n)
+		}
+	}
+}